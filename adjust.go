@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A split or bonus issue multiplies the share count, so the EPS of the quarters reported
+// before it is not comparable with the EPS after it. Companies restate earlier periods only
+// in filings approved after the ex-date, while the fundamentals keep each quarter as first
+// reported; adjustPerShare divides those quarters' per-share figures by the share factor.
+
+// bseCorpActionsURL lists the corporate actions of every equity with an ex-date in a range
+const bseCorpActionsURL = "https://api.bseindia.com/BseIndiaAPI/api/DefaultData/w"
+
+// shareActionsLookback is how far back the corporate actions are fetched: five quarters
+// for the TTM figures, plus a year for backfilled days
+const shareActionsLookback = 2 * 365 * 24 * time.Hour
+
+// shareActionsRefresh is how often the cached corporate actions are fetched again
+const shareActionsRefresh = 24 * time.Hour
+
+// ShareAction is a corporate action that changes the share count: after it each old share
+// is Factor shares (5 for a split of ₹10 shares into ₹2 ones, 2 for a 1:1 bonus, 0.1 for a
+// consolidation of ₹1 shares into ₹10 ones)
+type ShareAction struct {
+	ScripCode string    `json:"scrip_code"`
+	ExDate    time.Time `json:"ex_date"`
+	Kind      string    `json:"kind"` // Split, Bonus or Consolidation
+	Purpose   string    `json:"purpose"`
+	Factor    float64   `json:"factor"`
+}
+
+// corpActionFieldNames lists the field names of the corporate actions endpoint
+var corpActionFieldNames = struct {
+	ScripCode, ExDate, Purpose []string
+}{
+	ScripCode: []string{"scrip_code", "SCRIP_CODE", "scrip_cd"},
+	ExDate:    []string{"exdate", "Ex_date", "EX_DATE", "ex_date"},
+	Purpose:   []string{"Purpose", "purpose", "PURPOSE"},
+}
+
+var (
+	bonusRatioRe = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*:\s*(\d+(?:\.\d+)?)`)
+	faceValueRe  = regexp.MustCompile(`(?:rs|re|inr|₹)\.?\s*(\d+(?:\.\d+)?)\s*(?:/-)?.*?\bto\s*(?:rs|re|inr|₹)\.?\s*(\d+(?:\.\d+)?)`)
+)
+
+// parseShareAction reads the kind and share factor of a corporate action from its purpose,
+// e.g. "Bonus issue 1:1" or "Stock Split From Rs.10/- to Rs.2/-"; ok is false for actions
+// that leave the share count alone (dividends, ...) or whose ratio is not given
+func parseShareAction(purpose string) (kind string, factor float64, ok bool) {
+	p := strings.ToLower(purpose)
+	switch {
+	case strings.Contains(p, "bonus"):
+		m := bonusRatioRe.FindStringSubmatch(p)
+		if m == nil {
+			return "", 0, false
+		}
+		issued, held := parseRatioPart(m[1]), parseRatioPart(m[2])
+		if !(issued > 0) || !(held > 0) {
+			return "", 0, false
+		}
+		return "Bonus", (issued + held) / held, true
+	case strings.Contains(p, "split") || strings.Contains(p, "sub-division") || strings.Contains(p, "subdivision") ||
+		strings.Contains(p, "sub division") || strings.Contains(p, "consolidation"):
+		m := faceValueRe.FindStringSubmatch(p)
+		if m == nil {
+			return "", 0, false
+		}
+		from, to := parseRatioPart(m[1]), parseRatioPart(m[2])
+		if !(from > 0) || !(to > 0) || from == to {
+			return "", 0, false
+		}
+		if from < to {
+			return "Consolidation", from / to, true
+		}
+		return "Split", from / to, true
+	}
+	return "", 0, false
+}
+
+func parseRatioPart(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return math.NaN()
+	}
+	return f
+}
+
+// FetchShareActions lists the splits, bonus issues and consolidations of every equity with
+// an ex-date between from and to
+func FetchShareActions(client *http.Client, from, to time.Time) ([]ShareAction, error) {
+	if err := WarmUpBSE(client, false); err != nil {
+		log.Printf("FetchShareActions: warm-up: %v", err)
+	}
+	q := url.Values{
+		"Fdate":        {from.Format("20060102")},
+		"TDate":        {to.Format("20060102")},
+		"Purposecode":  {""},
+		"ddlcategorys": {"E"},
+		"ddlindustrys": {""},
+		"scripcode":    {""},
+		"segment":      {"0"},
+		"strSearch":    {"S"},
+	}
+	b, err := fetchBSEJSON(client, bseCorpActionsURL+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := bseRows(b)
+	if err != nil {
+		return nil, fmt.Errorf("corporate actions: %v", err)
+	}
+	var out []ShareAction
+	for _, m := range rows {
+		a := ShareAction{
+			ScripCode: bseField(m, corpActionFieldNames.ScripCode),
+			Purpose:   bseField(m, corpActionFieldNames.Purpose),
+		}
+		ex, err := time.ParseInLocation("02 Jan 2006", normalizeBSEDate(bseField(m, corpActionFieldNames.ExDate)), istZone)
+		if err != nil || a.ScripCode == "" {
+			continue
+		}
+		var ok bool
+		if a.Kind, a.Factor, ok = parseShareAction(a.Purpose); !ok {
+			continue
+		}
+		a.ExDate = ex
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// shareActionsCache is the content of <cache dir>/share-actions.json
+type shareActionsCache struct {
+	FetchedAt time.Time     `json:"fetched_at"`
+	Actions   []ShareAction `json:"actions"`
+}
+
+// loadShareActions returns the splits, bonus issues and consolidations of the last
+// shareActionsLookback by scrip code, fetched again when client is not nil and the cached
+// list is older than shareActionsRefresh. A failed fetch is logged and the cached list
+// used; nil when there is none.
+func loadShareActions(client *http.Client) map[string][]ShareAction {
+	dir, err := cacheDir()
+	if err != nil {
+		log.Printf("loadShareActions: %v", err)
+		return nil
+	}
+	path := filepath.Join(dir, "share-actions.json")
+	var c shareActionsCache
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &c); err != nil {
+			log.Printf("loadShareActions: ignoring %s: %v", path, err)
+			c = shareActionsCache{}
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("loadShareActions: %v", err)
+	}
+	if client != nil && time.Since(c.FetchedAt) >= shareActionsRefresh {
+		now := time.Now()
+		actions, err := FetchShareActions(client, now.Add(-shareActionsLookback), now.AddDate(0, 3, 0))
+		if err != nil {
+			log.Printf("loadShareActions: %v", err)
+		} else {
+			c = shareActionsCache{FetchedAt: now, Actions: actions}
+			if b, err := json.Marshal(c); err == nil {
+				if err := os.WriteFile(path, b, 0644); err != nil {
+					log.Printf("loadShareActions: %v", err)
+				}
+			}
+		}
+	}
+	if len(c.Actions) == 0 {
+		return nil
+	}
+	byCode := map[string][]ShareAction{}
+	for _, a := range c.Actions {
+		byCode[a.ScripCode] = append(byCode[a.ScripCode], a)
+	}
+	return byCode
+}
+
+// isPerShare reports whether a Metrics name is a per-share figure: one of epsNames, or a
+// dump key naming earnings or dividend per share
+func isPerShare(name string) bool {
+	for _, n := range epsNames {
+		if name == n {
+			return true
+		}
+	}
+	u := strings.ToUpper(name)
+	return strings.HasPrefix(u, "EPS") || strings.Contains(u, "_EPS") || strings.HasPrefix(u, "DPS") || strings.Contains(u, "_DPS")
+}
+
+// declaredBy is the latest day the results of q could have been declared: 45 days after
+// the quarter, 60 after the year-end (Q4) quarter
+func declaredBy(q Quarter) time.Time {
+	if q.Q == 4 {
+		return q.End().AddDate(0, 0, 60)
+	}
+	return q.End().AddDate(0, 0, 45)
+}
+
+// adjustPerShare divides the per-share figures of each quarter of r by the share actions
+// that went ex after the quarter was declared and by asOf (the run's day), so the EPS of
+// every quarter is on today's share count, and records what it did in r.ShareAdjustments.
+// The latest quarter is declared on asOf and never adjusted.
+func adjustPerShare(r *CompanyResult, actions []ShareAction, asOf time.Time) {
+	if len(actions) == 0 {
+		return
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].ExDate.Before(actions[j].ExDate) })
+	for _, a := range actions {
+		if a.ExDate.After(asOf) {
+			continue
+		}
+		latest := "" // the latest quarter adjusted for a
+		for i, q := range r.Quarters {
+			if !q.Known() || i == 0 || !a.ExDate.After(declaredBy(q)) {
+				continue
+			}
+			adjusted := false
+			for name, vals := range r.Metrics {
+				if i < len(vals) && isPerShare(name) && !math.IsNaN(vals[i]) {
+					vals[i] /= a.Factor
+					adjusted = true
+				}
+			}
+			if adjusted && latest == "" {
+				latest = q.String()
+			}
+		}
+		if latest != "" {
+			r.ShareAdjustments = append(r.ShareAdjustments, fmt.Sprintf("%s (%s, ex %s): per-share figures of %s and earlier ÷%s",
+				a.Kind, a.Purpose, a.ExDate.Format("02 Jan 2006"), latest, strconv.FormatFloat(a.Factor, 'f', -1, 64)))
+		}
+	}
+}
+
+// attachShareAdjustments adjusts the per-share figures of every result (see
+// adjustPerShare) for the splits and bonus issues of its company, matched by scrip code
+// through the day's BSE items
+func attachShareAdjustments(results []CompanyResult, items []BSEItem, actions map[string][]ShareAction, asOf time.Time) {
+	if len(actions) == 0 {
+		return
+	}
+	codes := make(map[string]string, len(items))
+	for _, it := range items {
+		codes[it.ShortName] = it.ScripCode
+	}
+	for i := range results {
+		code := results[i].ScripCode
+		if code == "" {
+			code = codes[results[i].Company]
+		}
+		adjustPerShare(&results[i], actions[code], asOf)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bseAnnouncementsURL is the XHR behind bseindia.com's corporate announcements page
+const bseAnnouncementsURL = "https://api.bseindia.com/BseIndiaAPI/api/AnnSubCategoryGetData/w"
+
+// maxAnnouncementPages bounds the pages fetched for one query
+const maxAnnouncementPages = 40
+
+// Announcement is one corporate filing from the BSE announcements feed
+type Announcement struct {
+	ScripCode   string
+	Symbol      string // from the company's bseindia.com URL; empty when missing
+	LongName    string
+	Headline    string
+	Category    string // e.g. "Result", "Corp. Action", "Board Meeting"
+	SubCategory string // e.g. "Financial Results"
+	Time        time.Time
+	PDFURL      string // attachment, empty when the filing has none
+	XBRLURL     string // XBRL of a results filing, empty when not filed
+}
+
+// announcementPageURL is the company's announcements page on bseindia.com
+func announcementPageURL(scripCode string) string {
+	return "https://www.bseindia.com/corporates/ann.html?scrip=" + url.QueryEscape(scripCode)
+}
+
+// FetchAnnouncements lists the BSE announcements in category (e.g. "Result"; "-1" for
+// all) disseminated between from and to, following the feed's pages
+func FetchAnnouncements(client *http.Client, category string, from, to time.Time) ([]Announcement, error) {
+	var out []Announcement
+	for page := 1; page <= maxAnnouncementPages; page++ {
+		q := url.Values{
+			"pageno":      {strconv.Itoa(page)},
+			"strCat":      {category},
+			"strPrevDate": {from.Format("20060102")},
+			"strToDate":   {to.Format("20060102")},
+			"strScrip":    {""},
+			"strSearch":   {"P"},
+			"strType":     {"C"},
+			"subcategory": {"-1"},
+		}
+		anns, pages, err := fetchAnnouncementPage(client, bseAnnouncementsURL+"?"+q.Encode())
+		if err != nil {
+			return out, fmt.Errorf("announcements page %d: %v", page, err)
+		}
+		out = append(out, anns...)
+		if len(anns) == 0 || page >= pages {
+			break
+		}
+	}
+	return out, nil
+}
+
+// fetchAnnouncementPage fetches one page of the feed and returns its announcements and
+// the total page count
+func fetchAnnouncementPage(client *http.Client, u string) ([]Announcement, int, error) {
+	req, _ := http.NewRequest("GET", u, nil)
+	setBSEHeaders(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil, 0, fmt.Errorf("status=%d", resp.StatusCode)
+	}
+	var body struct {
+		Table []struct {
+			ScripCode      json.Number `json:"SCRIP_CD"`
+			Headline       string      `json:"HEADLINE"`
+			Subject        string      `json:"NEWSSUB"`
+			Category       string      `json:"CATEGORYNAME"`
+			SubCategory    string      `json:"SUBCATNAME"`
+			Disseminated   string      `json:"DissemDT"`
+			NewsDate       string      `json:"NEWS_DT"`
+			Attachment     string      `json:"ATTACHMENTNAME"`
+			XML            string      `json:"XML_NAME"`
+			LongName       string      `json:"SLONGNAME"`
+			CompanyURL     string      `json:"NSURL"`
+			PDFFlag        int         `json:"PDFFLAG"`
+			TotalPageCount int         `json:"TotalPageCnt"`
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, 0, fmt.Errorf("invalid JSON: %v", err)
+	}
+	pages := 1
+	anns := make([]Announcement, 0, len(body.Table))
+	for _, row := range body.Table {
+		pages = max(pages, row.TotalPageCount)
+		a := Announcement{
+			ScripCode:   row.ScripCode.String(),
+			Headline:    strings.TrimSpace(row.Headline),
+			Category:    strings.TrimSpace(row.Category),
+			SubCategory: strings.TrimSpace(row.SubCategory),
+			Symbol:      symbolFromStockURL(row.CompanyURL),
+			LongName:    strings.TrimSpace(row.LongName),
+		}
+		if a.Headline == "" {
+			a.Headline = strings.TrimSpace(row.Subject)
+		}
+		for _, d := range []string{row.Disseminated, row.NewsDate} {
+			if t, err := parseBSETime(d); err == nil {
+				a.Time = t
+				break
+			}
+		}
+		if name := strings.TrimSpace(row.Attachment); name != "" {
+			dir := "AttachLive"
+			if row.PDFFlag == 1 {
+				dir = "AttachHis" // older filings are moved to the archive
+			}
+			a.PDFURL = "https://www.bseindia.com/xml-data/corpfiling/" + dir + "/" + url.PathEscape(name)
+		}
+		if x := strings.TrimSpace(row.XML); x != "" {
+			a.XBRLURL = x
+			if !strings.HasPrefix(x, "http") {
+				a.XBRLURL = "https://www.bseindia.com/XBRLFILES/FourOneUploadDocument/" + url.PathEscape(x)
+			}
+		}
+		anns = append(anns, a)
+	}
+	return anns, pages, nil
+}
+
+// symbolFromStockURL returns the symbol in a bseindia.com stock page URL, e.g. RELIANCE
+// for https://www.bseindia.com/stock-share-price/reliance-industries-ltd/reliance/500325/
+func symbolFromStockURL(u string) string {
+	parts := strings.Split(strings.Trim(strings.TrimSpace(u), "/"), "/")
+	if len(parts) < 3 || !strings.Contains(u, "stock-share-price") {
+		return ""
+	}
+	return strings.ToUpper(parts[len(parts)-2])
+}
+
+// istZone is Indian Standard Time, which BSE timestamps are in
+var istZone = time.FixedZone("IST", 5*60*60+30*60)
+
+// parseBSETime parses the timestamps of the announcements feed
+func parseBSETime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05", "02 Jan 2006 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, istZone); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", s)
+}
+
+// corpActionKinds are the corporate actions detected in announcement headlines, in
+// badge order, with the words that announce them
+var corpActionKinds = []struct {
+	Kind  string
+	Words []string
+}{
+	{"Dividend", []string{"dividend"}},
+	{"Bonus", []string{"bonus"}},
+	{"Split", []string{"split", "sub-division", "subdivision", "sub division"}},
+}
+
+// detectCorpActions returns the corporate actions a headline announces
+func detectCorpActions(headline string) []string {
+	h := strings.ToLower(headline)
+	var kinds []string
+	for _, k := range corpActionKinds {
+		for _, w := range k.Words {
+			if strings.Contains(h, w) {
+				kinds = append(kinds, k.Kind)
+				break
+			}
+		}
+	}
+	return kinds
+}
+
+// attachCorpActions marks each result with the dividends, bonus issues and splits its
+// company announced in anns, matched by scrip code through the day's BSE items
+func attachCorpActions(results []CompanyResult, items []BSEItem, anns []Announcement) {
+	found := make(map[string]map[string]bool)
+	for _, a := range anns {
+		for _, kind := range detectCorpActions(a.Headline) {
+			if found[a.ScripCode] == nil {
+				found[a.ScripCode] = make(map[string]bool)
+			}
+			found[a.ScripCode][kind] = true
+		}
+	}
+	codes := make(map[string]string, len(items))
+	for _, it := range items {
+		codes[it.ShortName] = it.ScripCode
+	}
+	for i := range results {
+		kinds := found[codes[results[i].Company]]
+		results[i].CorpActions = nil
+		for _, k := range corpActionKinds {
+			if kinds[k.Kind] {
+				results[i].CorpActions = append(results[i].CorpActions, k.Kind)
+			}
+		}
+	}
+}
+
+// researchKinds are the follow-up filings linked from the report, with the words of
+// their headline or subcategory
+var researchKinds = []struct {
+	Kind  string
+	Words []string
+}{
+	{"presentation", []string{"investor presentation", "earnings presentation", "analyst presentation", "presentation"}},
+	{"call", []string{"earnings call", "conference call", "con. call", "concall", "analyst meet", "investor meet", "analysts/institutional investor meet"}},
+}
+
+// attachResearch links each result to the latest investor presentation and earnings
+// call announcement of its company in anns (a call announcement without attachment is
+// linked to the company's announcements page)
+func attachResearch(results []CompanyResult, items []BSEItem, anns []Announcement) {
+	sorted := append([]Announcement(nil), anns...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.After(sorted[j].Time) })
+	links := map[string]map[string]string{}
+	for _, a := range sorted {
+		text := strings.ToLower(a.SubCategory + " " + a.Headline)
+		for _, k := range researchKinds {
+			if links[a.ScripCode][k.Kind] != "" {
+				continue
+			}
+			for _, w := range k.Words {
+				if !strings.Contains(text, w) {
+					continue
+				}
+				u := a.PDFURL
+				if u == "" {
+					u = announcementPageURL(a.ScripCode)
+				}
+				if links[a.ScripCode] == nil {
+					links[a.ScripCode] = map[string]string{}
+				}
+				links[a.ScripCode][k.Kind] = u
+				break
+			}
+		}
+	}
+	codes := make(map[string]string, len(items))
+	for _, it := range items {
+		codes[it.ShortName] = it.ScripCode
+	}
+	for i := range results {
+		l := links[codes[results[i].Company]]
+		results[i].PresentationURL, results[i].CallURL = l["presentation"], l["call"]
+	}
+}
+
+// isResultsFiling reports whether a is a financial-results filing
+func isResultsFiling(a Announcement) bool {
+	return strings.Contains(strings.ToLower(a.SubCategory), "financial result")
+}
+
+// declaredTimes returns when each scrip's results were declared: the time of its
+// earliest financial-results filing in anns
+func declaredTimes(anns []Announcement) map[string]time.Time {
+	out := map[string]time.Time{}
+	for _, a := range anns {
+		if !isResultsFiling(a) || a.Time.IsZero() {
+			continue
+		}
+		if t, ok := out[a.ScripCode]; !ok || a.Time.Before(t) {
+			out[a.ScripCode] = a.Time
+		}
+	}
+	return out
+}
+
+// attachFilings links each result to its results announcement: the company's BSE
+// announcements page and the PDF of the latest financial-results filing, and sets when
+// the results were declared. Results are matched to announcements by scrip code through
+// the day's BSE items.
+func attachFilings(results []CompanyResult, items []BSEItem, anns []Announcement) {
+	codes := make(map[string]string, len(items))
+	for _, it := range items {
+		if it.ScripCode != "" {
+			codes[it.ShortName] = it.ScripCode
+		}
+	}
+	// latest first, so the first match per scrip is the newest filing
+	sorted := append([]Announcement(nil), anns...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.After(sorted[j].Time) })
+	pdfs := make(map[string]string)
+	for _, pass := range []func(Announcement) bool{
+		isResultsFiling,
+		func(Announcement) bool { return true },
+	} {
+		for _, a := range sorted {
+			if a.PDFURL != "" && pdfs[a.ScripCode] == "" && pass(a) {
+				pdfs[a.ScripCode] = a.PDFURL
+			}
+		}
+	}
+	declared := declaredTimes(anns)
+	for i := range results {
+		code, ok := codes[results[i].Company]
+		if !ok {
+			continue
+		}
+		results[i].AnnouncementURL = announcementPageURL(code)
+		results[i].PDFURL = pdfs[code]
+		results[i].DeclaredAt = declared[code]
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Data-entry slips at the provider (a figure in lakh instead of crore, a digit too many, a
+// quarter's revenue typed into net profit) look like spectacular results. detectAnomalies
+// holds the latest quarter against the company's own past quarters and flags it for
+// checking against the filing before anyone acts on it.
+
+// anomalyQuarters is how many quarters of the fundamentals, the latest four included, the
+// anomaly checks look at
+const anomalyQuarters = 16
+
+// a latest figure is anomalous when it lies more than anomalySigmas standard deviations from
+// the company's past figures, measured over at least minAnomalyHistory past quarters
+const (
+	anomalySigmas     = 5
+	minAnomalyHistory = 6
+)
+
+// meanStd returns the mean and sample standard deviation of vals
+func meanStd(vals []float64) (mean, std float64) {
+	for _, v := range vals {
+		mean += v
+	}
+	mean /= float64(len(vals))
+	for _, v := range vals {
+		std += (v - mean) * (v - mean)
+	}
+	if len(vals) > 1 {
+		std = math.Sqrt(std / float64(len(vals)-1))
+	}
+	return mean, std
+}
+
+// detectAnomalies checks the latest quarter of a series (newest first, rev and np aligned
+// with quarters) and describes what looks wrong:
+//   - a quarter-on-quarter revenue change more than anomalySigmas σ from the company's past
+//     changes (and over 25%), or a revenue off by a factor of 50 or more (a units slip)
+//   - net profit larger than revenue, or an NP margin more than anomalySigmas σ (and over 15
+//     points) from its past margins
+func detectAnomalies(quarters []Quarter, rev, np []float64) []string {
+	if len(quarters) < 2 || len(rev) < 2 || len(np) < 1 {
+		return nil
+	}
+	var out []string
+	q := quarters[0]
+	rev0, np0 := rev[0], np[0]
+
+	// changes[i] is the revenue change from quarter i+1 to quarter i, between adjacent quarters
+	var changes []float64
+	for i := 1; i+1 < len(rev) && i+1 < len(quarters); i++ {
+		if consecutive(quarters[i:], 2) && rev[i+1] > 0 && !math.IsNaN(rev[i]) {
+			changes = append(changes, (rev[i]-rev[i+1])/rev[i+1])
+		}
+	}
+	if rev[1] > 0 && !math.IsNaN(rev0) && consecutive(quarters, 2) {
+		c := (rev0 - rev[1]) / rev[1]
+		ratio := rev0 / rev[1]
+		switch {
+		case ratio >= 50 || (ratio > 0 && ratio <= 1.0/50):
+			out = append(out, fmt.Sprintf("revenue %s in %s is %s the %s of %s: a units slip?", formatFloat(rev0), q, factorWord(ratio), formatFloat(rev[1]), quarters[1]))
+		case len(changes) >= minAnomalyHistory:
+			mean, std := meanStd(changes)
+			std = math.Max(std, 0.01)
+			if sigmas := math.Abs(c-mean) / std; sigmas > anomalySigmas && math.Abs(c) > 0.25 {
+				out = append(out, fmt.Sprintf("revenue %+.0f%% QoQ in %s, %.0fσ from its usual change (%+.0f%% ± %.0f%%)", c*100, q, sigmas, mean*100, std*100))
+			}
+		}
+	}
+
+	if rev0 > 0 && !math.IsNaN(np0) {
+		if math.Abs(np0) > rev0 {
+			out = append(out, fmt.Sprintf("net profit %s larger than revenue %s in %s", formatFloat(np0), formatFloat(rev0), q))
+		} else {
+			var margins []float64
+			for i := 1; i < len(rev) && i < len(np); i++ {
+				if rev[i] > 0 && !math.IsNaN(np[i]) {
+					margins = append(margins, np[i]/rev[i])
+				}
+			}
+			if len(margins) >= minAnomalyHistory {
+				m := np0 / rev0
+				mean, std := meanStd(margins)
+				std = math.Max(std, 0.01)
+				if sigmas := math.Abs(m-mean) / std; sigmas > anomalySigmas && math.Abs(m-mean) > 0.15 {
+					out = append(out, fmt.Sprintf("NP margin %.0f%% in %s, %.0fσ from its usual %.0f%% ± %.0f%%", m*100, q, sigmas, mean*100, std*100))
+				}
+			}
+		}
+	}
+	return out
+}
+
+// factorWord describes ratio as "100× " or "1/100 of"
+func factorWord(ratio float64) string {
+	if ratio >= 1 {
+		return fmt.Sprintf("%.0f×", ratio)
+	}
+	return fmt.Sprintf("1/%.0f of", 1/ratio)
+}
+
+// docAnomalies runs detectAnomalies over the reported quarters of cr and the older quarters
+// of doc
+func docAnomalies(cr CompanyResult, doc fundamentalsDoc, reg MetricRegistry) []string {
+	n := len(doc.Quarters)
+	quarters := append([]Quarter(nil), cr.Quarters[:n]...)
+	rev := append([]float64(nil), cr.RevenueNums[:n]...)
+	np := append([]float64(nil), cr.NetProfitNums[:n]...)
+	revKeys, npKeys := reg.Keys("revenue"), reg.Keys("net_profit")
+	for i, label := range doc.PastQuarters {
+		quarters = append(quarters, ParseQuarter(label))
+		r, p := math.NaN(), math.NaN()
+		if e := doc.PastEntries[i]; e != nil {
+			r = quarterValueToFloat64(valueFromMap(e, revKeys...))
+			p = quarterValueToFloat64(valueFromMap(e, npKeys...))
+		}
+		rev, np = append(rev, r), append(np, p)
+	}
+	return detectAnomalies(quarters, rev, np)
+}
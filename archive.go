@@ -0,0 +1,160 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultArchiveRetention is how many days of raw responses the archive keeps
+const defaultArchiveRetention = 90
+
+// ArchiveConfig keeps a gzipped copy of every trendlyne page and fundamentals response,
+// under <dir>/<date>/<company>/, so later parser fixes can be applied without refetching
+// (see reprocess)
+type ArchiveConfig struct {
+	Enabled       bool   `json:"enabled"`
+	Dir           string `json:"dir"`            // default <cache dir>/archive
+	RetentionDays int    `json:"retention_days"` // default 90; older days are pruned after each run
+}
+
+// archiveDir returns the archive root
+func (c ArchiveConfig) archiveDir() (string, error) {
+	if c.Dir != "" {
+		return c.Dir, nil
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "archive"), nil
+}
+
+// gzipFile is a gzip stream into a file; Close finishes both
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g gzipFile) Close() error {
+	err := g.Writer.Close()
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// archiveWriter creates <archive>/<date>/<company>/<name>.gz for a response archived as
+// it streams in. It returns nil when archiving is off or the file can't be created (logged).
+func archiveWriter(c ArchiveConfig, date, company, name string) io.WriteCloser {
+	if !c.Enabled {
+		return nil
+	}
+	root, err := c.archiveDir()
+	if err != nil {
+		log.Printf("archiveWriter: %v", err)
+		return nil
+	}
+	dir := filepath.Join(root, date, safeFileName(company))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("archiveWriter: %v", err)
+		return nil
+	}
+	f, err := os.Create(filepath.Join(dir, name+".gz"))
+	if err != nil {
+		log.Printf("archiveWriter: %v", err)
+		return nil
+	}
+	return gzipFile{gzip.NewWriter(f), f}
+}
+
+// openArchived opens <archive>/<date>/<company>/<name>.gz for reading
+func openArchived(c ArchiveConfig, date, company, name string) (io.ReadCloser, error) {
+	root, err := c.archiveDir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(root, date, safeFileName(company), name+".gz"))
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", f.Name(), err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+// rawWriters is where a raw response is copied as it streams in: the -dump-raw file and
+// the archive, either of which may be off
+type rawWriters []io.WriteCloser
+
+// rawWriter opens the dump and archive copies of a company's response; date is the run's
+// day (2006-01-02)
+func rawWriter(cfg Config, date, company, name string) rawWriters {
+	var ws rawWriters
+	if f := dumpRawFile(cfg.DumpRaw, company, name); f != nil {
+		ws = append(ws, f)
+	}
+	if w := archiveWriter(cfg.Archive, date, company, name); w != nil {
+		ws = append(ws, w)
+	}
+	return ws
+}
+
+// writer returns the copies as one writer, nil when there are none
+func (ws rawWriters) writer() io.Writer {
+	if len(ws) == 0 {
+		return nil
+	}
+	out := make([]io.Writer, len(ws))
+	for i, w := range ws {
+		out[i] = w
+	}
+	return io.MultiWriter(out...)
+}
+
+// Close closes every copy, logging failures
+func (ws rawWriters) Close() {
+	for _, w := range ws {
+		if err := w.Close(); err != nil {
+			log.Printf("rawWriters: %v", err)
+		}
+	}
+}
+
+// pruneArchive removes the archived days older than retention days before now and
+// returns how many it removed
+func pruneArchive(c ArchiveConfig, retention int, now time.Time) (int, error) {
+	root, err := c.archiveDir()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	cutoff := now.AddDate(0, 0, -retention).Format("2006-01-02")
+	removed := 0
+	for _, e := range entries {
+		if _, err := time.Parse("2006-01-02", e.Name()); err != nil || !e.IsDir() || e.Name() >= cutoff {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, e.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// the Arrow format constants used here (Schema.fbs, Message.fbs)
+const (
+	arrowV5 = 4 // MetadataVersion
+
+	arrowSchema      = 1 // MessageHeader
+	arrowRecordBatch = 3
+
+	arrowFloatingPoint = 3 // Type
+	arrowUtf8          = 5
+	arrowDate          = 8
+
+	arrowDouble = 2 // Precision
+	arrowDay    = 0 // DateUnit
+)
+
+// arrowMagic starts and ends an Arrow IPC file (Feather v2)
+const arrowMagic = "ARROW1"
+
+// writeArrow writes rows as an Arrow IPC file (Feather v2) of one record batch. Values
+// follow cols as for writeParquet: utf8 strings, date32 days and float64 columns.
+func writeArrow(w io.Writer, cols []dataColumn, rows [][]interface{}) error {
+	if _, err := io.WriteString(w, arrowMagic+"\x00\x00"); err != nil {
+		return err
+	}
+	offset := int64(8)
+
+	fb := &fbBuilder{}
+	fb.finish(arrowMessage(fb, arrowSchema, arrowSchemaTable(fb, cols), 0))
+	n, err := writeArrowMessage(w, fb.b, nil)
+	if err != nil {
+		return err
+	}
+	offset += n
+
+	type block struct {
+		offset, body int64
+		meta         int32
+	}
+	var blocks []block
+	if len(rows) > 0 {
+		body, nodes, buffers, err := arrowBody(cols, rows)
+		if err != nil {
+			return err
+		}
+		fb := &fbBuilder{}
+		bufVec := fb.structVector(16, len(buffers), func(i int) []byte { return buffers[i] })
+		nodeVec := fb.structVector(16, len(nodes), func(i int) []byte { return nodes[i] })
+		fb.startTable(3)
+		fb.addInt64(0, int64(len(rows)))
+		fb.addOffset(1, nodeVec)
+		fb.addOffset(2, bufVec)
+		batch := fb.endTable()
+		fb.finish(arrowMessage(fb, arrowRecordBatch, batch, int64(len(body))))
+		n, err := writeArrowMessage(w, fb.b, body)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, block{offset, int64(len(body)), int32(n - int64(len(body)))})
+		offset += n
+	}
+	// end-of-stream marker
+	if _, err := w.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	fb = &fbBuilder{}
+	batches := fb.structVector(24, len(blocks), func(i int) []byte {
+		b := binary.LittleEndian.AppendUint64(nil, uint64(blocks[i].offset))
+		b = binary.LittleEndian.AppendUint32(b, uint32(blocks[i].meta))
+		b = append(b, 0, 0, 0, 0)
+		return binary.LittleEndian.AppendUint64(b, uint64(blocks[i].body))
+	})
+	dicts := fb.structVector(24, 0, nil)
+	schema := arrowSchemaTable(fb, cols)
+	fb.startTable(4)
+	fb.addInt16(0, arrowV5)
+	fb.addOffset(1, schema)
+	fb.addOffset(2, dicts)
+	fb.addOffset(3, batches)
+	fb.finish(fb.endTable())
+	if _, err := w.Write(fb.b); err != nil {
+		return err
+	}
+	tail := binary.LittleEndian.AppendUint32(nil, uint32(len(fb.b)))
+	_, err = w.Write(append(tail, arrowMagic...))
+	return err
+}
+
+// arrowMessage adds a Message table wrapping header
+func arrowMessage(fb *fbBuilder, headerType byte, header int, bodyLength int64) int {
+	fb.startTable(4)
+	fb.addInt64(3, bodyLength)
+	fb.addOffset(2, header)
+	fb.addInt16(0, arrowV5)
+	fb.addUint8(1, headerType)
+	return fb.endTable()
+}
+
+// arrowSchemaTable adds the Schema table describing cols
+func arrowSchemaTable(fb *fbBuilder, cols []dataColumn) int {
+	fields := make([]int, len(cols))
+	for i, col := range cols {
+		name := fb.createString(col.name)
+		var typeType byte
+		fb.startTable(1)
+		switch col.typ {
+		case colString:
+			typeType = arrowUtf8
+		case colDate:
+			typeType = arrowDate
+			fb.addInt16(0, arrowDay)
+		case colDouble:
+			typeType = arrowFloatingPoint
+			fb.addInt16(0, arrowDouble)
+		}
+		typ := fb.endTable()
+		children := fb.offsetVector(nil)
+		fb.startTable(7)
+		fb.addOffset(0, name)
+		fb.addOffset(3, typ)
+		fb.addOffset(5, children)
+		fb.addBool(1, col.nullable)
+		fb.addUint8(2, typeType)
+		fields[i] = fb.endTable()
+	}
+	vec := fb.offsetVector(fields)
+	fb.startTable(4)
+	fb.addOffset(1, vec)
+	return fb.endTable()
+}
+
+// writeArrowMessage writes an encapsulated message: the continuation marker, the metadata
+// length, the metadata padded to 8 bytes and the body. It returns the bytes written.
+func writeArrowMessage(w io.Writer, meta, body []byte) (int64, error) {
+	padded := len(meta) + (8-len(meta)%8)%8
+	b := binary.LittleEndian.AppendUint32([]byte{0xFF, 0xFF, 0xFF, 0xFF}, uint32(padded))
+	b = append(b, meta...)
+	b = append(b, make([]byte, padded-len(meta))...)
+	if _, err := w.Write(append(b, body...)); err != nil {
+		return 0, err
+	}
+	return int64(len(b) + len(body)), nil
+}
+
+// arrowBody lays out the columns of rows as record batch buffers: per column a validity
+// bitmap (empty without nulls), then the offsets and data of utf8 or the values of
+// date32 and float64, each padded to 8 bytes. It returns the body with the FieldNode and
+// Buffer structs describing it.
+func arrowBody(cols []dataColumn, rows [][]interface{}) (body []byte, nodes, buffers [][]byte, err error) {
+	add := func(buf []byte) {
+		b := binary.LittleEndian.AppendUint64(nil, uint64(len(body)))
+		buffers = append(buffers, binary.LittleEndian.AppendUint64(b, uint64(len(buf))))
+		body = append(body, buf...)
+		body = append(body, make([]byte, (8-len(buf)%8)%8)...)
+	}
+	for i, col := range cols {
+		validity := make([]byte, (len(rows)+7)/8)
+		nulls := 0
+		var offsets, data []byte
+		offsets = binary.LittleEndian.AppendUint32(offsets, 0)
+		for n, row := range rows {
+			v := row[i]
+			if v == nil {
+				if !col.nullable {
+					return nil, nil, nil, fmt.Errorf("arrow: row %d: %s is empty", n+1, col.name)
+				}
+				nulls++
+			} else {
+				validity[n/8] |= 1 << (n % 8)
+			}
+			switch col.typ {
+			case colString:
+				if v != nil {
+					data = append(data, fmt.Sprint(v)...)
+				}
+				offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+			case colDate:
+				var days int32
+				if v != nil {
+					t, err := time.Parse("2006-01-02", fmt.Sprint(v))
+					if err != nil {
+						return nil, nil, nil, fmt.Errorf("arrow: row %d: %s: %v", n+1, col.name, err)
+					}
+					days = int32(t.Unix() / 86400)
+				}
+				data = binary.LittleEndian.AppendUint32(data, uint32(days))
+			case colDouble:
+				var f float64
+				if v != nil {
+					var ok bool
+					if f, ok = v.(float64); !ok {
+						return nil, nil, nil, fmt.Errorf("arrow: row %d: %s is not a number", n+1, col.name)
+					}
+				}
+				data = binary.LittleEndian.AppendUint64(data, math.Float64bits(f))
+			}
+		}
+		node := binary.LittleEndian.AppendUint64(nil, uint64(len(rows)))
+		nodes = append(nodes, binary.LittleEndian.AppendUint64(node, uint64(nulls)))
+		if nulls == 0 {
+			validity = nil
+		}
+		add(validity)
+		if col.typ == colString {
+			add(offsets)
+		}
+		add(data)
+	}
+	return body, nodes, buffers, nil
+}
+
+// fbBuilder builds a FlatBuffer back to front, the way the flatc builders do: children
+// are added before the tables that point at them, and positions are counted from the end
+// of the buffer until finish.
+type fbBuilder struct {
+	b        []byte
+	minAlign int
+	fields   []int // positions of the current table's fields, 0 when absent
+	start    int   // position where the current table began
+}
+
+// prepend puts p in front of the buffer
+func (f *fbBuilder) prepend(p []byte) {
+	f.b = append(p, f.b...)
+}
+
+// prep pads so that after writing extra more bytes, the buffer is aligned to size
+func (f *fbBuilder) prep(size, extra int) {
+	if size > f.minAlign {
+		f.minAlign = size
+	}
+	if pad := (size - (len(f.b)+extra)%size) % size; pad > 0 {
+		f.prepend(make([]byte, pad))
+	}
+}
+
+// uoffset prepends an offset to the object at position off
+func (f *fbBuilder) uoffset(off int) {
+	f.prep(4, 0)
+	f.prepend(binary.LittleEndian.AppendUint32(nil, uint32(len(f.b)+4-off)))
+}
+
+func (f *fbBuilder) createString(s string) int {
+	f.prep(4, len(s)+1)
+	f.prepend(append([]byte(s), 0))
+	f.prepend(binary.LittleEndian.AppendUint32(nil, uint32(len(s))))
+	return len(f.b)
+}
+
+// offsetVector adds a vector of offsets to the objects at positions offs
+func (f *fbBuilder) offsetVector(offs []int) int {
+	f.prep(4, 4*len(offs))
+	for i := len(offs) - 1; i >= 0; i-- {
+		f.uoffset(offs[i])
+	}
+	f.prepend(binary.LittleEndian.AppendUint32(nil, uint32(len(offs))))
+	return len(f.b)
+}
+
+// structVector adds a vector of n structs of size bytes (8-byte aligned), elem(i) being
+// the encoding of the i-th
+func (f *fbBuilder) structVector(size, n int, elem func(i int) []byte) int {
+	f.prep(4, size*n)
+	f.prep(8, size*n)
+	for i := n - 1; i >= 0; i-- {
+		f.prepend(elem(i))
+	}
+	f.prepend(binary.LittleEndian.AppendUint32(nil, uint32(n)))
+	return len(f.b)
+}
+
+// startTable begins a table of n fields; endTable writes its vtable and returns it
+func (f *fbBuilder) startTable(n int) {
+	f.fields = make([]int, n)
+	f.start = len(f.b)
+}
+
+func (f *fbBuilder) scalar(slot int, p []byte) {
+	f.prep(len(p), 0)
+	f.prepend(p)
+	f.fields[slot] = len(f.b)
+}
+
+func (f *fbBuilder) addBool(slot int, v bool) {
+	if v {
+		f.scalar(slot, []byte{1})
+	} else {
+		f.scalar(slot, []byte{0})
+	}
+}
+
+func (f *fbBuilder) addUint8(slot int, v byte) {
+	f.scalar(slot, []byte{v})
+}
+
+func (f *fbBuilder) addInt16(slot int, v int16) {
+	f.scalar(slot, binary.LittleEndian.AppendUint16(nil, uint16(v)))
+}
+
+func (f *fbBuilder) addInt64(slot int, v int64) {
+	f.scalar(slot, binary.LittleEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (f *fbBuilder) addOffset(slot int, off int) {
+	f.uoffset(off)
+	f.fields[slot] = len(f.b)
+}
+
+func (f *fbBuilder) endTable() int {
+	f.prep(4, 0)
+	f.prepend(make([]byte, 4)) // soffset to the vtable, patched below
+	table := len(f.b)
+	vt := binary.LittleEndian.AppendUint16(nil, uint16(4+2*len(f.fields)))
+	vt = binary.LittleEndian.AppendUint16(vt, uint16(table-f.start))
+	for _, pos := range f.fields {
+		if pos == 0 {
+			vt = binary.LittleEndian.AppendUint16(vt, 0)
+		} else {
+			vt = binary.LittleEndian.AppendUint16(vt, uint16(table-pos))
+		}
+	}
+	f.prepend(vt)
+	binary.LittleEndian.PutUint32(f.b[len(f.b)-table:], uint32(len(f.b)-table))
+	return table
+}
+
+// finish prepends the offset to the root table; f.b is then the finished buffer
+func (f *fbBuilder) finish(root int) {
+	f.prep(f.minAlign, 4)
+	f.uoffset(root)
+}
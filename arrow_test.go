@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fbTable reads a FlatBuffer table at pos of b, the reading half of fbBuilder
+type fbTable struct {
+	b   []byte
+	pos int
+}
+
+// fbRoot is the root table of the FlatBuffer b
+func fbRoot(b []byte) fbTable {
+	return fbTable{b, int(binary.LittleEndian.Uint32(b))}
+}
+
+// field is the position of field slot, 0 when absent
+func (t fbTable) field(slot int) int {
+	vt := t.pos - int(int32(binary.LittleEndian.Uint32(t.b[t.pos:])))
+	if 4+2*slot >= int(binary.LittleEndian.Uint16(t.b[vt:])) {
+		return 0
+	}
+	if off := int(binary.LittleEndian.Uint16(t.b[vt+4+2*slot:])); off != 0 {
+		return t.pos + off
+	}
+	return 0
+}
+
+func (t fbTable) uint8(slot int) byte {
+	if p := t.field(slot); p != 0 {
+		return t.b[p]
+	}
+	return 0
+}
+
+func (t fbTable) int16(slot int) int16 {
+	if p := t.field(slot); p != 0 {
+		return int16(binary.LittleEndian.Uint16(t.b[p:]))
+	}
+	return 0
+}
+
+func (t fbTable) int64(slot int) int64 {
+	if p := t.field(slot); p != 0 {
+		return int64(binary.LittleEndian.Uint64(t.b[p:]))
+	}
+	return 0
+}
+
+// deref follows the offset in field slot
+func (t fbTable) deref(slot int) int {
+	p := t.field(slot)
+	if p == 0 {
+		return 0
+	}
+	return p + int(binary.LittleEndian.Uint32(t.b[p:]))
+}
+
+func (t fbTable) table(slot int) fbTable {
+	return fbTable{t.b, t.deref(slot)}
+}
+
+func (t fbTable) string(slot int) string {
+	p := t.deref(slot)
+	if p == 0 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint32(t.b[p:]))
+	return string(t.b[p+4 : p+4+n])
+}
+
+// vector returns the length of the vector in field slot and the position of its elements
+func (t fbTable) vector(slot int) (int, int) {
+	p := t.deref(slot)
+	if p == 0 {
+		return 0, 0
+	}
+	return int(binary.LittleEndian.Uint32(t.b[p:])), p + 4
+}
+
+// tables returns the tables of a vector of offsets
+func (t fbTable) tables(slot int) []fbTable {
+	n, p := t.vector(slot)
+	out := make([]fbTable, n)
+	for i := range out {
+		e := p + 4*i
+		out[i] = fbTable{t.b, e + int(binary.LittleEndian.Uint32(t.b[e:]))}
+	}
+	return out
+}
+
+// arrowField is a decoded Field of a Schema
+type arrowField struct {
+	name      string
+	nullable  bool
+	typeType  byte
+	typeParam int16 // precision of a FloatingPoint, unit of a Date
+	children  int
+}
+
+func arrowFields(schema fbTable) []arrowField {
+	var out []arrowField
+	for _, f := range schema.tables(1) {
+		n, _ := f.vector(5)
+		out = append(out, arrowField{f.string(0), f.uint8(1) == 1, f.uint8(2), f.table(3).int16(0), n})
+	}
+	return out
+}
+
+// arrowFile is an IPC file written by writeArrow, decoded
+type arrowFile struct {
+	schema, footerSchema []arrowField
+	batches, bodies      []int64 // offsets and body lengths of the record batch messages
+	rows                 [][]interface{}
+}
+
+// readArrowMessage checks the framing of the encapsulated message at off and returns its
+// Message table, its body and the offset after it
+func readArrowMessage(b []byte, off int) (fbTable, []byte, int, error) {
+	if off%8 != 0 {
+		return fbTable{}, nil, 0, fmt.Errorf("message at %d is not 8-byte aligned", off)
+	}
+	if binary.LittleEndian.Uint32(b[off:]) != 0xFFFFFFFF {
+		return fbTable{}, nil, 0, fmt.Errorf("message at %d: no continuation marker", off)
+	}
+	mlen := int(binary.LittleEndian.Uint32(b[off+4:]))
+	if mlen%8 != 0 {
+		return fbTable{}, nil, 0, fmt.Errorf("message at %d: metadata of %d bytes is not padded to 8", off, mlen)
+	}
+	meta := b[off+8 : off+8+mlen]
+	msg := fbRoot(meta)
+	if v := msg.int16(0); v != arrowV5 {
+		return fbTable{}, nil, 0, fmt.Errorf("message at %d: version %d", off, v)
+	}
+	body := int(msg.int64(3))
+	if body%8 != 0 {
+		return fbTable{}, nil, 0, fmt.Errorf("message at %d: body of %d bytes is not padded to 8", off, body)
+	}
+	end := off + 8 + mlen + body
+	return msg, b[off+8+mlen : end], end, nil
+}
+
+// readArrow checks the framing of an Arrow IPC file and decodes its schema, footer and
+// record batch back into rows of string, float64 and nil; dates come back as ISO strings
+func readArrow(b []byte) (*arrowFile, error) {
+	if len(b) < 18 || string(b[:8]) != arrowMagic+"\x00\x00" || string(b[len(b)-6:]) != arrowMagic {
+		return nil, fmt.Errorf("no ARROW1 magic at both ends")
+	}
+	f := &arrowFile{}
+	msg, _, off, err := readArrowMessage(b, 8)
+	if err != nil {
+		return nil, err
+	}
+	if msg.uint8(1) != arrowSchema {
+		return nil, fmt.Errorf("first message is of type %d, want a schema", msg.uint8(1))
+	}
+	f.schema = arrowFields(msg.table(2))
+
+	for binary.LittleEndian.Uint32(b[off+4:]) != 0 {
+		start := off
+		msg, body, end, err := readArrowMessage(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = end
+		if msg.uint8(1) != arrowRecordBatch {
+			return nil, fmt.Errorf("message at %d is of type %d, want a record batch", start, msg.uint8(1))
+		}
+		batch := msg.table(2)
+		rows := int(batch.int64(0))
+		nn, nodes := batch.vector(1)
+		nb, bufs := batch.vector(2)
+		if nn != len(f.schema) {
+			return nil, fmt.Errorf("%d field nodes for %d fields", nn, len(f.schema))
+		}
+		buffer := func(i int) []byte {
+			p := bufs + 16*i
+			o, l := binary.LittleEndian.Uint64(batch.b[p:]), binary.LittleEndian.Uint64(batch.b[p+8:])
+			if o%8 != 0 {
+				err = fmt.Errorf("buffer %d at %d is not 8-byte aligned", i, o)
+			}
+			return body[o : o+l]
+		}
+		bi := 0
+		out := make([][]interface{}, rows)
+		for i := range out {
+			out[i] = make([]interface{}, nn)
+		}
+		for c, field := range f.schema {
+			length := binary.LittleEndian.Uint64(batch.b[nodes+16*c:])
+			nulls := binary.LittleEndian.Uint64(batch.b[nodes+16*c+8:])
+			if int(length) != rows {
+				return nil, fmt.Errorf("%s: node of %d rows in a batch of %d", field.name, length, rows)
+			}
+			validity := buffer(bi)
+			bi++
+			if (nulls == 0) != (len(validity) == 0) {
+				return nil, fmt.Errorf("%s: %d nulls with a validity bitmap of %d bytes", field.name, nulls, len(validity))
+			}
+			var offsets []byte
+			if field.typeType == arrowUtf8 {
+				offsets = buffer(bi)
+				bi++
+			}
+			data := buffer(bi)
+			bi++
+			for r := 0; r < rows; r++ {
+				if len(validity) > 0 && validity[r/8]&(1<<(r%8)) == 0 {
+					continue
+				}
+				switch field.typeType {
+				case arrowUtf8:
+					from, to := binary.LittleEndian.Uint32(offsets[4*r:]), binary.LittleEndian.Uint32(offsets[4*r+4:])
+					out[r][c] = string(data[from:to])
+				case arrowDate:
+					days := int32(binary.LittleEndian.Uint32(data[4*r:]))
+					out[r][c] = time.Unix(int64(days)*86400, 0).UTC().Format("2006-01-02")
+				case arrowFloatingPoint:
+					out[r][c] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*r:]))
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bi != nb {
+			return nil, fmt.Errorf("%d buffers, %d used", nb, bi)
+		}
+		f.batches = append(f.batches, int64(start))
+		f.bodies = append(f.bodies, int64(len(body)))
+		f.rows = append(f.rows, out...)
+	}
+	if binary.LittleEndian.Uint32(b[off:]) != 0xFFFFFFFF {
+		return nil, fmt.Errorf("no end-of-stream marker at %d", off)
+	}
+	off += 8
+
+	flen := int(binary.LittleEndian.Uint32(b[len(b)-10:]))
+	if off+flen != len(b)-10 {
+		return nil, fmt.Errorf("footer of %d bytes at %d, file ends at %d", flen, off, len(b)-10)
+	}
+	footer := fbRoot(b[off : off+flen])
+	if v := footer.int16(0); v != arrowV5 {
+		return nil, fmt.Errorf("footer version %d", v)
+	}
+	f.footerSchema = arrowFields(footer.table(1))
+	n, blocks := footer.vector(3)
+	for i := 0; i < n; i++ {
+		p := blocks + 24*i
+		o := int64(binary.LittleEndian.Uint64(footer.b[p:]))
+		meta := int64(int32(binary.LittleEndian.Uint32(footer.b[p+8:])))
+		body := int64(binary.LittleEndian.Uint64(footer.b[p+16:]))
+		if i >= len(f.batches) || o != f.batches[i] || int64(binary.LittleEndian.Uint32(b[o+4:]))+8 != meta || body != f.bodies[i] {
+			return nil, fmt.Errorf("footer block %d (%d, %d, %d) doesn't match the batches at %v", i, o, meta, body, f.batches)
+		}
+	}
+	if n != len(f.batches) {
+		return nil, fmt.Errorf("footer lists %d record batches, the file has %d", n, len(f.batches))
+	}
+	return f, nil
+}
+
+func TestWriteArrow(t *testing.T) {
+	var rows [][]interface{}
+	for _, run := range loadFixture(t) {
+		for _, row := range BuildQuarterRows(run.Date, run.Results) {
+			rows = append(rows, row.Values())
+		}
+	}
+	rows = append(rows, []interface{}{"2024-07-12", "NEWCO", "Nouvelle Société ₹", "", "Jun 2024", nil, nil, -0.5})
+
+	var buf bytes.Buffer
+	if err := writeArrow(&buf, quarterColumns, rows); err != nil {
+		t.Fatal(err)
+	}
+	f, err := readArrow(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []arrowField
+	for _, col := range quarterColumns {
+		switch col.typ {
+		case colString:
+			want = append(want, arrowField{col.name, col.nullable, arrowUtf8, 0, 0})
+		case colDate:
+			want = append(want, arrowField{col.name, col.nullable, arrowDate, arrowDay, 0})
+		case colDouble:
+			want = append(want, arrowField{col.name, col.nullable, arrowFloatingPoint, arrowDouble, 0})
+		}
+	}
+	if !reflect.DeepEqual(f.schema, want) {
+		t.Errorf("schema = %+v, want %+v", f.schema, want)
+	}
+	if !reflect.DeepEqual(f.footerSchema, want) {
+		t.Errorf("footer schema = %+v, want %+v", f.footerSchema, want)
+	}
+	if len(f.batches) != 1 {
+		t.Errorf("%d record batches, want 1", len(f.batches))
+	}
+	if len(f.rows) != len(rows) {
+		t.Fatalf("%d rows, want %d", len(f.rows), len(rows))
+	}
+	for i := range rows {
+		if !reflect.DeepEqual(f.rows[i], rows[i]) {
+			t.Errorf("row %d = %v, want %v", i, f.rows[i], rows[i])
+		}
+	}
+
+	// no rows: the schema and an empty footer
+	buf.Reset()
+	if err := writeArrow(&buf, quarterColumns, nil); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := readArrow(buf.Bytes()); err != nil || len(f.batches) != 0 || len(f.schema) != len(quarterColumns) {
+		t.Errorf("empty file: %v, %+v", err, f)
+	}
+
+	bad := append([]interface{}{}, rows[0]...)
+	bad[1] = nil
+	if err := writeArrow(io.Discard, quarterColumns, [][]interface{}{bad}); err == nil || !strings.Contains(err.Error(), "company is empty") {
+		t.Errorf("null company: err = %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// assetFS holds the stylesheets and scripts of the pages (assets/). They are inlined into
+// each page, so a report stays a single file that opens anywhere.
+//
+//go:embed assets
+var assetFS embed.FS
+
+// assetsDir holds overrides (-assets): a file there named like a built-in asset is used
+// instead of it; the others stay built in
+var assetsDir string
+
+// useAssets makes dir the asset override dir, exiting when it isn't one
+func useAssets(dir string) {
+	if dir == "" {
+		return
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		log.Fatalf("assets: %v", err)
+	}
+	if !fi.IsDir() {
+		log.Fatalf("assets: %s is not a directory", dir)
+	}
+	assetsDir = dir
+}
+
+// asset returns the named asset, from the override dir when it has the file
+func asset(name string) string {
+	if assetsDir != "" {
+		b, err := os.ReadFile(filepath.Join(assetsDir, name))
+		if err == nil {
+			return string(b)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("asset: %v; using the built-in %s", err, name)
+		}
+	}
+	b, err := assetFS.ReadFile("assets/" + name)
+	if err != nil {
+		panic("asset: no built-in " + name) // a typo in the caller
+	}
+	return string(b)
+}
+
+// styleTag and scriptTag inline an asset into a page
+func styleTag(name string) string {
+	return "<style>\n" + asset(name) + "</style>"
+}
+
+func scriptTag(name string) string {
+	return "<script>\n" + asset(name) + "</script>"
+}
+
+// runAssets implements `quarter-compare assets DIR`: copy the built-in assets into DIR
+// as a starting point for -assets overrides; files already there are kept
+func runAssets(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: quarter-compare assets DIR")
+		os.Exit(2)
+	}
+	dir := args[0]
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatalf("assets: %v", err)
+	}
+	entries, err := assetFS.ReadDir("assets")
+	if err != nil {
+		log.Fatalf("assets: %v", err)
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(path); err == nil {
+			fmt.Println("kept", path)
+			continue
+		}
+		b, err := assetFS.ReadFile("assets/" + e.Name())
+		if err != nil {
+			log.Fatalf("assets: %v", err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			log.Fatalf("assets: %v", err)
+		}
+		fmt.Println("wrote", path)
+	}
+}
@@ -0,0 +1,45 @@
+function drawDuel(canvas, labels, names, sets){
+  const dpr = window.devicePixelRatio || 1;
+  const cw = canvas.clientWidth, ch = canvas.clientHeight;
+  canvas.width = Math.round(cw*dpr); canvas.height = Math.round(ch*dpr);
+  const ctx = canvas.getContext("2d");
+  ctx.setTransform(dpr,0,0,dpr,0,0);
+  ctx.clearRect(0,0,cw,ch);
+  const pad = {l:56, r:16, t:24, b:40};
+  let min = Infinity, max = -Infinity;
+  sets.forEach(function(s){ s.forEach(function(v){ if(v !== null){ min = Math.min(min, v); max = Math.max(max, v); } }); });
+  ctx.font = "11px Arial"; ctx.fillStyle = "#666";
+  if(min === Infinity){ ctx.fillText("No numeric data to display", pad.l, pad.t+20); return; }
+  if(min === max){ min -= 1; max += 1; }
+  min = Math.min(min, 0);
+  const n = labels.length;
+  const sx = function(i){ return pad.l + (n > 1 ? i*(cw-pad.l-pad.r)/(n-1) : (cw-pad.l-pad.r)/2); };
+  const sy = function(v){ return pad.t + (max-v)/(max-min)*(ch-pad.t-pad.b); };
+  ctx.strokeStyle = "#ddd"; ctx.lineWidth = 1;
+  for(let g=0; g<=4; g++){
+    const v = min + (max-min)*g/4, y = sy(v);
+    ctx.beginPath(); ctx.moveTo(pad.l, y); ctx.lineTo(cw-pad.r, y); ctx.stroke();
+    ctx.fillText(v.toFixed(0), 4, y+4);
+  }
+  labels.forEach(function(l, i){ ctx.fillText(l, sx(i)-20, ch-pad.b+16); });
+  const colors = ["#2c7be5", "#e5532c"];
+  sets.forEach(function(s, k){
+    ctx.strokeStyle = colors[k]; ctx.fillStyle = colors[k]; ctx.lineWidth = 2;
+    ctx.beginPath();
+    let pen = false;
+    s.forEach(function(v, i){
+      if(v === null){ pen = false; return; }
+      if(pen) ctx.lineTo(sx(i), sy(v)); else ctx.moveTo(sx(i), sy(v));
+      pen = true;
+    });
+    ctx.stroke();
+    s.forEach(function(v, i){ if(v !== null){ ctx.beginPath(); ctx.arc(sx(i), sy(v), 3, 0, Math.PI*2); ctx.fill(); } });
+    ctx.fillText(names[k], pad.l + 8 + k*120, 14);
+  });
+}
+function drawDuels(){
+  drawDuel(document.getElementById("revChart"), QC_DUEL.labels, QC_DUEL.names, QC_DUEL.revenue);
+  drawDuel(document.getElementById("npChart"), QC_DUEL.labels, QC_DUEL.names, QC_DUEL.netprofit);
+}
+document.addEventListener("DOMContentLoaded", drawDuels);
+window.addEventListener("resize", drawDuels);
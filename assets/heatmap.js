@@ -0,0 +1,67 @@
+// squarified treemap layout: returns [{item,x,y,w,h}] filling the given rectangle
+function layoutTreemap(items, x, y, w, h){
+  const total = items.reduce(function(s,i){ return s + i.size; }, 0);
+  const scale = (w*h) / total;
+  const nodes = items.slice().sort(function(a,b){ return b.size - a.size; }).map(function(i){ return {item:i, area:i.size*scale}; });
+  const out = [];
+  let rect = {x:x, y:y, w:w, h:h};
+  function worst(row, side){
+    let s = 0, mx = -Infinity, mn = Infinity;
+    row.forEach(function(n){ s += n.area; mx = Math.max(mx, n.area); mn = Math.min(mn, n.area); });
+    return Math.max(side*side*mx/(s*s), (s*s)/(side*side*mn));
+  }
+  function place(row){
+    const s = row.reduce(function(a,n){ return a + n.area; }, 0);
+    if(rect.w >= rect.h){
+      const colW = s / rect.h;
+      let cy = rect.y;
+      row.forEach(function(n){ const hh = n.area/colW; out.push({item:n.item, x:rect.x, y:cy, w:colW, h:hh}); cy += hh; });
+      rect = {x:rect.x+colW, y:rect.y, w:rect.w-colW, h:rect.h};
+    } else {
+      const rowH = s / rect.w;
+      let cx = rect.x;
+      row.forEach(function(n){ const ww = n.area/rowH; out.push({item:n.item, x:cx, y:rect.y, w:ww, h:rowH}); cx += ww; });
+      rect = {x:rect.x, y:rect.y+rowH, w:rect.w, h:rect.h-rowH};
+    }
+  }
+  let row = [];
+  nodes.forEach(function(n){
+    const side = Math.min(rect.w, rect.h);
+    if(row.length === 0 || worst(row.concat([n]), side) <= worst(row, side)){ row.push(n); }
+    else { place(row); row = [n]; }
+  });
+  if(row.length) place(row);
+  return out;
+}
+
+function heatColor(score){
+  if(score === null || score === undefined || isNaN(score)) return "#d9d9d9";
+  const t = Math.min(Math.abs(score), 50) / 50; // 0..1
+  const light = Math.round(90 - t*45);
+  return score >= 0 ? "hsl(140,55%," + light + "%)" : "hsl(0,65%," + light + "%)";
+}
+
+function drawHeatmap(){
+  const box = document.getElementById("heatmap");
+  if(!box || typeof QC_HEATMAP === "undefined") return;
+  box.innerHTML = "";
+  const rects = layoutTreemap(QC_HEATMAP, 0, 0, box.clientWidth, box.clientHeight);
+  rects.forEach(function(r){
+    const d = document.createElement("div");
+    d.style.cssText = "position:absolute;box-sizing:border-box;border:1px solid #fff;overflow:hidden;padding:3px;font-size:11px;line-height:1.2;text-align:left";
+    d.style.left = r.x + "px"; d.style.top = r.y + "px";
+    d.style.width = r.w + "px"; d.style.height = r.h + "px";
+    d.style.background = heatColor(r.item.score);
+    d.title = r.item.company + " — " + (r.item.longName || "") + "\nNP %Δ: " + r.item.label;
+    if(r.w > 40 && r.h > 24){
+      const b = document.createElement("strong");
+      b.textContent = r.item.company;
+      d.appendChild(b);
+      d.appendChild(document.createElement("br"));
+      d.appendChild(document.createTextNode(r.item.label));
+    }
+    box.appendChild(d);
+  });
+}
+document.addEventListener("DOMContentLoaded", drawHeatmap);
+window.addEventListener("resize", drawHeatmap);
@@ -0,0 +1,32 @@
+// keeps a served report up to date: on a run event for the page's day (any day for
+// /report.html, the latest) it fetches the page again and swaps the table rows in place,
+// highlighting the companies that are new or changed. A changed header (say, new
+// quarters) reloads the whole page instead.
+document.addEventListener("DOMContentLoaded", function(){
+  const table = document.getElementById("reportTable");
+  if(!table || !window.EventSource) return;
+  const m = location.pathname.match(/\/reports\/(.+)\.html$/);
+  const day = m ? decodeURIComponent(m[1]) : "";
+  const status = document.getElementById("liveStatus");
+  function columns(t){ return Array.from(t.tHead.querySelectorAll("th[data-col]")).map(function(th){ return th.getAttribute("data-col"); }).join("|"); }
+  function refresh(){
+    fetch(location.pathname, {cache: "no-store"}).then(function(resp){ return resp.text(); }).then(function(txt){
+      const fresh = new DOMParser().parseFromString(txt, "text/html").getElementById("reportTable");
+      if(!fresh) return;
+      if(columns(fresh) !== columns(table)){ location.reload(); return; }
+      const before = {};
+      for(const r of table.tBodies[0].rows) before[r.id] = r.getAttribute("data-json");
+      const rows = Array.from(fresh.tBodies[0].rows).map(function(r){ return document.importNode(r, true); });
+      let changed = 0;
+      rows.forEach(function(r){
+        if(before[r.id] !== r.getAttribute("data-json")){ r.classList.add("fresh"); changed++; }
+      });
+      table.tBodies[0].replaceChildren.apply(table.tBodies[0], rows);
+      table.dispatchEvent(new CustomEvent("rowsupdated", {detail: rows}));
+      if(status) status.textContent = "Updated " + new Date().toLocaleTimeString() + ": " + changed + " new or changed (highlighted); reload for the summaries.";
+    }).catch(function(err){ console.error("live refresh", err); });
+  }
+  const events = new EventSource("/events");
+  events.addEventListener("run", function(e){ if(day === "" || e.data === day) refresh(); });
+  events.onopen = function(){ if(status && !status.textContent) status.textContent = "Live: the table updates as results are stored."; };
+});
@@ -0,0 +1,382 @@
+// helper: setup canvas for devicePixelRatio
+function setupCanvasForDPR(canvas){
+  const dpr = window.devicePixelRatio || 1;
+  const styleW = canvas.clientWidth;
+  const styleH = canvas.clientHeight;
+  canvas.width = Math.round(styleW * dpr);
+  canvas.height = Math.round(styleH * dpr);
+  const ctx = canvas.getContext("2d");
+  ctx.setTransform(dpr,0,0,dpr,0,0); // scale coordinates to CSS pixels
+  return ctx;
+}
+
+// drawChart: draws full chart, optionally highlight index
+function drawChart(canvas, labels, values, title, highlightIndex){
+  const ctx = setupCanvasForDPR(canvas);
+  const cw = canvas.clientWidth;
+  const ch = canvas.clientHeight;
+  // clear
+  ctx.clearRect(0,0,cw,ch);
+  // padding
+  const padLeft = 40, padRight = 20, padTop = 30, padBottom = 40;
+  const chartW = cw - padLeft - padRight;
+  const chartH = ch - padTop - padBottom;
+
+  // numeric array and compute min/max ignoring NaN
+  const nums = [];
+  for(let i=0;i<values.length;i++){
+    const v = values[i];
+    const n = (v === null || v === undefined || isNaN(Number(v))) ? NaN : Number(v);
+    nums.push(n);
+  }
+  let min = Infinity, max = -Infinity;
+  for(const v of nums){ if(!isNaN(v)){ min=Math.min(min,v); max=Math.max(max,v); } }
+  if(min===Infinity || max===-Infinity){
+    ctx.fillStyle="#666";
+    ctx.font="14px Arial";
+    ctx.fillText("No numeric data to display", padLeft, padTop + 20);
+    return;
+  }
+  // add small margins
+  if (min === max) { min = min - Math.abs(min)*0.05 - 1; max = max + Math.abs(max)*0.05 + 1; }
+  const range = max - min;
+
+  // axes
+  ctx.strokeStyle = "#ddd";
+  ctx.lineWidth = 1;
+  ctx.beginPath();
+  // y grid lines and labels
+  ctx.fillStyle = "#666";
+  ctx.font = "11px Arial";
+  const gridLines = 4;
+  for(let i=0;i<=gridLines;i++){
+    const y = padTop + (chartH * i / gridLines);
+    ctx.beginPath();
+    ctx.moveTo(padLeft, y);
+    ctx.lineTo(padLeft + chartW, y);
+    ctx.stroke();
+    const val = (max - (range * i / gridLines));
+    ctx.fillText(val.toFixed(2), 4, y+4);
+  }
+  // x-axis labels placeholders
+  const n = nums.length;
+  const stepX = n>1 ? chartW / (n-1) : chartW;
+  // draw line
+  ctx.beginPath();
+  ctx.strokeStyle = "#2c7be5";
+  ctx.lineWidth = 2;
+  let firstDrawn = false;
+  for(let i=0;i<n;i++){
+    const v = nums[i];
+    if(isNaN(v)) continue;
+    const x = padLeft + i * stepX;
+    const y = padTop + chartH - ((v - min) / range) * chartH;
+    if(!firstDrawn){ ctx.moveTo(x,y); firstDrawn = true; } else { ctx.lineTo(x,y); }
+  }
+  ctx.stroke();
+  // draw points and labels
+  for(let i=0;i<n;i++){
+    const v = nums[i];
+    const x = padLeft + i * stepX;
+    const y = isNaN(v) ? padTop + chartH : padTop + chartH - ((v - min) / range) * chartH;
+    // x label
+    const lab = labels[i] || "";
+    ctx.fillStyle = "#333";
+    ctx.font = "11px Arial";
+    ctx.fillText(lab, x - 20, padTop + chartH + 16, 80);
+    if(!isNaN(v)){
+      ctx.beginPath();
+      ctx.fillStyle = (i===highlightIndex) ? "#ff6b6b" : "#2c7be5";
+      ctx.arc(x, y, (i===highlightIndex)?6:4, 0, Math.PI*2);
+      ctx.fill();
+      // small value near point
+      ctx.fillStyle = "#000";
+      ctx.font = "11px Arial";
+      if (i===highlightIndex) {
+        ctx.fillText(v.toString(), x+8, y-8);
+      }
+    } else {
+      // draw hollow marker for missing
+      ctx.beginPath();
+      ctx.strokeStyle = "#bbb";
+      ctx.arc(x, padTop + chartH, 3, 0, Math.PI*2);
+      ctx.stroke();
+    }
+  }
+  // title
+  ctx.fillStyle="#111";
+  ctx.font="bold 13px Arial";
+  ctx.fillText(title, padLeft, 16);
+  // store computed points for hover interactions
+  const pts = [];
+  for(let i=0;i<n;i++){
+    const px = padLeft + i * stepX;
+    const py = isNaN(nums[i]) ? padTop + chartH : padTop + chartH - ((nums[i] - min) / range) * chartH;
+    pts.push({x:px,y:py,val:nums[i],label:labels[i]||""});
+  }
+  canvas._chartPoints = pts;
+}
+
+// utility: get mouse pos in CSS pixels relative to canvas
+function getMousePos(canvas, evt){
+  const rect = canvas.getBoundingClientRect();
+  const x = evt.clientX - rect.left;
+  const y = evt.clientY - rect.top;
+  return {x:x, y:y};
+}
+
+// attach hover handlers to canvas
+function attachHover(canvas, titlePrefix){
+  if(!canvas) return;
+  // remove existing listeners (simple approach)
+  canvas.onmousemove = null;
+  canvas.onmouseleave = null;
+  const tooltip = document.getElementById("chartTooltip");
+  canvas.onmousemove = function(e){
+    const pos = getMousePos(canvas, e);
+    const pts = canvas._chartPoints || [];
+    let nearest = -1;
+    let minDist = 1e9;
+    for(let i=0;i<pts.length;i++){
+      const d = Math.hypot(pos.x - pts[i].x, pos.y - pts[i].y);
+      if(d < minDist){ minDist = d; nearest = i; }
+    }
+    // consider radius threshold (20px)
+    if(minDist <= 20 && nearest >= 0){
+      // redraw with highlight
+      const allLabels = pts.map(p=>p.label);
+      const allVals = pts.map(p=>p.val);
+      drawChart(canvas, allLabels, allVals, titlePrefix, nearest);
+      // show tooltip near cursor
+      const p = pts[nearest];
+      tooltip.style.display = "block";
+      tooltip.style.left = (e.clientX + 12) + "px";
+      tooltip.style.top = (e.clientY + 12) + "px";
+      tooltip.innerHTML = "<strong>"+ (p.label || "") + "</strong><br/>" + (isNaN(p.val) ? "N/A" : p.val);
+    } else {
+      // no highlight
+      const allLabels = pts.map(p=>p.label);
+      const allVals = pts.map(p=>p.val);
+      drawChart(canvas, allLabels, allVals, titlePrefix, -1);
+      tooltip.style.display = "none";
+    }
+  };
+  canvas.onmouseleave = function(){
+    const pts = canvas._chartPoints || [];
+    const allLabels = pts.map(p=>p.label);
+    const allVals = pts.map(p=>p.val);
+    drawChart(canvas, allLabels, allVals, titlePrefix, -1);
+    const tooltip = document.getElementById("chartTooltip");
+    tooltip.style.display = "none";
+  };
+}
+
+// segment breakdown of the latest quarter: revenue, share of the segments' total, change
+// on the previous quarter and result; the segment whose revenue moved most is bold
+function drawSegments(box, segments, quarter){
+  box.textContent = "";
+  if(!segments || !segments.length) return;
+  const num = v => (v === null || v === undefined) ? NaN : Number(v);
+  let total = 0, moved = -1, most = 0;
+  segments.forEach(function(s, i){
+    const rev = num(s.revenue), prev = num(s.prev);
+    if(!isNaN(rev)) total += rev;
+    if(!isNaN(rev) && !isNaN(prev) && Math.abs(rev-prev) > most){ most = Math.abs(rev-prev); moved = i; }
+  });
+  const h = document.createElement("h4");
+  h.textContent = "Segments" + (quarter ? " — " + quarter : "") + " (₹ cr)";
+  h.style.margin = "0 0 4px";
+  box.appendChild(h);
+  const table = document.createElement("table");
+  table.className = "small";
+  const head = table.insertRow();
+  ["Segment", "Revenue", "Share", "%Δ QoQ", "Result", "Margin"].forEach(function(t){
+    const th = document.createElement("th");
+    th.textContent = t;
+    head.appendChild(th);
+  });
+  segments.forEach(function(s, i){
+    const rev = num(s.revenue), prev = num(s.prev), res = num(s.result);
+    const row = table.insertRow();
+    if(i === moved){ row.style.fontWeight = "bold"; row.title = "moved most on the previous quarter"; }
+    [s.name,
+     isNaN(rev) ? "N/A" : rev.toFixed(2),
+     isNaN(rev) || !(total > 0) ? "" : (rev/total*100).toFixed(1) + "%",
+     isNaN(rev) || isNaN(prev) || prev === 0 ? "" : ((rev-prev)/Math.abs(prev)*100).toFixed(1) + "%",
+     isNaN(res) ? "" : res.toFixed(2),
+     isNaN(res) || !(rev > 0) ? "" : (res/rev*100).toFixed(1) + "%"].forEach(function(t){ row.insertCell().textContent = t; });
+  });
+  box.appendChild(table);
+}
+
+// business description under the modal title, linked to the article it comes from
+function drawProfile(box, text, url){
+  box.textContent = "";
+  box.style.display = text ? "" : "none";
+  if(!text) return;
+  box.appendChild(document.createTextNode(text + " "));
+  if(url && /^https?:\/\//.test(url)){
+    const a = document.createElement("a");
+    a.href = url;
+    a.target = "_blank";
+    a.rel = "noopener";
+    a.textContent = "Wikipedia";
+    box.appendChild(a);
+  }
+}
+
+// open modal helper existing in code: ensure we call attachHover after initial draw
+document.addEventListener("DOMContentLoaded", function(){
+  const table = document.getElementById("reportTable");
+  if(!table) return;
+  const overlay = document.getElementById("modalOverlay");
+  const annotation = document.getElementById("annotation");
+  let opener = null; // row focused again when the modal closes
+  let current = ""; // company shown in the modal
+  let notes = loadNotes();
+  const byCompany = {};
+  function closeModal(){
+    overlay.style.display = "none";
+    document.getElementById("chartTooltip").style.display = "none";
+    if(location.hash.indexOf("#company=") === 0) history.replaceState(null, "", location.pathname + location.search);
+    if(opener) opener.focus();
+    opener = null;
+  }
+  function wireRow(r){
+    try { byCompany[JSON.parse(r.getAttribute("data-json")).company] = r; } catch(err){}
+    r.style.cursor = "pointer";
+    // rows open the chart from the keyboard too: Tab to a row, Enter or Space
+    r.tabIndex = 0;
+    r.setAttribute("aria-label", r.cells[0].textContent.trim() + ", press Enter for the quarterly chart");
+    r.addEventListener("keydown", function(e){
+      if(e.target === r && (e.key === "Enter" || e.key === " ")){ e.preventDefault(); r.click(); }
+    });
+    r.addEventListener("click", function(e){
+      if(e.target.closest("a,button")) return; // links in the row keep their own action
+      // open modal with row
+      const j = r.getAttribute("data-json");
+      if(!j) return;
+      let obj;
+      try { obj = JSON.parse(j); } catch(err){ console.error("invalid row json", err); return; }
+      const title = obj.company + " — " + (obj.longName || "");
+      document.getElementById("modalTitle").textContent = title;
+      drawProfile(document.getElementById("modalProfile"), obj.profile, obj.profileUrl);
+      current = obj.company;
+      history.replaceState(null, "", "#company=" + encodeURIComponent(current));
+      annotation.value = notes[current] ? notes[current].text : "";
+      const quarters = obj.quarters || [];
+      const revenue = obj.revenue || [];
+      const profit = obj.netprofit || [];
+      document.getElementById("modalNote").textContent = "Hover over points to see values. Showing up to 4 quarters.";
+      const revCanvas = document.getElementById("revenueChart");
+      const profCanvas = document.getElementById("profitChart");
+      drawChart(revCanvas, quarters, revenue, "Revenue", -1);
+      drawChart(profCanvas, quarters, profit, "Net Profit", -1);
+      attachHover(revCanvas, "Revenue");
+      attachHover(profCanvas, "Net Profit");
+      drawSegments(document.getElementById("modalSegments"), obj.segments, quarters[0]);
+      overlay.style.display = "block";
+      opener = r;
+      document.getElementById("modalClose").focus();
+    });
+  }
+  for(const r of table.tBodies[0].rows) wireRow(r);
+  const closeBtn = document.getElementById("modalClose");
+  if(closeBtn) closeBtn.addEventListener("click", closeModal);
+  overlay.addEventListener("click", function(e){ if(e.target === overlay) closeModal(); });
+  // Escape closes; Tab cycles through the dialog's controls
+  overlay.addEventListener("keydown", function(e){
+    if(e.key === "Escape"){ e.preventDefault(); closeModal(); }
+    if(e.key === "Tab"){
+      const controls = Array.from(document.getElementById("modal").querySelectorAll("button,textarea"));
+      const i = controls.indexOf(document.activeElement);
+      const next = e.shiftKey ? (i <= 0 ? controls.length-1 : i-1) : (i+1) % controls.length;
+      e.preventDefault();
+      controls[next].focus();
+    }
+  });
+
+  // deep links: report.html#company=TCS opens that company's chart
+  function openFromHash(){
+    if(location.hash.indexOf("#company=") !== 0) return;
+    const r = byCompany[decodeURIComponent(location.hash.slice("#company=".length))];
+    if(r){ r.scrollIntoView({block: "center"}); r.click(); }
+  }
+  window.addEventListener("hashchange", openFromHash);
+  openFromHash();
+  document.getElementById("modalLink").addEventListener("click", function(){
+    const btn = this;
+    if(!navigator.clipboard){ prompt("Copy this link:", location.href); return; }
+    navigator.clipboard.writeText(location.href).then(function(){ btn.textContent = "Copied"; setTimeout(function(){ btn.textContent = "Copy link"; }, 1500); },
+      function(){ prompt("Copy this link:", location.href); });
+  });
+
+  // notes: one per company, saved as typed and marked 📝 on the company's row
+  function markNote(company){
+    const r = byCompany[company];
+    if(!r) return;
+    let mark = r.cells[0].querySelector(".my-note");
+    const note = notes[company];
+    if(!note || !note.text){ if(mark) mark.remove(); return; }
+    if(!mark){
+      mark = document.createElement("span");
+      mark.className = "my-note";
+      mark.textContent = " 📝";
+      r.cells[0].insertBefore(mark, r.cells[0].querySelector("br"));
+    }
+    mark.title = note.text;
+  }
+  Object.keys(notes).forEach(markNote);
+  table.addEventListener("rowsupdated", function(e){
+    e.detail.forEach(wireRow);
+    Object.keys(notes).forEach(markNote);
+  });
+  annotation.addEventListener("input", function(){
+    if(!current) return;
+    const text = annotation.value.trim();
+    if(text) notes[current] = {text: text, updated: new Date().toISOString()};
+    else delete notes[current];
+    saveNotes(notes);
+    markNote(current);
+  });
+  document.getElementById("exportNotes").addEventListener("click", function(){
+    const blob = new Blob([JSON.stringify(notes, null, 2)], {type: "application/json"});
+    const a = document.createElement("a");
+    a.href = URL.createObjectURL(blob);
+    a.download = "quarter-compare-notes.json";
+    a.click();
+    URL.revokeObjectURL(a.href);
+  });
+  const importFile = document.getElementById("importNotesFile");
+  document.getElementById("importNotes").addEventListener("click", function(){ importFile.click(); });
+  importFile.addEventListener("change", function(){
+    const f = importFile.files[0];
+    if(!f) return;
+    f.text().then(function(txt){
+      const incoming = JSON.parse(txt);
+      let n = 0;
+      // the newer of two notes on the same company wins
+      for(const company in incoming){
+        const note = incoming[company];
+        if(!note || typeof note.text !== "string") continue;
+        if(notes[company] && (notes[company].updated || "") >= (note.updated || "")) continue;
+        notes[company] = {text: note.text, updated: note.updated || new Date().toISOString()};
+        markNote(company);
+        n++;
+      }
+      saveNotes(notes);
+      alert("Imported " + n + " note(s).");
+    }).catch(function(err){ alert("Not a notes file: " + err.message); });
+    importFile.value = "";
+  });
+});
+
+// reader notes by company ({text, updated}); kept apart from the view state so a reset
+// doesn't lose them
+const notesKey = "quarter-compare.notes";
+function loadNotes(){
+  try { return JSON.parse(localStorage.getItem(notesKey)) || {}; } catch(err){ return {}; }
+}
+function saveNotes(notes){
+  try { localStorage.setItem(notesKey, JSON.stringify(notes)); } catch(err){}
+}
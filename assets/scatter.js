@@ -0,0 +1,83 @@
+function drawScatter(highlight){
+  const canvas = document.getElementById("scatterChart");
+  if(!canvas || typeof QC_SCATTER === "undefined") return;
+  const dpr = window.devicePixelRatio || 1;
+  const cw = canvas.clientWidth, ch = canvas.clientHeight;
+  canvas.width = Math.round(cw*dpr); canvas.height = Math.round(ch*dpr);
+  const ctx = canvas.getContext("2d");
+  ctx.setTransform(dpr,0,0,dpr,0,0);
+  ctx.clearRect(0,0,cw,ch);
+  const pad = {l:50, r:20, t:20, b:36};
+  const cap = 200;
+  const clamp = function(v){ return Math.max(-cap, Math.min(cap, v)); };
+  let minX = 0, maxX = 0, minY = 0, maxY = 0;
+  QC_SCATTER.forEach(function(p){
+    minX = Math.min(minX, clamp(p.rev)); maxX = Math.max(maxX, clamp(p.rev));
+    minY = Math.min(minY, clamp(p.np)); maxY = Math.max(maxY, clamp(p.np));
+  });
+  const spanX = (maxX - minX) || 1, spanY = (maxY - minY) || 1;
+  minX -= spanX*0.05; maxX += spanX*0.05; minY -= spanY*0.05; maxY += spanY*0.05;
+  const sx = function(v){ return pad.l + (clamp(v)-minX)/(maxX-minX)*(cw-pad.l-pad.r); };
+  const sy = function(v){ return pad.t + (maxY-clamp(v))/(maxY-minY)*(ch-pad.t-pad.b); };
+  // divergence quadrant (rev up, np down)
+  ctx.fillStyle = "rgba(248,215,218,0.35)";
+  ctx.fillRect(sx(0), sy(0), cw-pad.r-sx(0), ch-pad.b-sy(0));
+  // zero axes
+  ctx.strokeStyle = "#999"; ctx.lineWidth = 1;
+  ctx.beginPath(); ctx.moveTo(sx(0), pad.t); ctx.lineTo(sx(0), ch-pad.b); ctx.stroke();
+  ctx.beginPath(); ctx.moveTo(pad.l, sy(0)); ctx.lineTo(cw-pad.r, sy(0)); ctx.stroke();
+  ctx.fillStyle = "#666"; ctx.font = "11px Arial";
+  ctx.fillText(minX.toFixed(0)+"%", pad.l, ch-pad.b+14);
+  ctx.fillText(maxX.toFixed(0)+"%", cw-pad.r-30, ch-pad.b+14);
+  ctx.fillText("Revenue %Δ →", (cw/2)-30, ch-6);
+  ctx.fillText(maxY.toFixed(0)+"%", 4, pad.t+8);
+  ctx.fillText(minY.toFixed(0)+"%", 4, ch-pad.b);
+  ctx.fillText("NP %Δ", 4, sy(0)-4);
+  const pts = [];
+  QC_SCATTER.forEach(function(p, i){
+    const x = sx(p.rev), y = sy(p.np);
+    const capped = Math.abs(p.rev) > cap || Math.abs(p.np) > cap;
+    const color = (p.rev > 0 && p.np < 0) ? "#d9534f" : "#2c7be5";
+    ctx.beginPath();
+    ctx.arc(x, y, i===highlight ? 7 : 5, 0, Math.PI*2);
+    if(capped){ ctx.strokeStyle = color; ctx.lineWidth = 2; ctx.stroke(); }
+    else { ctx.fillStyle = color; ctx.fill(); }
+    pts.push({x:x, y:y, p:p});
+  });
+  canvas._scatterPoints = pts;
+}
+
+document.addEventListener("DOMContentLoaded", function(){
+  const canvas = document.getElementById("scatterChart");
+  if(!canvas) return;
+  const tip = document.getElementById("scatterTooltip");
+  drawScatter(-1);
+  canvas.addEventListener("mousemove", function(e){
+    const rect = canvas.getBoundingClientRect();
+    const mx = e.clientX - rect.left, my = e.clientY - rect.top;
+    let best = -1, bestD = 1e9;
+    (canvas._scatterPoints || []).forEach(function(pt, i){
+      const d = Math.hypot(mx - pt.x, my - pt.y);
+      if(d < bestD){ bestD = d; best = i; }
+    });
+    if(best >= 0 && bestD <= 12){
+      const p = canvas._scatterPoints[best].p;
+      drawScatter(best);
+      tip.style.display = "block";
+      tip.style.left = (e.clientX + 12) + "px";
+      tip.style.top = (e.clientY + 12) + "px";
+      tip.innerHTML = "";
+      const b = document.createElement("strong");
+      b.textContent = p.company;
+      tip.appendChild(b);
+      tip.appendChild(document.createTextNode(" " + (p.longName || "")));
+      tip.appendChild(document.createElement("br"));
+      tip.appendChild(document.createTextNode("Rev " + p.rev.toFixed(2) + "% · NP " + p.np.toFixed(2) + "%"));
+    } else {
+      drawScatter(-1);
+      tip.style.display = "none";
+    }
+  });
+  canvas.addEventListener("mouseleave", function(){ drawScatter(-1); tip.style.display = "none"; });
+  window.addEventListener("resize", function(){ drawScatter(-1); });
+});
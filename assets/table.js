@@ -0,0 +1,140 @@
+document.addEventListener("DOMContentLoaded", function(){
+  const table = document.getElementById("reportTable");
+  if(!table) return;
+  const state = loadTableState();
+  const ths = Array.from(table.querySelectorAll("thead th[aria-sort]"));
+  function applySort(th, asc){
+    // reset indicators
+    ths.forEach(function(x){ x.setAttribute("aria-sort","none"); const sp=x.querySelector(".sort-indicator"); if(sp) sp.textContent=""; });
+    th.setAttribute("aria-sort", asc ? "ascending" : "descending");
+    const indicator = th.querySelector(".sort-indicator");
+    if(indicator) indicator.textContent = asc?"▲":"▼";
+    sortTable(table, columnStart(th), asc);
+  }
+  ths.forEach(function(th){
+    const btn = th.querySelector("button.sort");
+    if(!btn) return;
+    btn.addEventListener("click", function(){
+      const asc = th.getAttribute("aria-sort") !== "ascending";
+      applySort(th, asc);
+      state.sort = {col: th.getAttribute("data-col"), asc: asc};
+      saveTableState(state);
+    });
+  });
+
+  // company filter and column picker, remembered with the sort across reloads and days
+  const filter = document.getElementById("rowFilter");
+  const list = document.getElementById("columnList");
+  function applyFilter(){
+    const q = (state.filter || "").toLowerCase();
+    for(const r of table.tBodies[0].rows){
+      r.hidden = q !== "" && r.cells[0].textContent.toLowerCase().indexOf(q) < 0;
+    }
+  }
+  function applyHidden(){
+    const hidden = state.hidden || [];
+    ths.forEach(function(th){
+      const off = hidden.indexOf(th.getAttribute("data-col")) >= 0;
+      const start = columnStart(th);
+      th.style.display = off ? "none" : "";
+      for(const r of Array.from(table.tHead.rows).slice(1).concat(Array.from(table.tBodies[0].rows))){
+        for(let i = start; i < start + th.colSpan && i < r.cells.length; i++) r.cells[i].style.display = off ? "none" : "";
+      }
+    });
+  }
+  if(filter){
+    filter.value = state.filter || "";
+    filter.addEventListener("input", function(){ state.filter = filter.value.trim(); saveTableState(state); applyFilter(); });
+  }
+  if(list){
+    ths.slice(1).forEach(function(th){
+      const key = th.getAttribute("data-col");
+      const label = document.createElement("label");
+      const box = document.createElement("input");
+      box.type = "checkbox";
+      box.checked = (state.hidden || []).indexOf(key) < 0;
+      box.addEventListener("change", function(){
+        state.hidden = (state.hidden || []).filter(function(k){ return k !== key; });
+        if(!box.checked) state.hidden.push(key);
+        saveTableState(state);
+        applyHidden();
+      });
+      label.appendChild(box);
+      label.appendChild(document.createTextNode(" " + th.querySelector("button.sort").textContent));
+      list.appendChild(label);
+    });
+  }
+  const reset = document.getElementById("resetView");
+  if(reset) reset.addEventListener("click", function(){ saveTableState({}); location.reload(); });
+
+  if(state.sort){
+    const th = ths.find(function(x){ return x.getAttribute("data-col") === state.sort.col; });
+    if(th) applySort(th, state.sort.asc);
+  }
+  applyFilter();
+  applyHidden();
+  // rows swapped in by a live update get the current sort, filter and columns
+  table.addEventListener("rowsupdated", function(){
+    const th = ths.find(function(x){ return x.getAttribute("aria-sort") !== "none"; });
+    if(th) applySort(th, th.getAttribute("aria-sort") === "ascending");
+    applyFilter();
+    applyHidden();
+  });
+});
+
+// the body column a header starts at; a quarter header spans revenue and net profit
+function columnStart(th){
+  let idx = 0;
+  for(let x = th.previousElementSibling; x; x = x.previousElementSibling) idx += x.colSpan;
+  return idx;
+}
+
+// the reader's sort, filter and hidden columns; one entry for every report, which all
+// share the table layout. Storage can be off (private windows, some file:// setups).
+const tableStateKey = "quarter-compare.table";
+function loadTableState(){
+  try { return JSON.parse(localStorage.getItem(tableStateKey)) || {}; } catch(err){ return {}; }
+}
+function saveTableState(state){
+  try { localStorage.setItem(tableStateKey, JSON.stringify(state)); } catch(err){}
+}
+
+function parseNumericCell(cell){
+  const ds = cell.getAttribute("data-sort");
+  if(ds !== null && ds.length>0){
+    const n = Number(ds);
+    if(!isNaN(n)) return n;
+  }
+  // fallback: try strip % and commas
+  const txt = cell.textContent.replace(/%/g,'').replace(/,/g,'').trim();
+  const n = Number(txt);
+  if(!isNaN(n)) return n;
+  return NaN;
+}
+
+function sortTable(table, colIndex, asc){
+  const tbody = table.tBodies[0];
+  const rows = Array.from(tbody.rows);
+  rows.sort(function(a,b){
+    // pinned watchlist rows stay on top
+    const aPin = a.classList.contains("watch"), bPin = b.classList.contains("watch");
+    if(aPin !== bPin) return aPin ? -1 : 1;
+    const aCell = a.cells[colIndex];
+    const bCell = b.cells[colIndex];
+    const aVal = parseNumericCell(aCell);
+    const bVal = parseNumericCell(bCell);
+    const aNan = Number.isNaN(aVal);
+    const bNan = Number.isNaN(bVal);
+    if(aNan && bNan) return 0;
+    if(aNan) return 1; // push NaN to bottom
+    if(bNan) return -1;
+    if(aVal < bVal) return asc ? -1 : 1;
+    if(aVal > bVal) return asc ? 1 : -1;
+    // tie-breaker: company name (first cell)
+    const aName = a.cells[0].textContent.trim().toLowerCase();
+    const bName = b.cells[0].textContent.trim().toLowerCase();
+    return aName < bName ? -1 : (aName > bName ? 1 : 0);
+  });
+  // re-append rows in new order
+  rows.forEach(function(r){ tbody.appendChild(r); });
+}
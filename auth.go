@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ServeConfig protects `serve`: its pages, /events, /graphql and the gRPC API. With a
+// username or token set every request must log in, by basic auth or as
+// "Authorization: Bearer <token>"; with allow set only those client addresses get in.
+// The TLS settings switch it to HTTPS (see tls.go).
+type ServeConfig struct {
+	Username string   `json:"username"`
+	Password string   `json:"password" secret:"true"`
+	Token    string   `json:"token" secret:"true"`
+	Allow    []string `json:"allow"` // client IPs or CIDR ranges, e.g. 192.168.1.0/24; empty: any
+
+	// a certificate of your own, PEM files
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// or certificates from Let's Encrypt for these host names
+	Autocert      []string `json:"autocert"`
+	AutocertEmail string   `json:"autocert_email"` // for expiry notices from Let's Encrypt
+	AutocertDir   string   `json:"autocert_dir"`   // certificate cache, default <app dir>/autocert
+	HTTPAddr      string   `json:"http_addr"`      // autocert: answers HTTP-01 challenges and redirects to https, default ":80"; "-" for none
+}
+
+// checkServe validates the login settings and the allowlist
+func checkServe(c ServeConfig) error {
+	if (c.Username == "") != (c.Password == "") {
+		return fmt.Errorf("username and password go together")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file go together")
+	}
+	if c.CertFile != "" && len(c.Autocert) > 0 {
+		return fmt.Errorf("set cert_file/key_file or autocert, not both")
+	}
+	_, err := parseAllowlist(c.Allow)
+	return err
+}
+
+// parseAllowlist turns IPs and CIDR ranges into networks
+func parseAllowlist(allow []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, a := range allow {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, fmt.Errorf("allow: %q is not an IP or CIDR range", a)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, fmt.Errorf("allow: %v", err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// secured reports whether requests have to log in
+func (c ServeConfig) secured() bool {
+	return c.Username != "" || c.Token != ""
+}
+
+// protect wraps next with the allowlist and login checks of c. Refusals are HTTP 403 or
+// 401, or for grpc the PERMISSION_DENIED and UNAUTHENTICATED statuses. CORS preflights,
+// which carry no credentials, are answered here without reaching next, with the CORS
+// headers of cors (see setCORS).
+func (c ServeConfig) protect(next http.Handler, grpc bool, cors string) http.Handler {
+	nets, _ := parseAllowlist(c.Allow) // checked by LoadConfig
+	refuse := func(w http.ResponseWriter, status, grpcCode int, msg string) {
+		if grpc {
+			w.Header().Set("content-type", "application/grpc")
+			w.Header().Set("grpc-status", fmt.Sprint(grpcCode))
+			w.Header().Set("grpc-message", grpcPercentEncode(msg))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Error(w, msg, status)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(nets) > 0 && !allowedAddr(nets, r.RemoteAddr) {
+			refuse(w, http.StatusForbidden, grpcPermissionDenied, "forbidden")
+			return
+		}
+		if !c.secured() || c.loggedIn(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == "OPTIONS" {
+			setCORS(w, cors)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if c.Username != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="quarter-compare", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="quarter-compare"`)
+		}
+		refuse(w, http.StatusUnauthorized, grpcUnauthenticated, "login required")
+	})
+}
+
+// loggedIn checks the request's bearer token or basic-auth credentials
+func (c ServeConfig) loggedIn(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && c.Token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1
+	}
+	if user, pass, ok := r.BasicAuth(); ok && c.Username != "" {
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(c.Username))
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(c.Password))
+		return userOK&passOK == 1
+	}
+	return false
+}
+
+// allowedAddr reports whether the client address (host:port) is in one of nets
+func allowedAddr(nets []*net.IPNet, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// loopbackAddr reports whether a listen address only accepts local connections
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
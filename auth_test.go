@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtect(t *testing.T) {
+	page := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("report"))
+	})
+	cases := []struct {
+		name     string
+		cfg      ServeConfig
+		method   string
+		auth     string
+		status   int
+		body     string
+		corsSent bool
+	}{
+		{"open", ServeConfig{}, "GET", "", http.StatusOK, "report", false},
+		{"open preflight", ServeConfig{}, "OPTIONS", "", http.StatusOK, "report", false},
+		{"no login", ServeConfig{Token: "t"}, "GET", "", http.StatusUnauthorized, "login required\n", false},
+		{"bearer", ServeConfig{Token: "t"}, "GET", "Bearer t", http.StatusOK, "report", false},
+		{"wrong bearer", ServeConfig{Token: "t"}, "GET", "Bearer x", http.StatusUnauthorized, "login required\n", false},
+		// a preflight gets no data, however protected the page
+		{"preflight", ServeConfig{Token: "t"}, "OPTIONS", "", http.StatusNoContent, "", true},
+		{"basic preflight", ServeConfig{Username: "u", Password: "p"}, "OPTIONS", "", http.StatusNoContent, "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, "/report.html", nil)
+			if c.auth != "" {
+				req.Header.Set("Authorization", c.auth)
+			}
+			w := httptest.NewRecorder()
+			c.cfg.protect(page, false, "http://localhost:5173").ServeHTTP(w, req)
+			if w.Code != c.status || w.Body.String() != c.body {
+				t.Errorf("%s: got %d %q, want %d %q", c.method, w.Code, w.Body.String(), c.status, c.body)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin") != ""; got != c.corsSent {
+				t.Errorf("CORS headers sent: %v, want %v", got, c.corsSent)
+			}
+		})
+	}
+}
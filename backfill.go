@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// runBackfill implements `quarter-compare backfill -from D -to D`: collect the results of
+// past days into the history, so the trend features have data from the start
+func runBackfill(args []string) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	from := fs.String("from", "", "first day (2006-01-02)")
+	to := fs.String("to", "", "last day (2006-01-02, default: yesterday)")
+	force := fs.Bool("force", false, "fetch days already in the history again")
+	fs.Parse(args)
+	cfg := mustLoadConfig(*configPath)
+
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		log.Fatalf("backfill: -from: %v", err)
+	}
+	end := time.Now().AddDate(0, 0, -1)
+	if *to != "" {
+		if end, err = time.Parse("2006-01-02", *to); err != nil {
+			log.Fatalf("backfill: -to: %v", err)
+		}
+	}
+	if end.Before(start) {
+		log.Fatalf("backfill: -to is before -from")
+	}
+	db, err := openHistory()
+	if err != nil {
+		log.Fatalf("backfill: %v", err)
+	}
+	defer db.Close()
+	storedDays, err := historyDays(db)
+	if err != nil {
+		log.Fatalf("backfill: load history: %v", err)
+	}
+	stored := map[string]bool{}
+	for _, d := range storedDays {
+		stored[d.Date] = true
+	}
+
+	client := NewHTTPClient(cfg)
+	if err := TrendlyneLogin(client, cfg.Trendlyne); err != nil {
+		log.Printf("backfill: trendlyne login failed, continuing anonymously: %v", err)
+	}
+	days, companies := 0, 0
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		if stored[date] && !*force {
+			fmt.Printf("%s: already stored, skipping (use -force to fetch again)\n", date)
+			continue
+		}
+		results, failures, decisions, err := collectPastResults(client, cfg, day)
+		if errors.Is(err, errNoMeetings) {
+			fmt.Printf("%s: no results filed\n", date)
+			continue
+		}
+		if err != nil {
+			log.Printf("backfill: %s: %v", date, err)
+			continue
+		}
+		if err := saveRun(db, RunRecord{Date: date, Results: results, Failures: failures}); err != nil {
+			log.Fatalf("backfill: save history: %v", err)
+		}
+		SaveDecisions(date, "", decisions)
+		fmt.Printf("%s: %d companies, %d failed\n", date, len(results), len(failures))
+		days++
+		companies += len(results)
+	}
+	fmt.Printf("backfilled %d days, %d company results\n", days, companies)
+}
+
+// collectPastResults collects the results filed on a past day. The companies come from
+// that day's financial-results announcements instead of the meeting calendar, which only
+// lists forthcoming meetings, and the fundamentals are read as they stood then (see
+// quartersAsOf). Market data such as the market cap is today's.
+func collectPastResults(client *http.Client, cfg Config, day time.Time) ([]CompanyResult, []Failure, []Decision, error) {
+	items, err := pastResultItems(client, day)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("announcements: %v", err)
+	}
+	if len(items) == 0 {
+		return nil, nil, nil, errNoMeetings
+	}
+	cfg.AsOf = day
+	cfg.Scrips = loadScripMaster(client, cfg.ScripMaster)
+	items, decisions := screenItems(items, cfg, day.Format("02 Jan 2006"))
+	results, failures, fetched := collectItems(client, cfg, day.Format("02 Jan 2006"), items)
+	return results, failures, append(decisions, fetched...), nil
+}
+
+// pastResultItems lists the companies that filed financial results on day, as BSE items
+func pastResultItems(client *http.Client, day time.Time) ([]BSEItem, error) {
+	anns, err := FetchAnnouncements(client, "Result", day, day)
+	if err != nil && len(anns) == 0 {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var items []BSEItem
+	for _, a := range anns {
+		if a.ScripCode == "" || seen[a.ScripCode] || !isResultsFiling(a) {
+			continue
+		}
+		seen[a.ScripCode] = true
+		name := a.Symbol
+		if name == "" {
+			name = a.ScripCode
+		}
+		items = append(items, BSEItem{ScripCode: a.ScripCode, ShortName: name, LongName: a.LongName, MeetingDate: day.Format("02 Jan 2006")})
+	}
+	return items, nil
+}
+
+// quartersAsOf drops the leading quarters (newest first) that had not ended before asOf,
+// so a past day's report shows the quarter declared that day as the latest. Labels it
+// cannot parse are kept.
+func quartersAsOf(quarters []string, asOf time.Time) []string {
+	for len(quarters) > 0 {
+		end, ok := parseQuarterEnd(quarters[0])
+		if !ok || end.Before(asOf) {
+			break
+		}
+		quarters = quarters[1:]
+	}
+	return quarters
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// `backtest` replays the stored runs through alert rules, expressions over rowVars as in
+// notify.desktop.when, and follows the price of every company a rule fired for through
+// the runs after it, so thresholds can be tuned on past seasons rather than live.
+
+// backtestHorizons are the days after an alert its price move is measured at. Prices come
+// only with stored results, which a company gets about once a quarter, so these are the
+// horizons its next two results land near; shorter ones would almost never have a price.
+var backtestHorizons = []int{90, 180}
+
+// alertRule is a named alert expression
+type alertRule struct {
+	Name string
+	When *Expr
+}
+
+// loadRules reads a rules file: a JSON object or a flat YAML mapping of rule name to
+// expression, one per line ("big jump: np_growth >= 30 && rev_growth > 10"), values
+// optionally quoted and # starting a comment. YAML rules keep their file order.
+func loadRules(path string) ([]alertRule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var names, exprs []string
+	if strings.HasPrefix(strings.TrimSpace(string(b)), "{") {
+		var m map[string]string
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			exprs = append(exprs, m[name])
+		}
+	} else {
+		sc := bufio.NewScanner(strings.NewReader(string(b)))
+		for n := 1; sc.Scan(); n++ {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+				continue
+			}
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: want \"name: expression\"", path, n)
+			}
+			name, value = unquoteYAML(strings.TrimSpace(name)), strings.TrimSpace(value)
+			if strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "'") {
+				value = unquoteYAML(value)
+			} else if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			names, exprs = append(names, name), append(exprs, value)
+		}
+	}
+	var rules []alertRule
+	for i, name := range names {
+		e, err := ParseExpr(exprs[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %q: %v", path, name, err)
+		}
+		rules = append(rules, alertRule{Name: name, When: e})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s: no rules", path)
+	}
+	return rules, nil
+}
+
+// unquoteYAML strips the quotes of a double- or single-quoted YAML scalar
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// backtestAlert is one alert a rule would have sent, with the price after it
+type backtestAlert struct {
+	Rule   string
+	Date   string // run the alert fires in, 2006-01-02
+	Result CompanyResult
+	Moves  []float64 // % price change at each of backtestHorizons, NaN when unknown
+	Latest float64   // % price change to the latest stored run of the company
+	Last   string    // date of that run
+}
+
+// sameCompany reports whether two stored results are of the same company
+func sameCompany(a, b CompanyResult) bool {
+	if a.ScripCode != "" && b.ScripCode != "" {
+		return a.ScripCode == b.ScripCode
+	}
+	return strings.EqualFold(a.Company, b.Company)
+}
+
+// priceMove is the % change from price p0 to p1, NaN when either is unknown
+func priceMove(p0, p1 float64) float64 {
+	if !(p0 > 0) || !(p1 > 0) {
+		return math.NaN()
+	}
+	return (p1/p0 - 1) * 100
+}
+
+// Backtest replays runs (any order) dated from..to (2006-01-02, empty for open) through the
+// rules, as the alerts would see them: only watchlist companies when watchlistOnly. Price
+// moves come from the prices stored with the company's later results, the run nearest each
+// horizon within half of it, so they are only as dense as the runs the company appears in.
+func Backtest(runs []RunRecord, rules []alertRule, watchlist []string, watchlistOnly bool, zeroBase, from, to string) ([]backtestAlert, error) {
+	runs = append([]RunRecord(nil), runs...)
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Date < runs[j].Date })
+	var alerts []backtestAlert
+	for ri, run := range runs {
+		if (from != "" && run.Date < from) || (to != "" && run.Date > to) {
+			continue
+		}
+		results := run.Results
+		if watchlistOnly {
+			results = nil
+			for _, r := range run.Results {
+				if inWatchlist(watchlist, r.Company) {
+					results = append(results, r)
+				}
+			}
+		}
+		day, err := time.Parse("2006-01-02", run.Date)
+		if err != nil {
+			continue
+		}
+		for _, rule := range rules {
+			for _, r := range results {
+				ok, err := rule.When.EvalBool(rowVars(r, watchlist, zeroBase))
+				if err != nil {
+					return nil, fmt.Errorf("rule %q: %s %s: %v", rule.Name, run.Date, r.Company, err)
+				}
+				if !ok {
+					continue
+				}
+				a := backtestAlert{Rule: rule.Name, Date: run.Date, Result: r, Latest: math.NaN()}
+				a.Moves = make([]float64, len(backtestHorizons))
+				off := make([]float64, len(backtestHorizons)) // days the price used is off the horizon
+				for i := range a.Moves {
+					a.Moves[i], off[i] = math.NaN(), math.Inf(1)
+				}
+				for _, later := range runs[ri+1:] {
+					for _, lr := range later.Results {
+						if !sameCompany(r, lr) || !(lr.Price > 0) {
+							continue
+						}
+						t, _ := time.Parse("2006-01-02", later.Date)
+						for i, h := range backtestHorizons {
+							d := math.Abs(t.Sub(day.AddDate(0, 0, h)).Hours() / 24)
+							if d <= float64(h)/2 && d < off[i] {
+								a.Moves[i], off[i] = priceMove(r.Price, lr.Price), d
+							}
+						}
+						a.Latest, a.Last = priceMove(r.Price, lr.Price), later.Date
+						break
+					}
+				}
+				alerts = append(alerts, a)
+			}
+		}
+	}
+	return alerts, nil
+}
+
+// writeBacktest prints every alert and, per rule, the alert count with the median move,
+// the share of rising prices and how many alerts had a price at each horizon
+func writeBacktest(w io.Writer, rules []alertRule, alerts []backtestAlert, zeroBase string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	head := "RULE\tDATE\tCOMPANY\tQUARTER\tREV %Δ\tNP %Δ\tPRICE"
+	for _, h := range backtestHorizons {
+		head += fmt.Sprintf("\t+%dD", h)
+	}
+	fmt.Fprintln(tw, head+"\tLATEST")
+	for _, a := range alerts {
+		rev, np := latestGrowth(a.Result, zeroBase)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s", a.Rule, a.Date, a.Result.Company, firstQuarter(a.Result), rev, np, fmtNum(a.Result.Price))
+		for _, m := range a.Moves {
+			fmt.Fprintf(tw, "\t%s", fmtPct(m))
+		}
+		latest := fmtPct(a.Latest)
+		if a.Last != "" {
+			latest += " (" + a.Last + ")"
+		}
+		fmt.Fprintf(tw, "\t%s\n", latest)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	head = "RULE\tALERTS"
+	for _, h := range backtestHorizons {
+		head += fmt.Sprintf("\tMEDIAN +%dD\tUP +%dD\tPRICED +%dD", h, h, h)
+	}
+	fmt.Fprintln(tw, head)
+	for _, rule := range rules {
+		var fired []backtestAlert
+		for _, a := range alerts {
+			if a.Rule == rule.Name {
+				fired = append(fired, a)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d", rule.Name, len(fired))
+		for i := range backtestHorizons {
+			var moves []float64
+			up := 0
+			for _, a := range fired {
+				if m := a.Moves[i]; !math.IsNaN(m) {
+					moves = append(moves, m)
+					if m > 0 {
+						up++
+					}
+				}
+			}
+			upShare := "-"
+			if len(moves) > 0 {
+				upShare = fmt.Sprintf("%d/%d", up, len(moves))
+			}
+			fmt.Fprintf(tw, "\t%s\t%s\t%d/%d", fmtPct(quantile(validSorted(moves), 0.5)), upShare, len(moves), len(fired))
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+// runBacktest implements `quarter-compare backtest`
+func runBacktest(args []string) {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	rulesPath := fs.String("rules", "", "rules file: YAML or JSON mapping of rule name to alert expression (default: notify.desktop.when)")
+	from := fs.String("from", "", "replay runs from this date (2006-01-02)")
+	to := fs.String("to", "", "replay runs up to this date (2006-01-02)")
+	all := fs.Bool("all", false, "replay every company, even with notify.watchlist_only set")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: quarter-compare backtest [-rules rules.yaml] [-from 2006-01-02] [-to 2006-01-02] [-all]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	for _, d := range []string{*from, *to} {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			log.Fatalf("backtest: bad date %q (want 2006-01-02)", d)
+		}
+	}
+	cfg := mustLoadConfig(*configPath)
+
+	var rules []alertRule
+	if *rulesPath != "" {
+		var err error
+		if rules, err = loadRules(*rulesPath); err != nil {
+			log.Fatalf("backtest: %v", err)
+		}
+	} else {
+		when := cfg.Notify.Desktop.When
+		if when == "" {
+			when = defaultDesktopWhen
+		}
+		e, err := ParseExpr(when)
+		if err != nil {
+			log.Fatalf("backtest: notify.desktop.when: %v", err)
+		}
+		rules = []alertRule{{Name: "desktop", When: e}}
+	}
+
+	runs, err := LoadHistory()
+	if err != nil {
+		log.Fatalf("load history: %v", err)
+	}
+	alerts, err := Backtest(runs, rules, cfg.Watchlist, cfg.Notify.WatchlistOnly && !*all, cfg.ZeroBase, *from, *to)
+	if err != nil {
+		log.Fatalf("backtest: %v", err)
+	}
+	writeBacktest(os.Stdout, rules, alerts, cfg.ZeroBase)
+}
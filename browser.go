@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// fileURL returns the file:// URL of a local path
+func fileURL(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // windows: C:/x → /C:/x
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// openBrowser opens target in the default browser without waiting for it
+func openBrowser(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// showReport opens a written report in the browser with -open, else (or when no browser
+// could be launched) prints its file:// URL
+func showReport(path string, open bool) {
+	u := fileURL(path)
+	if open {
+		err := openBrowser(u)
+		if err == nil {
+			return
+		}
+		log.Printf("open report: %v", err)
+	}
+	fmt.Println(u)
+}
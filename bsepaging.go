@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// On the heaviest result days the BSE calendar can run past one response: the API then
+// says how many pages or rows there are (TotalPageCnt on the rows, a ROWCNT table next to
+// them), or just stops at a round page size. bsePagingOf reads what a response says and
+// FetchBSEList follows up with the missing pages, so no company silently drops off a busy
+// date.
+
+// field names BSE responses give the page count and the row count under, on the rows or
+// beside them
+var (
+	bsePageCountKeys = []string{"TotalPageCnt", "TotalPageCount", "TOTAL_PAGES", "totalPages", "PageCount"}
+	bseRowCountKeys  = []string{"ROWCNT", "RowCnt", "TotalRecords", "TOTAL_RECORDS", "totalRecords", "TotalCount", "total_count"}
+)
+
+// bsePageSizes are the page sizes a silently truncated list tends to stop at
+var bsePageSizes = map[int]bool{50: true, 100: true, 200: true, 250: true, 500: true, 1000: true}
+
+const (
+	maxBSEPages    = 20 // follow-up pages fetched at most
+	bsePageWorkers = 4
+)
+
+// bsePaging is what a BSE list response says about its paging; zero when it says nothing
+type bsePaging struct {
+	Pages int // total pages
+	Rows  int // total rows over all pages
+}
+
+// bsePagingOf reads the paging of a BSE list response: page and row counts on its object,
+// on its rows or in a one-row side table ({"Table": [...], "Table1": [{"ROWCNT": 312}]})
+func bsePagingOf(b []byte) bsePaging {
+	var v interface{}
+	if json.Unmarshal(b, &v) != nil {
+		return bsePaging{}
+	}
+	var p bsePaging
+	look := func(m map[string]interface{}) {
+		p.Pages = max(p.Pages, bseInt(m, bsePageCountKeys))
+		p.Rows = max(p.Rows, bseInt(m, bseRowCountKeys))
+	}
+	rows := func(list []interface{}) {
+		// the counts are repeated on every row; the first says it
+		if len(list) > 0 {
+			if m, ok := list[0].(map[string]interface{}); ok {
+				look(m)
+			}
+		}
+	}
+	switch x := v.(type) {
+	case []interface{}:
+		rows(x)
+	case map[string]interface{}:
+		look(x)
+		for _, val := range x {
+			if list, ok := val.([]interface{}); ok {
+				rows(list)
+			}
+		}
+	}
+	return p
+}
+
+// bseInt is the first of the named fields of m holding a whole number
+func bseInt(m map[string]interface{}, names []string) int {
+	for _, n := range names {
+		switch x := m[n].(type) {
+		case float64:
+			return int(x)
+		case string:
+			if i, err := strconv.Atoi(x); err == nil {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// bsePageURL is endpoint asking for page n (pageno, as the BSE APIs name it)
+func bsePageURL(endpoint string, n int) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	q := u.Query()
+	q.Set("pageno", strconv.Itoa(n))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// bseItemKey identifies a meeting across pages
+func bseItemKey(it BSEItem) string {
+	return it.ScripCode + "|" + it.ShortName + "|" + it.MeetingDate
+}
+
+// followBSEPages completes first, the items of page 1 of endpoint, when the response (b)
+// says there are more pages or rows, or stops at a round page size. Pages the response
+// counts are fetched bsePageWorkers at a time; an unannounced next page is tried once, and
+// followed only while it brings new meetings (some endpoints ignore pageno and repeat
+// page 1). A page that fails is logged and what was fetched kept.
+func followBSEPages(client *http.Client, endpoint string, b []byte, first []BSEItem) []BSEItem {
+	if len(first) == 0 {
+		return first
+	}
+	paging := bsePagingOf(b)
+	pages := paging.Pages
+	if pages <= 1 && paging.Rows > len(first) {
+		pages = (paging.Rows + len(first) - 1) / len(first)
+	}
+	pages = min(pages, maxBSEPages)
+
+	seen := map[string]bool{}
+	out := make([]BSEItem, 0, len(first))
+	add := func(items []BSEItem) (fresh int) {
+		for _, it := range items {
+			if k := bseItemKey(it); !seen[k] {
+				seen[k] = true
+				out = append(out, it)
+				fresh++
+			}
+		}
+		return fresh
+	}
+	add(first)
+
+	if pages > 1 {
+		results := make([][]BSEItem, pages+1)
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, bsePageWorkers)
+		for n := 2; n <= pages; n++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(n int) {
+				defer func() { <-sem; wg.Done() }()
+				items, err := FetchBSEPage(client, bsePageURL(endpoint, n))
+				if err != nil {
+					log.Printf("followBSEPages: page %d of %d: %v", n, pages, err)
+					return
+				}
+				results[n] = items
+			}(n)
+		}
+		wg.Wait()
+		for _, items := range results[2:] {
+			add(items)
+		}
+	} else if paging == (bsePaging{}) && bsePageSizes[len(first)] {
+		// exactly a page size and nothing said: possibly cut off
+		for n := 2; n <= maxBSEPages; n++ {
+			items, err := FetchBSEPage(client, bsePageURL(endpoint, n))
+			if err != nil {
+				log.Printf("followBSEPages: %d meetings, a round page size, but page %d failed: %v", len(first), n, err)
+				break
+			}
+			if add(items) == 0 {
+				if n == 2 {
+					log.Printf("followBSEPages: %d meetings, a round page size, and the endpoint does not page; the list may be cut off", len(first))
+				}
+				break
+			}
+			log.Printf("followBSEPages: page %d of the BSE list added %d meetings", n, len(items))
+		}
+	}
+	if paging.Rows > len(out) {
+		log.Printf("followBSEPages: BSE lists %d meetings but %d could be fetched; busy dates may be incomplete", paging.Rows, len(out))
+	}
+	return out
+}
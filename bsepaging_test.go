@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bseMeetings is a BSE calendar page of n meetings numbered from off, each carrying extra
+// fields (e.g. `"TotalPageCnt":3`)
+func bseMeetings(n, off int, extra string) string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = fmt.Sprintf(`{"scrip_Code":"%d","short_name":"C%d","meeting_date":"20 Oct 2026"%s}`, 500000+off+i, off+i, extra)
+	}
+	return "[" + strings.Join(rows, ",") + "]"
+}
+
+func TestBSEPagingOf(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want bsePaging
+	}{
+		{"plain list", bseMeetings(3, 0, ""), bsePaging{}},
+		{"count on the rows", bseMeetings(2, 0, `,"TotalPageCnt":3`), bsePaging{Pages: 3}},
+		{"count as a string", bseMeetings(2, 0, `,"TotalPageCnt":"4"`), bsePaging{Pages: 4}},
+		{"row count table", `{"Table":` + bseMeetings(2, 0, "") + `,"Table1":[{"ROWCNT":312}]}`, bsePaging{Rows: 312}},
+		{"counts on the object", `{"totalPages":2,"totalRecords":150,"data":` + bseMeetings(2, 0, "") + `}`, bsePaging{Pages: 2, Rows: 150}},
+		{"empty table", `{"Table":[]}`, bsePaging{}},
+		{"HTML", `<html>Access Denied</html>`, bsePaging{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := bsePagingOf([]byte(c.body)); got != c.want {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFollowBSEPages(t *testing.T) {
+	log.SetOutput(io.Discard) // short and failed pages are logged
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// each endpoint answers page n (1 without pageno) of a list
+	endpoints := map[string]func(n int) string{
+		// three pages counted on the rows, the last one short
+		"/counted": func(n int) string {
+			if n == 3 {
+				return bseMeetings(10, 100, `,"TotalPageCnt":3`)
+			}
+			return bseMeetings(50, 50*(n-1), `,"TotalPageCnt":3`)
+		},
+		// 80 rows in a side table, 50 a page
+		"/rowcnt": func(n int) string {
+			if n == 2 {
+				return `{"Table":` + bseMeetings(30, 50, "") + `,"Table1":[{"ROWCNT":80}]}`
+			}
+			return `{"Table":` + bseMeetings(50, 0, "") + `,"Table1":[{"ROWCNT":80}]}`
+		},
+		// cut off at 100 without saying so; page 3 is empty
+		"/truncated": func(n int) string {
+			if n >= 3 {
+				return "[]"
+			}
+			return bseMeetings(100, 100*(n-1), "")
+		},
+		// 100 meetings and pageno ignored: every page repeats page 1
+		"/ignores-pageno": func(n int) string { return bseMeetings(100, 0, "") },
+		// pages overlap by a meeting
+		"/overlapping": func(n int) string {
+			return bseMeetings(50, 49*(n-1), `,"TotalPageCnt":2`)
+		},
+		// a small list is not a page
+		"/small": func(n int) string { return bseMeetings(37, 0, "") },
+		// page 2 of a counted list fails
+		"/failing": func(n int) string {
+			if n == 2 {
+				return "<html>busy</html>"
+			}
+			return bseMeetings(50, 50*(n-1), `,"TotalPageCnt":3`)
+		},
+	}
+	var mu sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := 1
+		if p := r.URL.Query().Get("pageno"); p != "" {
+			n, _ = strconv.Atoi(p)
+		}
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		fmt.Fprint(w, endpoints[r.URL.Path](n))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		path     string
+		want     int // meetings
+		requests int
+	}{
+		{"/counted", 110, 3},
+		{"/rowcnt", 80, 2},
+		{"/truncated", 200, 3},
+		{"/ignores-pageno", 100, 2},
+		{"/overlapping", 99, 2},
+		{"/small", 37, 1},
+		{"/failing", 100, 3},
+	}
+	for _, c := range cases {
+		t.Run(strings.TrimPrefix(c.path, "/"), func(t *testing.T) {
+			items, err := FetchBSEList(srv.Client(), srv.URL+c.path+"?strCat=-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := map[string]bool{}
+			for _, it := range items {
+				if seen[bseItemKey(it)] {
+					t.Errorf("%s listed twice", it.ShortName)
+				}
+				seen[bseItemKey(it)] = true
+			}
+			if len(items) != c.want || requests[c.path] != c.requests {
+				t.Errorf("got %d meetings in %d requests, want %d in %d", len(items), requests[c.path], c.want, c.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// errOutOfTime marks companies left unfetched because the run deadline passed
+var errOutOfTime = errors.New("skipped: run deadline (max_duration) reached")
+
+// errInterrupted marks companies left unfetched because the run was interrupted
+var errInterrupted = errors.New("skipped: run interrupted")
+
+// interrupted is set by the first interrupt during a fetch (see catchInterrupt)
+var interrupted atomic.Bool
+
+// pastDeadline reports whether deadline is set and has passed, or the run was interrupted
+func pastDeadline(deadline time.Time) bool {
+	return interrupted.Load() || !deadline.IsZero() && time.Now().After(deadline)
+}
+
+// catchInterrupt makes an interrupt (Ctrl-C) end the fetch like a passed deadline: no new
+// companies are started and the report is written from those done. A second interrupt
+// quits at once. stop restores the default handling.
+func catchInterrupt() (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sig:
+				if interrupted.Swap(true) {
+					log.Printf("catchInterrupt: interrupted again, quitting")
+					os.Exit(130)
+				}
+				log.Printf("catchInterrupt: finishing the companies in progress; interrupt again to quit")
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sig)
+		close(done)
+		interrupted.Store(false)
+	}
+}
+
+// skipReason is why the companies cut off by pastDeadline were not fetched
+func skipReason() error {
+	if interrupted.Load() {
+		return errInterrupted
+	}
+	return errOutOfTime
+}
+
+// runDeadline is the fetch deadline of a run started at start; zero when unbounded
+func runDeadline(cfg Config, start time.Time) time.Time {
+	d := cfg.maxDuration()
+	if d <= 0 {
+		return time.Time{}
+	}
+	return start.Add(d)
+}
+
+// prioritizeItems orders items the way they are fetched: companies whose results have
+// landed (see Config.Landed; the latest first), then watchlist companies, then the
+// largest market caps known from the metadata cache; the rest keep BSE's order. The
+// workers take companies in this order, so a deadline, an interrupt or a rate limit cuts
+// off the least wanted first.
+func prioritizeItems(items []BSEItem, watchlist []string, landed map[string]time.Time, meta *metaCache) []BSEItem {
+	mcap := func(itm BSEItem) float64 {
+		if m, ok, _ := meta.get(symbolKey(itm)); ok && m.MarketCap != nil {
+			return *m.MarketCap
+		}
+		return math.NaN()
+	}
+	ranked := append([]BSEItem(nil), items...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if la, lb := landed[a.ScripCode], landed[b.ScripCode]; !la.Equal(lb) {
+			return la.After(lb) // the latest results first
+		}
+		wa, wb := inWatchlist(watchlist, a.ShortName, a.ScripCode), inWatchlist(watchlist, b.ShortName, b.ScripCode)
+		if wa != wb {
+			return wa
+		}
+		ma, mb := mcap(a), mcap(b)
+		if math.IsNaN(ma) || math.IsNaN(mb) {
+			return !math.IsNaN(ma) && math.IsNaN(mb)
+		}
+		return ma > mb
+	})
+	return ranked
+}
+
+// limitItems orders items with prioritizeItems and keeps at most limit of them (limit <=
+// 0: all)
+func limitItems(items []BSEItem, limit int, watchlist []string, landed map[string]time.Time, meta *metaCache) (kept, skipped []BSEItem) {
+	ranked := prioritizeItems(items, watchlist, landed, meta)
+	if limit <= 0 || len(ranked) <= limit {
+		return ranked, nil
+	}
+	log.Printf("limitItems: fetching %d of %d companies", limit, len(items))
+	return ranked[:limit], ranked[limit:]
+}
+
+// skippedFailures reports items that were not fetched at all
+func skippedFailures(items []BSEItem, reason string) []Failure {
+	var out []Failure
+	for _, itm := range items {
+		out = append(out, Failure{Company: itm.ShortName, LongName: itm.LongName, Error: reason})
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+)
+
+// calendarMonths bounds the months of the result-day calendar
+const calendarMonths = 3
+
+// calendarListed is how many companies a day's cell names; the rest are in its tooltip
+const calendarListed = 3
+
+// calendarDay is one day of the result-day calendar
+type calendarDay struct {
+	Count     int
+	Watchlist []string // watchlist companies meeting that day
+	Names     []string // every company meeting that day
+}
+
+// resultDays counts the meetings of items per day (2006-01-02)
+func resultDays(items []BSEItem, watchlist []string) map[string]*calendarDay {
+	days := map[string]*calendarDay{}
+	for _, it := range items {
+		t, err := time.Parse("02 Jan 2006", it.MeetingDate)
+		if err != nil {
+			continue
+		}
+		key := t.Format("2006-01-02")
+		d := days[key]
+		if d == nil {
+			d = &calendarDay{}
+			days[key] = d
+		}
+		d.Count++
+		d.Names = append(d.Names, it.ShortName)
+		if inWatchlist(watchlist, it.ShortName, it.ScripCode) {
+			d.Watchlist = append(d.Watchlist, it.ShortName)
+		}
+	}
+	return days
+}
+
+// calendarColor shades a day by its share of the busiest day's meetings
+func calendarColor(count, most int) string {
+	if count == 0 || most == 0 {
+		return ""
+	}
+	light := 92 - 50*count/most
+	text := ""
+	if light < 60 {
+		text = ";color:#fff"
+	}
+	return fmt.Sprintf(" style='background:hsl(210,70%%,%d%%)%s'", light, text)
+}
+
+// RenderResultCalendar builds a month-view page of items, the meetings of the forthcoming
+// results feed, from the month of from on: each day colored by how many companies meet
+// then, with the watchlist companies among them named, so heavy evenings stand out
+func RenderResultCalendar(items []BSEItem, watchlist []string, from time.Time) string {
+	days := resultDays(items, watchlist)
+	most, last := 0, from
+	for key, d := range days {
+		most = max(most, d.Count)
+		if t, _ := time.Parse("2006-01-02", key); t.After(last) {
+			last = t
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<!doctype html><html lang='en'><head><meta charset='utf-8'><title>Result calendar</title>")
+	sb.WriteString(styleTag("calendar.css") + "</head><body>")
+	sb.WriteString("<h2>Result calendar</h2>")
+	sb.WriteString(fmt.Sprintf("<p class='small'>%d result board meetings from the BSE forthcoming-results list as of %s; the darker a day, the more companies report. Watchlist companies are named in bold; hover a day for all of them.</p>",
+		len(items), html.EscapeString(from.Format("02 Jan 2006 15:04"))))
+
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	today := from.Format("2006-01-02")
+	for n := 0; n < calendarMonths && !month.After(last); n++ {
+		sb.WriteString("<h3>" + month.Format("January 2006") + "</h3>")
+		sb.WriteString("<table class='calendar'><thead><tr><th>Mon</th><th>Tue</th><th>Wed</th><th>Thu</th><th>Fri</th><th>Sat</th><th>Sun</th></tr></thead><tbody><tr>")
+		lead := (int(month.Weekday()) + 6) % 7 // Monday first
+		sb.WriteString(strings.Repeat("<td class='pad'></td>", lead))
+		for day := month; day.Month() == month.Month(); day = day.AddDate(0, 0, 1) {
+			if day.Weekday() == time.Monday && day.Day() != 1 {
+				sb.WriteString("</tr><tr>")
+			}
+			key := day.Format("2006-01-02")
+			d := days[key]
+			class := ""
+			if key == today {
+				class = " today"
+			}
+			if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+				class += " weekend"
+			}
+			if d == nil {
+				sb.WriteString("<td class='day" + class + "'><span class='num'>" + fmt.Sprint(day.Day()) + "</span></td>")
+				continue
+			}
+			names := append([]string(nil), d.Names...)
+			sort.Strings(names)
+			sb.WriteString("<td class='day" + class + "'" + calendarColor(d.Count, most) + " title='" + html.EscapeString(strings.Join(names, ", ")) + "'>")
+			sb.WriteString(fmt.Sprintf("<span class='num'>%d</span><span class='count'>%d</span>", day.Day(), d.Count))
+			for i, w := range d.Watchlist {
+				if i == calendarListed {
+					sb.WriteString(fmt.Sprintf("<span class='more'>+%d more</span>", len(d.Watchlist)-i))
+					break
+				}
+				sb.WriteString("<b>" + html.EscapeString(w) + "</b>")
+			}
+			sb.WriteString("</td>")
+		}
+		if trail := (7 - (lead+month.AddDate(0, 1, -1).Day())%7) % 7; trail > 0 {
+			sb.WriteString(strings.Repeat("<td class='pad'></td>", trail))
+		}
+		sb.WriteString("</tr></tbody></table>")
+		month = month.AddDate(0, 1, 0)
+	}
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
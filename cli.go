@@ -0,0 +1,400 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// command is one `quarter-compare <name>` subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+// commands lists the subcommands in help order; "run" is the default
+var commands = []command{
+	{"run", "fetch today's results, write the report and run configured exports (default)", runRun},
+	{"watch", "poll today's results every interval, alerting only on new or changed numbers", runWatch},
+	{"report", "regenerate the HTML report from stored history", runReport},
+	{"serve", "serve the report and stored history over HTTP", runServe},
+	{"history", "query stored results by company or date", runHistory},
+	{"backfill", "collect the results of past days (-from/-to) into the history", runBackfill},
+	{"reprocess", "re-parse a stored day from the raw response archive and rewrite its report", runReprocess},
+	{"season", "write a page of a stored day's late declarations and revisions since earlier runs", runSeason},
+	{"upcoming", "list upcoming watchlist meetings and write an .ics calendar", runUpcoming},
+	{"backtest", "replay stored history through alert rules and show the price moves after each alert", runBacktest},
+	{"kite", "import the watchlist from the holdings of a Zerodha Kite account now", runKite},
+	{"estimates", "snapshot analyst consensus estimates of companies meeting soon (run daily)", runEstimates},
+	{"compare", "fetch the given companies now, regardless of the meeting calendar", runCompare},
+	{"duel", "fetch two companies and write a side-by-side page with overlaid charts", runDuel},
+	{"publish", "add today's results to a static site, optionally commit/push it", runPublish},
+	{"plugins", "list source and sink plugins found in the plugins dir", runPlugins},
+	{"doctor", "check that BSE and trendlyne still answer in the expected shape", runDoctor},
+	{"update", "replace this binary with the latest GitHub release (checksum-verified)", runUpdate},
+	{"version", "print the version", func([]string) { fmt.Println(buildVersion()) }},
+	{"cache", "show, clear or prune cached data (cache info | cache clear | cache prune)", runCache},
+	{"scrips", "look companies up in the cached BSE scrip master (codes, ISIN, group, renames)", runScrips},
+	{"decisions", "show why each company of a day's BSE list was reported or left out", runDecisions},
+	{"assets", "copy the built-in stylesheets and scripts into a dir, to edit and pass as -assets", runAssets},
+}
+
+// dispatch runs the subcommand named by args[0]; no name (or a leading flag) means "run"
+func dispatch(args []string) {
+	if len(args) > 0 && isHelpArg(args[0]) {
+		usage()
+		return
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runRun(args)
+		return
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			c.run(args[1:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage()
+	os.Exit(2)
+}
+
+func isHelpArg(s string) bool {
+	return s == "help" || s == "-h" || s == "-help" || s == "--help"
+}
+
+// usage prints the subcommand overview
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: quarter-compare [command] [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run `quarter-compare <command> -h` for the flags of a command")
+}
+
+// runRun implements `quarter-compare run`: today's results, report and exports
+func runRun(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	filterFlag := fs.String("filter", "", "only keep rows matching this expression, e.g. 'np_growth > 20' (default: config filter)")
+	dumpRawFlag := fs.String("dump-raw", "", "save raw trendlyne pages and fundamentals JSON per company under this dir")
+	sortFlag := fs.String("sort-by", "", "row order: company, np-growth, rev-growth or mcap (default: config sort_by, else company)")
+	maxDuration := fs.Duration("max-duration", 0, "stop fetching after this long, e.g. 10m; unfetched companies are reported as skipped (default: config max_duration)")
+	limit := fs.Int("limit", 0, "fetch at most this many companies, watchlist and largest market caps first (default: config limit)")
+	purposeFlag := fs.String("purpose", "", "also fetch board meetings whose purpose contains one of these, comma-separated, e.g. 'dividend,fund raising' or 'all' (default: config purposes)")
+	openFlag := fs.Bool("open", false, "open the report in the default browser when written")
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+	cfg := mustLoadConfig(*configPath)
+	if *purposeFlag != "" {
+		cfg.Purposes = strings.Split(*purposeFlag, ",")
+	}
+	if *dumpRawFlag != "" {
+		cfg.DumpRaw = *dumpRawFlag
+	}
+	if *sortFlag != "" {
+		cfg.SortBy = *sortFlag
+	}
+	if *maxDuration > 0 {
+		cfg.MaxDuration = maxDuration.String()
+	}
+	if *limit > 0 {
+		cfg.Limit = *limit
+	}
+	filter := mustFilter(*filterFlag, cfg)
+	opts := mustReportOptions(cfg)
+
+	// create HTTP client with cookie jar
+	client := NewHTTPClient(cfg)
+
+	today := time.Now().Format("02 Jan 2006")
+	results, failures, decisions, err := collectResults(client, cfg, today)
+	if errors.Is(err, errNoMeetings) {
+		SaveDecisions(isoDate(today), filter, decisions)
+		fmt.Println("no meetings for today:", today)
+		return
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	db, err := openHistory()
+	if err != nil {
+		log.Printf("open history: %v", err)
+	} else {
+		defer db.Close()
+		if err := saveRun(db, RunRecord{Date: isoDate(today), Results: results, Failures: failures}); err != nil {
+			log.Printf("save history: %v", err)
+		}
+	}
+	results = filterOrAll(filter, cfg, results)
+	markFiltered(decisions, filter, results)
+	SaveDecisions(isoDate(today), filter, decisions)
+
+	// generate HTML report
+	outPath, err := reportPath(cfg)
+	if err != nil {
+		log.Fatalf("cannot determine output path: %v", err)
+	}
+	if err := GenerateHTMLReport(outPath, results, failures, opts.withHistory(db, isoDate(today))); err != nil {
+		log.Fatalf("generate report: %v", err)
+	}
+	fmt.Println("report saved to", outPath)
+	showReport(outPath, *openFlag)
+
+	runExports(cfg, today, results, failures, outPath)
+	RunHooks(cfg.Hooks, cfg.Watchlist, today, results)
+	if err := Notify(client, cfg.Notify, cfg.Watchlist, cfg.ZeroBase, today, results, failures, outPath); err != nil {
+		log.Printf("notify: %v", err)
+	}
+}
+
+// runExports runs the optional publishing targets and exporters enabled in cfg
+func runExports(cfg Config, date string, results []CompanyResult, failures []Failure, outPath string) {
+	client := NewHTTPClient(cfg)
+	if cfg.SFTP.Host != "" {
+		if err := UploadSFTP(cfg.SFTP, outPath); err != nil {
+			log.Printf("sftp upload failed: %v", err)
+		} else {
+			fmt.Println("report uploaded to", cfg.SFTP.Host)
+		}
+	}
+	rows := BuildExportRows(date, results, cfg.ZeroBase)
+	if cfg.Sheets.SpreadsheetID != "" {
+		if err := AppendToSheet(client, cfg.Sheets, rows); err != nil {
+			log.Printf("google sheets export failed: %v", err)
+		} else {
+			fmt.Printf("appended %d rows to google sheet\n", len(rows))
+		}
+	}
+	if cfg.Notion.DatabaseID != "" {
+		if err := PushToNotion(client, cfg.Notion, rows, "file://"+filepath.ToSlash(outPath)); err != nil {
+			log.Printf("notion export failed: %v", err)
+		} else {
+			fmt.Printf("pushed %d rows to notion\n", len(rows))
+		}
+	}
+	if cfg.Kafka.RestURL != "" && cfg.Kafka.Topic != "" {
+		if err := ProduceKafka(client, cfg.Kafka, rows); err != nil {
+			log.Printf("kafka export failed: %v", err)
+		} else {
+			fmt.Printf("produced %d events to kafka topic %s\n", len(rows), cfg.Kafka.Topic)
+		}
+	}
+	if cfg.ClickHouse.URL != "" {
+		qrows := BuildQuarterRows(date, results)
+		if err := InsertClickHouse(client, cfg.ClickHouse, qrows); err != nil {
+			log.Printf("clickhouse export failed: %v", err)
+		} else {
+			fmt.Printf("inserted %d quarter rows into clickhouse\n", len(qrows))
+		}
+	}
+	if cfg.MQTT.Broker != "" {
+		if err := PublishMQTT(cfg.MQTT, date, results, failures, cfg.ZeroBase); err != nil {
+			log.Printf("mqtt publish failed: %v", err)
+		} else {
+			fmt.Printf("published %d results to mqtt\n", len(results))
+		}
+	}
+	plugins, err := DiscoverPlugins(cfg.Plugins)
+	if err != nil {
+		log.Printf("plugins: %v", err)
+	}
+	RunSinkPlugins(cfg.Plugins, plugins, date, results)
+}
+
+// runReport implements `quarter-compare report`: rebuild the HTML report from history
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	date := fs.String("date", "", "stored day to render (2006-01-02, default: latest)")
+	out := fs.String("o", "", "output file (default: config output, else <app dir>/report.html)")
+	filterFlag := fs.String("filter", "", "only keep rows matching this expression, e.g. 'np_growth > 20' (default: config filter)")
+	sortFlag := fs.String("sort-by", "", "row order: company, np-growth, rev-growth or mcap (default: config sort_by, else company)")
+	openFlag := fs.Bool("open", false, "open the report in the default browser when written")
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+	cfg := mustLoadConfig(*configPath)
+	if *sortFlag != "" {
+		cfg.SortBy = *sortFlag
+	}
+	filter := mustFilter(*filterFlag, cfg)
+
+	db, err := openHistory()
+	if err != nil {
+		log.Fatalf("open history: %v", err)
+	}
+	defer db.Close()
+	run, ok, err := storedRun(db, *date)
+	if err != nil {
+		log.Fatalf("load history: %v", err)
+	}
+	if !ok {
+		log.Fatalf("no stored results for %q; see `quarter-compare history`", *date)
+	}
+	if *out == "" {
+		if *out, err = reportPath(cfg); err != nil {
+			log.Fatalf("cannot determine output path: %v", err)
+		}
+	}
+	if err := GenerateHTMLReport(*out, filterOrAll(filter, cfg, run.Results), run.Failures, mustReportOptions(cfg).withHistory(db, run.Date)); err != nil {
+		log.Fatalf("generate report: %v", err)
+	}
+	fmt.Printf("report for %s saved to %s\n", run.Date, *out)
+	showReport(*out, *openFlag)
+}
+
+// findRun returns the run stored for date, or the newest run when date is empty
+func findRun(runs []RunRecord, date string) (RunRecord, bool) {
+	for _, run := range runs {
+		if date == "" || run.Date == date {
+			return run, true
+		}
+	}
+	return RunRecord{}, false
+}
+
+// runCompare implements `quarter-compare compare TICKER...`: fetch the named companies
+// right away and write a report for just them
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	out := fs.String("o", "", "output file (default: <app dir>/compare.html)")
+	dumpRawFlag := fs.String("dump-raw", "", "save raw trendlyne pages and fundamentals JSON per company under this dir")
+	filterFlag := fs.String("filter", "", "only keep rows matching this expression, e.g. 'np_growth > 20' (default: config filter)")
+	sortFlag := fs.String("sort-by", "", "row order: company, np-growth, rev-growth or mcap (default: config sort_by, else company)")
+	openFlag := fs.Bool("open", false, "open the report in the default browser when written")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: quarter-compare compare [-config file] [-o file] [-filter expr] [-sort-by key] [-assets dir] [-open] TICKER|BSECODE [...]")
+		fs.PrintDefaults()
+	}
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg := mustLoadConfig(*configPath)
+	if *dumpRawFlag != "" {
+		cfg.DumpRaw = *dumpRawFlag
+	}
+	if *sortFlag != "" {
+		cfg.SortBy = *sortFlag
+	}
+	filter := mustFilter(*filterFlag, cfg)
+	if *out == "" {
+		dir, err := getAppDir()
+		if err != nil {
+			log.Fatalf("cannot determine app dir: %v", err)
+		}
+		*out = filepath.Join(dir, "compare.html")
+	}
+
+	client := NewHTTPClient(cfg)
+	if err := TrendlyneLogin(client, cfg.Trendlyne); err != nil {
+		log.Printf("compare: trendlyne login failed, continuing anonymously: %v", err)
+	}
+	plugins, err := DiscoverPlugins(cfg.Plugins)
+	if err != nil {
+		log.Printf("compare: plugins: %v", err)
+	}
+	caches := loadLookupCaches()
+	scrips := loadScripMaster(client, cfg.ScripMaster)
+	var results []CompanyResult
+	var failures []Failure
+	var items []BSEItem
+	for _, ticker := range fs.Args() {
+		itm := tickerItem(ticker, scrips)
+		items = append(items, itm)
+		cr, err := fetchCompany(client, cfg, plugins, caches, itm)
+		if err != nil {
+			log.Printf("compare: skipping %s: %v", ticker, err)
+			failures = append(failures, Failure{Company: ticker, Error: err.Error()})
+			continue
+		}
+		results = append(results, cr)
+	}
+	caches.save("compare")
+	if len(results) == 0 {
+		log.Fatalf("compare: no company could be fetched")
+	}
+	attachScrips(results, items, scrips)
+	results = filterOrAll(filter, cfg, results)
+	if err := GenerateHTMLReport(*out, results, failures, mustReportOptions(cfg)); err != nil {
+		log.Fatalf("generate report: %v", err)
+	}
+	fmt.Println("comparison saved to", *out)
+	showReport(*out, *openFlag)
+}
+
+// cacheDir returns <app dir>/cache, creating it if needed. It holds data that can be
+// refetched at any time, unlike history.
+func cacheDir() (string, error) {
+	appDir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(appDir, "cache")
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// runCache implements `quarter-compare cache info|clear|prune`
+func runCache(args []string) {
+	dir, err := cacheDir()
+	if err != nil {
+		log.Fatalf("cannot determine cache dir: %v", err)
+	}
+	action := "info"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "info":
+		files, size := 0, int64(0)
+		filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if fi, err := d.Info(); err == nil {
+					files++
+					size += fi.Size()
+				}
+			}
+			return nil
+		})
+		fmt.Printf("cache dir: %s\n%d files, %.1f KiB\n", dir, files, float64(size)/1024)
+	case "clear":
+		if err := os.RemoveAll(dir); err != nil {
+			log.Fatalf("clear cache: %v", err)
+		}
+		fmt.Println("cache cleared:", dir)
+	case "prune":
+		fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+		configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+		days := fs.Int("days", 0, "keep this many days of archived responses (default: config archive.retention_days)")
+		fs.Parse(args[1:])
+		cfg := mustLoadConfig(*configPath)
+		if *days <= 0 {
+			*days = cfg.Archive.RetentionDays
+		}
+		removed, err := pruneArchive(cfg.Archive, *days, time.Now())
+		if err != nil {
+			log.Fatalf("prune archive: %v", err)
+		}
+		fmt.Printf("removed %d archived days older than %d days\n", removed, *days)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: quarter-compare cache info|clear|prune [-days N]")
+		os.Exit(2)
+	}
+}
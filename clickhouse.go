@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ClickHouseConfig inserts the per-quarter rows (see QuarterRow) into a ClickHouse table
+// over its HTTP interface, for ad-hoc SQL over everything collected
+type ClickHouseConfig struct {
+	URL      string `json:"url"`      // e.g. http://localhost:8123
+	Database string `json:"database"` // default "default"
+	Table    string `json:"table"`    // default quarter_results; created when missing
+	User     string `json:"user"`
+	Password string `json:"password" secret:"true"`
+}
+
+// clickHouseIdent is what table and database names may look like; they are spliced into SQL
+var clickHouseIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// clickHouseSchema creates the table. A company's quarter is stored again by every run
+// that sees it; ReplacingMergeTree keeps the latest run's numbers (use FINAL, or argMax
+// over date, to read them before the merge).
+const clickHouseSchema = `CREATE TABLE IF NOT EXISTS %s (
+	date Date,
+	company String,
+	long_name String,
+	sector LowCardinality(String),
+	quarter String,
+	quarter_end Nullable(Date),
+	revenue Nullable(Float64),
+	net_profit Nullable(Float64)
+) ENGINE = ReplacingMergeTree(date) ORDER BY (company, quarter)`
+
+// table returns the table name, default quarter_results
+func (c ClickHouseConfig) table() string {
+	if c.Table != "" {
+		return c.Table
+	}
+	return "quarter_results"
+}
+
+// checkClickHouse validates the names spliced into SQL
+func checkClickHouse(c ClickHouseConfig) error {
+	if c.URL == "" {
+		return nil
+	}
+	if !clickHouseIdent.MatchString(c.table()) {
+		return fmt.Errorf("table %q: letters, digits and _ only", c.Table)
+	}
+	if c.Database != "" && !clickHouseIdent.MatchString(c.Database) {
+		return fmt.Errorf("database %q: letters, digits and _ only", c.Database)
+	}
+	return nil
+}
+
+// InsertClickHouse creates the table if needed and inserts rows as JSONEachRow
+func InsertClickHouse(client *http.Client, cfg ClickHouseConfig, rows []QuarterRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := clickHouseQuery(client, cfg, fmt.Sprintf(clickHouseSchema, cfg.table()), nil); err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, r := range rows {
+		rec := make(map[string]interface{}, len(quarterHeader))
+		for i, v := range r.Values() {
+			rec[quarterHeader[i]] = v
+		}
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("clickhouse: %v", err)
+		}
+	}
+	return clickHouseQuery(client, cfg, "INSERT INTO "+cfg.table()+" FORMAT JSONEachRow", &body)
+}
+
+// clickHouseQuery runs query over the HTTP interface, with data as the insert body
+func clickHouseQuery(client *http.Client, cfg ClickHouseConfig, query string, data io.Reader) error {
+	params := url.Values{"query": {query}}
+	if cfg.Database != "" {
+		params.Set("database", cfg.Database)
+	}
+	if data == nil {
+		data = strings.NewReader("")
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(cfg.URL, "/")+"/?"+params.Encode(), data)
+	if err != nil {
+		return fmt.Errorf("clickhouse: %v", err)
+	}
+	if cfg.User != "" {
+		req.Header.Set("X-ClickHouse-User", cfg.User)
+		req.Header.Set("X-ClickHouse-Key", cfg.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("clickhouse: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("clickhouse: status=%d body=%q", resp.StatusCode, b)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+)
+
+// maxCohortSeasons is how many result seasons the cohort section compares against
+const maxCohortSeasons = 6
+
+// cohortHistoryMonths is how far back before a run the cohort section reads stored runs:
+// a quarter for each season it shows and one more for the filings that come in late
+const cohortHistoryMonths = 3 * (maxCohortSeasons + 1)
+
+// cohortStat is the aggregate latest-quarter growth of a group of companies. Rev and NP
+// compare the summed latest quarter against the summed previous quarter, so each company
+// weighs by its size; only companies with both quarters known count towards a sum.
+type cohortStat struct {
+	Label     string
+	Days      int // runs that make up the cohort
+	Companies int
+	Rev, NP   growth
+}
+
+// cohortOf aggregates results into one cohortStat under the zero_base policy
+func cohortOf(label string, results []CompanyResult, zeroBase string) cohortStat {
+	var revCurr, revPrev, npCurr, npPrev float64
+	var revN, npN int
+	companies := 0
+	for _, r := range results {
+		rev, np := latestGrowth(r, zeroBase)
+		counted := false
+		if !math.IsNaN(rev.Abs) {
+			revCurr += rev.Curr
+			revPrev += rev.Prev
+			revN++
+			counted = true
+		}
+		if !math.IsNaN(np.Abs) {
+			npCurr += np.Curr
+			npPrev += np.Prev
+			npN++
+			counted = true
+		}
+		if counted {
+			companies++
+		}
+	}
+	st := cohortStat{Label: label, Days: 1, Companies: companies, Rev: computeGrowth(math.NaN(), math.NaN(), zeroBase), NP: computeGrowth(math.NaN(), math.NaN(), zeroBase)}
+	if revN > 0 {
+		st.Rev = computeGrowth(revCurr, revPrev, zeroBase)
+	}
+	if npN > 0 {
+		st.NP = computeGrowth(npCurr, npPrev, zeroBase)
+	}
+	return st
+}
+
+// seasonOf returns the result season of r: the name of its latest quarter
+func seasonOf(r CompanyResult) string {
+	if len(r.Quarters) == 0 {
+		return ""
+	}
+	return r.Quarters[0].String()
+}
+
+// seasonCohorts groups the stored runs and the current results of date by season and
+// aggregates each, newest season first. A company reporting twice in a season (a re-run, a
+// revised filing) counts once, with its latest result.
+func seasonCohorts(date string, results []CompanyResult, history []RunRecord, zeroBase string) []cohortStat {
+	type season struct {
+		last    string // date of the newest run in the season
+		days    map[string]bool
+		byName  map[string]CompanyResult
+		ordered []string
+	}
+	seasons := map[string]*season{}
+	add := func(date string, rs []CompanyResult) {
+		for _, r := range rs {
+			name := seasonOf(r)
+			if name == "" {
+				continue
+			}
+			s := seasons[name]
+			if s == nil {
+				s = &season{days: map[string]bool{}, byName: map[string]CompanyResult{}}
+				seasons[name] = s
+			}
+			if date > s.last {
+				s.last = date
+			}
+			s.days[date] = true
+			if _, ok := s.byName[r.Company]; !ok {
+				s.ordered = append(s.ordered, r.Company)
+			}
+			s.byName[r.Company] = r
+		}
+	}
+	// history is newest first; replay it oldest first so later runs win
+	for i := len(history) - 1; i >= 0; i-- {
+		add(history[i].Date, history[i].Results)
+	}
+	add(date, results)
+
+	names := make([]string, 0, len(seasons))
+	for name := range seasons {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := seasons[names[i]], seasons[names[j]]
+		if a.last != b.last {
+			return a.last > b.last
+		}
+		// several seasons in one run: the one with the most companies is the current one
+		if len(a.ordered) != len(b.ordered) {
+			return len(a.ordered) > len(b.ordered)
+		}
+		return names[i] < names[j]
+	})
+	out := make([]cohortStat, 0, len(names))
+	for _, name := range names {
+		s := seasons[name]
+		rs := make([]CompanyResult, 0, len(s.ordered))
+		for _, c := range s.ordered {
+			rs = append(rs, s.byName[c])
+		}
+		st := cohortOf(name, rs, zeroBase)
+		st.Days = len(s.days)
+		out = append(out, st)
+	}
+	return out
+}
+
+// writeCohortSection writes the aggregate growth of the run of date next to the same
+// statistic for the current season so far and the seasons before it, for a macro read on
+// the earnings season. history holds the runs before date. Nothing is written when no
+// company has two comparable quarters.
+func writeCohortSection(sb *strings.Builder, date string, results []CompanyResult, history []RunRecord, zeroBase string) {
+	today := cohortOf("This run", results, zeroBase)
+	if today.Companies == 0 {
+		return
+	}
+	seasons := seasonCohorts(date, results, history, zeroBase)
+	if len(seasons) > maxCohortSeasons {
+		seasons = seasons[:maxCohortSeasons]
+	}
+
+	cell := func(g growth) string {
+		return "<td class='" + g.class() + "' title='" + html.EscapeString(g.title()) + "'>" + html.EscapeString(g.String()) + "</td>"
+	}
+	sb.WriteString("<div id='cohort' style='margin-bottom:16px'><h4 title='summed latest quarter vs summed previous quarter of every company with both quarters known'>Cohort growth vs earlier seasons</h4>")
+	sb.WriteString("<table style='width:auto'><thead><tr><th>Cohort</th><th>Runs</th><th>Companies</th><th>Rev %Δ</th><th>NP %Δ</th></tr></thead><tbody>")
+	sb.WriteString("<tr><td class='left'><b>" + html.EscapeString(today.Label) + "</b></td><td>1</td>")
+	sb.WriteString(fmt.Sprintf("<td>%d</td>", today.Companies) + cell(today.Rev) + cell(today.NP) + "</tr>")
+	for i, s := range seasons {
+		label := s.Label + " season"
+		if i == 0 {
+			label += " so far"
+		}
+		sb.WriteString("<tr><td class='left'>" + html.EscapeString(label) + "</td>")
+		sb.WriteString(fmt.Sprintf("<td>%d</td><td>%d</td>", s.Days, s.Companies) + cell(s.Rev) + cell(s.NP) + "</tr>")
+	}
+	sb.WriteString("</tbody></table></div>")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Column is a computed report column: a formula over a result's metrics
+type Column struct {
+	Name   string
+	Expr   *Expr
+	Format string // "num" (default), "pct" or "cr"
+	Color  bool   // green when positive, red when negative
+}
+
+// ParseColumns compiles the configured computed columns
+func ParseColumns(cfgs []ColumnConfig) ([]Column, error) {
+	var cols []Column
+	for _, c := range cfgs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("computed column %q has no name", c.Formula)
+		}
+		e, err := ParseExpr(c.Formula)
+		if err != nil {
+			return nil, fmt.Errorf("computed column %s: %v", c.Name, err)
+		}
+		switch c.Format {
+		case "", "num", "pct", "cr":
+		default:
+			return nil, fmt.Errorf("computed column %s: unknown format %q", c.Name, c.Format)
+		}
+		cols = append(cols, Column{Name: c.Name, Expr: e, Format: c.Format, Color: c.Color})
+	}
+	return cols, nil
+}
+
+// formulaVars extends rowVars with the raw fundamentals fields of the latest quarter
+// (NP_Q, TOTAL_SR_Q, ...) and of the previous one as prev_NP_Q, ...
+func formulaVars(r CompanyResult, watchlist []string, zeroBase string) map[string]interface{} {
+	vars := rowVars(r, watchlist, zeroBase)
+	for k, vals := range r.Metrics {
+		vars[k] = math.NaN()
+		vars["prev_"+k] = math.NaN()
+		if len(vals) > 0 {
+			vars[k] = vals[0]
+		}
+		if len(vals) > 1 {
+			vars["prev_"+k] = vals[1]
+		}
+	}
+	return vars
+}
+
+// Value computes the column for r. Fields the company doesn't report are NaN, so the
+// cell is left empty rather than failing the report.
+func (c Column) Value(r CompanyResult, watchlist []string, zeroBase string) float64 {
+	vars := formulaVars(r, watchlist, zeroBase)
+	for _, name := range c.Expr.Names() {
+		if _, ok := vars[name]; !ok {
+			vars[name] = math.NaN()
+		}
+	}
+	v, err := c.Expr.EvalFloat(vars)
+	if err != nil {
+		log.Printf("column %s for %s: %v", c.Name, r.Company, err)
+		return math.NaN()
+	}
+	if math.IsInf(v, 0) {
+		return math.NaN()
+	}
+	return v
+}
+
+// String formats v for a table cell
+func (c Column) String(v float64) string {
+	if math.IsNaN(v) {
+		return "–"
+	}
+	switch c.Format {
+	case "pct":
+		return fmt.Sprintf("%.2f%%", v)
+	case "cr":
+		return formatFloat(v) + " cr"
+	}
+	return formatFloat(v)
+}
+
+// class returns the css color class for value v
+func (c Column) class(v float64) string {
+	if !c.Color || math.IsNaN(v) {
+		return ""
+	}
+	if v > 0 {
+		return "positive"
+	}
+	if v < 0 {
+		return "negative"
+	}
+	return "neutral"
+}
+
+// warnEmptyColumns logs columns with no value for any result, usually a misspelt field
+func warnEmptyColumns(cols []Column, results []CompanyResult, watchlist []string, zeroBase string) {
+	for _, c := range cols {
+		empty := true
+		for _, r := range results {
+			if !math.IsNaN(c.Value(r, watchlist, zeroBase)) {
+				empty = false
+				break
+			}
+		}
+		if empty && len(results) > 0 {
+			log.Printf("computed column %s is empty for every company; check the names in %q (fields: %s)",
+				c.Name, c.Expr, strings.Join(metricNames(results), ", "))
+		}
+	}
+}
+
+// metricNames lists the raw field names present in any result
+func metricNames(results []CompanyResult) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, r := range results {
+		for k := range r.Metrics {
+			if !seen[k] {
+				seen[k] = true
+				names = append(names, k)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
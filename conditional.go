@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// errNotModified is returned by conditional fetches when the server answers 304
+var errNotModified = errors.New("not modified")
+
+// httpValidators are the cache validators of a response. Sent back as If-None-Match /
+// If-Modified-Since on the next fetch, they let an unchanged resource cost a bodiless
+// 304 instead of a full download, which also keeps the request volume under anti-bot
+// thresholds.
+type httpValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// set adds the conditional headers to req; a zero value adds none
+func (v httpValidators) set(req *http.Request) {
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// validatorsOf returns the validators of resp
+func validatorsOf(resp *http.Response) httpValidators {
+	return httpValidators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the optional JSON config file (default: <app dir>/config.json).
+// Every section is optional; a missing file means defaults everywhere.
+type Config struct {
+	// Output is the report path (default: <app dir>/report.html)
+	Output string `json:"output"`
+	// Concurrency bounds parallel company fetches (default 20)
+	Concurrency int `json:"concurrency"`
+	// RequestTimeout is the per-request timeout in seconds (default 30); the retry pass for
+	// failed companies uses three times this
+	RequestTimeout int `json:"request_timeout"`
+	// Limit caps the companies fetched per run, preferring the watchlist, then the largest
+	// market caps (0: no cap)
+	Limit int `json:"limit"`
+	// MaxDuration bounds the fetching time of a run, e.g. "10m" (empty: no bound)
+	MaxDuration string `json:"max_duration"`
+	// Filter is an expression rows must match to be reported, e.g. `np_growth > 20` (see expr.go)
+	Filter string `json:"filter"`
+	// SortBy is the report row order: company (default), np-growth, rev-growth or mcap
+	SortBy string `json:"sort_by"`
+	// Purposes adds board meetings whose purpose contains one of these (e.g. "dividend",
+	// "fund raising"; "all" for every meeting) to the financial-results ones
+	Purposes []string `json:"purposes"`
+	// BSEEndpoints are the results-calendar URLs tried in order (default: built-in list)
+	BSEEndpoints []string `json:"bse_endpoints"`
+	// MaxBodyMB caps every response fetched (default 32)
+	MaxBodyMB int `json:"max_body_mb"`
+	// MaxBodyMBByHost overrides MaxBodyMB for a host and its subdomains, e.g.
+	// {"api.bseindia.com": 8}
+	MaxBodyMBByHost map[string]int `json:"max_body_mb_by_host"`
+	// DumpRaw saves every trendlyne page and fundamentals JSON under this dir, per company
+	DumpRaw string `json:"dump_raw"`
+	// Archive keeps gzipped raw responses per day for reprocessing (see archive.go)
+	Archive ArchiveConfig `json:"archive"`
+	// NotesFile is a CSV of ticker,note shown in the report (default: <app dir>/notes.csv)
+	NotesFile string `json:"notes_file"`
+	// HoldingsFile is a CSV of ticker,quantity,avg_price for the portfolio columns and section
+	// of the report (default: <app dir>/holdings.csv)
+	HoldingsFile string `json:"holdings_file"`
+	// Watchlist holds BSE short names or scrip codes of companies you follow
+	Watchlist []string `json:"watchlist"`
+	// Exclude holds BSE short names or scrip codes of companies never to fetch
+	Exclude []string `json:"exclude"`
+
+	Trendlyne TrendlyneConfig `json:"trendlyne"`
+
+	Sheets  SheetsConfig  `json:"sheets"`
+	Notion  NotionConfig  `json:"notion"`
+	SFTP    SFTPConfig    `json:"sftp"`
+	MQTT    MQTTConfig    `json:"mqtt"`
+	Kafka   KafkaConfig   `json:"kafka"`
+	Publish PublishConfig `json:"publish"`
+	Notify  NotifyConfig  `json:"notify"`
+	// Hooks are external commands run for each company result after a run
+	Hooks []HookConfig `json:"hooks"`
+
+	Plugins PluginsConfig `json:"plugins"`
+	// ZeroBase is how growth off a zero previous value is shown, sorted and summarized:
+	// "na" (default), "absolute", "new" or "hundred" (see zerobase.go)
+	ZeroBase string `json:"zero_base"`
+	// AsOf, set by backfill, parses the fundamentals as they stood on that day
+	AsOf time.Time `json:"-"`
+	// Landed, set by watch, holds when each scrip code's results reached BSE today; those
+	// companies are fetched first (see prioritizeItems)
+	Landed map[string]time.Time `json:"-"`
+	// ScripMaster sets how the BSE scrip master is kept and used (see scripmaster.go)
+	ScripMaster ScripMasterConfig `json:"scrip_master"`
+	// Scrips, set by the commands that fetch, is the loaded scrip master; nil when there is none
+	Scrips *scripMaster `json:"-"`
+	// Outliers sets how extreme %Δ values enter the report's summary averages
+	Outliers OutlierConfig `json:"outliers"`
+	// Peers are named peer groups of BSE short names, NSE symbols or scrip codes, e.g.
+	// {"IT-midcap": ["LTTS", "PERSISTENT", "COFORGE"]}; the report compares a group whenever
+	// one of them reports
+	Peers map[string][]string `json:"peers"`
+	// Estimates sets how analyst consensus snapshots are fetched and compared (see estimates.go)
+	Estimates EstimatesConfig `json:"estimates"`
+	// Profiles adds a business description per company to the company modal (see profile.go)
+	Profiles ProfilesConfig `json:"profiles"`
+	// Kite imports the holdings of a Zerodha account into the watchlist (see kite.go)
+	Kite KiteConfig `json:"kite"`
+	// CrossCheck compares the trendlyne figures with the XBRL of the BSE results filings
+	CrossCheck CrossCheckConfig `json:"cross_check"`
+	// Leverage sets when a result is flagged as growth financed by borrowings
+	Leverage LeverageConfig `json:"leverage"`
+	// Pipeline tunes the staged trendlyne fetch (see pipeline.go)
+	Pipeline PipelineConfig `json:"pipeline"`
+	// ClickHouse receives the per-quarter rows of every run (see clickhouse.go)
+	ClickHouse ClickHouseConfig `json:"clickhouse"`
+	// Serve sets who may use `serve` (see auth.go)
+	Serve ServeConfig `json:"serve"`
+	// Columns are computed report columns, e.g. {"name": "NP margin", "formula": "NP_Q / TOTAL_SR_Q * 100"}
+	Columns []ColumnConfig `json:"columns"`
+	// Metrics extends or adjusts the registry of values read from the fundamentals dump
+	Metrics []MetricConfig `json:"metrics"`
+}
+
+// TrendlyneConfig logs in to trendlyne so subscriber-only data is fetched. Either set
+// SessionCookie (the "sessionid" cookie from a logged-in browser) or Email and Password.
+type TrendlyneConfig struct {
+	Email         string `json:"email"`
+	Password      string `json:"password" secret:"true"`
+	SessionCookie string `json:"session_cookie" secret:"true"`
+}
+
+// SheetsConfig enables appending each run's rows to a Google Sheet
+type SheetsConfig struct {
+	SpreadsheetID   string `json:"spreadsheet_id"`
+	Range           string `json:"range"`                     // A1 range to append after, e.g. "Results!A1"
+	CredentialsFile string `json:"credentials_file"`          // service-account JSON key file
+	Credentials     string `json:"credentials" secret:"true"` // the key JSON itself, instead of credentials_file
+}
+
+// NotionConfig enables pushing each company's result as a row of a Notion database
+type NotionConfig struct {
+	Token      string `json:"token" secret:"true"` // internal integration token
+	DatabaseID string `json:"database_id"`
+	ReportURL  string `json:"report_url"` // link stored on each page; defaults to the local report file
+}
+
+// SFTPConfig enables uploading the generated report to a remote host after each run
+type SFTPConfig struct {
+	Host                  string `json:"host"`
+	Port                  int    `json:"port"` // default 22
+	User                  string `json:"user"`
+	Password              string `json:"password" secret:"true"`
+	KeyFile               string `json:"key_file"`
+	RemoteDir             string `json:"remote_dir"`
+	KnownHostsFile        string `json:"known_hosts_file"` // default ~/.ssh/known_hosts
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key"`
+}
+
+// PublishConfig holds defaults for the `publish` subcommand
+type PublishConfig struct {
+	Dir    string `json:"dir"`    // static site directory, default <app dir>/site
+	Git    bool   `json:"git"`    // commit changes (dir must be a git work tree)
+	Push   bool   `json:"push"`   // push after committing
+	Remote string `json:"remote"` // push remote, default: git's upstream (origin when only Branch is set)
+	Branch string `json:"branch"` // remote branch to push HEAD to, e.g. gh-pages
+
+	BaseURL      string  `json:"base_url"`       // public URL of the site, used for absolute links in feed.xml
+	FeedMoverPct float64 `json:"feed_mover_pct"` // also add a feed item per company with |NP %Δ| >= this (0 = off)
+}
+
+// NotifyConfig enables alerts for newly declared results, sent from `run` and `watch`.
+// Already-alerted results are remembered in <app dir>/notified.json and only re-sent
+// when their numbers change by at least ChangePct.
+type NotifyConfig struct {
+	Telegram      TelegramConfig `json:"telegram"`
+	Desktop       DesktopConfig  `json:"desktop"`
+	Email         EmailConfig    `json:"email"`
+	SMS           SMSConfig      `json:"sms"`
+	ChangePct     float64        `json:"change_pct"`     // re-alert threshold in percent (default 1)
+	WatchlistOnly bool           `json:"watchlist_only"` // only alert for watchlist companies
+}
+
+// TelegramConfig sends alerts through a Telegram bot
+type TelegramConfig struct {
+	BotToken string `json:"bot_token" secret:"true"`
+	ChatID   string `json:"chat_id"`
+}
+
+// DesktopConfig shows a native desktop notification for results crossing a threshold
+type DesktopConfig struct {
+	Enabled bool   `json:"enabled"`
+	When    string `json:"when"` // alert expression (see expr.go); default: abs(np_growth) >= 20 || abs(rev_growth) >= 20
+}
+
+// HookConfig is a shell command run once per CompanyResult, which it receives as JSON on stdin
+type HookConfig struct {
+	Command       string `json:"command"`
+	TimeoutSec    int    `json:"timeout_sec"`    // per invocation, default 30
+	WatchlistOnly bool   `json:"watchlist_only"` // only run for watchlist companies
+}
+
+// PluginsConfig controls the exec plugins (see plugin.go)
+type PluginsConfig struct {
+	Dir     string   `json:"dir"`     // default <app dir>/plugins
+	Sources []string `json:"sources"` // source order, "trendlyne" is the built-in; default: built-in then every source plugin
+	Sinks   []string `json:"sinks"`   // sink plugins to run; default all
+	// NSESources is the source order for companies listed on NSE (see sourceOrder); default Sources
+	NSESources []string `json:"nse_sources"`
+}
+
+// PipelineConfig sets the workers per pipeline stage and the capacity of the channels
+// between stages. Zero means the default: concurrency for resolve and fetch, the CPU
+// count for parse, half of concurrency for enrich, and concurrency for the buffers.
+type PipelineConfig struct {
+	ResolveWorkers int `json:"resolve_workers"`
+	FetchWorkers   int `json:"fetch_workers"`
+	ParseWorkers   int `json:"parse_workers"`
+	EnrichWorkers  int `json:"enrich_workers"`
+	Buffer         int `json:"buffer"`
+}
+
+// ScripMasterConfig: the scrip master is downloaded again once the cached copy is older
+// than Refresh (Go duration, default 24h); Groups, when set, keeps only companies of those
+// BSE groups (A, B, T, ...) in the fetch
+type ScripMasterConfig struct {
+	Refresh string   `json:"refresh"`
+	Groups  []string `json:"groups"`
+	URL     string   `json:"url"`     // default scripMasterURL
+	NSEURL  string   `json:"nse_url"` // NSE equity list joined on ISIN for the NSE symbols; default nseEquitiesURL
+}
+
+// KiteConfig: with APIKey and AccessToken, the companies of the account join the watchlist,
+// imported again once the last import is older than Refresh (Go duration, default 12h).
+// Import is "holdings" (default), "positions" or "both".
+type KiteConfig struct {
+	APIKey      string `json:"api_key"`
+	AccessToken string `json:"access_token" secret:"true"` // renewed daily through the Kite login flow
+	Import      string `json:"import"`
+	Refresh     string `json:"refresh"`
+	URL         string `json:"url"` // default kiteURL
+}
+
+func (c KiteConfig) enabled() bool { return c.APIKey != "" && c.AccessToken != "" }
+
+func (c KiteConfig) url() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	return kiteURL
+}
+
+func (c KiteConfig) refresh() time.Duration {
+	d, err := time.ParseDuration(c.Refresh)
+	if err != nil {
+		return defaultKiteRefresh
+	}
+	return d
+}
+
+// EstimatesConfig: `estimates` snapshots the consensus of companies meeting within Days
+// (default 30) from URL (default defaultEstimatesURL); a result is compared with the
+// consensus Window (Go duration, default 672h, four weeks) before it was declared
+type EstimatesConfig struct {
+	URL    string `json:"url"`
+	Window string `json:"window"`
+	Days   int    `json:"days"`
+}
+
+// window is Window parsed, defaultEstimatesWindow when unset; LoadConfig has already
+// validated it
+func (c EstimatesConfig) window() time.Duration {
+	d, err := time.ParseDuration(c.Window)
+	if err != nil {
+		return defaultEstimatesWindow
+	}
+	return d
+}
+
+// days is Days, defaultEstimatesDays when unset
+func (c EstimatesConfig) days() int {
+	if c.Days <= 0 {
+		return defaultEstimatesDays
+	}
+	return c.Days
+}
+
+// refresh is Refresh parsed, defaultScripMasterRefresh when unset; LoadConfig has
+// already validated it
+func (c ScripMasterConfig) refresh() time.Duration {
+	d, err := time.ParseDuration(c.Refresh)
+	if err != nil {
+		return defaultScripMasterRefresh
+	}
+	return d
+}
+
+// LeverageConfig holds the thresholds of flagLeverage: a company is highly leveraged at
+// MaxDebtEquity debt/equity (default 1.5) or below MinCoverage interest coverage (default 2)
+type LeverageConfig struct {
+	MaxDebtEquity float64 `json:"max_debt_equity"`
+	MinCoverage   float64 `json:"min_interest_coverage"`
+}
+
+// ColumnConfig defines a computed report column. Formula is an expression (see expr.go)
+// over the filter names plus the raw fundamentals fields of the latest quarter (NP_Q,
+// TOTAL_SR_Q, ...) and of the previous one (prev_NP_Q, ...).
+type ColumnConfig struct {
+	Name    string `json:"name"`
+	Formula string `json:"formula"`
+	Format  string `json:"format"` // num (default), pct or cr
+	Color   bool   `json:"color"`  // green when positive, red when negative
+}
+
+// MetricConfig is a metric registry entry. Naming "revenue" or "net_profit" replaces the
+// dump keys of a built-in metric (e.g. after a source rename); any other name adds a metric,
+// shown as a report column and usable in formulas and filters.
+type MetricConfig struct {
+	Name           string   `json:"name"`
+	Label          string   `json:"label"`
+	Keys           []string `json:"keys"`             // candidate dump keys, first present wins
+	Format         string   `json:"format"`           // num (default), pct or cr
+	HigherIsBetter *bool    `json:"higher_is_better"` // default true
+}
+
+// metricRegistry returns the metric registry; LoadConfig has already validated it
+func (c Config) metricRegistry() MetricRegistry {
+	reg, err := BuildMetricRegistry(c.Metrics)
+	if err != nil {
+		return defaultMetrics
+	}
+	return reg
+}
+
+// maxDuration is MaxDuration parsed; LoadConfig has already validated it
+func (c Config) maxDuration() time.Duration {
+	d, _ := time.ParseDuration(c.MaxDuration)
+	return d
+}
+
+// maxBody is the response size cap in bytes
+func (c Config) maxBody() int64 {
+	return int64(c.MaxBodyMB) << 20
+}
+
+// inWatchlist reports whether any of names (short name, scrip code, ...) is on the watchlist
+func inWatchlist(watchlist []string, names ...string) bool {
+	for _, w := range watchlist {
+		for _, n := range names {
+			if n != "" && strings.EqualFold(strings.TrimSpace(w), strings.TrimSpace(n)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getAppDir returns the directory for the report, config and other state.
+// Preferred location: $HOME/Documents/quarter-compare
+// Fallbacks: executable directory, current working directory.
+func getAppDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err == nil && home != "" {
+		dir := filepath.Join(home, "Documents", "quarter-compare")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+		return dir, nil
+	}
+	// fallback: executable directory
+	if exe, err2 := os.Executable(); err2 == nil {
+		dir := filepath.Dir(exe)
+		if err := os.MkdirAll(dir, 0o755); err == nil {
+			return dir, nil
+		}
+	}
+	// final fallback: current working directory
+	if wd, err3 := os.Getwd(); err3 == nil {
+		return wd, nil
+	}
+	return ".", nil
+}
+
+// LoadConfig reads the JSON config at path (a missing file yields defaults),
+// then applies QC_* environment overrides and resolves secret references (see secrets.go)
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return cfg, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return cfg, fmt.Errorf("parse config %s: %v", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), "QC", os.LookupEnv); err != nil {
+		return cfg, err
+	}
+	if err := resolveSecrets(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, err
+	}
+	if _, err := BuildMetricRegistry(cfg.Metrics); err != nil {
+		return cfg, fmt.Errorf("metrics: %v", err)
+	}
+	if cfg.MaxDuration != "" {
+		if _, err := time.ParseDuration(cfg.MaxDuration); err != nil {
+			return cfg, fmt.Errorf("max_duration: %v", err)
+		}
+	}
+	if cfg.ScripMaster.Refresh != "" {
+		if _, err := time.ParseDuration(cfg.ScripMaster.Refresh); err != nil {
+			return cfg, fmt.Errorf("scrip_master.refresh: %v", err)
+		}
+	}
+	if cfg.Estimates.Window != "" {
+		if _, err := time.ParseDuration(cfg.Estimates.Window); err != nil {
+			return cfg, fmt.Errorf("estimates.window: %v", err)
+		}
+	}
+	if cfg.Kite.Refresh != "" {
+		if _, err := time.ParseDuration(cfg.Kite.Refresh); err != nil {
+			return cfg, fmt.Errorf("kite.refresh: %v", err)
+		}
+	}
+	switch cfg.Kite.Import {
+	case "", "holdings", "positions", "both":
+	default:
+		return cfg, fmt.Errorf("kite.import: %q is not holdings, positions or both", cfg.Kite.Import)
+	}
+	if cfg.Notify.Desktop.When != "" {
+		if _, err := ParseExpr(cfg.Notify.Desktop.When); err != nil {
+			return cfg, fmt.Errorf("notify.desktop.when: %v", err)
+		}
+	}
+	if err := checkEmail(cfg.Notify.Email); err != nil {
+		return cfg, fmt.Errorf("notify.email: %v", err)
+	}
+	if err := checkServe(cfg.Serve); err != nil {
+		return cfg, fmt.Errorf("serve: %v", err)
+	}
+	if err := checkClickHouse(cfg.ClickHouse); err != nil {
+		return cfg, fmt.Errorf("clickhouse: %v", err)
+	}
+	if err := checkSMS(cfg.Notify.SMS); err != nil {
+		return cfg, fmt.Errorf("notify.sms: %v", err)
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 20
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = 30
+	}
+	if cfg.MaxBodyMB <= 0 {
+		cfg.MaxBodyMB = defaultMaxBodyMB
+	}
+	for host, mb := range cfg.MaxBodyMBByHost {
+		if mb <= 0 {
+			return cfg, fmt.Errorf("max_body_mb_by_host: %s: %d is not a positive size", host, mb)
+		}
+	}
+	if cfg.ZeroBase == "" {
+		cfg.ZeroBase = zeroBaseNA
+	}
+	if err := checkZeroBase(cfg.ZeroBase); err != nil {
+		return cfg, fmt.Errorf("zero_base: %v", err)
+	}
+	cfg.Outliers = cfg.Outliers.orDefaults()
+	if err := checkOutlierPolicy(cfg.Outliers.Policy); err != nil {
+		return cfg, fmt.Errorf("outliers: %v", err)
+	}
+	if cfg.Archive.RetentionDays <= 0 {
+		cfg.Archive.RetentionDays = defaultArchiveRetention
+	}
+	if cfg.CrossCheck.TolerancePct <= 0 {
+		cfg.CrossCheck.TolerancePct = defaultCrossCheckTolerance
+	}
+	if cfg.Leverage.MaxDebtEquity <= 0 {
+		cfg.Leverage.MaxDebtEquity = defaultMaxDebtEquity
+	}
+	if cfg.Leverage.MinCoverage <= 0 {
+		cfg.Leverage.MinCoverage = defaultMinCoverage
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides fields of the struct v from environment variables named after
+// their json tags: QC_OUTPUT, QC_SHEETS_SPREADSHEET_ID, ... String lists are comma-separated;
+// lists of objects and maps (QC_HOOKS, QC_PEERS, QC_MAX_BODY_MB_BY_HOST) are JSON.
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" || !f.IsExported() {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnv(fv, name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(fv, raw); err != nil {
+			return fmt.Errorf("env %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// setFromString parses raw into a string, bool, int, float or []string field;
+// other lists and maps are parsed as JSON
+func setFromString(fv reflect.Value, raw string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			// lists of objects (hooks, ...) are given as JSON
+			return json.Unmarshal([]byte(raw), fv.Addr().Interface())
+		}
+		var items []string
+		for _, it := range strings.Split(raw, ",") {
+			if it = strings.TrimSpace(it); it != "" {
+				items = append(items, it)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		// replaces the file's map rather than adding to it
+		m := reflect.New(fv.Type())
+		if err := json.Unmarshal([]byte(raw), m.Interface()); err != nil {
+			return err
+		}
+		fv.Set(m.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// reportPath returns cfg.Output, or the default report location
+func reportPath(cfg Config) (string, error) {
+	if cfg.Output != "" {
+		return cfg.Output, nil
+	}
+	return getOutputReportPath()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sessionCookieMaxAge is how long cookies without an expiry are kept between runs
+const sessionCookieMaxAge = 12 * time.Hour
+
+// persistentJar is a cookiejar.Jar that mirrors every cookie it receives to a JSON file,
+// so cookies acquired in one run (BSE homepage, trendlyne) are sent again by the next
+type persistentJar struct {
+	*cookiejar.Jar
+	path string
+
+	mu     sync.Mutex
+	stored map[string]storedCookie
+}
+
+// storedCookie is a cookie as received, with the URL that set it
+type storedCookie struct {
+	URL     string       `json:"url"`
+	Cookie  *http.Cookie `json:"cookie"`
+	SavedAt time.Time    `json:"saved_at"`
+}
+
+// cookieJarPath returns <app dir>/cookies.json
+func cookieJarPath() (string, error) {
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cookies.json"), nil
+}
+
+// newPersistentJar loads unexpired cookies from path into a fresh jar
+func newPersistentJar(path string) *persistentJar {
+	jar, _ := cookiejar.New(nil)
+	pj := &persistentJar{Jar: jar, path: path, stored: map[string]storedCookie{}}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return pj
+	}
+	var saved []storedCookie
+	if err := json.Unmarshal(b, &saved); err != nil {
+		log.Printf("newPersistentJar: ignoring %s: %v", path, err)
+		return pj
+	}
+	now := time.Now()
+	for _, sc := range saved {
+		u, err := url.Parse(sc.URL)
+		if err != nil || sc.Cookie == nil || cookieExpired(sc, now) {
+			continue
+		}
+		pj.Jar.SetCookies(u, []*http.Cookie{sc.Cookie})
+		pj.stored[cookieKey(u, sc.Cookie)] = sc
+	}
+	return pj
+}
+
+// SetCookies stores the cookies in the jar and rewrites the file
+func (pj *persistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	pj.Jar.SetCookies(u, cookies)
+
+	pj.mu.Lock()
+	defer pj.mu.Unlock()
+	now := time.Now()
+	origin := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String()
+	for _, c := range cookies {
+		c := *c
+		// pin relative lifetimes so reloading doesn't extend them
+		if c.MaxAge > 0 {
+			c.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+			c.MaxAge = 0
+		}
+		key := cookieKey(u, &c)
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(pj.stored, key)
+			continue
+		}
+		pj.stored[key] = storedCookie{URL: origin, Cookie: &c, SavedAt: now}
+	}
+	if err := pj.save(); err != nil {
+		log.Printf("persistentJar: save %s: %v", pj.path, err)
+	}
+}
+
+// save writes the stored cookies atomically; callers hold pj.mu
+func (pj *persistentJar) save() error {
+	list := make([]storedCookie, 0, len(pj.stored))
+	for _, sc := range pj.stored {
+		list = append(list, sc)
+	}
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := pj.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, pj.path)
+}
+
+// cookieKey identifies a cookie the way the jar does: domain, path and name
+func cookieKey(u *url.URL, c *http.Cookie) string {
+	domain := c.Domain
+	if domain == "" {
+		domain = u.Hostname()
+	}
+	return domain + "|" + c.Path + "|" + c.Name
+}
+
+func cookieExpired(sc storedCookie, now time.Time) bool {
+	if sc.Cookie.Expires.IsZero() {
+		return now.Sub(sc.SavedAt) > sessionCookieMaxAge
+	}
+	return sc.Cookie.Expires.Before(now)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCrossCheckTolerance is the largest difference (%) between the trendlyne figure
+// and the exchange filing that still counts as a match
+const defaultCrossCheckTolerance = 2.0
+
+// CrossCheckConfig turns on the comparison of trendlyne's latest quarter with the XBRL of
+// the company's BSE results filing (one more request per company)
+type CrossCheckConfig struct {
+	Enabled      bool    `json:"enabled"`
+	TolerancePct float64 `json:"tolerance_pct"` // default 2
+}
+
+// XBRL elements of the BSE results taxonomy read by parseXBRLResult, by local name
+var (
+	xbrlRevenue   = []string{"RevenueFromOperations", "TotalRevenueFromOperations", "IncomeFromOperations"}
+	xbrlNetProfit = []string{"ProfitLossForPeriod", "ProfitLossForThePeriod", "NetProfitLossForThePeriod"}
+	xbrlBasis     = "NatureOfReportStandaloneConsolidated"
+)
+
+// xbrlCurrentContext is the context BSE results XBRL uses for the quarter being reported
+const xbrlCurrentContext = "OneD"
+
+// XBRLResult holds the latest-quarter figures of a results filing, in ₹ cr (NaN when the
+// filing lacks them), and whether they are standalone or consolidated
+type XBRLResult struct {
+	Revenue   float64
+	NetProfit float64
+	Basis     string // "Standalone" or "Consolidated"; empty when not stated
+}
+
+// FetchXBRLResult downloads and parses the XBRL of a results filing
+func FetchXBRLResult(client *http.Client, xbrlURL string, maxBody int64) (XBRLResult, error) {
+	req, _ := http.NewRequest("GET", xbrlURL, nil)
+	setBSEHeaders(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return XBRLResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		io.Copy(io.Discard, resp.Body)
+		return XBRLResult{}, fmt.Errorf("status=%d", resp.StatusCode)
+	}
+	return parseXBRLResult(&cappedReader{r: resp.Body, limit: maxBody})
+}
+
+// parseXBRLResult reads revenue, net profit and the basis from XBRL, preferring the
+// current-quarter context and else the first value of each element. Amounts are in ₹.
+func parseXBRLResult(r io.Reader) (XBRLResult, error) {
+	res := XBRLResult{Revenue: math.NaN(), NetProfit: math.NaN()}
+	fromCurrent := map[*float64]bool{} // value read from the current-quarter context
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("invalid XBRL: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		name := start.Name.Local
+		var target *float64
+		switch {
+		case name == xbrlBasis:
+			var s string
+			if err := d.DecodeElement(&s, &start); err == nil && res.Basis == "" {
+				res.Basis = strings.TrimSpace(s)
+			}
+			continue
+		case containsString(xbrlRevenue, name):
+			target = &res.Revenue
+		case containsString(xbrlNetProfit, name):
+			target = &res.NetProfit
+		default:
+			continue
+		}
+		var s string
+		if err := d.DecodeElement(&s, &start); err != nil {
+			return res, fmt.Errorf("invalid XBRL: %v", err)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			continue
+		}
+		current := false
+		for _, a := range start.Attr {
+			if a.Name.Local == "contextRef" && a.Value == xbrlCurrentContext {
+				current = true
+			}
+		}
+		if fromCurrent[target] || (!current && !math.IsNaN(*target)) {
+			continue
+		}
+		*target = v / 1e7 // ₹ to ₹ cr
+		fromCurrent[target] = current
+	}
+	return res, nil
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// crossCheck compares each result's latest revenue and net profit with the XBRL of its
+// BSE financial-results filings in anns and records any difference beyond the tolerance
+// in CrossCheck. When the company filed both standalone and consolidated results, the
+// filing of the same basis as the trendlyne figures is used; a match with the other basis
+// only is reported as a standalone/consolidated mixup. Best effort: results whose filing
+// cannot be read are left unchecked.
+func crossCheck(client *http.Client, cfg Config, results []CompanyResult, items []BSEItem, anns []Announcement) {
+	tolerance := cfg.CrossCheck.TolerancePct
+	codes := make(map[string]string, len(items))
+	for _, it := range items {
+		codes[it.ShortName] = it.ScripCode
+	}
+	xbrls := map[string][]string{}
+	for _, a := range anns {
+		if a.XBRLURL != "" && isResultsFiling(a) {
+			xbrls[a.ScripCode] = append(xbrls[a.ScripCode], a.XBRLURL)
+		}
+	}
+
+	sem := make(chan struct{}, max(1, cfg.Concurrency))
+	var wg sync.WaitGroup
+	for i := range results {
+		urls := xbrls[codes[results[i].Company]]
+		if len(urls) == 0 {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *CompanyResult, urls []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var filings []XBRLResult
+			for _, u := range urls {
+				x, err := FetchXBRLResult(client, u, cfg.maxBody())
+				if err != nil {
+					log.Printf("crossCheck: %s: %v", r.Company, err)
+					continue
+				}
+				filings = append(filings, x)
+			}
+			r.CrossCheck = compareFilings(*r, filings, tolerance)
+		}(&results[i], urls)
+	}
+	wg.Wait()
+}
+
+// compareFilings describes how r differs from the filings beyond tolerance (%); empty
+// when a filing of the same basis matches or none could be compared
+func compareFilings(r CompanyResult, filings []XBRLResult, tolerance float64) string {
+	rev, np := math.NaN(), math.NaN()
+	if len(r.RevenueNums) > 0 {
+		rev = r.RevenueNums[0]
+	}
+	if len(r.NetProfitNums) > 0 {
+		np = r.NetProfitNums[0]
+	}
+	diffs := func(x XBRLResult) []string {
+		var out []string
+		for _, f := range []struct {
+			name         string
+			ours, theirs float64
+		}{{"revenue", rev, x.Revenue}, {"net profit", np, x.NetProfit}} {
+			if math.IsNaN(f.ours) || math.IsNaN(f.theirs) {
+				continue
+			}
+			base := math.Max(math.Abs(f.theirs), 0.01)
+			if math.Abs(f.ours-f.theirs)/base*100 > tolerance {
+				out = append(out, fmt.Sprintf("%s %s vs %s in the filing", f.name, formatFloat(f.ours), formatFloat(f.theirs)))
+			}
+		}
+		return out
+	}
+	basis := strings.ToLower(r.Basis)
+	var same, other []XBRLResult
+	for _, x := range filings {
+		if basis == "" || x.Basis == "" || strings.Contains(basis, strings.ToLower(x.Basis)) {
+			same = append(same, x)
+		} else {
+			other = append(other, x)
+		}
+	}
+	var mismatch []string
+	for _, x := range same {
+		d := diffs(x)
+		if len(d) == 0 {
+			return ""
+		}
+		if mismatch == nil {
+			mismatch = d
+		}
+	}
+	for _, x := range other {
+		d := diffs(x)
+		if len(d) == 0 {
+			return fmt.Sprintf("matches the %s filing, not %s: standalone/consolidated mixup", strings.ToLower(x.Basis), basis)
+		}
+		if mismatch == nil && len(same) == 0 {
+			mismatch = append(d, "only a "+strings.ToLower(x.Basis)+" filing")
+		}
+	}
+	if mismatch == nil {
+		return ""
+	}
+	return strings.Join(mismatch, "; ")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// default leverage thresholds (see LeverageConfig)
+const (
+	defaultMaxDebtEquity = 1.5
+	defaultMinCoverage   = 2.0
+)
+
+// Metrics names of the quarterly lines used for interest coverage, first present wins
+var (
+	interestNames = []string{"INTEREST_Q", "FINANCE_COST_Q", "FIN_COST_Q", "INT_Q"}
+	quarterlyEBIT = []string{"EBIT_Q", "PBIT_Q"}
+	quarterlyPBT  = []string{"PBT_Q", "PROFIT_BEFORE_TAX_Q"}
+)
+
+// quarterlyValue is quarter i of the first of names known in r.Metrics, NaN when none is
+func quarterlyValue(r CompanyResult, names []string, i int) float64 {
+	for _, n := range names {
+		if vals := r.Metrics[n]; i < len(vals) && !math.IsNaN(vals[i]) {
+			return vals[i]
+		}
+	}
+	return math.NaN()
+}
+
+// interestCoverage is EBIT over interest for quarter i (0 = latest); EBIT is profit
+// before tax plus interest when the dump has no EBIT line. NaN without interest.
+func interestCoverage(r CompanyResult, i int) float64 {
+	interest := quarterlyValue(r, interestNames, i)
+	if !(interest > 0) {
+		return math.NaN()
+	}
+	ebit := quarterlyValue(r, quarterlyEBIT, i)
+	if math.IsNaN(ebit) {
+		ebit = quarterlyValue(r, quarterlyPBT, i) + interest
+	}
+	return ebit / interest
+}
+
+// annualDebt reads total debt (₹ cr) for the latest year of doc's annual tables, with its
+// ratio to equity and its change (%) from the year before; NaN when unknown
+func annualDebt(doc fundamentalsDoc) (debt, debtEquity, change float64) {
+	debt, debtEquity, change = math.NaN(), math.NaN(), math.NaN()
+	if len(doc.Annual) == 0 {
+		return
+	}
+	debt = annualValue(doc.Annual[0], debtKeys)
+	if equity := annualValue(doc.Annual[0], equityKeys); equity > 0 {
+		debtEquity = debt / equity
+	}
+	if len(doc.Annual) > 1 {
+		if prev := annualValue(doc.Annual[1], debtKeys); prev > 0 {
+			change = (debt - prev) / prev * 100
+		}
+	}
+	return
+}
+
+// flagLeverage marks the results whose profit grew while the company is highly leveraged
+// (debt/equity at or above cfg.MaxDebtEquity, or interest coverage below cfg.MinCoverage)
+// and borrowing more (debt up over the year, or interest up over the quarter): growth
+// that borrowings may be paying for. The reason is kept in Leverage.
+func flagLeverage(results []CompanyResult, cfg LeverageConfig) {
+	for i := range results {
+		r := &results[i]
+		r.Leverage = ""
+		_, np := latestGrowth(*r, zeroBaseNA) // only the figures are used, not the % change
+		if !(np.Curr > np.Prev) {
+			continue
+		}
+		var high, rising []string
+		if r.DebtToEquity >= cfg.MaxDebtEquity {
+			high = append(high, fmt.Sprintf("debt/equity %.2f", r.DebtToEquity))
+		}
+		if cov := interestCoverage(*r, 0); cov < cfg.MinCoverage {
+			high = append(high, fmt.Sprintf("interest cover %.1fx", cov))
+		}
+		if r.DebtChange > 0 {
+			rising = append(rising, fmt.Sprintf("debt %+.0f%% YoY", r.DebtChange))
+		}
+		if curr, prev := quarterlyValue(*r, interestNames, 0), quarterlyValue(*r, interestNames, 1); prev > 0 && curr > prev {
+			rising = append(rising, fmt.Sprintf("interest %+.0f%% QoQ", (curr-prev)/prev*100))
+		}
+		if len(high) > 0 && len(rising) > 0 {
+			r.Leverage = strings.Join(append(high, rising...), ", ")
+		}
+	}
+}
+
+// hasDebt reports whether any result has a debt/equity ratio or interest coverage
+func hasDebt(results []CompanyResult) bool {
+	for _, r := range results {
+		if !math.IsNaN(r.DebtToEquity) || !math.IsNaN(interestCoverage(r, 0)) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatRatio formats a plain ratio for a table cell
+func formatRatio(v float64) string {
+	if math.IsNaN(v) {
+		return "–"
+	}
+	return fmt.Sprintf("%.2f", v)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Decision is what a run did with one company of the BSE list, and why. A run keeps its
+// decisions in decisions/<date>.json, to check that a company you expected was not
+// dropped unseen.
+type Decision struct {
+	Company     string `json:"company"`
+	LongName    string `json:"long_name,omitempty"`
+	ScripCode   string `json:"scrip_code,omitempty"`
+	MeetingDate string `json:"meeting_date,omitempty"`
+	Purpose     string `json:"purpose,omitempty"`
+	Reported    bool   `json:"reported"`
+	Reason      string `json:"reason"` // one of the reason* values
+	Detail      string `json:"detail,omitempty"`
+}
+
+// decision reasons
+const (
+	reasonReported  = "reported"    // fetched and in the report
+	reasonOtherDay  = "other_day"   // meeting on another day
+	reasonPurpose   = "purpose"     // a meeting purpose not in Config.Purposes
+	reasonExcluded  = "excluded"    // in Config.Exclude
+	reasonGroup     = "group"       // a BSE group not in Config.ScripMaster.Groups
+	reasonDuplicate = "duplicate"   // listed again for the day; fetched once
+	reasonOverLimit = "over_limit"  // past Config.Limit
+	reasonOutOfTime = "out_of_time" // not started within Config.MaxDuration or before an interrupt
+	reasonFailed    = "failed"      // fetching or parsing failed, also on the retry
+	reasonFiltered  = "filtered"    // fetched, but not matching the filter expression
+)
+
+// DecisionLog is the content of decisions/<date>.json
+type DecisionLog struct {
+	Date      string     `json:"date"` // 2006-01-02
+	Filter    string     `json:"filter,omitempty"`
+	Decisions []Decision `json:"decisions"`
+}
+
+func newDecision(itm BSEItem, reason, detail string) Decision {
+	return Decision{
+		Company:     itm.ShortName,
+		LongName:    itm.LongName,
+		ScripCode:   itm.ScripCode,
+		MeetingDate: itm.MeetingDate,
+		Purpose:     itm.Purpose,
+		Reported:    reason == reasonReported,
+		Reason:      reason,
+		Detail:      detail,
+	}
+}
+
+// screenItems keeps the BSE items of date ("02 Jan 2006") that the run fetches: results
+// meetings and those of cfg.Purposes, not excluded (under any name the scrip master
+// knows), of the configured BSE groups, each company once. Every other item gets a
+// decision saying why it was left out. Codes and names missing from the BSE list are
+// filled in from the scrip master.
+func screenItems(items []BSEItem, cfg Config, date string) ([]BSEItem, []Decision) {
+	var kept []BSEItem
+	var decisions []Decision
+	first := map[string]BSEItem{}
+	for _, it := range items {
+		it = cfg.Scrips.canonical(it)
+		key := symbolKey(it)
+		prev, dup := first[key]
+		switch {
+		case it.MeetingDate != date:
+			decisions = append(decisions, newDecision(it, reasonOtherDay, "meeting on "+it.MeetingDate))
+		case !matchPurpose(it.Purpose, cfg.Purposes):
+			decisions = append(decisions, newDecision(it, reasonPurpose, "not a results meeting; see purposes in the config"))
+		case inWatchlist(cfg.Exclude, cfg.Scrips.names(it)...):
+			decisions = append(decisions, newDecision(it, reasonExcluded, "in exclude"))
+		case !cfg.Scrips.inGroups(it, cfg.ScripMaster.Groups):
+			s, _ := cfg.Scrips.lookup(it)
+			decisions = append(decisions, newDecision(it, reasonGroup, "BSE group "+s.Group))
+		case dup:
+			detail := "listed again"
+			if prev.Purpose != "" {
+				detail += "; fetched for " + prev.Purpose
+			}
+			decisions = append(decisions, newDecision(it, reasonDuplicate, detail))
+		default:
+			first[key] = it
+			kept = append(kept, it)
+		}
+	}
+	return kept, decisions
+}
+
+// itemDecisions records the same reason for each of items
+func itemDecisions(items []BSEItem, reason, detail string) []Decision {
+	var out []Decision
+	for _, itm := range items {
+		out = append(out, newDecision(itm, reason, detail))
+	}
+	return out
+}
+
+// fetchDecisions records the outcome of fetching items: reported for those in results,
+// failed with the error for those in failures
+func fetchDecisions(items []BSEItem, results []CompanyResult, failures []Failure) []Decision {
+	byName := map[string]BSEItem{}
+	for _, itm := range items {
+		byName[itm.ShortName] = itm
+	}
+	item := func(company, longName string) BSEItem {
+		if itm, ok := byName[company]; ok {
+			return itm
+		}
+		return BSEItem{ShortName: company, LongName: longName}
+	}
+	var out []Decision
+	for _, r := range results {
+		out = append(out, newDecision(item(r.Company, r.LongName), reasonReported, ""))
+	}
+	for _, f := range failures {
+		out = append(out, newDecision(item(f.Company, f.LongName), reasonFailed, f.Error))
+	}
+	return out
+}
+
+// markFiltered turns the reported decisions of companies the filter left out of kept
+// into filtered ones
+func markFiltered(decisions []Decision, filter string, kept []CompanyResult) {
+	if filter == "" {
+		return
+	}
+	in := map[string]bool{}
+	for _, r := range kept {
+		in[r.Company] = true
+	}
+	for i, d := range decisions {
+		if d.Reason == reasonReported && !in[d.Company] {
+			decisions[i].Reported, decisions[i].Reason, decisions[i].Detail = false, reasonFiltered, filter
+		}
+	}
+}
+
+// decisionsDir returns <app dir>/decisions, creating it if needed
+func decisionsDir() (string, error) {
+	appDir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(appDir, "decisions")
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// SaveDecisions stores the day's decisions as decisions/<date>.json, companies in name
+// order, replacing an earlier run of the same day. Errors are logged: the log is an aid,
+// not part of the run.
+func SaveDecisions(date, filter string, decisions []Decision) {
+	if len(decisions) == 0 {
+		return
+	}
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return strings.ToUpper(decisions[i].Company) < strings.ToUpper(decisions[j].Company)
+	})
+	dir, err := decisionsDir()
+	if err != nil {
+		log.Printf("SaveDecisions: %v", err)
+		return
+	}
+	b, err := json.MarshalIndent(DecisionLog{Date: date, Filter: filter, Decisions: decisions}, "", "  ")
+	if err != nil {
+		log.Printf("SaveDecisions: %v", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, date+".json"), b, 0644); err != nil {
+		log.Printf("SaveDecisions: %v", err)
+	}
+}
+
+// runDecisions implements `quarter-compare decisions`: show why each company of a day's
+// BSE list was reported or left out
+func runDecisions(args []string) {
+	fs := flag.NewFlagSet("decisions", flag.ExitOnError)
+	date := fs.String("date", "", "day to show (2006-01-02, default: the latest logged)")
+	company := fs.String("company", "", "only companies whose name or BSE code contains this")
+	skipped := fs.Bool("skipped", false, "only the companies left out of the report")
+	format := fs.String("format", "table", "output format: table or json")
+	fs.Parse(args)
+
+	dir, err := decisionsDir()
+	if err != nil {
+		log.Fatalf("cannot determine decisions dir: %v", err)
+	}
+	path := filepath.Join(dir, *date+".json")
+	if *date == "" {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		if len(files) == 0 {
+			fmt.Println("no decisions logged yet; every run logs them")
+			return
+		}
+		sort.Strings(files)
+		path = files[len(files)-1]
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("decisions: %v", err)
+	}
+	var dl DecisionLog
+	if err := json.Unmarshal(b, &dl); err != nil {
+		log.Fatalf("decisions: %s: %v", path, err)
+	}
+	q := strings.ToLower(*company)
+	var shown []Decision
+	for _, d := range dl.Decisions {
+		if *skipped && d.Reported {
+			continue
+		}
+		if q != "" && !strings.Contains(strings.ToLower(d.Company+" "+d.LongName+" "+d.ScripCode), q) {
+			continue
+		}
+		shown = append(shown, d)
+	}
+
+	switch *format {
+	case "json":
+		dl.Decisions = shown
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dl); err != nil {
+			log.Fatalf("%v", err)
+		}
+	case "table":
+		counts := map[string]int{}
+		for _, d := range dl.Decisions {
+			counts[d.Reason]++
+		}
+		var parts []string
+		for _, r := range []string{reasonReported, reasonFiltered, reasonFailed, reasonOverLimit, reasonOutOfTime, reasonDuplicate, reasonExcluded, reasonGroup, reasonPurpose, reasonOtherDay} {
+			if counts[r] > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", counts[r], r))
+			}
+		}
+		fmt.Printf("%s: %s\n", dl.Date, strings.Join(parts, ", "))
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "COMPANY\tCODE\tMEETING\tREASON\tDETAIL")
+		for _, d := range shown {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Company, d.ScripCode, d.MeetingDate, d.Reason, d.Detail)
+		}
+		tw.Flush()
+	default:
+		log.Fatalf("unknown -format %q (want table or json)", *format)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultDesktopWhen is the desktop alert threshold when notify.desktop.when is not set
+const defaultDesktopWhen = "abs(np_growth) >= 20 || abs(rev_growth) >= 20 || pledge_change > 0"
+
+// desktopMaxLines bounds the companies listed in one notification
+const desktopMaxLines = 8
+
+// desktopAlert shows one native notification listing the results that cross the
+// threshold expression and reports whether it was shown; it does nothing when none do
+func desktopAlert(cfg DesktopConfig, watchlist []string, zeroBase, date string, results []CompanyResult) (bool, error) {
+	when := cfg.When
+	if when == "" {
+		when = defaultDesktopWhen
+	}
+	movers, err := FilterResults(when, watchlist, zeroBase, results)
+	if err != nil {
+		return false, fmt.Errorf("desktop alert: %v", err)
+	}
+	if len(movers) == 0 {
+		return false, nil
+	}
+	SortResults(movers, "np-growth", zeroBase)
+	var lines []string
+	for i, r := range movers {
+		if i == desktopMaxLines {
+			lines = append(lines, fmt.Sprintf("… and %d more", len(movers)-i))
+			break
+		}
+		rev, np := latestGrowth(r, zeroBase)
+		lines = append(lines, fmt.Sprintf("%s: NP %s, rev %s", r.Company, np, rev))
+	}
+	title := fmt.Sprintf("quarter-compare: %d big mover(s) on %s", len(movers), date)
+	if err := sendDesktop(title, strings.Join(lines, "\n")); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sendDesktop shows a native notification: notify-send on linux and the BSDs, osascript
+// on macOS and a PowerShell toast on Windows. Title and body are passed as arguments or
+// environment, never spliced into a script.
+func sendDesktop(title, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv", "-e", "display notification (item 2 of argv) with title (item 1 of argv)", "-e", "end run",
+			title, body)
+	case "windows":
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToastScript)
+		cmd.Env = append(os.Environ(), "QC_TOAST_TITLE="+title, "QC_TOAST_BODY="+body)
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=quarter-compare", title, body)
+	default:
+		return errors.New("desktop notifications are not supported on " + runtime.GOOS)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("desktop notification: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// windowsToastScript shows $env:QC_TOAST_TITLE / $env:QC_TOAST_BODY as a toast
+const windowsToastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName('text')
+$x.Item(0).AppendChild($t.CreateTextNode($env:QC_TOAST_TITLE)) > $null
+$x.Item(1).AppendChild($t.CreateTextNode($env:QC_TOAST_BODY)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('quarter-compare').Show([Windows.UI.Notifications.ToastNotification]::new($t))
+`
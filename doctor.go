@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// doctorCheck is one health check: run returns a detail line on success
+type doctorCheck struct {
+	name string
+	run  func() (string, error)
+	hint string // suggested fix, printed when the check fails
+}
+
+// errSkipped marks a check that could not run because one it depends on failed
+var errSkipped = errors.New("skipped")
+
+// runDoctor implements `quarter-compare doctor`: check that each data source answers and
+// still has the shape the parsers expect, and suggest fixes for what is broken
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	code := fs.String("company", "532540", "BSE code of a known company to test trendlyne with")
+	symbol := fs.String("symbol", "TCS", "symbol of that company")
+	fs.Parse(args)
+
+	var cfg Config
+	client := NewHTTPClient(cfg)
+	var tr TrendItem
+	var pageURL, fundURL string
+	checks := []doctorCheck{
+		{"app dir", func() (string, error) {
+			dir, err := getAppDir()
+			if err != nil {
+				return "", err
+			}
+			probe := filepath.Join(dir, ".doctor")
+			if err := os.WriteFile(probe, nil, 0644); err != nil {
+				return "", err
+			}
+			os.Remove(probe)
+			return dir, nil
+		}, "the app dir must be writable: history, caches and the report live there"},
+		{"config", func() (string, error) {
+			path, err := configFilePath(*configPath)
+			if err != nil {
+				return "", err
+			}
+			if cfg, err = LoadConfig(path); err != nil {
+				return "", err
+			}
+			client.Timeout = time.Duration(cfg.RequestTimeout) * time.Second
+			client.Transport = cfg.transport()
+			if _, err := os.Stat(path); err != nil {
+				return path + " (not found, using defaults)", nil
+			}
+			return path, nil
+		}, "fix the reported field; every section is optional"},
+		{"bse warm-up", func() (string, error) {
+			return "cookies set", WarmUpBSE(client, true)
+		}, "bseindia.com is unreachable or blocks this network; check connectivity or try from another IP"},
+	}
+	failed := 0
+	runChecks := func(checks []doctorCheck) {
+		for _, c := range checks {
+			detail, err := c.run()
+			switch {
+			case errors.Is(err, errSkipped):
+				fmt.Printf("skip  %-18s needs the check above\n", c.name)
+			case err != nil:
+				failed++
+				fmt.Printf("FAIL  %-18s %v\n      fix: %s\n", c.name, err, c.hint)
+			default:
+				fmt.Printf("ok    %-18s %s\n", c.name, detail)
+			}
+		}
+	}
+	// the remaining checks depend on the config
+	runChecks(checks)
+	checks = nil
+
+	endpoints := cfg.BSEEndpoints
+	if len(endpoints) == 0 {
+		endpoints = defaultBSEEndpoints
+	}
+	for i, endpoint := range endpoints {
+		checks = append(checks, doctorCheck{fmt.Sprintf("bse endpoint %d", i+1), func() (string, error) {
+			items, err := FetchBSEList(client, endpoint)
+			if err != nil {
+				return "", err
+			}
+			dated := 0
+			for _, it := range items {
+				if it.MeetingDate != "" && it.ShortName != "" {
+					dated++
+				}
+			}
+			if len(items) > 0 && dated == 0 {
+				return "", fmt.Errorf("%d meetings but none with a name and date; field names changed?", len(items))
+			}
+			return fmt.Sprintf("%d meetings listed by %s", len(items), endpoint), nil
+		}, "an HTML answer usually means stale cookies or a blocked IP, an empty one a quiet day; if the JSON fields changed, add the new names to bseFieldNames or point bse_endpoints elsewhere"})
+	}
+	checks = append(checks,
+		doctorCheck{"bse scrip master", func() (string, error) {
+			scrips, err := FetchScripMaster(client, cfg.ScripMaster.URL)
+			if err != nil {
+				return "", err
+			}
+			grouped := 0
+			for _, s := range scrips {
+				if s.ID != "" && s.Group != "" {
+					grouped++
+				}
+			}
+			if grouped == 0 {
+				return "", fmt.Errorf("%d scrips but none with a symbol and group; field names changed?", len(scrips))
+			}
+			return fmt.Sprintf("%d scrips, %d with a symbol and group", len(scrips), grouped), nil
+		}, "runs go on without it (no group filter, no rename matching); if the JSON fields changed, add the new names to scripFieldNames or set scrip_master.url"},
+		doctorCheck{"nse equity list", func() (string, error) {
+			symbols, err := FetchNSESymbols(client, cfg.ScripMaster.NSEURL)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d NSE symbols", len(symbols)), nil
+		}, "runs go on without NSE symbols (the last ones downloaded are kept); if the CSV columns changed, update decodeNSESymbols or set scrip_master.nse_url"},
+		doctorCheck{"trendlyne login", func() (string, error) {
+			if cfg.Trendlyne.SessionCookie == "" && cfg.Trendlyne.Email == "" {
+				return "not configured (anonymous)", nil
+			}
+			return "session set", TrendlyneLogin(client, cfg.Trendlyne)
+		}, "check trendlyne.email/password, or paste a fresh sessionid cookie as trendlyne.session_cookie; delete trendlyne-session.json to force a new login"},
+		doctorCheck{"trendlyne search", func() (string, error) {
+			var err error
+			if tr, err = ResolveTrendItem(client, BSEItem{ScripCode: *code, ShortName: *symbol}); err != nil {
+				return "", err
+			}
+			pageURL = tr.NextURL
+			if pageURL == "" {
+				pageURL = fmt.Sprintf("https://trendlyne.com/equity/%d/%s/%s/", tr.K, tr.ID, tr.SlugName)
+			}
+			return fmt.Sprintf("%s → %s", tr.Label, pageURL), nil
+		}, "the autocomplete API moved or changed its JSON; compare with the request the trendlyne search box makes"},
+		doctorCheck{"trendlyne page", func() (string, error) {
+			if pageURL == "" {
+				return "", errSkipped
+			}
+			page, err := ScanTrendPage(client, pageURL, cfg.maxBody(), nil, httpValidators{})
+			if err != nil {
+				return "", err
+			}
+			u, meta := page.FundURL, page.Meta
+			if u == "" {
+				return "", errors.New("no data-tablesurl or get-fundamental_results URL on the page")
+			}
+			fundURL = u
+			var missing []string
+			if meta.Sector == "" {
+				missing = append(missing, "sector")
+			}
+			if meta.ISIN == "" {
+				missing = append(missing, "ISIN")
+			}
+			detail := "fundamentals URL found"
+			if len(missing) > 0 {
+				detail += "; no " + strings.Join(missing, ", ") + " on the page"
+			}
+			return detail, nil
+		}, "the page markup changed; save it with `compare -dump-raw dir` and look for the new fundamentals URL"},
+		doctorCheck{"fundamentals", func() (string, error) {
+			if fundURL == "" {
+				return "", errSkipped
+			}
+			root, err := FetchFundamentals(client, fundURL, pageURL, cfg.maxBody(), nil)
+			if err != nil {
+				return "", err
+			}
+			doc, issues := validateFundamentalsRoot(root, cfg.metricRegistry(), time.Time{})
+			if len(issues) > 0 {
+				return "", errors.New(strings.Join(issues, "; "))
+			}
+			return fmt.Sprintf("%d quarters, latest %s", len(doc.Quarters), doc.Quarters[0]), nil
+		}, "when fields were renamed, add the new names under metrics (e.g. {\"name\": \"revenue\", \"keys\": [...]}); a login page instead of JSON means the session expired"},
+		doctorCheck{"plugins", func() (string, error) {
+			plugins, err := DiscoverPlugins(cfg.Plugins)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d found", len(plugins)), nil
+		}, "run `quarter-compare plugins` to see which executable fails to describe itself"},
+	)
+
+	runChecks(checks)
+	if failed > 0 {
+		fmt.Printf("\n%d check(s) failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("\nall checks passed")
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runDuel implements `quarter-compare duel TICKER1 TICKER2`: fetch two companies right
+// away and write a side-by-side page for them
+func runDuel(args []string) {
+	fs := flag.NewFlagSet("duel", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	out := fs.String("o", "", "output file (default: <app dir>/duel.html)")
+	openFlag := fs.Bool("open", false, "open the page in the default browser when written")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: quarter-compare duel [-config file] [-o file] [-assets dir] [-open] TICKER1 TICKER2")
+		fs.PrintDefaults()
+	}
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg := mustLoadConfig(*configPath)
+	if *out == "" {
+		dir, err := getAppDir()
+		if err != nil {
+			log.Fatalf("cannot determine app dir: %v", err)
+		}
+		*out = filepath.Join(dir, "duel.html")
+	}
+
+	client := NewHTTPClient(cfg)
+	if err := TrendlyneLogin(client, cfg.Trendlyne); err != nil {
+		log.Printf("duel: trendlyne login failed, continuing anonymously: %v", err)
+	}
+	plugins, err := DiscoverPlugins(cfg.Plugins)
+	if err != nil {
+		log.Printf("duel: plugins: %v", err)
+	}
+	caches := loadLookupCaches()
+	scrips := loadScripMaster(client, cfg.ScripMaster)
+	var pair [2]CompanyResult
+	for i, ticker := range fs.Args() {
+		cr, err := fetchCompany(client, cfg, plugins, caches, tickerItem(ticker, scrips))
+		if err != nil {
+			log.Fatalf("duel: %s: %v", ticker, err)
+		}
+		pair[i] = cr
+	}
+	caches.save("duel")
+	if err := os.WriteFile(*out, []byte(RenderDuel(pair[0], pair[1], cfg.ZeroBase)), 0644); err != nil {
+		log.Fatalf("write duel page: %v", err)
+	}
+	fmt.Println("duel saved to", *out)
+	showReport(*out, *openFlag)
+}
+
+// tickerItem is the BSE item for a ticker given on the command line, completed from the
+// scrip master; a numeric ticker is a BSE scrip code
+func tickerItem(ticker string, scrips *scripMaster) BSEItem {
+	itm := BSEItem{ShortName: ticker}
+	if _, err := strconv.Atoi(ticker); err == nil {
+		itm.ScripCode = ticker
+	}
+	return scrips.canonical(itm)
+}
+
+// duelMetric is one row of the duel table
+type duelMetric struct {
+	Label          string
+	Value          func(r CompanyResult) float64
+	Format         func(v float64) string
+	HigherIsBetter bool
+}
+
+// duelMetrics are the rows of the duel table, in order, growth under the zero_base policy
+func duelMetrics(zeroBase string) []duelMetric {
+	return []duelMetric{
+		{"Revenue (latest)", func(r CompanyResult) float64 { rev, _ := latestGrowth(r, zeroBase); return rev.Curr }, formatCr, true},
+		{"Net profit (latest)", func(r CompanyResult) float64 { _, np := latestGrowth(r, zeroBase); return np.Curr }, formatCr, true},
+		{"Revenue %Δ QoQ", func(r CompanyResult) float64 { rev, _ := latestGrowth(r, zeroBase); return rev.Pct }, formatPct, true},
+		{"Net profit %Δ QoQ", func(r CompanyResult) float64 { _, np := latestGrowth(r, zeroBase); return np.Pct }, formatPct, true},
+		{"Net margin", func(r CompanyResult) float64 {
+			rev, np := latestGrowth(r, zeroBase)
+			if !(rev.Curr > 0) {
+				return math.NaN()
+			}
+			return np.Curr / rev.Curr * 100
+		}, formatPct, true},
+		{"Revenue (TTM)", func(r CompanyResult) float64 { return ttm(r.Quarters, r.RevenueNums) }, formatCr, true},
+		{"Net profit (TTM)", func(r CompanyResult) float64 { return ttm(r.Quarters, r.NetProfitNums) }, formatCr, true},
+		{"Market cap", func(r CompanyResult) float64 { return r.MarketCap }, formatCr, true},
+		{"P/E", func(r CompanyResult) float64 { return Valuate(r).PE }, formatMultiple, false},
+		{"P/B", func(r CompanyResult) float64 { return Valuate(r).PB }, formatMultiple, false},
+		{"EV/EBITDA", func(r CompanyResult) float64 { return Valuate(r).EVEBITDA }, formatMultiple, false},
+		{"ROE", func(r CompanyResult) float64 { return r.ROE }, formatPct, true},
+		{"ROCE", func(r CompanyResult) float64 { return r.ROCE }, formatPct, true},
+		{"Debt / equity", func(r CompanyResult) float64 { return r.DebtToEquity }, formatRatio, false},
+		{"Interest cover", func(r CompanyResult) float64 { return interestCoverage(r, 0) }, formatMultiple, true},
+		{"Promoter holding", func(r CompanyResult) float64 { return r.PromoterHolding }, formatPct, true},
+		{"Pledged", func(r CompanyResult) float64 { return r.Pledged }, formatPct, false},
+	}
+}
+
+// formatCr formats an amount in ₹ cr for a table cell
+func formatCr(v float64) string {
+	return Column{Format: "cr"}.String(v)
+}
+
+// RenderDuel builds the side-by-side page for a and b: overlaid revenue and net profit
+// charts over their last quarters, and a table of every metric with the difference, growth
+// under the zero_base policy
+func RenderDuel(a, b CompanyResult, zeroBase string) string {
+	name := func(r CompanyResult) string {
+		if r.LongName != "" {
+			return r.Company + " (" + r.LongName + ")"
+		}
+		return r.Company
+	}
+	var sb strings.Builder
+	sb.WriteString("<!doctype html><html><head><meta charset='utf-8'><title>" + html.EscapeString(a.Company+" vs "+b.Company) + "</title>")
+	sb.WriteString(styleTag("duel.css") + "</head><body>")
+	sb.WriteString("<h2><span class='swatch-a'>■</span> " + html.EscapeString(name(a)) + " vs <span class='swatch-b'>■</span> " + html.EscapeString(name(b)) + "</h2>")
+
+	// charts: oldest quarter on the left; quarter labels are a's, falling back to b's
+	series := func(vals []float64) []interface{} {
+		out := jsonFloats(vals)
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+		return out
+	}
+	labels := make([]string, max(len(a.Quarters), len(b.Quarters)))
+	for i := range labels {
+		q := ""
+		if i < len(a.Quarters) {
+			q = a.Quarters[i].String()
+		}
+		if q == "" && i < len(b.Quarters) {
+			q = b.Quarters[i].String()
+		}
+		labels[len(labels)-1-i] = q
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"labels": labels,
+		"names":  []string{a.Company, b.Company},
+		"revenue": [][]interface{}{
+			series(a.RevenueNums), series(b.RevenueNums),
+		},
+		"netprofit": [][]interface{}{
+			series(a.NetProfitNums), series(b.NetProfitNums),
+		},
+	})
+	sb.WriteString("<div class='charts'><div><h3>Revenue (₹ cr)</h3><canvas id='revChart'></canvas></div><div><h3>Net profit (₹ cr)</h3><canvas id='npChart'></canvas></div></div>")
+	if len(a.Quarters) > 0 && len(b.Quarters) > 0 && a.Quarters[0] != b.Quarters[0] {
+		sb.WriteString("<p class='small'>The latest quarters differ (" + html.EscapeString(a.Quarters[0].String()+" vs "+b.Quarters[0].String()) + "); the charts line the companies up by position, labelled with " + html.EscapeString(a.Company) + "'s quarters.</p>")
+	}
+
+	sb.WriteString("<h3>Metric by metric</h3><table><thead><tr><th>Metric</th><th>" + html.EscapeString(a.Company) + "</th><th>" + html.EscapeString(b.Company) + "</th><th>Δ (" + html.EscapeString(a.Company+" − "+b.Company) + ")</th></tr></thead><tbody>")
+	for _, m := range duelMetrics(zeroBase) {
+		va, vb := m.Value(a), m.Value(b)
+		if math.IsNaN(va) && math.IsNaN(vb) {
+			continue
+		}
+		ca, cb := "", ""
+		if !math.IsNaN(va) && !math.IsNaN(vb) && va != vb {
+			if (va > vb) == m.HigherIsBetter {
+				ca = "better"
+			} else {
+				cb = "better"
+			}
+		}
+		sb.WriteString("<tr><td class='left'>" + html.EscapeString(m.Label) + "</td>")
+		sb.WriteString("<td class='" + ca + "'>" + html.EscapeString(m.Format(va)) + "</td>")
+		sb.WriteString("<td class='" + cb + "'>" + html.EscapeString(m.Format(vb)) + "</td>")
+		sb.WriteString("<td>" + html.EscapeString(formatDelta(m, va-vb)) + "</td></tr>")
+	}
+	sb.WriteString("</tbody></table><p class='small'>Green marks the better side of each metric. Δ of percentages is in points.</p>")
+
+	sb.WriteString("<script>var QC_DUEL = " + string(data) + ";</script>")
+	sb.WriteString(scriptTag("duel.js"))
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+// formatDelta formats the difference of a duel metric: signed, in the metric's unit
+// (points for percentages)
+func formatDelta(m duelMetric, d float64) string {
+	if math.IsNaN(d) {
+		return "–"
+	}
+	s := m.Format(math.Abs(d))
+	if strings.HasSuffix(s, "%") {
+		s = strings.TrimSuffix(s, "%") + " pts"
+	}
+	if d < 0 {
+		return "−" + s
+	}
+	return "+" + s
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dumpRaw saves a raw response under <dir>/<company>/<name> for debugging parse failures
+// (-dump-raw). It is a no-op when dir is empty; write errors are only logged.
+func dumpRaw(dir, company, name string, body []byte) {
+	if dir == "" {
+		return
+	}
+	companyDir := filepath.Join(dir, safeFileName(company))
+	if err := os.MkdirAll(companyDir, 0o755); err != nil {
+		log.Printf("dumpRaw: %v", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(companyDir, name), body, 0644); err != nil {
+		log.Printf("dumpRaw: %v", err)
+	}
+}
+
+// dumpRawFile creates <dir>/<company>/<name> for a response that is dumped as it streams
+// in. It returns nil when dir is empty or the file can't be created (logged).
+func dumpRawFile(dir, company, name string) *os.File {
+	if dir == "" {
+		return nil
+	}
+	companyDir := filepath.Join(dir, safeFileName(company))
+	if err := os.MkdirAll(companyDir, 0o755); err != nil {
+		log.Printf("dumpRawFile: %v", err)
+		return nil
+	}
+	f, err := os.Create(filepath.Join(companyDir, name))
+	if err != nil {
+		log.Printf("dumpRawFile: %v", err)
+		return nil
+	}
+	return f
+}
+
+// safeFileName replaces characters that are unsafe in file names
+func safeFileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(s))
+	if s == "" || strings.Trim(s, ".") == "" {
+		return "_"
+	}
+	return s
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig sends the alerts as an HTML digest through an SMTP server: every alert to
+// To, and to each route the alerts matching its expression
+type EmailConfig struct {
+	Host      string       `json:"host"`
+	Port      int          `json:"port"` // default 587 (STARTTLS); 465 is implicit TLS
+	Username  string       `json:"username"`
+	Password  string       `json:"password" secret:"true"`
+	From      string       `json:"from"` // default: username
+	To        []string     `json:"to"`
+	Attach    string       `json:"attach"`     // "csv" or "xlsx": attach the day's export for To
+	ReportURL string       `json:"report_url"` // link to the full report in the digest, e.g. the published site
+	Routes    []EmailRoute `json:"routes"`
+}
+
+// EmailRoute sends the alerts matching When to more recipients, e.g. watchlist alerts to
+// a phone's mail-to-SMS address and the full digest with the report to a team list
+type EmailRoute struct {
+	To     []string `json:"to"`
+	When   string   `json:"when"`   // filter expression (see expr.go), e.g. "watchlist"; empty: every alert
+	Attach string   `json:"attach"` // "csv" or "xlsx"
+	Report bool     `json:"report"` // attach the HTML report
+}
+
+func (c EmailConfig) enabled() bool {
+	return c.Host != "" && (len(c.To) > 0 || len(c.Routes) > 0)
+}
+
+// routes returns To as a route for every alert, followed by the configured routes
+func (c EmailConfig) routes() []EmailRoute {
+	var out []EmailRoute
+	if len(c.To) > 0 {
+		out = append(out, EmailRoute{To: c.To, Attach: c.Attach})
+	}
+	return append(out, c.Routes...)
+}
+
+// checkEmail validates the attachment formats and route expressions
+func checkEmail(c EmailConfig) error {
+	for i, r := range c.routes() {
+		if r.Attach != "" && r.Attach != "csv" && r.Attach != "xlsx" {
+			return fmt.Errorf("attach %q: want csv or xlsx", r.Attach)
+		}
+		if len(r.To) == 0 {
+			return fmt.Errorf("route %d has no recipients", i)
+		}
+		if r.When != "" {
+			if _, err := ParseExpr(r.When); err != nil {
+				return fmt.Errorf("route %d: when: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// emailAttachment is a file attached to an email
+type emailAttachment struct {
+	Name, Type string
+	Data       []byte
+}
+
+// exportAttachment renders the day's results as the CSV or XLSX export (see exportHeader)
+func exportAttachment(format, day string, results []CompanyResult, zeroBase string) (emailAttachment, error) {
+	rows := BuildExportRows(day, results, zeroBase)
+	var buf bytes.Buffer
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(&buf)
+		cw.Write(exportHeader)
+		for _, row := range rows {
+			cw.Write(csvValues(row.Values()))
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return emailAttachment{}, err
+		}
+		return emailAttachment{"quarter-compare-" + day + ".csv", "text/csv", buf.Bytes()}, nil
+	case "xlsx":
+		vals := make([][]interface{}, len(rows))
+		for i, row := range rows {
+			vals[i] = row.Values()
+		}
+		if err := writeXLSX(&buf, exportHeader, vals); err != nil {
+			return emailAttachment{}, err
+		}
+		return emailAttachment{"quarter-compare-" + day + ".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes()}, nil
+	}
+	return emailAttachment{}, fmt.Errorf("unknown attachment format %q", format)
+}
+
+// digestMovers is how many top and bottom movers the digest lists
+const digestMovers = 5
+
+// digest colours; email clients drop <style> blocks and classes, so everything is inline
+const (
+	digestPositive = "#d4edda"
+	digestNegative = "#f8d7da"
+	digestCell     = "padding:4px 8px;border:1px solid #dddddd;font-family:Arial,Helvetica,sans-serif;font-size:13px;"
+)
+
+// renderDigest builds the email body for the alerts of date: the alerted results, the top
+// and bottom movers of the day and how many companies failed. It is laid out with tables,
+// inline styles and bgcolor attributes only, at most 600px wide, which Gmail and Outlook
+// (Word's renderer) both display the same way. Growth follows the zero_base policy.
+func renderDigest(date string, alerted, results []CompanyResult, failures []Failure, reportURL, zeroBase string) string {
+	var sb strings.Builder
+	sb.WriteString("<!doctype html><html><head><meta charset='utf-8'><meta name='viewport' content='width=device-width'></head>")
+	sb.WriteString("<body style='margin:0;padding:0;background:#f4f4f4'>")
+	sb.WriteString("<table role='presentation' width='100%' cellpadding='0' cellspacing='0' border='0' bgcolor='#f4f4f4'><tr><td align='center' style='padding:12px'>")
+	sb.WriteString("<table role='presentation' width='600' cellpadding='0' cellspacing='0' border='0' bgcolor='#ffffff' style='width:600px;max-width:100%;border-collapse:collapse'>")
+	sb.WriteString("<tr><td style='" + digestCell + "border:0;padding:16px 16px 4px;font-size:18px;font-weight:bold'>Quarter Compare — " + html.EscapeString(date) + "</td></tr>")
+	summary := fmt.Sprintf("%d result(s) alerted, %d companies reported", len(alerted), len(results))
+	if len(failures) > 0 {
+		summary += fmt.Sprintf(", <b style='color:#c0392b'>%d failed</b>", len(failures))
+	}
+	sb.WriteString("<tr><td style='" + digestCell + "border:0;padding:0 16px 12px;color:#555555'>" + summary + "</td></tr>")
+
+	section := func(title string, rows []CompanyResult) {
+		if len(rows) == 0 {
+			return
+		}
+		sb.WriteString("<tr><td style='padding:8px 16px'>")
+		sb.WriteString("<div style='font-family:Arial,Helvetica,sans-serif;font-size:14px;font-weight:bold;padding-bottom:4px'>" + html.EscapeString(title) + "</div>")
+		sb.WriteString("<table role='presentation' width='100%' cellpadding='0' cellspacing='0' border='0' style='border-collapse:collapse'>")
+		sb.WriteString("<tr><td bgcolor='#f2f2f2' style='" + digestCell + "font-weight:bold'>Company</td>" +
+			"<td bgcolor='#f2f2f2' style='" + digestCell + "font-weight:bold'>Quarter</td>" +
+			"<td bgcolor='#f2f2f2' align='right' style='" + digestCell + "font-weight:bold'>NP %Δ</td>" +
+			"<td bgcolor='#f2f2f2' align='right' style='" + digestCell + "font-weight:bold'>Rev %Δ</td></tr>")
+		for _, r := range rows {
+			rev, np := latestGrowth(r, zeroBase)
+			name := html.EscapeString(r.Company)
+			if pledgeRising(r) {
+				name += " <span style='color:#c0392b'>⚠ pledge ↑</span>"
+			}
+			sb.WriteString("<tr><td style='" + digestCell + "'>" + name + "</td><td style='" + digestCell + "'>" + html.EscapeString(firstQuarter(r)) + "</td>")
+			sb.WriteString(digestGrowthCell(np) + digestGrowthCell(rev) + "</tr>")
+		}
+		sb.WriteString("</table></td></tr>")
+	}
+	section("Alerts", alerted)
+	top, bottom := digestMoverLists(results, digestMovers, zeroBase)
+	section(fmt.Sprintf("Top %d by NP growth", len(top)), top)
+	section(fmt.Sprintf("Bottom %d by NP growth", len(bottom)), bottom)
+
+	if reportURL != "" {
+		sb.WriteString("<tr><td style='" + digestCell + "border:0;padding:12px 16px'><a href='" + html.EscapeString(reportURL) + "' style='color:#1976d2'>Open the full report</a></td></tr>")
+	}
+	sb.WriteString("<tr><td style='" + digestCell + "border:0;padding:8px 16px 16px;font-size:11px;color:#888888'>Sent by quarter-compare; ▲/▼ mark the direction of growth.</td></tr>")
+	sb.WriteString("</table></td></tr></table></body></html>")
+	return sb.String()
+}
+
+// digestGrowthCell renders a growth figure as a shaded, right-aligned cell
+func digestGrowthCell(g growth) string {
+	bg, sign := "", ""
+	switch g.class() {
+	case "positive":
+		bg, sign = " bgcolor='"+digestPositive+"'", "▲ "
+	case "negative":
+		bg, sign = " bgcolor='"+digestNegative+"'", "▼ "
+	}
+	return "<td align='right'" + bg + " style='" + digestCell + "'>" + sign + html.EscapeString(g.String()) + "</td>"
+}
+
+// digestMoverLists returns up to n results with the highest and the lowest NP growth
+// under the zero_base policy
+func digestMoverLists(results []CompanyResult, n int, zeroBase string) (top, bottom []CompanyResult) {
+	var movers []CompanyResult
+	for _, r := range results {
+		if _, np := latestGrowth(r, zeroBase); !math.IsNaN(np.Pct) {
+			movers = append(movers, r)
+		}
+	}
+	npPct := func(r CompanyResult) float64 { _, np := latestGrowth(r, zeroBase); return np.Pct }
+	sort.SliceStable(movers, func(i, j int) bool { return npPct(movers[i]) > npPct(movers[j]) })
+	top = movers[:min(n, len(movers))]
+	for i := len(movers) - 1; i >= len(top) && len(bottom) < n; i-- {
+		bottom = append(bottom, movers[i])
+	}
+	return top, bottom
+}
+
+// buildEmail assembles a multipart/alternative message with a plain-text and an HTML part,
+// both quoted-printable so no line exceeds the SMTP limit. With attachments it is wrapped
+// in multipart/mixed, the attachments base64-encoded.
+func buildEmail(from string, to []string, subject, text, htmlBody string, attachments []emailAttachment) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ typ, content string }{{"text/plain", text}, {"text/html", htmlBody}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.typ + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	contentType := mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()})
+	if len(attachments) > 0 {
+		var mixed bytes.Buffer
+		mx := multipart.NewWriter(&mixed)
+		w, err := mx.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+		if err != nil {
+			return nil, err
+		}
+		w.Write(body.Bytes())
+		for _, a := range attachments {
+			w, err := mx.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {mime.FormatMediaType(a.Type, map[string]string{"name": a.Name})},
+				"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+				"Content-Transfer-Encoding": {"base64"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			enc := base64.StdEncoding.EncodeToString(a.Data)
+			for len(enc) > 76 {
+				io.WriteString(w, enc[:76]+"\r\n")
+				enc = enc[76:]
+			}
+			io.WriteString(w, enc+"\r\n")
+		}
+		if err := mx.Close(); err != nil {
+			return nil, err
+		}
+		body = mixed
+		contentType = mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mx.Boundary()})
+	}
+
+	var msg bytes.Buffer
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := "quarter-compare"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%x@%s>\r\n", id, domain)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n\r\n", contentType)
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// sendEmail delivers msg through the configured SMTP server: implicit TLS on port 465,
+// else STARTTLS when the server offers it, authenticating when a username is set
+func sendEmail(cfg EmailConfig, to []string, msg []byte) error {
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	var c *smtp.Client
+	if port == 465 {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: cfg.Host})
+		if err != nil {
+			return fmt.Errorf("email: %v", err)
+		}
+		if c, err = smtp.NewClient(conn, cfg.Host); err != nil {
+			conn.Close()
+			return fmt.Errorf("email: %v", err)
+		}
+	} else {
+		var err error
+		if c, err = smtp.Dial(addr); err != nil {
+			return fmt.Errorf("email: %v", err)
+		}
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+				c.Close()
+				return fmt.Errorf("email: starttls: %v", err)
+			}
+		}
+	}
+	defer c.Close()
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("email: auth: %v", err)
+		}
+	}
+	if err := c.Mail(emailAddress(cfg.sender())); err != nil {
+		return fmt.Errorf("email: %v", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(emailAddress(rcpt)); err != nil {
+			return fmt.Errorf("email: %s: %v", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("email: %v", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("email: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("email: %v", err)
+	}
+	return c.Quit()
+}
+
+// sender returns the From address
+func (c EmailConfig) sender() string {
+	if c.From != "" {
+		return c.From
+	}
+	return c.Username
+}
+
+// emailAddress returns the bare address of "Name <addr>"
+func emailAddress(s string) string {
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		return strings.TrimSuffix(strings.TrimSpace(s[i+1:]), ">")
+	}
+	return strings.TrimSpace(s)
+}
+
+// emailDigest sends each route the digest of its alerts of day, with the attachments it
+// asks for; reportFile is the HTML report on disk. A route with no matching alert gets no
+// mail. Every route is tried; it reports whether any mail went out and the first error.
+func emailDigest(cfg EmailConfig, watchlist []string, zeroBase, day string, fresh, changed, results []CompanyResult, failures []Failure, reportFile string) (bool, error) {
+	sent := false
+	var first error
+	fail := func(err error) {
+		log.Printf("emailDigest: %v", err)
+		if first == nil {
+			first = err
+		}
+	}
+	for _, route := range cfg.routes() {
+		routeFresh, err := FilterResults(route.When, watchlist, zeroBase, fresh)
+		if err != nil {
+			fail(fmt.Errorf("email: when: %v", err))
+			continue
+		}
+		routeChanged, err := FilterResults(route.When, watchlist, zeroBase, changed)
+		if err != nil {
+			fail(fmt.Errorf("email: when: %v", err))
+			continue
+		}
+		alerted := append(append([]CompanyResult{}, routeFresh...), routeChanged...)
+		if len(alerted) == 0 {
+			continue
+		}
+		var attachments []emailAttachment
+		if route.Attach != "" {
+			a, err := exportAttachment(route.Attach, day, results, zeroBase)
+			if err != nil {
+				fail(fmt.Errorf("email: %v", err))
+				continue
+			}
+			attachments = append(attachments, a)
+		}
+		if route.Report && reportFile != "" {
+			b, err := os.ReadFile(reportFile)
+			if err != nil {
+				fail(fmt.Errorf("email: %v", err))
+				continue
+			}
+			attachments = append(attachments, emailAttachment{"quarter-compare-" + day + ".html", "text/html", b})
+		}
+		subject := fmt.Sprintf("Quarter Compare %s: %d result(s)", day, len(alerted))
+		msg, err := buildEmail(cfg.sender(), route.To, subject, alertMessage(day, routeFresh, routeChanged, zeroBase),
+			renderDigest(day, alerted, results, failures, cfg.ReportURL, zeroBase), attachments)
+		if err != nil {
+			fail(fmt.Errorf("email: %v", err))
+			continue
+		}
+		if err := sendEmail(cfg, route.To, msg); err != nil {
+			fail(err)
+			continue
+		}
+		sent = true
+	}
+	return sent, first
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding is advertised on every request made through NewHTTPClient
+const acceptEncoding = "gzip, deflate, br"
+
+// maxDecodedBody caps a decompressed response, so a decompression bomb fails with
+// bodyTooLargeError instead of filling memory
+const maxDecodedBody = 256 << 20
+
+// decodingTransport advertises gzip, deflate and brotli and decompresses responses
+// itself. Setting Accept-Encoding turns off net/http's own gzip handling, so every
+// encoding is handled here; bodies that arrive gzip-compressed without a
+// Content-Encoding header (BSE does this to some clients) are detected by their magic
+// bytes.
+type decodingTransport struct {
+	base http.RoundTripper
+}
+
+func (t decodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || req.Method == http.MethodHead || resp.Body == http.NoBody {
+		return resp, err
+	}
+	if err := decodeBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// decodeBody replaces resp.Body with its decoded form, undoing each Content-Encoding
+// in reverse order
+func decodeBody(resp *http.Response) error {
+	var encodings []string
+	for _, e := range strings.Split(resp.Header.Get("Content-Encoding"), ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" && e != "identity" {
+			encodings = append(encodings, e)
+		}
+	}
+	body := resp.Body
+	br := bufio.NewReader(body)
+	var r io.Reader = br
+	if len(encodings) == 0 {
+		if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+			encodings = []string{"gzip"}
+		} else {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{br, body}
+			return nil
+		}
+	}
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(r)
+		case "deflate":
+			r, err = newDeflateReader(r)
+		case "br":
+			r = brotli.NewReader(r)
+		default:
+			return fmt.Errorf("unsupported Content-Encoding %q", encodings[i])
+		}
+		if err != nil {
+			return fmt.Errorf("decode %s response: %v", encodings[i], err)
+		}
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{&cappedReader{r: r, limit: maxDecodedBody}, body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// newDeflateReader reads "deflate" bodies, which are meant to be zlib-wrapped but are
+// raw DEFLATE from some servers
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	h, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
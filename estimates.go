@@ -0,0 +1,506 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Analyst estimates are only published as the current consensus, so how expectations moved
+// before a result has to be recorded as it happens: `estimates` (run daily, e.g. from cron)
+// snapshots the consensus of the companies meeting soon into <app dir>/estimates.json,
+// and a run compares each result with the snapshots taken before it was declared.
+
+// defaultEstimatesURL is the trendlyne consensus endpoint; {k}, {id} and {slug} are the
+// company's trendlyne stock pk, code and slug (see TrendItem)
+const defaultEstimatesURL = "https://trendlyne.com/equity/api/stock/consensus-estimates/{k}/{id}/{slug}/"
+
+// default estimates settings: the window before a result the consensus move is measured
+// over, and how many days ahead `estimates` snapshots upcoming meetings
+const (
+	defaultEstimatesWindow = 28 * 24 * time.Hour
+	defaultEstimatesDays   = 30
+)
+
+// Estimate is the consensus for one quarter as published at a time; nil when not given
+type Estimate struct {
+	At        time.Time `json:"at"`
+	Quarter   Quarter   `json:"quarter"`
+	Revenue   *float64  `json:"revenue,omitempty"`    // ₹ cr
+	NetProfit *float64  `json:"net_profit,omitempty"` // ₹ cr
+	EPS       *float64  `json:"eps,omitempty"`        // ₹
+	Analysts  int       `json:"analysts,omitempty"`
+}
+
+// same reports whether e and o give the same figures
+func (e Estimate) same(o Estimate) bool {
+	eq := func(a, b *float64) bool { return (a == nil) == (b == nil) && (a == nil || *a == *b) }
+	return eq(e.Revenue, o.Revenue) && eq(e.NetProfit, o.NetProfit) && eq(e.EPS, o.EPS) && e.Analysts == o.Analysts
+}
+
+// normalized field names of the consensus figures, matched on the start of a key
+var estimateFieldNames = struct {
+	Period, Revenue, NetProfit, EPS, Analysts []string
+}{
+	Period:    []string{"quarter", "period", "label", "date", "fiscal"},
+	Revenue:   []string{"revenue", "sales", "totalrevenue", "netsales"},
+	NetProfit: []string{"netprofit", "pat", "netincome", "profit"},
+	EPS:       []string{"eps"},
+	Analysts:  []string{"analysts", "numanalysts", "noofanalysts", "numberofanalysts", "estimates", "count"},
+}
+
+// estimateField is the number under the first key of m starting with one of names, skipping
+// reported and surprise figures; NaN when there is none
+func estimateField(m map[string]interface{}, names []string) float64 {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, n := range names {
+		for _, k := range keys {
+			nk := normalizeKey(k)
+			if !strings.HasPrefix(nk, n) || strings.Contains(nk, "actual") || strings.Contains(nk, "surprise") || strings.Contains(nk, "reported") {
+				continue
+			}
+			if f := quarterValueToFloat64(valueFromMap(m, k)); !math.IsNaN(f) {
+				return f
+			}
+		}
+	}
+	return math.NaN()
+}
+
+// decodeEstimates finds the quarterly consensus figures anywhere in a decoded response:
+// objects with a quarter label under a period key, or objects keyed by quarter label,
+// holding at least one of revenue, net profit and EPS. Annual figures are skipped.
+func decodeEstimates(v interface{}, at time.Time) []Estimate {
+	byQuarter := map[Quarter]Estimate{}
+	add := func(q Quarter, m map[string]interface{}) {
+		e := Estimate{At: at, Quarter: q,
+			Revenue:   nullableFloat(estimateField(m, estimateFieldNames.Revenue)),
+			NetProfit: nullableFloat(estimateField(m, estimateFieldNames.NetProfit)),
+			EPS:       nullableFloat(estimateField(m, estimateFieldNames.EPS)),
+		}
+		if n := estimateField(m, estimateFieldNames.Analysts); n > 0 && n < 1000 {
+			e.Analysts = int(n)
+		}
+		if _, seen := byQuarter[q]; !seen && (e.Revenue != nil || e.NetProfit != nil || e.EPS != nil) {
+			byQuarter[q] = e
+		}
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			for _, n := range estimateFieldNames.Period {
+				for k, pv := range vv {
+					if s, ok := pv.(string); ok && strings.HasPrefix(normalizeKey(k), n) {
+						if q := ParseQuarter(s); q.Known() {
+							add(q, vv)
+						}
+					}
+				}
+			}
+			keys := make([]string, 0, len(vv))
+			for k := range vv {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if m, ok := vv[k].(map[string]interface{}); ok {
+					if q := ParseQuarter(k); q.Known() {
+						add(q, m)
+					}
+				}
+				walk(vv[k])
+			}
+		case []interface{}:
+			for _, x := range vv {
+				walk(x)
+			}
+		}
+	}
+	walk(v)
+	out := make([]Estimate, 0, len(byQuarter))
+	for _, e := range byQuarter {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Quarter.End().Before(out[j].Quarter.End()) })
+	return out
+}
+
+// estimatesURL fills the company's trendlyne identifiers into the configured template
+func estimatesURL(template string, e symbolEntry) string {
+	if template == "" {
+		template = defaultEstimatesURL
+	}
+	return strings.NewReplacer("{k}", strconv.Itoa(e.K), "{id}", e.TrendID, "{slug}", e.Slug).Replace(template)
+}
+
+// FetchEstimates fetches the consensus estimates of a company from estURL
+func FetchEstimates(client *http.Client, estURL, referer string, maxBody int64) ([]Estimate, error) {
+	req, _ := http.NewRequest("GET", estURL, nil)
+	req.Header.Set("accept", "application/json")
+	req.Header.Set("referer", referer)
+	req.Header.Set("user-agent", "go-client")
+	req.Header.Set("x-requested-with", "XMLHttpRequest")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var v interface{}
+	if err := json.NewDecoder(&cappedReader{r: resp.Body, limit: maxBody}).Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return decodeEstimates(v, time.Now()), nil
+}
+
+// estimateStore is <app dir>/estimates.json: the consensus snapshots of each company by
+// symbol key (see symbolKey), oldest first, a new one only when the figures changed
+type estimateStore struct {
+	path      string
+	Snapshots map[string][]Estimate
+}
+
+// loadEstimates reads the estimate store; a missing or unreadable file gives an empty one
+func loadEstimates() *estimateStore {
+	dir, err := getAppDir()
+	if err != nil {
+		log.Printf("loadEstimates: %v", err)
+		return nil
+	}
+	s := &estimateStore{path: filepath.Join(dir, "estimates.json"), Snapshots: map[string][]Estimate{}}
+	b, err := os.ReadFile(s.path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &s.Snapshots); err != nil {
+			log.Printf("loadEstimates: ignoring %s: %v", s.path, err)
+			s.Snapshots = map[string][]Estimate{}
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("loadEstimates: %v", err)
+	}
+	return s
+}
+
+// record adds the estimates fetched for a company, skipping those that repeat the
+// quarter's latest snapshot; it returns how many were added
+func (s *estimateStore) record(key string, ests []Estimate) int {
+	added := 0
+	for _, e := range ests {
+		if last, ok := s.latest(key, e.Quarter, e.At.Add(time.Nanosecond)); ok && last.same(e) {
+			continue
+		}
+		s.Snapshots[key] = append(s.Snapshots[key], e)
+		added++
+	}
+	return added
+}
+
+// latest returns the last snapshot of quarter q taken before t
+func (s *estimateStore) latest(key string, q Quarter, t time.Time) (Estimate, bool) {
+	var out Estimate
+	found := false
+	if s == nil {
+		return out, false
+	}
+	for _, e := range s.Snapshots[key] {
+		if e.Quarter == q && e.At.Before(t) && (!found || !e.At.Before(out.At)) {
+			out, found = e, true
+		}
+	}
+	return out, found
+}
+
+// earliest returns the first snapshot of quarter q taken before t
+func (s *estimateStore) earliest(key string, q Quarter, t time.Time) (Estimate, bool) {
+	var out Estimate
+	found := false
+	for _, e := range s.Snapshots[key] {
+		if e.Quarter == q && e.At.Before(t) && (!found || e.At.Before(out.At)) {
+			out, found = e, true
+		}
+	}
+	return out, found
+}
+
+func (s *estimateStore) save() error {
+	b, err := json.MarshalIndent(s.Snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// ConsensusFigure is a consensus figure at the start of the window (Was) and just before
+// the result (Now), and the figure reported; nil when unknown
+type ConsensusFigure struct {
+	Was    *float64 `json:"was,omitempty"`
+	Now    *float64 `json:"now,omitempty"`
+	Actual *float64 `json:"actual,omitempty"`
+}
+
+// Move is the % change of the consensus over the window, NaN when unknown
+func (f ConsensusFigure) Move() float64 {
+	if f.Was == nil || f.Now == nil {
+		return math.NaN()
+	}
+	return pctOrNaN(*f.Now, *f.Was)
+}
+
+// Surprise is the % by which the reported figure beat (>0) or missed the consensus
+func (f ConsensusFigure) Surprise() float64 {
+	if f.Now == nil || f.Actual == nil {
+		return math.NaN()
+	}
+	return pctOrNaN(*f.Actual, *f.Now)
+}
+
+// Consensus is how the analysts' consensus for a result's latest quarter moved in the
+// window before the result was declared (see attachConsensus)
+type Consensus struct {
+	Quarter   Quarter         `json:"quarter"`
+	Since     time.Time       `json:"since"` // the snapshot the move is measured from
+	At        time.Time       `json:"at"`    // the last snapshot before the result
+	Declared  time.Time       `json:"declared"`
+	Analysts  int             `json:"analysts,omitempty"`
+	Revenue   ConsensusFigure `json:"revenue"`
+	NetProfit ConsensusFigure `json:"net_profit"`
+	EPS       ConsensusFigure `json:"eps"`
+}
+
+// main is the figure the report leads with: net profit, else revenue, else EPS
+func (c Consensus) main() (string, ConsensusFigure) {
+	switch {
+	case c.NetProfit.Now != nil:
+		return "NP", c.NetProfit
+	case c.Revenue.Now != nil:
+		return "Revenue", c.Revenue
+	}
+	return "EPS", c.EPS
+}
+
+// consensusFor builds the Consensus of r's latest quarter from the snapshots of key taken
+// before declared: the last one, and the one in effect window earlier (else the first one
+// recorded). nil when no snapshot precedes the result.
+func consensusFor(s *estimateStore, key string, r CompanyResult, declared time.Time, window time.Duration) *Consensus {
+	if len(r.Quarters) == 0 || !r.Quarters[0].Known() {
+		return nil
+	}
+	q := r.Quarters[0]
+	now, ok := s.latest(key, q, declared)
+	if !ok {
+		return nil
+	}
+	was, ok := s.latest(key, q, declared.Add(-window).Add(time.Nanosecond))
+	if !ok {
+		was, _ = s.earliest(key, q, declared)
+	}
+	eps := math.NaN()
+	for _, n := range epsNames {
+		if vals := r.Metrics[n]; len(vals) > 0 && !math.IsNaN(vals[0]) {
+			eps = vals[0]
+			break
+		}
+	}
+	since := was.At
+	if start := declared.Add(-window); since.Before(start) {
+		since = start // the snapshot was still the consensus when the window opened
+	}
+	return &Consensus{
+		Quarter: q, Since: since, At: now.At, Declared: declared, Analysts: now.Analysts,
+		Revenue:   ConsensusFigure{Was: was.Revenue, Now: now.Revenue, Actual: nullableFloat(valueAt(r.RevenueNums, 0))},
+		NetProfit: ConsensusFigure{Was: was.NetProfit, Now: now.NetProfit, Actual: nullableFloat(valueAt(r.NetProfitNums, 0))},
+		EPS:       ConsensusFigure{Was: was.EPS, Now: now.EPS, Actual: nullableFloat(eps)},
+	}
+}
+
+// attachConsensus sets the Consensus of every result with estimate snapshots from before
+// it was declared (DeclaredAt, else the start of day)
+func attachConsensus(results []CompanyResult, items []BSEItem, s *estimateStore, day time.Time, window time.Duration) {
+	if s == nil || len(s.Snapshots) == 0 {
+		return
+	}
+	keys := make(map[string]string, len(items))
+	for _, it := range items {
+		keys[it.ShortName] = symbolKey(it)
+	}
+	for i := range results {
+		key := keys[results[i].Company]
+		if key == "" {
+			key = symbolKey(BSEItem{ScripCode: results[i].ScripCode, ShortName: results[i].Company})
+		}
+		declared := results[i].DeclaredAt
+		if declared.IsZero() {
+			declared = day
+		}
+		results[i].Consensus = consensusFor(s, key, results[i], declared, window)
+	}
+}
+
+// hasConsensus reports whether any result has a consensus
+func hasConsensus(results []CompanyResult) bool {
+	for _, r := range results {
+		if r.Consensus != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// consensusCell is the report cell of a result's consensus: the lead figure's move over
+// the window and the beat or miss, with every figure in the title. Sorts by the surprise.
+func consensusCell(r CompanyResult) string {
+	c := r.Consensus
+	if c == nil {
+		return "<td data-sort='NaN'></td>"
+	}
+	name, f := c.main()
+	var parts []string
+	if m := f.Move(); !math.IsNaN(m) && !c.Since.Equal(c.At) {
+		weeks := int(math.Round(c.Declared.Sub(c.Since).Hours() / (24 * 7)))
+		parts = append(parts, fmt.Sprintf("%s est. %+.1f%% in %d wk", name, m, max(weeks, 1)))
+	} else {
+		parts = append(parts, name+" est. "+formatFloat(nanFloat(f.Now)))
+	}
+	if s := f.Surprise(); !math.IsNaN(s) {
+		word := "beat"
+		if s < 0 {
+			word = "missed"
+		}
+		parts = append(parts, fmt.Sprintf("%s by %.1f%%", word, math.Abs(s)))
+	}
+	var title []string
+	title = append(title, fmt.Sprintf("Consensus for %s from %s to the last estimate before the result (%s)", c.Quarter, c.Since.Format("02 Jan"), c.At.Format("02 Jan")))
+	for _, x := range []struct {
+		name string
+		f    ConsensusFigure
+	}{{"Revenue", c.Revenue}, {"Net profit", c.NetProfit}, {"EPS", c.EPS}} {
+		if x.f.Now == nil {
+			continue
+		}
+		line := fmt.Sprintf("%s: %s → %s", x.name, formatFloat(nanFloat(x.f.Was)), formatFloat(*x.f.Now))
+		if x.f.Actual != nil {
+			line += ", reported " + formatFloat(*x.f.Actual)
+		}
+		title = append(title, line)
+	}
+	if c.Analysts > 0 {
+		title = append(title, fmt.Sprintf("%d analysts", c.Analysts))
+	}
+	class := ""
+	switch s := f.Surprise(); {
+	case s > 0:
+		class = "positive"
+	case s < 0:
+		class = "negative"
+	}
+	return "<td class='small " + class + "' data-sort='" + numSortValue(f.Surprise()) + "' title='" + html.EscapeString(strings.Join(title, "\n")) + "'>" +
+		html.EscapeString(strings.Join(parts, " · ")) + "</td>"
+}
+
+// runEstimates implements `quarter-compare estimates`: snapshot the consensus estimates of
+// the companies meeting in the next days (watchlist only when one is set, unless -all),
+// or of the named companies
+func runEstimates(args []string) {
+	fs := flag.NewFlagSet("estimates", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	days := fs.Int("days", 0, "snapshot companies meeting within this many days (default estimates.days)")
+	all := fs.Bool("all", false, "include every company, not just the watchlist")
+	show := fs.Bool("show", false, "print the stored snapshots of the named companies instead of fetching")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: quarter-compare estimates [-config file] [-days N] [-all] [-show] [SYMBOL ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cfg := mustLoadConfig(*configPath)
+	store := loadEstimates()
+	if store == nil {
+		log.Fatalf("estimates: cannot determine app dir")
+	}
+
+	if *show {
+		scrips := loadScripMaster(nil, cfg.ScripMaster)
+		for _, name := range fs.Args() {
+			fmt.Println(name + ":")
+			for _, e := range store.Snapshots[symbolKey(tickerItem(name, scrips))] {
+				fmt.Printf("  %s  %-8s  revenue %s  net profit %s  EPS %s  analysts %d\n", e.At.Format("2006-01-02 15:04"), e.Quarter,
+					formatFloat(nanFloat(e.Revenue)), formatFloat(nanFloat(e.NetProfit)), formatFloat(nanFloat(e.EPS)), e.Analysts)
+			}
+		}
+		return
+	}
+
+	client := NewHTTPClient(cfg)
+	if err := TrendlyneLogin(client, cfg.Trendlyne); err != nil {
+		log.Printf("runEstimates: trendlyne login: %v", err)
+	}
+	var items []BSEItem
+	if fs.NArg() > 0 {
+		scrips := loadScripMaster(client, cfg.ScripMaster)
+		for _, name := range fs.Args() {
+			items = append(items, tickerItem(name, scrips))
+		}
+	} else {
+		meetings, err := FetchBSEMeetings(client, cfg.BSEEndpoints)
+		if err != nil {
+			log.Fatalf("fetch bse list: %v", err)
+		}
+		if *days <= 0 {
+			*days = cfg.Estimates.days()
+		}
+		until := time.Now().AddDate(0, 0, *days)
+		for _, it := range UpcomingMeetings(filterPurpose(meetings, cfg.Purposes), time.Now(), cfg.Watchlist, *all) {
+			if t, err := time.ParseInLocation("02 Jan 2006", it.MeetingDate, time.Local); err == nil && t.Before(until) {
+				items = append(items, it)
+			}
+		}
+	}
+
+	symbols := loadSymbolCache()
+	total := 0
+	for _, it := range items {
+		key := symbolKey(it)
+		e, ok := symbols.get(key)
+		if !ok {
+			tr, err := ResolveTrendItem(client, it)
+			if err != nil {
+				log.Printf("runEstimates: %s: trendlyne search: %v", it.ShortName, err)
+				continue
+			}
+			e = symbolEntry{TrendID: tr.ID, K: tr.K, Slug: tr.SlugName, PageURL: fmt.Sprintf("https://trendlyne.com/equity/%d/%s/%s/", tr.K, tr.ID, tr.SlugName)}
+		}
+		ests, err := FetchEstimates(client, estimatesURL(cfg.Estimates.URL, e), e.PageURL, cfg.maxBody())
+		if err != nil {
+			log.Printf("runEstimates: %s: %v", it.ShortName, err)
+			continue
+		}
+		n := store.record(key, ests)
+		total += n
+		fmt.Printf("%-12s %s  %d quarter(s), %d changed\n", it.ShortName, it.MeetingDate, len(ests), n)
+	}
+	if err := store.save(); err != nil {
+		log.Fatalf("save estimates: %v", err)
+	}
+	fmt.Printf("%d companies, %d new snapshot(s) in %s\n", len(items), total, store.path)
+}
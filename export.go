@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// ExportRow is one company's result flattened for external sinks (sheets, databases, feeds)
+type ExportRow struct {
+	Date      string // run date, 2006-01-02
+	Company   string
+	LongName  string
+	Sector    string
+	Quarter   string // latest quarter label
+	Revenue   float64
+	NetProfit float64
+	RevPct    float64 // latest vs previous quarter, NaN when not a plain % change
+	NPPct     float64
+	MarketCap float64
+}
+
+// exportHeader names the columns produced by ExportRow.Values
+var exportHeader = []string{"date", "company", "long_name", "sector", "quarter", "revenue", "net_profit", "rev_pct", "np_pct", "market_cap"}
+
+// BuildExportRows flattens results for the run date (given in BSE "02 Jan 2006" form or ISO form),
+// growth under the zero_base policy
+func BuildExportRows(date string, results []CompanyResult, zeroBase string) []ExportRow {
+	date = isoDate(date)
+	rows := make([]ExportRow, 0, len(results))
+	for _, r := range results {
+		rev, np := latestGrowth(r, zeroBase)
+		q := ""
+		if len(r.Quarters) > 0 {
+			q = r.Quarters[0].String()
+		}
+		rows = append(rows, ExportRow{
+			Date:      date,
+			Company:   r.Company,
+			LongName:  r.LongName,
+			Sector:    r.Sector,
+			Quarter:   q,
+			Revenue:   rev.Curr,
+			NetProfit: np.Curr,
+			RevPct:    rev.Pct,
+			NPPct:     np.Pct,
+			MarketCap: r.MarketCap,
+		})
+	}
+	return rows
+}
+
+// Values returns the row in exportHeader order; NaN becomes nil (an empty cell)
+func (r ExportRow) Values() []interface{} {
+	num := func(v float64) interface{} {
+		if math.IsNaN(v) {
+			return nil
+		}
+		return math.Round(v*100) / 100
+	}
+	return []interface{}{r.Date, r.Company, r.LongName, r.Sector, r.Quarter,
+		num(r.Revenue), num(r.NetProfit), num(r.RevPct), num(r.NPPct), num(r.MarketCap)}
+}
+
+// isoDate converts a BSE "02 Jan 2006" date to 2006-01-02; other inputs are returned unchanged
+func isoDate(d string) string {
+	if t, err := time.Parse("02 Jan 2006", d); err == nil {
+		return t.Format("2006-01-02")
+	}
+	return d
+}
+
+// QuarterRow is one quarter of one company's result, the long form of the history for
+// analytics sinks (ClickHouse) and files
+type QuarterRow struct {
+	Date       string // run date, 2006-01-02
+	Company    string
+	LongName   string
+	Sector     string
+	Quarter    string // label, e.g. "Jun 2024"
+	QuarterEnd string // last day of the quarter (2006-01-02), empty when the label can't be read
+	Revenue    float64
+	NetProfit  float64
+}
+
+// quarterHeader names the columns of QuarterRow.Values
+var quarterHeader = []string{"date", "company", "long_name", "sector", "quarter", "quarter_end", "revenue", "net_profit"}
+
+// columnType is the type of a column in the typed file formats (Parquet, Arrow)
+type columnType int
+
+const (
+	colString columnType = iota
+	colDate              // an ISO date string, stored as days since 1970-01-01
+	colDouble
+)
+
+// dataColumn describes one column of a typed file
+type dataColumn struct {
+	name     string
+	typ      columnType
+	nullable bool
+}
+
+// quarterColumns types quarterHeader for the typed file formats
+var quarterColumns = []dataColumn{
+	{"date", colDate, false},
+	{"company", colString, false},
+	{"long_name", colString, false},
+	{"sector", colString, false},
+	{"quarter", colString, false},
+	{"quarter_end", colDate, true},
+	{"revenue", colDouble, true},
+	{"net_profit", colDouble, true},
+}
+
+// BuildQuarterRows flattens results to one row per company and quarter; quarters
+// without a label are left out
+func BuildQuarterRows(date string, results []CompanyResult) []QuarterRow {
+	date = isoDate(date)
+	var rows []QuarterRow
+	for _, r := range results {
+		for i, q := range r.Quarters {
+			if q.String() == "" {
+				continue
+			}
+			end := ""
+			if q.Known() {
+				end = q.End().Format("2006-01-02")
+			}
+			rows = append(rows, QuarterRow{
+				Date:       date,
+				Company:    r.Company,
+				LongName:   r.LongName,
+				Sector:     r.Sector,
+				Quarter:    q.String(),
+				QuarterEnd: end,
+				Revenue:    valueAt(r.RevenueNums, i),
+				NetProfit:  valueAt(r.NetProfitNums, i),
+			})
+		}
+	}
+	return rows
+}
+
+// Values returns the row in quarterHeader order; NaN and an unknown quarter end become nil
+func (r QuarterRow) Values() []interface{} {
+	num := func(v float64) interface{} {
+		if math.IsNaN(v) {
+			return nil
+		}
+		return v
+	}
+	var end interface{}
+	if r.QuarterEnd != "" {
+		end = r.QuarterEnd
+	}
+	return []interface{}{r.Date, r.Company, r.LongName, r.Sector, r.Quarter, end, num(r.Revenue), num(r.NetProfit)}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Expr is a small expression language with Go syntax, used for row filters:
+//
+//	np_growth > 20 && sector != "Finance"
+//	contains(lower(long_name), "bank") || market_cap >= 50000
+//
+// Values are numbers (float64), strings and bools. Missing numbers are NaN and every
+// comparison with NaN is false, so rows lacking a metric never match by accident; x/0 is
+// missing too (a P/E over zero earnings). Numbers are written in decimal, e.g. 1e3, 0.5 or 1_000.
+// String == and != ignore case, so sector == "it" matches "IT"; < and > compare bytes.
+type Expr struct {
+	src  string
+	node ast.Expr
+}
+
+// ParseExpr parses src and checks that it only uses supported syntax
+func ParseExpr(src string) (*Expr, error) {
+	node, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %v", src, err)
+	}
+	if err := checkExpr(node); err != nil {
+		return nil, fmt.Errorf("expression %q: %v", src, err)
+	}
+	return &Expr{src: src, node: node}, nil
+}
+
+// String returns the source text
+func (e *Expr) String() string { return e.src }
+
+// Names returns the variable names the expression refers to
+func (e *Expr) Names() []string {
+	var names []string
+	seen := map[string]bool{}
+	ast.Inspect(e.node, func(n ast.Node) bool {
+		if c, ok := n.(*ast.CallExpr); ok {
+			// skip the function name, visit the arguments
+			for _, a := range c.Args {
+				for _, name := range (&Expr{node: a}).Names() {
+					if !seen[name] {
+						seen[name] = true
+						names = append(names, name)
+					}
+				}
+			}
+			return false
+		}
+		if id, ok := n.(*ast.Ident); ok && id.Name != "true" && id.Name != "false" && !seen[id.Name] {
+			seen[id.Name] = true
+			names = append(names, id.Name)
+		}
+		return true
+	})
+	return names
+}
+
+// Eval evaluates the expression against vars
+func (e *Expr) Eval(vars map[string]interface{}) (interface{}, error) {
+	return evalNode(e.node, vars)
+}
+
+// EvalBool evaluates the expression and requires a bool result
+func (e *Expr) EvalBool(vars map[string]interface{}) (bool, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q is not a condition (got %v)", e.src, v)
+	}
+	return b, nil
+}
+
+// EvalFloat evaluates the expression and requires a numeric result
+func (e *Expr) EvalFloat(vars map[string]interface{}) (float64, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return math.NaN(), err
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return math.NaN(), fmt.Errorf("expression %q is not numeric (got %v)", e.src, v)
+	}
+	return f, nil
+}
+
+// exprFuncs are the functions callable from expressions
+var exprFuncs = map[string]func(args []interface{}) (interface{}, error){
+	"abs":   numFunc(math.Abs),
+	"round": numFunc(math.Round),
+	"isnan": func(a []interface{}) (interface{}, error) { f, err := oneNum(a); return math.IsNaN(f), err },
+	"lower": strFunc(strings.ToLower),
+	"upper": strFunc(strings.ToUpper),
+	"contains": func(a []interface{}) (interface{}, error) {
+		s, sub, err := twoStr(a)
+		return strings.Contains(s, sub), err
+	},
+	"hasprefix": func(a []interface{}) (interface{}, error) {
+		s, p, err := twoStr(a)
+		return strings.HasPrefix(s, p), err
+	},
+	"min": func(a []interface{}) (interface{}, error) { x, y, err := twoNum(a); return math.Min(x, y), err },
+	"max": func(a []interface{}) (interface{}, error) { x, y, err := twoNum(a); return math.Max(x, y), err },
+}
+
+// checkExpr rejects syntax the evaluator doesn't handle, so errors surface at parse time
+func checkExpr(n ast.Expr) error {
+	var err error
+	ast.Inspect(n, func(node ast.Node) bool {
+		if err != nil || node == nil {
+			return false
+		}
+		switch x := node.(type) {
+		case *ast.BinaryExpr, *ast.ParenExpr, *ast.Ident:
+		case *ast.UnaryExpr:
+			if x.Op != token.NOT && x.Op != token.SUB && x.Op != token.ADD {
+				err = fmt.Errorf("unsupported operator %s", x.Op)
+			}
+		case *ast.BasicLit:
+			switch x.Kind {
+			case token.INT, token.FLOAT:
+				// Go also reads 0x10, 0o17 and 0b101, which evalNode can't
+				if _, perr := strconv.ParseFloat(x.Value, 64); perr != nil {
+					err = fmt.Errorf("unsupported number %s (write it in decimal)", x.Value)
+				}
+			case token.STRING:
+			default:
+				err = fmt.Errorf("unsupported literal %s", x.Value)
+			}
+		case *ast.CallExpr:
+			id, ok := x.Fun.(*ast.Ident)
+			if !ok || exprFuncs[id.Name] == nil {
+				err = fmt.Errorf("unknown function %s", exprText(x.Fun))
+				return false
+			}
+			for _, a := range x.Args {
+				if err = checkExpr(a); err != nil {
+					break
+				}
+			}
+			return false
+		default:
+			err = fmt.Errorf("unsupported syntax %s", exprText(x.(ast.Expr)))
+		}
+		return err == nil
+	})
+	return err
+}
+
+func exprText(n ast.Expr) string {
+	switch x := n.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.SelectorExpr:
+		return exprText(x.X) + "." + x.Sel.Name
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+func evalNode(n ast.Expr, vars map[string]interface{}) (interface{}, error) {
+	switch x := n.(type) {
+	case *ast.ParenExpr:
+		return evalNode(x.X, vars)
+	case *ast.BasicLit:
+		if x.Kind == token.STRING {
+			return strconv.Unquote(x.Value)
+		}
+		return strconv.ParseFloat(x.Value, 64)
+	case *ast.Ident:
+		switch x.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		v, ok := vars[x.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown name %q", x.Name)
+		}
+		return v, nil
+	case *ast.UnaryExpr:
+		v, err := evalNode(x.X, vars)
+		if err != nil {
+			return nil, err
+		}
+		if x.Op == token.NOT {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("! needs a bool, got %v", v)
+			}
+			return !b, nil
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a number, got %v", x.Op, v)
+		}
+		if x.Op == token.SUB {
+			return -f, nil
+		}
+		return f, nil
+	case *ast.CallExpr:
+		args := make([]interface{}, len(x.Args))
+		for i, a := range x.Args {
+			v, err := evalNode(a, vars)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		name := x.Fun.(*ast.Ident).Name
+		v, err := exprFuncs[name](args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return v, nil
+	case *ast.BinaryExpr:
+		return evalBinary(x, vars)
+	}
+	return nil, fmt.Errorf("unsupported syntax %T", n)
+}
+
+func evalBinary(x *ast.BinaryExpr, vars map[string]interface{}) (interface{}, error) {
+	l, err := evalNode(x.X, vars)
+	if err != nil {
+		return nil, err
+	}
+	// short-circuit logic
+	if x.Op == token.LAND || x.Op == token.LOR {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, got %v", x.Op, l)
+		}
+		if (x.Op == token.LAND && !lb) || (x.Op == token.LOR && lb) {
+			return lb, nil
+		}
+		r, err := evalNode(x.Y, vars)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, got %v", x.Op, r)
+		}
+		return rb, nil
+	}
+	r, err := evalNode(x.Y, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply %s to number and %v", x.Op, r)
+		}
+		switch x.Op {
+		case token.ADD:
+			return lv + rv, nil
+		case token.SUB:
+			return lv - rv, nil
+		case token.MUL:
+			return lv * rv, nil
+		case token.QUO:
+			if rv == 0 {
+				return math.NaN(), nil
+			}
+			return lv / rv, nil
+		case token.EQL:
+			return lv == rv, nil
+		case token.NEQ:
+			// NaN != x is true in Go; keep "missing never matches" for != too
+			return !math.IsNaN(lv) && !math.IsNaN(rv) && lv != rv, nil
+		case token.LSS:
+			return lv < rv, nil
+		case token.LEQ:
+			return lv <= rv, nil
+		case token.GTR:
+			return lv > rv, nil
+		case token.GEQ:
+			return lv >= rv, nil
+		}
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply %s to string and %v", x.Op, r)
+		}
+		switch x.Op {
+		case token.ADD:
+			return lv + rv, nil
+		case token.EQL:
+			return strings.EqualFold(lv, rv), nil
+		case token.NEQ:
+			return !strings.EqualFold(lv, rv), nil
+		case token.LSS:
+			return lv < rv, nil
+		case token.GTR:
+			return lv > rv, nil
+		}
+	case bool:
+		rv, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply %s to bool and %v", x.Op, r)
+		}
+		switch x.Op {
+		case token.EQL:
+			return lv == rv, nil
+		case token.NEQ:
+			return lv != rv, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported operator %s for %v", x.Op, l)
+}
+
+func numFunc(f func(float64) float64) func([]interface{}) (interface{}, error) {
+	return func(a []interface{}) (interface{}, error) {
+		x, err := oneNum(a)
+		return f(x), err
+	}
+}
+
+func strFunc(f func(string) string) func([]interface{}) (interface{}, error) {
+	return func(a []interface{}) (interface{}, error) {
+		if len(a) != 1 {
+			return nil, fmt.Errorf("want 1 argument, got %d", len(a))
+		}
+		s, ok := a[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("want a string, got %v", a[0])
+		}
+		return f(s), nil
+	}
+}
+
+func oneNum(a []interface{}) (float64, error) {
+	if len(a) != 1 {
+		return math.NaN(), fmt.Errorf("want 1 argument, got %d", len(a))
+	}
+	f, ok := a[0].(float64)
+	if !ok {
+		return math.NaN(), fmt.Errorf("want a number, got %v", a[0])
+	}
+	return f, nil
+}
+
+func twoNum(a []interface{}) (float64, float64, error) {
+	if len(a) != 2 {
+		return 0, 0, fmt.Errorf("want 2 arguments, got %d", len(a))
+	}
+	x, ok1 := a[0].(float64)
+	y, ok2 := a[1].(float64)
+	if !ok1 || !ok2 {
+		return 0, 0, fmt.Errorf("want numbers, got %v, %v", a[0], a[1])
+	}
+	return x, y, nil
+}
+
+func twoStr(a []interface{}) (string, string, error) {
+	if len(a) != 2 {
+		return "", "", fmt.Errorf("want 2 arguments, got %d", len(a))
+	}
+	x, ok1 := a[0].(string)
+	y, ok2 := a[1].(string)
+	if !ok1 || !ok2 {
+		return "", "", fmt.Errorf("want strings, got %v, %v", a[0], a[1])
+	}
+	return x, y, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"np_growth": 25.0,
+		"revenue":   120.0,
+		"pe":        math.NaN(),
+		"sector":    "IT",
+		"company":   "TCS",
+		"watchlist": true,
+	}
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		// arithmetic and precedence
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"12 / 3 / 2", 2.0},
+		{"-np_growth + 5", -20.0},
+		{"+revenue", 120.0},
+		{"2 * -3", -6.0},
+		{"1.5e2 + .5", 150.5},
+		{"007", 7.0},
+		{"1_000 + 1", 1001.0},
+		{"revenue / 0", math.NaN()},
+		{"pe * 2", math.NaN()},
+		{`"a" + "b"`, "ab"},
+		{"abs(-3) + round(2.5) + min(1, 2) + max(1, 2)", 9.0},
+
+		// comparisons
+		{"np_growth > 20", true},
+		{"np_growth >= 25 && np_growth <= 25", true},
+		{"np_growth < 25", false},
+		{"np_growth == 25", true},
+		{"np_growth != 25", false},
+		{"pe > 0 || pe <= 0", false}, // missing never compares
+		{"pe == pe", false},
+		{"pe != 1", false},
+		{"revenue / 0 > 1", false},
+		{"isnan(pe) && !isnan(revenue)", true},
+		{`sector == "it"`, true}, // == ignores case
+		{`sector != "It"`, false},
+		{`sector == "Finance"`, false},
+		{`"a" < "b" && "B" < "a"`, true}, // < compares bytes
+		{`lower(company) == "tcs" && upper("x") == "X"`, true},
+		{`contains(sector, "T") && hasprefix(company, "TC")`, true},
+		{"watchlist == true && true != false", true},
+
+		// precedence of logic: && binds tighter than ||
+		{"false && false || true", true},
+		{"true || false && false", true},
+		{"!watchlist || np_growth > 20", true},
+		{"!(watchlist || false)", false},
+		// short-circuit: the right side isn't evaluated
+		{"false && nosuch > 1", false},
+		{"true || nosuch > 1", true},
+	}
+	for _, c := range cases {
+		e, err := ParseExpr(c.src)
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", c.src, err)
+			continue
+		}
+		got, err := e.Eval(vars)
+		if err != nil {
+			t.Errorf("%q: %v", c.src, err)
+			continue
+		}
+		if f, ok := c.want.(float64); ok && math.IsNaN(f) {
+			if g, ok := got.(float64); !ok || !math.IsNaN(g) {
+				t.Errorf("%q = %v, want NaN", c.src, got)
+			}
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q = %#v, want %#v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	parseErrs := []struct{ src, want string }{
+		{"np_growth >", "expected operand"},
+		{"0x10 > 1", "unsupported number 0x10"},
+		{"0o17 > 1", "unsupported number 0o17"},
+		{"0b101 > 1", "unsupported number 0b101"},
+		{"2i > 1", "unsupported literal 2i"},
+		{"company == 'T'", "unsupported literal 'T'"},
+		{"^np_growth", "unsupported operator ^"},
+		{"sqrt(4)", "unknown function sqrt"},
+		{"math.Abs(1)", "unknown function math.Abs"},
+		{"abs(x[0])", "unsupported syntax"},
+		{"sector.name", "unsupported syntax"},
+		{"func() {}", "unsupported syntax"},
+	}
+	for _, c := range parseErrs {
+		if _, err := ParseExpr(c.src); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("ParseExpr(%q) = %v, want %q", c.src, err, c.want)
+		}
+	}
+
+	vars := map[string]interface{}{"np_growth": 25.0, "sector": "IT", "watchlist": true}
+	evalErrs := []struct{ src, want string }{
+		{"nosuch > 1", `unknown name "nosuch"`},
+		{`sector > 1`, "cannot apply > to string and 1"},
+		{`np_growth + "x"`, "cannot apply + to number and x"},
+		{"watchlist && 1", "&& needs bools, got 1"},
+		{"1 || watchlist", "|| needs bools, got 1"},
+		{"!np_growth", "! needs a bool, got 25"},
+		{"-sector", "- needs a number, got IT"},
+		{"np_growth % 2", "unsupported operator %"},
+		{`sector * "x"`, "unsupported operator *"},
+		{"watchlist < true", "unsupported operator <"},
+		{"abs(sector)", "abs: want a number, got IT"},
+		{"abs(1, 2)", "abs: want 1 argument, got 2"},
+		{"contains(sector)", "contains: want 2 arguments, got 1"},
+		{"lower(1)", "lower: want a string, got 1"},
+	}
+	for _, c := range evalErrs {
+		e, err := ParseExpr(c.src)
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", c.src, err)
+			continue
+		}
+		if _, err := e.Eval(vars); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%q: err = %v, want %q", c.src, err, c.want)
+		}
+	}
+
+	e, _ := ParseExpr("np_growth + 1")
+	if _, err := e.EvalBool(vars); err == nil || !strings.Contains(err.Error(), "is not a condition") {
+		t.Errorf("EvalBool of a number: %v", err)
+	}
+	e, _ = ParseExpr("watchlist")
+	if _, err := e.EvalFloat(vars); err == nil || !strings.Contains(err.Error(), "is not numeric") {
+		t.Errorf("EvalFloat of a bool: %v", err)
+	}
+}
+
+func TestExprNames(t *testing.T) {
+	e, err := ParseExpr(`abs(np_growth) > 20 && contains(lower(sector), "it") || np_growth < pe && true`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Names(), []string{"np_growth", "sector", "pe"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
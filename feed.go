@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// feedMaxDays bounds how many published days appear in feed.xml
+const feedMaxDays = 30
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// writeSiteFeed writes feed.xml with one item per published day and, when
+// pc.FeedMoverPct > 0, one item per company whose |NP %Δ| (under the zero_base policy)
+// reaches that threshold
+func writeSiteFeed(dir string, pc PublishConfig, runs []RunRecord, zeroBase string) error {
+	base := strings.TrimRight(pc.BaseURL, "/")
+	link := func(p string) string {
+		if base == "" {
+			return p
+		}
+		return base + "/" + p
+	}
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         "Quarter Compare results",
+			Link:          link("index.html"),
+			Description:   "Quarterly revenue and net profit comparison for companies reporting each day",
+			LastBuildDate: time.Now().Format(time.RFC1123Z),
+		},
+	}
+	for i, run := range runs {
+		if i >= feedMaxDays {
+			break
+		}
+		pub := run.Date
+		if t, err := time.Parse("2006-01-02", run.Date); err == nil {
+			pub = t.Add(18 * time.Hour).Format(time.RFC1123Z)
+		}
+		reportLink := link("reports/" + run.Date + ".html")
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       fmt.Sprintf("Results for %s: %d companies", run.Date, len(run.Results)),
+			Link:        reportLink,
+			Description: runDigest(run.Results, zeroBase),
+			GUID:        rssGUID{Value: "quarter-compare-" + run.Date},
+			PubDate:     pub,
+		})
+		if pc.FeedMoverPct <= 0 {
+			continue
+		}
+		for _, r := range run.Results {
+			rev, np := latestGrowth(r, zeroBase)
+			if math.IsNaN(np.Pct) || math.Abs(np.Pct) < pc.FeedMoverPct {
+				continue
+			}
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title:       fmt.Sprintf("%s: NP %s, revenue %s", r.Company, np.String(), rev.String()),
+				Link:        reportLink + "#" + rowAnchor(r.Company),
+				Description: fmt.Sprintf("%s (%s) reported %s on %s.", r.LongName, r.Company, firstQuarter(r), run.Date),
+				GUID:        rssGUID{Value: "quarter-compare-" + run.Date + "-" + r.Company},
+				PubDate:     pub,
+			})
+		}
+	}
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "feed.xml"), append([]byte(xml.Header), b...), 0644)
+}
+
+// runDigest summarizes a day's results as plain text: top and bottom NP movers
+func runDigest(results []CompanyResult, zeroBase string) string {
+	type mover struct {
+		company string
+		pct     float64
+	}
+	var movers []mover
+	for _, r := range results {
+		if p := npPct(r, zeroBase); !math.IsNaN(p) {
+			movers = append(movers, mover{r.Company, p})
+		}
+	}
+	if len(movers) == 0 {
+		return fmt.Sprintf("%d companies reported; no comparable NP %%Δ values.", len(results))
+	}
+	sort.Slice(movers, func(i, j int) bool { return movers[i].pct > movers[j].pct })
+	list := func(ms []mover) string {
+		parts := make([]string, 0, len(ms))
+		for _, m := range ms {
+			parts = append(parts, fmt.Sprintf("%s %.2f%%", m.company, m.pct))
+		}
+		return strings.Join(parts, ", ")
+	}
+	n := min(3, len(movers))
+	bottom := make([]mover, 0, n)
+	for i := len(movers) - 1; i >= len(movers)-n; i-- {
+		bottom = append(bottom, movers[i])
+	}
+	return fmt.Sprintf("%d companies reported. Top NP movers: %s. Bottom: %s.", len(results), list(movers[:n]), list(bottom))
+}
+
+// firstQuarter returns the latest quarter label of a result, or "results"
+func firstQuarter(r CompanyResult) string {
+	if len(r.Quarters) > 0 && r.Quarters[0].String() != "" {
+		return r.Quarters[0].String()
+	}
+	return "results"
+}
@@ -5,31 +5,150 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"math"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// NewHTTPClient returns an http.Client with cookie jar
-func NewHTTPClient() *http.Client {
-	jar, _ := cookiejar.New(nil)
-	return &http.Client{Jar: jar}
+// NewHTTPClient returns an http.Client whose cookie jar is persisted in <app dir>/cookies.json,
+// which accepts and decodes compressed responses (see decodingTransport) and which refuses
+// responses over the size caps of cfg or binary where text was expected (see guardTransport)
+func NewHTTPClient(cfg Config) *http.Client {
+	transport := cfg.transport()
+	path, err := cookieJarPath()
+	if err != nil {
+		jar, _ := cookiejar.New(nil)
+		return &http.Client{Jar: jar, Transport: transport}
+	}
+	return &http.Client{Jar: newPersistentJar(path), Transport: transport}
 }
 
-// FetchBSEList fetches the BSE API and unmarshals it
-func FetchBSEList(client *http.Client, url string) ([]BSEItem, error) {
-	req, _ := http.NewRequest("GET", url, nil)
-	// stronger browser-like headers to reduce HTML error pages
+const bseHomeURL = "https://www.bseindia.com/"
+
+// WarmUpBSE loads the BSE homepage so the jar holds the cookies the API expects.
+// It is skipped when cookies from an earlier run are still present, unless force is set.
+func WarmUpBSE(client *http.Client, force bool) error {
+	u, _ := url.Parse(bseHomeURL)
+	if !force && client.Jar != nil && len(client.Jar.Cookies(u)) > 0 {
+		return nil
+	}
+	req, _ := http.NewRequest("GET", bseHomeURL, nil)
+	req.Header.Set("accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("accept-language", "en-US,en;q=0.7")
+	req.Header.Set("user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("bse homepage status=%d", resp.StatusCode)
+	}
+	return nil
+}
+
+// defaultBSEEndpoints are the results-calendar endpoints tried in order: the forthcoming
+// results API, then the board-meetings XHR behind bseindia.com's corporates pages
+var defaultBSEEndpoints = []string{
+	"https://api.bseindia.com/BseIndiaAPI/api/Corpforthresults/w",
+	"https://api.bseindia.com/BseIndiaAPI/api/BoardMeeting/w?scripcode=&fromdt=&todt=&purpose=",
+}
+
+// FetchBSEMeetings fetches the BSE results calendar from the first endpoint that answers
+// with data (endpoints defaults to defaultBSEEndpoints). Cookies are warmed up first, and
+// refreshed once when the first endpoint rejects the request.
+func FetchBSEMeetings(client *http.Client, endpoints []string) ([]BSEItem, error) {
+	if len(endpoints) == 0 {
+		endpoints = defaultBSEEndpoints
+	}
+	if err := WarmUpBSE(client, false); err != nil {
+		log.Printf("FetchBSEMeetings: warm-up: %v", err)
+	}
+	var errs []string
+	for i, endpoint := range endpoints {
+		items, err := FetchBSEList(client, endpoint)
+		if err != nil && i == 0 {
+			// stale or missing cookies are the usual cause; refresh them and retry once
+			log.Printf("FetchBSEMeetings: %v; retrying after warm-up", err)
+			if werr := WarmUpBSE(client, true); werr != nil {
+				log.Printf("FetchBSEMeetings: warm-up: %v", werr)
+			}
+			items, err = FetchBSEList(client, endpoint)
+		}
+		if err == nil && len(items) == 0 {
+			err = errors.New("no meetings listed")
+		}
+		if err == nil {
+			if i > 0 {
+				log.Printf("FetchBSEMeetings: using fallback endpoint %s", endpoint)
+			}
+			return items, nil
+		}
+		log.Printf("FetchBSEMeetings: %s: %v", endpoint, err)
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("all %d BSE endpoints failed: %s", len(endpoints), strings.Join(errs, "; "))
+}
+
+// setBSEHeaders sets browser-like headers on a BSE API request; without them the API
+// tends to answer with HTML error pages
+func setBSEHeaders(req *http.Request) {
 	req.Header.Set("accept", "application/json, text/plain, */*")
 	req.Header.Set("accept-language", "en-US,en;q=0.7")
 	req.Header.Set("origin", "https://www.bseindia.com")
 	req.Header.Set("referer", "https://www.bseindia.com/")
 	req.Header.Set("user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36")
+}
+
+// FetchBSEList fetches the BSE API and unmarshals it, following further pages when the
+// response is paginated or looks cut off (see followBSEPages)
+func FetchBSEList(client *http.Client, url string) ([]BSEItem, error) {
+	b, items, err := fetchBSEPageRaw(client, url)
+	if err != nil {
+		return nil, err
+	}
+	return followBSEPages(client, url, b, items), nil
+}
+
+// FetchBSEPage fetches one page of the BSE API and unmarshals it
+func FetchBSEPage(client *http.Client, url string) ([]BSEItem, error) {
+	_, items, err := fetchBSEPageRaw(client, url)
+	return items, err
+}
+
+// fetchBSEPageRaw fetches one page of the BSE API and returns the body and its items
+func fetchBSEPageRaw(client *http.Client, url string) ([]byte, []BSEItem, error) {
+	b, err := fetchBSEJSON(client, url)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := decodeBSEItems(b)
+	if err != nil {
+		// if still failing, provide a snippet to help debugging
+		snippet := string(b)
+		if len(snippet) > 512 {
+			snippet = snippet[:512]
+		}
+		return nil, nil, fmt.Errorf("invalid JSON from BSE endpoint: %v snippet=%q", err, snippet)
+	}
+	return b, items, nil
+}
+
+// fetchBSEJSON fetches a BSE API endpoint and returns its JSON, dug out of the HTML page
+// the API sometimes wraps it in
+func fetchBSEJSON(client *http.Client, url string) ([]byte, error) {
+	req, _ := http.NewRequest("GET", url, nil)
+	setBSEHeaders(req)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -59,19 +178,103 @@ func FetchBSEList(client *http.Client, url string) ([]BSEItem, error) {
 		}
 		b = jsonb
 	}
+	return b, nil
+}
 
+// bseFieldNames lists the field names used for each BSEItem field across BSE endpoints
+var bseFieldNames = struct {
+	ScripCode, ShortName, LongName, MeetingDate, URL, Purpose []string
+}{
+	ScripCode:   []string{"scrip_Code", "SCRIP_CD", "scrip_cd", "ScripCode"},
+	ShortName:   []string{"short_name", "Short_name", "SHORT_NAME", "scrip_id", "SCRIP_ID"},
+	LongName:    []string{"Long_Name", "LONG_NAME", "SLONGNAME", "long_name"},
+	MeetingDate: []string{"meeting_date", "MEETING_DATE", "BM_DATE", "Meeting_Date"},
+	URL:         []string{"URL", "url", "NSURL"},
+	Purpose:     []string{"Purpose", "PURPOSE", "PURPOSE_NAME", "purpose_name"},
+}
+
+// decodeBSEItems decodes a BSE calendar response: an array of meetings, or an object
+// wrapping one (e.g. {"Table": [...]}). Field names and date formats differ between
+// endpoints; dates are normalized to "02 Jan 2006". Meetings of every purpose are kept;
+// callers narrow them with filterPurpose.
+func decodeBSEItems(b []byte) ([]BSEItem, error) {
+	rows, err := bseRows(b)
+	if err != nil {
+		return nil, err
+	}
 	var items []BSEItem
-	if err := json.Unmarshal(b, &items); err != nil {
-		// if still failing, provide a snippet to help debugging
-		snippet := string(b)
-		if len(snippet) > 512 {
-			snippet = snippet[:512]
+	for _, m := range rows {
+		it := BSEItem{
+			ScripCode:   bseField(m, bseFieldNames.ScripCode),
+			ShortName:   bseField(m, bseFieldNames.ShortName),
+			LongName:    bseField(m, bseFieldNames.LongName),
+			MeetingDate: normalizeBSEDate(bseField(m, bseFieldNames.MeetingDate)),
+			URL:         bseField(m, bseFieldNames.URL),
+			Purpose:     bseField(m, bseFieldNames.Purpose),
+		}
+		if it.ShortName == "" {
+			it.ShortName = it.ScripCode
 		}
-		return nil, fmt.Errorf("invalid JSON from BSE endpoint: %v snippet=%q", err, snippet)
+		if it.ShortName == "" {
+			continue
+		}
+		items = append(items, it)
 	}
 	return items, nil
 }
 
+// bseRows decodes a BSE API response: an array of rows, or an object wrapping one (e.g.
+// {"Table": [...]}; with several, as with a row count in "Table1", the longest)
+func bseRows(b []byte) ([]map[string]interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	rows, ok := v.([]interface{})
+	if obj, isObj := v.(map[string]interface{}); isObj {
+		for _, val := range obj {
+			if list, isList := val.([]interface{}); isList && (!ok || len(list) > len(rows)) {
+				rows, ok = list, true
+			}
+		}
+	}
+	if !ok {
+		return nil, errors.New("no list of rows in response")
+	}
+	var out []map[string]interface{}
+	for _, row := range rows {
+		if m, ok := row.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// bseField returns the first non-empty of the named fields of a BSE row, as a string
+func bseField(m map[string]interface{}, names []string) string {
+	for _, n := range names {
+		switch x := m[n].(type) {
+		case string:
+			if s := strings.TrimSpace(x); s != "" {
+				return s
+			}
+		case float64:
+			return strconv.FormatFloat(x, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// normalizeBSEDate converts the date formats used by BSE endpoints to "02 Jan 2006"
+func normalizeBSEDate(s string) string {
+	for _, layout := range []string{"02 Jan 2006", "2 Jan 2006", "02-Jan-2006", "02 Jan 2006 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04:05.000", "2006-01-02", "02/01/2006", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("02 Jan 2006")
+		}
+	}
+	return s
+}
+
 // extractJSONFromBody looks for the first '{' or '[' and returns bytes from that position to end,
 // trimming any trailing HTML after matching JSON object/array using a lightweight balance scan.
 func extractJSONFromBody(b []byte) ([]byte, error) {
@@ -139,11 +342,11 @@ func extractJSONFromBody(b []byte) ([]byte, error) {
 	return nil, errors.New("could not find matching JSON end")
 }
 
-// FetchTrendSearch calls trendlyne autocomplete and returns parsed items
+// FetchTrendSearch calls trendlyne autocomplete and returns parsed items. term may be a
+// name, an NSE symbol or a numeric BSE code.
 func FetchTrendSearch(client *http.Client, term string) ([]TrendItem, error) {
-	esc := term
-	url := fmt.Sprintf("https://trendlyne.com/member/api/ac_snames/all/?term=%s&all-results=true", esc)
-	req, _ := http.NewRequest("GET", url, nil)
+	q := url.Values{"term": {term}, "all-results": {"true"}}
+	req, _ := http.NewRequest("GET", "https://trendlyne.com/member/api/ac_snames/all/?"+q.Encode(), nil)
 	req.Header.Set("accept", "*/*")
 	req.Header.Set("referer", "https://trendlyne.com/")
 	req.Header.Set("user-agent", "go-client")
@@ -161,50 +364,144 @@ func FetchTrendSearch(client *http.Client, term string) ([]TrendItem, error) {
 	return items, nil
 }
 
-// ExtractFundamentalsURLFromPage fetches HTML page and finds data-tablesurl
-func ExtractFundamentalsURLFromPage(client *http.Client, pageURL string) (string, error) {
+// ResolveTrendItem finds the trendlyne entry for a BSE item. It searches by the numeric
+// BSE code first, which is unambiguous, then by the NSE symbol and the short name (usually
+// the same), preferring an exact code or symbol match over the first hit.
+func ResolveTrendItem(client *http.Client, itm BSEItem) (TrendItem, error) {
+	var terms []string
+	if itm.ScripCode != "" {
+		terms = append(terms, itm.ScripCode)
+	}
+	if itm.NSESymbol != "" && !strings.EqualFold(itm.NSESymbol, itm.ShortName) {
+		terms = append(terms, itm.NSESymbol)
+	}
+	if itm.ShortName != "" && itm.ShortName != itm.ScripCode {
+		terms = append(terms, itm.ShortName)
+	}
+	var lastErr error
+	for _, term := range terms {
+		items, err := FetchTrendSearch(client, term)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if tr, ok := pickTrendItem(items, itm); ok {
+			return tr, nil
+		}
+	}
+	if lastErr != nil {
+		return TrendItem{}, lastErr
+	}
+	return TrendItem{}, fmt.Errorf("no results for %s", strings.Join(terms, " / "))
+}
+
+// pickTrendItem chooses the best search hit: same BSE code, then same symbol (NSE symbol
+// or short name), then the first; Match records which (see matchCode)
+func pickTrendItem(items []TrendItem, itm BSEItem) (TrendItem, bool) {
+	if len(items) == 0 {
+		return TrendItem{}, false
+	}
+	if itm.ScripCode != "" {
+		for _, it := range items {
+			if it.BSEcode == itm.ScripCode {
+				it.Match = matchCode
+				return it, true
+			}
+		}
+	}
+	for _, it := range items {
+		if inWatchlist([]string{it.Value, it.ID}, itm.NSESymbol, itm.ShortName) {
+			it.Match = matchSymbol
+			return it, true
+		}
+	}
+	it := items[0]
+	it.Match = matchFirst
+	return it, true
+}
+
+// TrendPage is what ScanTrendPage extracts from a company page
+type TrendPage struct {
+	FundURL    string // empty when not found
+	Meta       PageMeta
+	Validators httpValidators
+}
+
+// ScanTrendPage fetches a trendlyne equity page and extracts the fundamentals URL and the
+// page metadata as the page streams in (see scanPage). maxBody caps the page size (0: no
+// cap); dump, when not nil, gets a copy of the page. With validators from an earlier
+// fetch the request is conditional, and errNotModified is returned when the page has
+// not changed.
+func ScanTrendPage(client *http.Client, pageURL string, maxBody int64, dump io.Writer, cond httpValidators) (TrendPage, error) {
 	req, _ := http.NewRequest("GET", pageURL, nil)
 	req.Header.Set("user-agent", "go-client")
+	cond.set(req)
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return TrendPage{}, err
 	}
 	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-
-	// first try the original data-tablesurl attribute
-	re := regexp.MustCompile(`data-tablesurl=(https?://[^\s"'<>]+)`)
-	m := re.FindSubmatch(body)
-	if len(m) >= 2 {
-		url := string(m[1])
-		return url, nil
+	if resp.StatusCode == http.StatusNotModified {
+		return TrendPage{Validators: cond}, errNotModified
+	}
+	var r io.Reader = &cappedReader{r: resp.Body, limit: maxBody}
+	if dump != nil {
+		r = io.TeeReader(r, dump)
+	}
+	s, err := scanPage(r)
+	if err != nil {
+		return TrendPage{}, err
 	}
-	// try quoted attribute variant
-	re2 := regexp.MustCompile(`data-tablesurl\s*=\s*["'](https?://[^"']+)["']`)
-	m2 := re2.FindSubmatch(body)
-	if len(m2) >= 2 {
-		return string(m2[1]), nil
+	if s.fundURL != "" && !s.fundPreferred {
+		log.Printf("ScanTrendPage: fallback found fundamentals URL=%s", s.fundURL)
 	}
+	return TrendPage{FundURL: s.fundURL, Meta: s.meta, Validators: validatorsOf(resp)}, nil
+}
 
-	// fallback: search for any URL that contains get-fundamental_results (more robust)
-	reGet := regexp.MustCompile(`https?://[^\s"'<>]*get-fundamental_results[^\s"'<>]*`)
-	m3 := reGet.Find(body)
-	if m3 != nil {
-		// normalize: ensure trailing slash (Trendlyne seems to expect a trailing slash in examples)
-		u := string(bytes.TrimSpace(m3))
-		if !strings.HasSuffix(u, "/") {
-			u = u + "/"
-		}
-		log.Printf("ExtractFundamentalsURLFromPage: fallback found fundamentals URL=%s", u)
-		return u, nil
+// ExtractFundamentalsURL finds data-tablesurl (or a get-fundamental_results URL) in page HTML
+func ExtractFundamentalsURL(body []byte) (string, error) {
+	s := newPageScanner()
+	s.scan(body)
+	if s.fundURL == "" {
+		return "", errors.New("data-tablesurl not found")
+	}
+	if !s.fundPreferred {
+		log.Printf("ExtractFundamentalsURL: fallback found fundamentals URL=%s", s.fundURL)
 	}
+	return s.fundURL, nil
+}
+
+// PageMeta holds company metadata scraped from the trendlyne equity page
+type PageMeta struct {
+	MarketCap float64 // ₹ cr, NaN when not found
+	Sector    string  // empty when not found
+	ISIN      string  // empty when not found
+	LongName  string  // company name from the page heading, empty when not found
+
+	Price           float64 // ₹ per share, NaN when not found
+	BookValue       float64 // ₹ per share, NaN when not found
+	EnterpriseValue float64 // ₹ cr, NaN when not found
 
-	// no URL found
-	return "", errors.New("data-tablesurl not found")
+	PromoterHolding float64 // % of shares, NaN when not found
+	Pledged         float64 // % of promoter shares pledged, NaN when not found
 }
 
-// FetchFundamentalsJSON GETs the fundamentals URL and returns raw JSON bytes
-func FetchFundamentalsJSON(client *http.Client, fundURL, referer string) ([]byte, error) {
+// ExtractPageMeta scrapes best-effort metadata (market cap, sector, ISIN, name, quote) from trendlyne page HTML
+func ExtractPageMeta(body []byte) PageMeta {
+	s := newPageScanner()
+	s.scan(body)
+	return s.meta
+}
+
+// unescapeText trims and html-unescapes scraped text
+func unescapeText(b []byte) string {
+	return html.UnescapeString(strings.TrimSpace(string(b)))
+}
+
+// FetchFundamentals GETs the fundamentals URL and stream-decodes the parts of the JSON
+// that are used (see decodeFundamentals). maxBody caps the response size (0: no cap);
+// dump, when not nil, gets a copy of the raw response.
+func FetchFundamentals(client *http.Client, fundURL, referer string, maxBody int64, dump io.Writer) (map[string]interface{}, error) {
 	req, _ := http.NewRequest("GET", fundURL, nil)
 	req.Header.Set("accept", "*/*")
 	req.Header.Set("referer", referer)
@@ -215,160 +512,308 @@ func FetchFundamentalsJSON(client *http.Client, fundURL, referer string) ([]byte
 		return nil, err
 	}
 	defer resp.Body.Close()
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	// log status for diagnostics
-	log.Printf("FetchFundamentalsJSON: url=%s status=%d len=%d", fundURL, resp.StatusCode, len(b))
 
-	// ensure it's JSON
-	clean := bytes.TrimSpace(b)
-	if len(clean) == 0 {
+	// keep the first bytes for a diagnostic snippet when the response isn't JSON
+	body := &cappedReader{r: resp.Body, limit: maxBody}
+	var head bytes.Buffer
+	r := io.TeeReader(body, &prefixWriter{buf: &head, max: 512})
+	if dump != nil {
+		r = io.TeeReader(r, dump)
+	}
+	root, err := decodeFundamentals(r)
+	// log status for diagnostics
+	log.Printf("FetchFundamentals: url=%s status=%d len=%d", fundURL, resp.StatusCode, body.n)
+	var tooLarge bodyTooLargeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return nil, err
+	case err == io.EOF:
 		return nil, errors.New("empty fundamentals response")
+	case err != nil:
+		log.Printf("FetchFundamentals: response is not valid JSON for %s snippet=%q", fundURL, head.String())
+		return nil, fmt.Errorf("invalid JSON: %v", err)
 	}
-	// quick check and log snippet if not JSON-like
-	if !(clean[0] == '{' || clean[0] == '[') {
-		snippet := string(clean)
-		if len(snippet) > 512 {
-			snippet = snippet[:512]
-		}
-		log.Printf("FetchFundamentalsJSON: response does not start with JSON token for %s snippet=%q", fundURL, snippet)
-		// still return the content; caller can attempt to recover or fail
-	}
-	return clean, nil
+	return root, nil
 }
 
-// ParseCompanyFundamentals extracts last 4 quarters revenue and net profit
-func ParseCompanyFundamentals(shortName string, fundJSON []byte) CompanyResult {
-	log.Printf("ParseCompanyFundamentals: start for %s (bytes=%d)", shortName, len(fundJSON))
-	cr := CompanyResult{
-		Company: shortName,
+// prefixWriter keeps the first max bytes written to it and discards the rest
+type prefixWriter struct {
+	buf *bytes.Buffer
+	max int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if room := w.max - w.buf.Len(); room > 0 {
+		w.buf.Write(p[:min(room, len(p))])
 	}
-	// decode into map
+	return len(p), nil
+}
+
+// fundamentalsDoc is the validated shape of a fundamentals payload: the quarter labels from
+// quarterlyOrder (newest first, at most 4) and each quarter's entry of the chosen dump
+// (nil when the dump lacks that quarter), and likewise for the latest two years of the
+// optional annual tables
+type fundamentalsDoc struct {
+	Quarters []string
+	Entries  []map[string]interface{}
+	Basis    string // key of the chosen quarterly dump, e.g. "consolidated"
+
+	Years  []string
+	Annual []map[string]interface{}
+
+	Segments []Segment
+
+	// the quarters after the latest four, up to anomalyQuarters in all, for detectAnomalies
+	PastQuarters []string
+	PastEntries  []map[string]interface{}
+}
+
+// ValidateFundamentals checks fundJSON against the expected structure
+// ({"body": {"quarterlyOrder": [...], "quarterlyDataDump": {<kind>: {<quarter>: {<key>: value}}}}})
+// and returns what could be read plus a human-readable issue per problem found
+func ValidateFundamentals(fundJSON []byte, reg MetricRegistry) (fundamentalsDoc, []string) {
 	var root map[string]interface{}
 	if err := json.Unmarshal(fundJSON, &root); err != nil {
-		log.Printf("ParseCompanyFundamentals: json unmarshal error for %s: %v", shortName, err)
-		return cr
-	}
-	body, _ := root["body"].(map[string]interface{})
-	if body == nil {
-		log.Printf("ParseCompanyFundamentals: no body in fundamentals JSON for %s", shortName)
-	}
-	qOrder := []string{}
-	if body != nil {
-		if qo, ok := body["quarterlyOrder"].([]interface{}); ok {
-			for _, qi := range qo {
-				if s, ok := qi.(string); ok {
-					qOrder = append(qOrder, s)
-				}
-			}
+		return fundamentalsDoc{}, []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+	return validateFundamentalsRoot(root, reg, time.Time{})
+}
+
+// validateFundamentalsRoot is ValidateFundamentals on an already decoded document. A
+// non-zero asOf skips the quarters that had not ended by then (see quartersAsOf).
+func validateFundamentalsRoot(root map[string]interface{}, reg MetricRegistry, asOf time.Time) (fundamentalsDoc, []string) {
+	var doc fundamentalsDoc
+	var issues []string
+	body, ok := root["body"].(map[string]interface{})
+	if !ok {
+		return doc, []string{fmt.Sprintf("no \"body\" object (top-level keys: %s)", keyList(root, 10))}
+	}
+
+	qo, _ := body["quarterlyOrder"].([]interface{})
+	for _, qi := range qo {
+		if s, ok := qi.(string); ok && s != "" {
+			doc.Quarters = append(doc.Quarters, s)
 		}
 	}
-	if len(qOrder) == 0 {
-		log.Printf("ParseCompanyFundamentals: quarterlyOrder empty for %s", shortName)
+	if len(doc.Quarters) == 0 {
+		issues = append(issues, "quarterlyOrder missing or empty")
+	}
+	if !asOf.IsZero() {
+		doc.Quarters = quartersAsOf(doc.Quarters, asOf)
+	}
+	all := doc.Quarters
+	if len(doc.Quarters) > 4 {
+		doc.Quarters = doc.Quarters[:4]
 	}
 
-	// choose best dump map (prefer consolidated if it contains the quarter keys; else pick best match)
 	var dump map[string]interface{}
-	if body != nil {
-		if qdRaw, ok := body["quarterlyDataDump"]; ok {
-			if qd, ok := qdRaw.(map[string]interface{}); ok {
-				// pick the best candidate among entries of qd (consolidated/standalone/others)
-				dump = chooseBestDump(qd, qOrder)
-				if dump == nil {
-					log.Printf("ParseCompanyFundamentals: no suitable quarterlyDataDump candidate found for %s; will attempt best-effort reads", shortName)
-				}
-			} else {
-				log.Printf("ParseCompanyFundamentals: quarterlyDataDump has unexpected type for %s", shortName)
+	switch qd := body["quarterlyDataDump"].(type) {
+	case nil:
+		issues = append(issues, fmt.Sprintf("quarterlyDataDump missing (body keys: %s)", keyList(body, 10)))
+	case map[string]interface{}:
+		// pick the best candidate among entries of qd (consolidated/standalone/others)
+		if doc.Basis, dump = chooseBestDump(qd, doc.Quarters); dump == nil {
+			issues = append(issues, fmt.Sprintf("quarterlyDataDump has no object entries (keys: %s)", keyList(qd, 10)))
+		}
+	default:
+		issues = append(issues, fmt.Sprintf("quarterlyDataDump is %T, want an object", qd))
+	}
+
+	revKeys := reg.Keys("revenue")
+	npKeys := reg.Keys("net_profit")
+	missingRev, missingNP := 0, 0
+	present := map[string]interface{}{}
+	doc.Entries = make([]map[string]interface{}, len(doc.Quarters))
+	for i, q := range doc.Quarters {
+		if dump == nil {
+			continue
+		}
+		entry, ok := dump[q].(map[string]interface{})
+		if !ok {
+			// tolerate formatting differences in the quarter label
+			if alt := findQuarterKey(dump, q); alt != "" {
+				entry, ok = dump[alt].(map[string]interface{})
 			}
-		} else {
-			log.Printf("ParseCompanyFundamentals: no quarterlyDataDump for %s", shortName)
+		}
+		if !ok {
+			issues = append(issues, fmt.Sprintf("quarter %q missing from quarterlyDataDump", q))
+			continue
+		}
+		doc.Entries[i] = entry
+		for k, v := range entry {
+			present[k] = v
+		}
+		if valueFromMap(entry, revKeys...) == "not declared" {
+			missingRev++
+		}
+		if valueFromMap(entry, npKeys...) == "not declared" {
+			missingNP++
 		}
 	}
-	if dump == nil {
-		log.Printf("ParseCompanyFundamentals: consolidated dump not found for %s", shortName)
+	if missingRev > 0 {
+		issues = append(issues, fmt.Sprintf("revenue keys %v missing in %d quarter(s)", revKeys, missingRev))
+	}
+	if missingNP > 0 {
+		issues = append(issues, fmt.Sprintf("net profit keys %v missing in %d quarter(s)", npKeys, missingNP))
+	}
+	if dump != nil {
+		for _, q := range all[len(doc.Quarters):min(len(all), anomalyQuarters)] {
+			entry, ok := dump[q].(map[string]interface{})
+			if !ok {
+				entry, _ = dump[findQuarterKey(dump, q)].(map[string]interface{})
+			}
+			doc.PastQuarters = append(doc.PastQuarters, q)
+			doc.PastEntries = append(doc.PastEntries, entry)
+		}
+	}
+	doc.Years, doc.Annual = annualEntries(body)
+	doc.Segments = segmentEntries(body, doc.Quarters, doc.Basis)
+	// a key rename shows up as every quarter missing; list what is there to fix the registry
+	if len(present) > 0 && (missingRev == len(doc.Quarters) || missingNP == len(doc.Quarters)) {
+		issues = append(issues, fmt.Sprintf("fields present: %s", keyList(present, 25)))
 	}
+	return doc, issues
+}
 
-	// helper: find best matching key in dump for requested quarter label
-	findQuarterKey := func(d map[string]interface{}, q string) string {
-		normalize := func(s string) string {
-			s = strings.ToLower(s)
-			// remove all non-alphanumeric chars
-			re := regexp.MustCompile(`[^a-z0-9]`)
-			return re.ReplaceAllString(s, "")
+// annualEntries reads the latest two years of body.annualOrder / body.annualDataDump.
+// The annual tables only feed the return ratios, so their absence is not an issue.
+func annualEntries(body map[string]interface{}) ([]string, []map[string]interface{}) {
+	ao, _ := body["annualOrder"].([]interface{})
+	var years []string
+	for _, yi := range ao {
+		if s, ok := yi.(string); ok && s != "" {
+			years = append(years, s)
 		}
-		nq := normalize(q)
-		// exact-normalized match first
-		for k := range d {
-			if nq == normalize(k) {
-				return k
+	}
+	if len(years) > 2 {
+		years = years[:2]
+	}
+	ad, _ := body["annualDataDump"].(map[string]interface{})
+	_, dump := chooseBestDump(ad, years)
+	if dump == nil {
+		return nil, nil
+	}
+	entries := make([]map[string]interface{}, len(years))
+	for i, y := range years {
+		entry, ok := dump[y].(map[string]interface{})
+		if !ok {
+			if alt := findQuarterKey(dump, y); alt != "" {
+				entry, _ = dump[alt].(map[string]interface{})
 			}
 		}
-		// containment heuristics
+		entries[i] = entry
+	}
+	return years, entries
+}
+
+// keyList returns up to n sorted keys of m, comma-separated
+func keyList(m map[string]interface{}, n int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > n {
+		keys = append(keys[:n], "…")
+	}
+	if len(keys) == 0 {
+		return "none"
+	}
+	return strings.Join(keys, ", ")
+}
+
+// findQuarterKey finds the dump key matching quarter label q, ignoring case and punctuation,
+// else naming the same fiscal quarter in another format ("Jun-24", "Q1 FY25")
+func findQuarterKey(d map[string]interface{}, q string) string {
+	nq := normalizeKey(q)
+	// exact-normalized match first
+	for k := range d {
+		if nq == normalizeKey(k) {
+			return k
+		}
+	}
+	// containment heuristics
+	for k := range d {
+		nk := normalizeKey(k)
+		if strings.Contains(nk, nq) || strings.Contains(nq, nk) {
+			return k
+		}
+	}
+	if pq := ParseQuarter(q); pq.Known() {
 		for k := range d {
-			nk := normalize(k)
-			if strings.Contains(nk, nq) || strings.Contains(nq, nk) {
+			if ParseQuarter(k) == pq {
 				return k
 			}
 		}
-		return ""
-	}
-
-	// take up to first 4 quarters from qOrder
-	max := 4
-	if len(qOrder) < 4 {
-		max = len(qOrder)
-	}
-	cr.Quarters = make([]string, 0, 4)
-	cr.Revenue = make([]QuarterValue, 0, 4)
-	cr.NetProfit = make([]QuarterValue, 0, 4)
-	for i := 0; i < max; i++ {
-		q := qOrder[i]
-		cr.Quarters = append(cr.Quarters, q)
-		if dump != nil {
-			// try direct key
-			if qmap, ok := dump[q].(map[string]interface{}); ok {
-				rev := valueFromMap(qmap, "TOTAL_SR_Q", "SR_Q")
-				np := valueFromMap(qmap, "NP_Q")
-				if string(rev) == "not declared" {
-					log.Printf("ParseCompanyFundamentals: revenue keys missing for %s quarter=%s keys=[TOTAL_SR_Q,SR_Q]", shortName, q)
-				}
-				if string(np) == "not declared" {
-					log.Printf("ParseCompanyFundamentals: netprofit key missing for %s quarter=%s key=[NP_Q]", shortName, q)
-				}
-				cr.Revenue = append(cr.Revenue, rev)
-				cr.NetProfit = append(cr.NetProfit, np)
-				continue
-			}
-			// try fuzzy match on keys
-			if alt := findQuarterKey(dump, q); alt != "" {
-				if qmap, ok := dump[alt].(map[string]interface{}); ok {
-					log.Printf("ParseCompanyFundamentals: matched quarter %s -> dump key %s for %s", q, alt, shortName)
-					rev := valueFromMap(qmap, "TOTAL_SR_Q", "SR_Q")
-					np := valueFromMap(qmap, "NP_Q")
-					cr.Revenue = append(cr.Revenue, rev)
-					cr.NetProfit = append(cr.NetProfit, np)
-					continue
-				}
-			}
-			// quarter entry missing inside dump
-			log.Printf("ParseCompanyFundamentals: quarter %s missing in dump for %s", q, shortName)
-		} else {
-			// dump is nil
-			log.Printf("ParseCompanyFundamentals: no dump to read quarter %s for %s", q, shortName)
+	}
+	return ""
+}
+
+var nonAlnumRe = regexp.MustCompile(`[^a-z0-9]`)
+
+func normalizeKey(s string) string {
+	return nonAlnumRe.ReplaceAllString(strings.ToLower(s), "")
+}
+
+// ParseCompanyFundamentals extracts the last 4 quarters of revenue and net profit (and the
+// registry's extra metrics). Problems found by ValidateFundamentals are kept in cr.Issues.
+func ParseCompanyFundamentals(shortName string, fundJSON []byte, reg MetricRegistry) CompanyResult {
+	doc, issues := ValidateFundamentals(fundJSON, reg)
+	return companyResultFromDoc(shortName, doc, issues, reg)
+}
+
+// ParseFundamentalsRoot is ParseCompanyFundamentals on a document from FetchFundamentals,
+// as the quarters stood on asOf (zero: now)
+func ParseFundamentalsRoot(shortName string, root map[string]interface{}, reg MetricRegistry, asOf time.Time) CompanyResult {
+	doc, issues := validateFundamentalsRoot(root, reg, asOf)
+	return companyResultFromDoc(shortName, doc, issues, reg)
+}
+
+func companyResultFromDoc(shortName string, doc fundamentalsDoc, issues []string, reg MetricRegistry) CompanyResult {
+	cr := CompanyResult{
+		Company:   shortName,
+		MarketCap: math.NaN(),
+
+		Price:           math.NaN(),
+		BookValue:       math.NaN(),
+		EnterpriseValue: math.NaN(),
+
+		PromoterHolding: math.NaN(),
+		Pledged:         math.NaN(),
+		HoldingChange:   math.NaN(),
+		PledgeChange:    math.NaN(),
+	}
+	cr.ROE, cr.ROCE = annualReturns(doc)
+	cr.Debt, cr.DebtToEquity, cr.DebtChange = annualDebt(doc)
+	if len(doc.Years) > 0 {
+		cr.AnnualYear = doc.Years[0]
+	}
+	cr.Basis = doc.Basis
+	cr.Segments = doc.Segments
+	cr.Issues = issues
+	if len(issues) > 0 {
+		log.Printf("ParseCompanyFundamentals: %s: %s", shortName, strings.Join(issues, "; "))
+	}
+
+	revKeys := reg.Keys("revenue")
+	npKeys := reg.Keys("net_profit")
+	for i, q := range doc.Quarters {
+		cr.Quarters = append(cr.Quarters, ParseQuarter(q))
+		rev, np := QuarterValue("not declared"), QuarterValue("not declared")
+		if entry := doc.Entries[i]; entry != nil {
+			addMetrics(&cr, reg, entry, i, len(doc.Quarters))
+			rev = valueFromMap(entry, revKeys...)
+			np = valueFromMap(entry, npKeys...)
 		}
-		// not found
-		cr.Revenue = append(cr.Revenue, QuarterValue("not declared"))
-		cr.NetProfit = append(cr.NetProfit, QuarterValue("not declared"))
+		cr.Revenue = append(cr.Revenue, rev)
+		cr.NetProfit = append(cr.NetProfit, np)
 	}
 	// pad up to 4 entries with "not declared"
 	for len(cr.Quarters) < 4 {
-		cr.Quarters = append(cr.Quarters, "")
+		cr.Quarters = append(cr.Quarters, Quarter{})
 		cr.Revenue = append(cr.Revenue, QuarterValue("not declared"))
 		cr.NetProfit = append(cr.NetProfit, QuarterValue("not declared"))
 	}
-	log.Printf("ParseCompanyFundamentals: finished for %s quarters=%v revenue=%v netprofit=%v", shortName, cr.Quarters, cr.Revenue, cr.NetProfit)
 
 	// populate numeric arrays (NaN for "not declared")
 	cr.RevenueNums = make([]float64, len(cr.Revenue))
@@ -377,10 +822,49 @@ func ParseCompanyFundamentals(shortName string, fundJSON []byte) CompanyResult {
 		cr.RevenueNums[i] = quarterValueToFloat64(cr.Revenue[i])
 		cr.NetProfitNums[i] = quarterValueToFloat64(cr.NetProfit[i])
 	}
-
+	cr.Anomalies = docAnomalies(cr, doc, reg)
 	return cr
 }
 
+// addMetrics records every numeric field of quarter i's dump entry in cr.Metrics, plus the
+// registry's extra metrics under their names
+func addMetrics(cr *CompanyResult, reg MetricRegistry, qmap map[string]interface{}, i, n int) {
+	set := func(k string, f float64) {
+		if cr.Metrics == nil {
+			cr.Metrics = map[string][]float64{}
+		}
+		vals, ok := cr.Metrics[k]
+		if !ok {
+			vals = make([]float64, n)
+			for j := range vals {
+				vals[j] = math.NaN()
+			}
+			cr.Metrics[k] = vals
+		}
+		vals[i] = f
+	}
+	for _, m := range reg.Extra() {
+		if f := quarterValueToFloat64(valueFromMap(qmap, m.Keys...)); !math.IsNaN(f) {
+			set(m.Name, f)
+		}
+	}
+	for k, v := range qmap {
+		var f float64
+		switch vv := v.(type) {
+		case float64:
+			f = vv
+		case string:
+			var err error
+			if f, err = strconv.ParseFloat(strings.ReplaceAll(vv, ",", ""), 64); err != nil || math.IsInf(f, 0) {
+				continue
+			}
+		default:
+			continue
+		}
+		set(k, f)
+	}
+}
+
 // quarterValueToFloat64 converts QuarterValue to float64, returns NaN if not parseable
 func quarterValueToFloat64(q QuarterValue) float64 {
 	s := strings.TrimSpace(string(q))
@@ -389,26 +873,23 @@ func quarterValueToFloat64(q QuarterValue) float64 {
 	}
 	// remove commas if any
 	s = strings.ReplaceAll(s, ",", "")
-	if f, err := strconv.ParseFloat(s, 64); err == nil {
+	// ParseFloat also takes "Inf" and "Infinity", which are no figure
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) {
 		return f
 	}
 	return math.NaN()
 }
 
-// chooseBestDump scores candidates under quarterlyDataDump and returns the map with most matches
-func chooseBestDump(qd map[string]interface{}, qOrder []string) map[string]interface{} {
-	normalize := func(s string) string {
-		s = strings.ToLower(s)
-		re := regexp.MustCompile(`[^a-z0-9]`)
-		return re.ReplaceAllString(s, "")
-	}
+// chooseBestDump scores candidates under quarterlyDataDump and returns the map with most
+// matches and its key (e.g. "consolidated")
+func chooseBestDump(qd map[string]interface{}, qOrder []string) (string, map[string]interface{}) {
 	// prepare normalized targets
 	targets := make([]string, 0, len(qOrder))
 	for _, q := range qOrder {
-		targets = append(targets, normalize(q))
+		targets = append(targets, normalizeKey(q))
 	}
-	bestKey := ""
 	bestScore := -1
+	var bestKey string
 	var bestMap map[string]interface{}
 	for k, v := range qd {
 		m, ok := v.(map[string]interface{})
@@ -418,7 +899,7 @@ func chooseBestDump(qd map[string]interface{}, qOrder []string) map[string]inter
 		// score how many targets appear in m's keys (normalized)
 		score := 0
 		for mk := range m {
-			nmk := normalize(mk)
+			nmk := normalizeKey(mk)
 			for _, t := range targets {
 				if t == nmk || strings.Contains(nmk, t) || strings.Contains(t, nmk) {
 					score++
@@ -427,17 +908,12 @@ func chooseBestDump(qd map[string]interface{}, qOrder []string) map[string]inter
 				}
 			}
 		}
-		log.Printf("chooseBestDump: candidate=%s score=%d keys=%d", k, score, len(m))
-		if score > bestScore {
+		if score > bestScore || (score == bestScore && k < bestKey) {
 			bestScore = score
-			bestKey = k
-			bestMap = m
+			bestKey, bestMap = k, m
 		}
 	}
-	if bestMap != nil {
-		log.Printf("chooseBestDump: selected candidate=%s with score=%d", bestKey, bestScore)
-	}
-	return bestMap
+	return bestKey, bestMap
 }
 
 // valueFromMap tries keys in order and returns formatted QuarterValue
@@ -449,7 +925,7 @@ func valueFromMap(m map[string]interface{}, keys ...string) QuarterValue {
 				return QuarterValue(formatFloat(vv))
 			case string:
 				// sometimes numbers are strings
-				if f, err := strconv.ParseFloat(vv, 64); err == nil {
+				if f, err := strconv.ParseFloat(vv, 64); err == nil && !math.IsInf(f, 0) {
 					return QuarterValue(formatFloat(f))
 				}
 				if vv == "" {
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+)
+
+// Fuzz targets for the helpers that make sense of upstream payloads. `go test` runs them
+// on the seeds below (and on any failing input saved under testdata/fuzz); to search for
+// new failures run one at a time, e.g.
+//
+//	go test -run '^$' -fuzz FuzzParseCompanyFundamentals -fuzztime 1m
+
+// fundamentalsSeed is a trimmed trendlyne fundamentals response
+const fundamentalsSeed = `{"head":{"status":"0"},"body":{
+"quarterlyOrder":["Jun 2024","Mar 2024","Dec 2023","Sep 2023","Jun 2023"],
+"quarterlyDataDump":{
+ "consolidated":{"Jun 2024":{"TOTAL_SR_Q":62613,"NP_Q":12105,"EBITDA_Q":"17,220"},"Mar 2024":{"TOTAL_SR_Q":"61,237","NP_Q":12502},"Dec 2023":{"SR_Q":60583,"NP_Q":null},"Sep-2023":{"TOTAL_SR_Q":59692,"NP_Q":-11.5}},
+ "standalone":{"Jun 2024":{"TOTAL_SR_Q":52000}}},
+"annualOrder":["Mar 2024","Mar 2023"],
+"annualDataDump":{"consolidated":{"Mar 2024":{"NP_A":45908,"TOTAL_EQUITY_A":90489,"TOTAL_DEBT_A":8021},"Mar 2023":{"NP_A":42147,"TOTAL_DEBT_A":7688}}}}}`
+
+func FuzzExtractJSONFromBody(f *testing.F) {
+	f.Add([]byte(`<html><script>var data = {"a":[1,2,{"b":"}"}]};</script></html>`))
+	f.Add([]byte(`while(1);[{"id":"1","label":"TCS \"x\" ]"}]<!-- -->`))
+	f.Add([]byte(`<p>no json here</p>`))
+	f.Add([]byte(`{"truncated": ["a", "b`))
+	f.Add([]byte("\xef\xbb\xbf{\"x\":\"\\\\\"}\x00"))
+	f.Add([]byte(fundamentalsSeed))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		out, err := extractJSONFromBody(b)
+		if err != nil {
+			return
+		}
+		if len(out) < 2 || !bytes.Contains(b, out) {
+			t.Fatalf("result %q is not a part of the input", out)
+		}
+		if open, close := out[0], out[len(out)-1]; !(open == '{' && close == '}') && !(open == '[' && close == ']') {
+			t.Fatalf("result %q is not delimited by a bracket pair", out)
+		}
+		// whatever was found, a valid document is returned whole
+		if json.Valid(b) && (b[0] == '{' || b[0] == '[') && !bytes.Equal(out, bytes.TrimSpace(b)) {
+			t.Fatalf("valid JSON %q came back as %q", b, out)
+		}
+	})
+}
+
+func FuzzQuarterValueToFloat64(f *testing.F) {
+	for _, s := range []string{"62613", "1,23,456.78", " -11.5 ", "not declared", "NOT DECLARED", "", "--",
+		"1e400", "Infinity", "-inf", "NaN", "0x1p-2", "12_000", "₹ 5", "\x00"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		v := quarterValueToFloat64(QuarterValue(s))
+		if math.IsInf(v, 0) {
+			t.Fatalf("%q parsed as %v; want a finite number or NaN", s, v)
+		}
+		// the report shows it with formatFloat, and reads that back
+		if !math.IsNaN(v) && math.IsNaN(quarterValueToFloat64(QuarterValue(formatFloat(v)))) {
+			t.Fatalf("%q parsed as %v, but formatFloat gives %q", s, v, formatFloat(v))
+		}
+	})
+}
+
+func FuzzParseCompanyFundamentals(f *testing.F) {
+	f.Add([]byte(fundamentalsSeed))
+	f.Add([]byte(fundamentalsSeed[:len(fundamentalsSeed)/2]))
+	f.Add([]byte(`{"body":{"quarterlyOrder":"Jun 2024","quarterlyDataDump":[1,2]}}`))
+	f.Add([]byte(`{"body":{"quarterlyOrder":["","Jun 2024",7],"quarterlyDataDump":{"x":{"jun2024":{"NP_Q":"Infinity","TOTAL_SR_Q":true}}}}}`))
+	f.Add([]byte(`{"body":null}`))
+	f.Add([]byte(`<html>Service Unavailable</html>`))
+	reg, err := BuildMetricRegistry([]MetricConfig{{Name: "ebitda", Keys: []string{"EBITDA_Q"}}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	log.SetOutput(io.Discard) // issues are logged per company
+	f.Cleanup(func() { log.SetOutput(os.Stderr) })
+	f.Fuzz(func(t *testing.T, b []byte) {
+		cr := ParseCompanyFundamentals("FUZZ", b, reg)
+		if !json.Valid(b) && len(cr.Issues) == 0 {
+			t.Fatalf("invalid JSON parsed without issues")
+		}
+		// the report and the exports index these by quarter
+		n := len(cr.Quarters)
+		if n != 4 || len(cr.Revenue) != n || len(cr.NetProfit) != n || len(cr.RevenueNums) != n || len(cr.NetProfitNums) != n {
+			t.Fatalf("quarters %d, revenue %d/%d, net profit %d/%d; want 4 of each",
+				n, len(cr.Revenue), len(cr.RevenueNums), len(cr.NetProfit), len(cr.NetProfitNums))
+		}
+		for k, vals := range cr.Metrics {
+			if len(vals) > n {
+				t.Fatalf("metric %s has %d values for %d quarters", k, len(vals), n)
+			}
+		}
+		// stored in the history as JSON
+		if _, err := json.Marshal(cr); err != nil {
+			t.Fatalf("result does not marshal: %v", err)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+)
+
+// rowVars returns the names a filter expression can use for one result, its growth under
+// the zero_base policy
+func rowVars(r CompanyResult, watchlist []string, zeroBase string) map[string]interface{} {
+	at := func(vals []float64, i int) float64 {
+		if i < len(vals) {
+			return vals[i]
+		}
+		return math.NaN()
+	}
+	rev, np := latestGrowth(r, zeroBase)
+	val := Valuate(r)
+	quality, _ := dataQuality(r)
+	quarter := ""
+	if len(r.Quarters) > 0 {
+		quarter = r.Quarters[0].String()
+	}
+	return map[string]interface{}{
+		"company":         r.Company,
+		"long_name":       r.LongName,
+		"sector":          r.Sector,
+		"isin":            r.ISIN,
+		"group":           r.Group,     // BSE group: A, B, T, ...
+		"nse_symbol":      r.NSESymbol, // empty when not listed on NSE
+		"purpose":         r.Purpose,   // empty for results meetings
+		"actions":         strings.Join(r.CorpActions, ","),
+		"quarter":         quarter,
+		"revenue":         at(r.RevenueNums, 0),
+		"net_profit":      at(r.NetProfitNums, 0),
+		"prev_revenue":    at(r.RevenueNums, 1),
+		"prev_net_profit": at(r.NetProfitNums, 1),
+		"rev_growth":      rev.Pct, // % vs previous quarter, NaN on a sign flip
+		"np_growth":       np.Pct,
+		"rev_change":      rev.Abs, // ₹ cr vs previous quarter
+		"np_change":       np.Abs,
+		"market_cap":      r.MarketCap,
+		"price":           r.Price,
+		"pe":              val.PE,
+		"pb":              val.PB,
+		"ev_ebitda":       val.EVEBITDA,
+		"roe":             r.ROE, // %, latest year
+		"roce":            r.ROCE,
+		"debt":            r.Debt, // ₹ cr, latest year
+		"debt_equity":     r.DebtToEquity,
+		"interest_cover":  interestCoverage(r, 0),
+		"leveraged":       r.Leverage != "",
+		"promoter":        r.PromoterHolding, // % of shares
+		"holding_change":  r.HoldingChange,   // percentage points since the shareholding last moved
+		"pledged":         r.Pledged,         // % of the promoter holding
+		"pledge_change":   r.PledgeChange,
+		"watchlist":       inWatchlist(watchlist, r.Company),
+		"quality":         float64(quality), // data-quality score, 0-100
+		"mismatch":        r.CrossCheck != "",
+	}
+}
+
+// FilterResults keeps the results for which the filter expression is true, growth taken
+// under the zero_base policy. An empty filter keeps everything.
+func FilterResults(filter string, watchlist []string, zeroBase string, results []CompanyResult) ([]CompanyResult, error) {
+	if filter == "" {
+		return results, nil
+	}
+	e, err := ParseExpr(filter)
+	if err != nil {
+		return nil, err
+	}
+	var kept []CompanyResult
+	for _, r := range results {
+		vars := formulaVars(r, watchlist, zeroBase)
+		// metrics a company doesn't report are missing, not an error
+		for _, name := range e.Names() {
+			if _, ok := vars[name]; !ok {
+				vars[name] = math.NaN()
+			}
+		}
+		ok, err := e.EvalBool(vars)
+		if err != nil {
+			return nil, fmt.Errorf("filter on %s: %v", r.Company, err)
+		}
+		if ok {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// mustFilter returns the filter to use (the flag value, else the config's) after checking
+// that it parses, so a typo fails before any fetching
+func mustFilter(flagValue string, cfg Config) string {
+	filter := flagValue
+	if filter == "" {
+		filter = cfg.Filter
+	}
+	if filter != "" {
+		if _, err := ParseExpr(filter); err != nil {
+			log.Fatalf("filter: %v", err)
+		}
+	}
+	return filter
+}
+
+// filterOrAll applies the filter, logging and keeping every result if it fails to evaluate
+func filterOrAll(filter string, cfg Config, results []CompanyResult) []CompanyResult {
+	kept, err := FilterResults(filter, cfg.Watchlist, cfg.ZeroBase, results)
+	if err != nil {
+		log.Printf("filter ignored: %v", err)
+		return results
+	}
+	return kept
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files from the current output:
+//
+//	go test -run Golden -update
+//
+// Review the diff of testdata/golden before committing it.
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// loadFixture reads the canned runs of testdata/runs.json, newest first
+func loadFixture(t *testing.T) []RunRecord {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "runs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runs []RunRecord
+	if err := json.Unmarshal(b, &runs); err != nil {
+		t.Fatalf("testdata/runs.json: %v", err)
+	}
+	return runs
+}
+
+// checkGolden compares got with testdata/golden/name, or writes it there with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run `go test -run Golden -update` to create it)", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Fatalf("%s differs from the golden file at line %d:\n got: %s\nwant: %s\n(if the change is intended, run `go test -run Golden -update`)",
+				name, i+1, clip(g, w), clip(w, g))
+		}
+	}
+}
+
+// clip shortens a long line (the report puts whole tables on one) to the part around
+// where it first differs from other
+func clip(line, other string) string {
+	at := 0
+	for at < len(line) && at < len(other) && line[at] == other[at] {
+		at++
+	}
+	from, to := max(at-80, 0), min(at+80, len(line))
+	s := line[from:to]
+	if from > 0 {
+		s = "…" + s
+	}
+	if to < len(line) {
+		s += "…"
+	}
+	return s
+}
+
+func TestGoldenReport(t *testing.T) {
+	runs := loadFixture(t)
+	latest := runs[0]
+	cols, err := ParseColumns([]ColumnConfig{{Name: "NP margin", Formula: "NP_Q / TOTAL_SR_Q * 100", Format: "pct", Color: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		opts ReportOptions
+	}{
+		{"report.html", ReportOptions{}},
+		{"report_configured.html", ReportOptions{
+			Columns:   cols,
+			Watchlist: []string{"TURNAROUND"},
+			SortBy:    "np-growth",
+			Notes:     Notes{"TCS": "buyback pending"},
+		}},
+		{"report_cohort.html", ReportOptions{Date: latest.Date, History: runs[1:]}},
+		{"report_live.html", ReportOptions{Live: true}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkGolden(t, c.name, []byte(RenderHTMLReport(latest.Results, latest.Failures, c.opts)))
+		})
+	}
+}
+
+func TestGoldenSeason(t *testing.T) {
+	runs := loadFixture(t)
+	checkGolden(t, "season.html", []byte(RenderSeason(runs[0], runs[1:])))
+}
+
+func TestGoldenDuel(t *testing.T) {
+	results := loadFixture(t)[0].Results
+	checkGolden(t, "duel.html", []byte(RenderDuel(results[0], results[1], zeroBaseNA)))
+}
+
+func TestGoldenHistoryCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeHistoryCSV(&buf, loadFixture(t), zeroBaseNA); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "history.csv", buf.Bytes())
+}
+
+func TestGoldenHistoryJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeHistoryJSON(&buf, loadFixture(t)); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "history.json", buf.Bytes())
+}
@@ -0,0 +1,840 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A small GraphQL query engine: the parser for query documents (fields, aliases,
+// arguments, variables, fragments and @include/@skip) and an executor over gqlTypes.
+// Object types only, so fragments apply when their type condition names the type.
+
+// gqlMaxDepth bounds how deeply selection sets, argument values and variable types may
+// nest in a document; the deepest path in gqlSchema,
+// companies.history.quarters.revenueGrowth.pct, is 5
+const gqlMaxDepth = 10
+
+// gqlMaxFields bounds the fields one operation selects once its fragments are expanded,
+// so a query can't ask for the same costly field thousands of times under aliases
+const gqlMaxFields = 500
+
+// gqlDoc is a parsed query document
+type gqlDoc struct {
+	ops   []gqlOp
+	frags map[string]gqlFragment
+}
+
+type gqlOp struct {
+	kind, name string
+	vars       []gqlVarDef
+	sel        []gqlSel
+}
+
+type gqlVarDef struct {
+	name, typ string
+	def       interface{}
+}
+
+type gqlFragment struct {
+	on  string
+	sel []gqlSel
+}
+
+// gqlSel is one selection: a field, a fragment spread (spread set) or an inline fragment
+// (inline set, on the optional type condition)
+type gqlSel struct {
+	alias, name string
+	args        map[string]interface{}
+	sel         []gqlSel
+	spread      string
+	inline      bool
+	on          string
+	dirs        map[string]map[string]interface{}
+}
+
+// gqlVar is a $variable in an argument value
+type gqlVar string
+
+// key is the field's name in the response
+func (s gqlSel) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type gqlToken struct {
+	kind byte // 'p' punctuator, 'n' name, 'i' int, 'f' float, 's' string, 0 end
+	val  string
+}
+
+// gqlLex splits a query into tokens
+func gqlLex(src string) ([]gqlToken, error) {
+	var toks []gqlToken
+	src = strings.TrimPrefix(src, "\ufeff")
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, gqlToken{'p', "..."})
+			i += 3
+		case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+			toks = append(toks, gqlToken{'p', string(c)})
+			i++
+		case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, gqlToken{'n', src[i:j]})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j, kind := i+1, byte('i')
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || strings.IndexByte(".eE+-", src[j]) >= 0) {
+				if strings.IndexByte(".eE", src[j]) >= 0 {
+					kind = 'f'
+				}
+				j++
+			}
+			toks = append(toks, gqlToken{kind, src[i:j]})
+			i = j
+		case strings.HasPrefix(src[i:], `"""`):
+			end := strings.Index(src[i+3:], `"""`)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated block string")
+			}
+			toks = append(toks, gqlToken{'s', strings.TrimSpace(src[i+3 : i+3+end])})
+			i += end + 6
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(src[i:j+1]), &s); err != nil {
+				return nil, fmt.Errorf("bad string %s", src[i:j+1])
+			}
+			toks = append(toks, gqlToken{'s', s})
+			i = j + 1
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return append(toks, gqlToken{}), nil
+}
+
+// gqlParser is a recursive-descent parser over the tokens of one document
+type gqlParser struct {
+	toks  []gqlToken
+	pos   int
+	depth int // of the selection sets and values being read
+}
+
+// nest enters a selection set or a list or object value; leave undoes it
+func (p *gqlParser) nest() error {
+	if p.depth++; p.depth > gqlMaxDepth {
+		return fmt.Errorf("nested deeper than %d levels", gqlMaxDepth)
+	}
+	return nil
+}
+
+func (p *gqlParser) leave() { p.depth-- }
+
+// parseGraphQL parses a query document
+func parseGraphQL(src string) (*gqlDoc, error) {
+	toks, err := gqlLex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{toks: toks}
+	doc := &gqlDoc{frags: map[string]gqlFragment{}}
+	for p.peek().kind != 0 {
+		switch t := p.peek(); {
+		case t.kind == 'p' && t.val == "{":
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.ops = append(doc.ops, gqlOp{kind: "query", sel: sel})
+		case t.kind == 'n' && t.val == "fragment":
+			p.pos++
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.keyword("on"); err != nil {
+				return nil, err
+			}
+			on, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.frags[name] = gqlFragment{on, sel}
+		case t.kind == 'n' && (t.val == "query" || t.val == "mutation" || t.val == "subscription"):
+			p.pos++
+			op := gqlOp{kind: t.val}
+			if p.peek().kind == 'n' {
+				op.name = p.next().val
+			}
+			if p.accept("(") {
+				for !p.accept(")") {
+					if err := p.expect("$"); err != nil {
+						return nil, err
+					}
+					name, err := p.name()
+					if err != nil {
+						return nil, err
+					}
+					if err := p.expect(":"); err != nil {
+						return nil, err
+					}
+					typ, err := p.typeRef()
+					if err != nil {
+						return nil, err
+					}
+					v := gqlVarDef{name: name, typ: typ}
+					if p.accept("=") {
+						if v.def, err = p.value(true); err != nil {
+							return nil, err
+						}
+					}
+					op.vars = append(op.vars, v)
+				}
+			}
+			if _, err := p.directives(); err != nil {
+				return nil, err
+			}
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			op.sel = sel
+			doc.ops = append(doc.ops, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.ops) == 0 {
+		return nil, fmt.Errorf("no operation in the document")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) peek() gqlToken { return p.toks[p.pos] }
+
+func (p *gqlParser) next() gqlToken {
+	t := p.toks[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the punctuator s if it is next
+func (p *gqlParser) accept(s string) bool {
+	if t := p.peek(); t.kind == 'p' && t.val == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expect(s string) error {
+	if !p.accept(s) {
+		return fmt.Errorf("expected %q, got %s", s, p.describe())
+	}
+	return nil
+}
+
+func (p *gqlParser) keyword(s string) error {
+	if t := p.peek(); t.kind != 'n' || t.val != s {
+		return fmt.Errorf("expected %q, got %s", s, p.describe())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.peek().kind != 'n' {
+		return "", fmt.Errorf("expected a name, got %s", p.describe())
+	}
+	return p.next().val, nil
+}
+
+func (p *gqlParser) describe() string {
+	if t := p.peek(); t.kind != 0 {
+		return strconv.Quote(t.val)
+	}
+	return "end of document"
+}
+
+func (p *gqlParser) unexpected() error {
+	return fmt.Errorf("unexpected %s", p.describe())
+}
+
+// typeRef reads a variable type such as [String!]! and returns it as written
+func (p *gqlParser) typeRef() (string, error) {
+	var typ string
+	if p.accept("[") {
+		if err := p.nest(); err != nil {
+			return "", err
+		}
+		defer p.leave()
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.accept("!") {
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSel, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	var sels []gqlSel
+	for !p.accept("}") {
+		var s gqlSel
+		var err error
+		if p.accept("...") {
+			if t := p.peek(); t.kind == 'n' && t.val != "on" {
+				s.spread = p.next().val
+			} else {
+				s.inline = true
+				if p.peek().kind == 'n' {
+					p.pos++
+					if s.on, err = p.name(); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if s.dirs, err = p.directives(); err != nil {
+				return nil, err
+			}
+			if s.inline {
+				if s.sel, err = p.selectionSet(); err != nil {
+					return nil, err
+				}
+			}
+			sels = append(sels, s)
+			continue
+		}
+		if s.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if p.accept(":") {
+			s.alias = s.name
+			if s.name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if s.args, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		if s.dirs, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t.kind == 'p' && t.val == "{" {
+			if s.sel, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		sels = append(sels, s)
+	}
+	return sels, nil
+}
+
+// arguments reads an optional (name: value ...) list
+func (p *gqlParser) arguments(constant bool) (map[string]interface{}, error) {
+	if !p.accept("(") {
+		return nil, nil
+	}
+	args := map[string]interface{}{}
+	for !p.accept(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(constant); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func (p *gqlParser) directives() (map[string]map[string]interface{}, error) {
+	var dirs map[string]map[string]interface{}
+	for p.accept("@") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		if dirs == nil {
+			dirs = map[string]map[string]interface{}{}
+		}
+		dirs[name] = args
+	}
+	return dirs, nil
+}
+
+// value reads an argument value; constant values (variable defaults) cannot use variables
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	start := p.pos
+	t := p.next()
+	switch t.kind {
+	case 'i':
+		n, err := strconv.Atoi(t.val)
+		if err != nil {
+			return nil, fmt.Errorf("bad integer %s", t.val)
+		}
+		return n, nil
+	case 'f':
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %s", t.val)
+		}
+		return f, nil
+	case 's':
+		return t.val, nil
+	case 'n':
+		switch t.val {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t.val, nil // enum values are taken as strings
+	case 'p':
+		switch t.val {
+		case "$":
+			if constant {
+				return nil, fmt.Errorf("variables are not allowed here")
+			}
+			name, err := p.name()
+			return gqlVar(name), err
+		case "[":
+			if err := p.nest(); err != nil {
+				return nil, err
+			}
+			defer p.leave()
+			list := []interface{}{}
+			for !p.accept("]") {
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, nil
+		case "{":
+			if err := p.nest(); err != nil {
+				return nil, err
+			}
+			defer p.leave()
+			obj := map[string]interface{}{}
+			for !p.accept("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if obj[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		}
+	}
+	p.pos = start
+	return nil, p.unexpected()
+}
+
+// gqlField is a field of an object type in gqlTypes. typ is a scalar (String, Int, Float,
+// Boolean), an object type or [T] for a list; args maps argument names to their types,
+// with ! marking the required ones.
+type gqlField struct {
+	typ     string
+	args    map[string]string
+	resolve func(e *gqlExec, src interface{}, args gqlArgs) (interface{}, error)
+}
+
+// gqlArgs are the arguments of one field, variables substituted
+type gqlArgs map[string]interface{}
+
+func (a gqlArgs) str(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+func (a gqlArgs) num(name string) int {
+	n, _ := a[name].(int)
+	return n
+}
+
+func gqlScalar(typ string) bool {
+	switch typ {
+	case "String", "Int", "Float", "Boolean":
+		return true
+	}
+	return false
+}
+
+// gqlObject is a response object, keeping the fields in query order
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key string
+	val interface{}
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(e.key)
+		v, err := json.Marshal(e.val)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// gqlError is an entry of the response's errors
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// gqlExec executes one operation, reading the history database db as its fields ask
+type gqlExec struct {
+	doc       *gqlDoc
+	vars      map[string]interface{}
+	db        *sql.DB
+	watchlist []string
+	zeroBase  string       // the zero_base policy of every growth
+	scrips    *scripMaster // for the former names of a company
+	errs      []gqlError
+
+	companies  map[string][]gqlResult // companyResults by upper-cased name
+	aliasCache map[string][]string    // aliases by upper-cased name
+	fields     int                    // selected so far by validate
+}
+
+// operation picks the operation to run: the named one, or the only one
+func (d *gqlDoc) operation(name string) (gqlOp, error) {
+	for _, op := range d.ops {
+		if op.name == name || name == "" && len(d.ops) == 1 {
+			return op, nil
+		}
+	}
+	if name == "" {
+		return gqlOp{}, fmt.Errorf("the document has several operations; set operationName")
+	}
+	return gqlOp{}, fmt.Errorf("no operation named %q", name)
+}
+
+// variables applies the operation's variable defaults to the request's values and checks
+// the required ones are set
+func (op gqlOp) variables(given map[string]interface{}) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, v := range op.vars {
+		val, ok := given[v.name]
+		if !ok {
+			val = v.def
+		}
+		if val == nil && strings.HasSuffix(v.typ, "!") {
+			return nil, fmt.Errorf("variable $%s of type %s is required", v.name, v.typ)
+		}
+		// JSON numbers arrive as float64; Int variables want int
+		if f, ok := val.(float64); ok && strings.TrimSuffix(v.typ, "!") == "Int" && f == float64(int(f)) {
+			val = int(f)
+		}
+		vars[v.name] = val
+	}
+	return vars, nil
+}
+
+// validate checks sel against typ before anything runs: fields and arguments exist,
+// required arguments are given, objects, and only objects, have a selection, and no more
+// than gqlMaxFields are selected
+func (e *gqlExec) validate(typ string, sel []gqlSel, seen map[string]bool) error {
+	for _, s := range sel {
+		switch {
+		case s.spread != "":
+			f, ok := e.doc.frags[s.spread]
+			if !ok {
+				return fmt.Errorf("unknown fragment %q", s.spread)
+			}
+			if seen[s.spread] {
+				return fmt.Errorf("fragment %q spreads itself", s.spread)
+			}
+			if f.on != typ {
+				return fmt.Errorf("fragment %q on %s cannot be spread within %s", s.spread, f.on, typ)
+			}
+			seen[s.spread] = true
+			err := e.validate(typ, f.sel, seen)
+			delete(seen, s.spread)
+			if err != nil {
+				return err
+			}
+			continue
+		case s.inline:
+			if s.on != "" && s.on != typ {
+				return fmt.Errorf("inline fragment on %s cannot be used within %s", s.on, typ)
+			}
+			if err := e.validate(typ, s.sel, seen); err != nil {
+				return err
+			}
+			continue
+		}
+		if e.fields++; e.fields > gqlMaxFields {
+			return fmt.Errorf("the query selects more than %d fields", gqlMaxFields)
+		}
+		switch {
+		case s.name == "__typename":
+			continue
+		case s.name == "__schema" || s.name == "__type":
+			return fmt.Errorf("introspection is not supported; the schema is served at /graphql/schema")
+		}
+		f, ok := gqlTypes[typ][s.name]
+		if !ok {
+			return fmt.Errorf("cannot query field %q on type %s", s.name, typ)
+		}
+		for name := range s.args {
+			if _, ok := f.args[name]; !ok {
+				return fmt.Errorf("unknown argument %q on field %s.%s", name, typ, s.name)
+			}
+		}
+		for name, at := range f.args {
+			if strings.HasSuffix(at, "!") && s.args[name] == nil {
+				return fmt.Errorf("field %s.%s needs argument %q", typ, s.name, name)
+			}
+		}
+		inner := strings.Trim(f.typ, "[]")
+		if gqlScalar(inner) {
+			if s.sel != nil {
+				return fmt.Errorf("field %s.%s is a %s and has no fields", typ, s.name, f.typ)
+			}
+			continue
+		}
+		if s.sel == nil {
+			return fmt.Errorf("field %s.%s of type %s needs a selection of its fields", typ, s.name, f.typ)
+		}
+		if err := e.validate(inner, s.sel, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect flattens fragments and drops @skip/@include'd selections; fields asked for
+// twice under one key are merged
+func (e *gqlExec) collect(sel []gqlSel, keys *[]string, fields map[string][]gqlSel) {
+	for _, s := range sel {
+		if d, ok := s.dirs["skip"]; ok && e.arg(d["if"]) == true {
+			continue
+		}
+		if d, ok := s.dirs["include"]; ok && e.arg(d["if"]) != true {
+			continue
+		}
+		switch {
+		case s.spread != "":
+			e.collect(e.doc.frags[s.spread].sel, keys, fields)
+		case s.inline:
+			e.collect(s.sel, keys, fields)
+		default:
+			if _, ok := fields[s.key()]; !ok {
+				*keys = append(*keys, s.key())
+			}
+			fields[s.key()] = append(fields[s.key()], s)
+		}
+	}
+}
+
+// arg substitutes the variables in an argument value
+func (e *gqlExec) arg(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case gqlVar:
+		return e.vars[string(vv)]
+	case []interface{}:
+		out := make([]interface{}, len(vv))
+		for i, x := range vv {
+			out[i] = e.arg(x)
+		}
+		return out
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, x := range vv {
+			out[k] = e.arg(x)
+		}
+		return out
+	}
+	return v
+}
+
+// selectionSet resolves sel on src, an object of type typ
+func (e *gqlExec) selectionSet(typ string, src interface{}, sel []gqlSel, path []interface{}) gqlObject {
+	var keys []string
+	fields := map[string][]gqlSel{}
+	e.collect(sel, &keys, fields)
+	out := make(gqlObject, 0, len(keys))
+	for _, key := range keys {
+		s := fields[key][0]
+		if s.name == "__typename" {
+			out = append(out, gqlEntry{key, typ})
+			continue
+		}
+		var sub []gqlSel
+		for _, f := range fields[key] {
+			sub = append(sub, f.sel...)
+		}
+		f := gqlTypes[typ][s.name]
+		fieldPath := append(path[:len(path):len(path)], key)
+		args := gqlArgs{}
+		var err error
+		for name, at := range f.args {
+			if args[name], err = gqlCoerce(at, e.arg(s.args[name])); err != nil {
+				err = fmt.Errorf("argument %q: %v", name, err)
+				break
+			}
+		}
+		var v interface{}
+		if err == nil {
+			v, err = f.resolve(e, src, args)
+		}
+		if err != nil {
+			e.errs = append(e.errs, gqlError{Message: err.Error(), Path: fieldPath})
+			out = append(out, gqlEntry{key, nil})
+			continue
+		}
+		out = append(out, gqlEntry{key, e.complete(f.typ, v, sub, fieldPath)})
+	}
+	return out
+}
+
+// complete turns a resolved value into its response form
+func (e *gqlExec) complete(typ string, v interface{}, sel []gqlSel, path []interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		list, _ := v.([]interface{})
+		out := make([]interface{}, len(list))
+		for i, x := range list {
+			out[i] = e.complete(typ[1:len(typ)-1], x, sel, append(path[:len(path):len(path)], i))
+		}
+		return out
+	}
+	if gqlScalar(typ) {
+		return v
+	}
+	return e.selectionSet(typ, v, sel, path)
+}
+
+// gqlCoerce checks an argument value against its declared type
+func gqlCoerce(typ string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch strings.TrimSuffix(typ, "!") {
+	case "Int":
+		if f, ok := v.(float64); ok && f == float64(int(f)) {
+			v = int(f)
+		}
+		if _, ok := v.(int); !ok {
+			return nil, fmt.Errorf("want an Int")
+		}
+	case "String":
+		if _, ok := v.(string); !ok {
+			return nil, fmt.Errorf("want a String")
+		}
+	}
+	return v, nil
+}
+
+// runGraphQL parses and executes a query, returning the response body
+func runGraphQL(query, operation string, variables map[string]interface{}, db *sql.DB, scrips *scripMaster, watchlist []string, zeroBase string) map[string]interface{} {
+	fail := func(err error) map[string]interface{} {
+		return map[string]interface{}{"errors": []gqlError{{Message: err.Error()}}}
+	}
+	doc, err := parseGraphQL(query)
+	if err != nil {
+		return fail(fmt.Errorf("syntax error: %v", err))
+	}
+	op, err := doc.operation(operation)
+	if err != nil {
+		return fail(err)
+	}
+	if op.kind != "query" {
+		return fail(fmt.Errorf("only queries are supported, not %s", op.kind))
+	}
+	vars, err := op.variables(variables)
+	if err != nil {
+		return fail(err)
+	}
+	e := &gqlExec{doc: doc, vars: vars, db: db, scrips: scrips, watchlist: watchlist, zeroBase: zeroBase}
+	if err := e.validate("Query", op.sel, map[string]bool{}); err != nil {
+		return fail(err)
+	}
+	resp := map[string]interface{}{"data": e.selectionSet("Query", nil, op.sel, nil)}
+	if len(e.errs) > 0 {
+		resp["errors"] = e.errs
+	}
+	return resp
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// gqlSchema documents the GraphQL API served at /graphql (see gqlTypes); it is served
+// as is at /graphql/schema for client code generators
+const gqlSchema = `# Quarter Compare GraphQL API over the stored history. Numbers are ₹ cr or %;
+# a figure that is not known is null.
+
+type Query {
+  "stored runs, newest first"
+  runs(limit: Int): [Run]
+  "the run stored for date (2006-01-02), the latest without"
+  run(date: String): Run
+  "a company by short or long name"
+  company(name: String!): Company
+  "every company in the history by name; sector keeps those whose latest result is in it"
+  companies(sector: String): [Company]
+}
+
+type Run {
+  date: String
+  companyCount: Int
+  "company picks one (short or long name); filter is a filter expression such as \"np_growth > 20\"; sortBy is company, np-growth, rev-growth or mcap"
+  results(company: String, filter: String, sortBy: String): [Result]
+  failures: [Failure]
+}
+
+"one company's result as stored by a run"
+type Result {
+  date: String
+  company: String
+  longName: String
+  sector: String
+  isin: String
+  marketCap: Float
+  price: Float
+  promoterHolding: Float
+  pledged: Float
+  "the latest quarter"
+  quarter: String
+  revenue: Float
+  netProfit: Float
+  "the latest quarter against the one before"
+  revenueGrowth: Growth
+  netProfitGrowth: Growth
+  "latest first"
+  quarters: [Quarter]
+  issues: [String]
+  announcementUrl: String
+  pdfUrl: String
+}
+
+type Quarter {
+  label: String
+  "last day of the quarter, 2006-01-02"
+  end: String
+  revenue: Float
+  netProfit: Float
+  "against the quarter before it in the result"
+  revenueGrowth: Growth
+  netProfitGrowth: Growth
+}
+
+type Growth {
+  "percent change; null when a side is missing or the sign flipped"
+  pct: Float
+  "absolute change in ₹ cr"
+  change: Float
+  "loss to profit or profit to loss"
+  signFlip: Boolean
+  "as shown in the report"
+  text: String
+}
+
+type Company {
+  name: String
+  longName: String
+  sector: String
+  "the result of the latest run that has the company"
+  latest: Result
+  "its result in every run, newest first"
+  history(limit: Int): [Result]
+}
+
+type Failure {
+  company: String
+  longName: String
+  error: String
+}
+`
+
+// the values behind the object types
+type (
+	gqlResult struct {
+		date string
+		r    CompanyResult
+	}
+	gqlQuarter struct {
+		r CompanyResult
+		i int
+	}
+	gqlCompany struct {
+		name string
+	}
+)
+
+// gqlTypes are the object types of gqlSchema and their resolvers
+var gqlTypes = map[string]map[string]gqlField{
+	"Query": {
+		"runs": {typ: "[Run]", args: map[string]string{"limit": "Int"}, resolve: func(e *gqlExec, _ interface{}, a gqlArgs) (interface{}, error) {
+			runs, err := queryHistory(e.db, historyQuery{Limit: a.num("limit")})
+			if err != nil {
+				return nil, err
+			}
+			out := make([]interface{}, len(runs))
+			for i, run := range runs {
+				out[i] = run
+			}
+			return out, nil
+		}},
+		"run": {typ: "Run", args: map[string]string{"date": "String"}, resolve: func(e *gqlExec, _ interface{}, a gqlArgs) (interface{}, error) {
+			run, ok, err := storedRun(e.db, a.str("date"))
+			if err != nil || !ok {
+				return nil, err
+			}
+			return run, nil
+		}},
+		"company": {typ: "Company", args: map[string]string{"name": "String!"}, resolve: func(e *gqlExec, _ interface{}, a gqlArgs) (interface{}, error) {
+			if a.str("name") == "" {
+				return nil, nil
+			}
+			rs, err := e.companyResults(a.str("name"))
+			if err != nil || len(rs) == 0 {
+				return nil, err
+			}
+			return gqlCompany{rs[0].r.Company}, nil
+		}},
+		"companies": {typ: "[Company]", args: map[string]string{"sector": "String"}, resolve: func(e *gqlExec, _ interface{}, a gqlArgs) (interface{}, error) {
+			sectors, err := historySectors(e.db)
+			if err != nil {
+				return nil, err
+			}
+			var names []string
+			for name, sector := range sectors {
+				if s := a.str("sector"); s == "" || strings.EqualFold(sector, s) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			out := make([]interface{}, len(names))
+			for i, name := range names {
+				out[i] = gqlCompany{name}
+			}
+			return out, nil
+		}},
+	},
+	"Run": {
+		"date": {typ: "String", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) { return src.(RunRecord).Date, nil }},
+		"companyCount": {typ: "Int", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			return len(src.(RunRecord).Results), nil
+		}},
+		"results": {typ: "[Result]", args: map[string]string{"company": "String", "filter": "String", "sortBy": "String"}, resolve: func(e *gqlExec, src interface{}, a gqlArgs) (interface{}, error) {
+			run := src.(RunRecord)
+			if err := checkSortBy(a.str("sortBy")); err != nil {
+				return nil, err
+			}
+			results := run.Results
+			if name := a.str("company"); name != "" {
+				matched, err := queryHistory(e.db, historyQuery{Company: name, Aliases: e.aliases(name), Date: run.Date})
+				if err != nil {
+					return nil, err
+				}
+				if len(matched) == 0 {
+					return []interface{}{}, nil
+				}
+				results = matched[0].Results
+			}
+			kept, err := FilterResults(a.str("filter"), e.watchlist, e.zeroBase, results)
+			if err != nil {
+				return nil, fmt.Errorf("filter: %v", err)
+			}
+			if by := a.str("sortBy"); by != "" {
+				kept = append([]CompanyResult(nil), kept...)
+				SortResults(kept, by, e.zeroBase)
+			}
+			out := make([]interface{}, len(kept))
+			for i, r := range kept {
+				out[i] = gqlResult{run.Date, r}
+			}
+			return out, nil
+		}},
+		"failures": {typ: "[Failure]", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			var out []interface{}
+			for _, f := range src.(RunRecord).Failures {
+				out = append(out, f)
+			}
+			return out, nil
+		}},
+	},
+	"Result": {
+		"date":            {typ: "String", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) { return src.(gqlResult).date, nil }},
+		"company":         gqlResultField("String", func(r CompanyResult) interface{} { return r.Company }),
+		"longName":        gqlResultField("String", func(r CompanyResult) interface{} { return r.LongName }),
+		"sector":          gqlResultField("String", func(r CompanyResult) interface{} { return gqlString(r.Sector) }),
+		"isin":            gqlResultField("String", func(r CompanyResult) interface{} { return gqlString(r.ISIN) }),
+		"marketCap":       gqlResultField("Float", func(r CompanyResult) interface{} { return gqlFloat(r.MarketCap) }),
+		"price":           gqlResultField("Float", func(r CompanyResult) interface{} { return gqlFloat(r.Price) }),
+		"promoterHolding": gqlResultField("Float", func(r CompanyResult) interface{} { return gqlFloat(r.PromoterHolding) }),
+		"pledged":         gqlResultField("Float", func(r CompanyResult) interface{} { return gqlFloat(r.Pledged) }),
+		"quarter": gqlResultField("String", func(r CompanyResult) interface{} {
+			if len(r.Quarters) == 0 {
+				return nil
+			}
+			return gqlString(r.Quarters[0].String())
+		}),
+		"revenue":   gqlResultField("Float", func(r CompanyResult) interface{} { return gqlFloat(valueAt(r.RevenueNums, 0)) }),
+		"netProfit": gqlResultField("Float", func(r CompanyResult) interface{} { return gqlFloat(valueAt(r.NetProfitNums, 0)) }),
+		"revenueGrowth": {typ: "Growth", resolve: func(e *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			rev, _ := latestGrowth(src.(gqlResult).r, e.zeroBase)
+			return rev, nil
+		}},
+		"netProfitGrowth": {typ: "Growth", resolve: func(e *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			_, np := latestGrowth(src.(gqlResult).r, e.zeroBase)
+			return np, nil
+		}},
+		"quarters": gqlResultField("[Quarter]", func(r CompanyResult) interface{} {
+			var out []interface{}
+			for i, q := range r.Quarters {
+				if q.String() != "" {
+					out = append(out, gqlQuarter{r, i})
+				}
+			}
+			return out
+		}),
+		"issues": gqlResultField("[String]", func(r CompanyResult) interface{} {
+			out := []interface{}{}
+			for _, s := range r.Issues {
+				out = append(out, s)
+			}
+			return out
+		}),
+		"announcementUrl": gqlResultField("String", func(r CompanyResult) interface{} { return gqlString(r.AnnouncementURL) }),
+		"pdfUrl":          gqlResultField("String", func(r CompanyResult) interface{} { return gqlString(r.PDFURL) }),
+	},
+	"Quarter": {
+		"label": gqlQuarterField("String", func(q gqlQuarter) interface{} { return q.r.Quarters[q.i].String() }),
+		"end": gqlQuarterField("String", func(q gqlQuarter) interface{} {
+			if qq := q.r.Quarters[q.i]; qq.Known() {
+				return qq.End().Format("2006-01-02")
+			}
+			return nil
+		}),
+		"revenue":   gqlQuarterField("Float", func(q gqlQuarter) interface{} { return gqlFloat(valueAt(q.r.RevenueNums, q.i)) }),
+		"netProfit": gqlQuarterField("Float", func(q gqlQuarter) interface{} { return gqlFloat(valueAt(q.r.NetProfitNums, q.i)) }),
+		"revenueGrowth": {typ: "Growth", resolve: func(e *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			q := src.(gqlQuarter)
+			return quarterGrowth(q.r.Quarters, q.r.RevenueNums, q.i, e.zeroBase), nil
+		}},
+		"netProfitGrowth": {typ: "Growth", resolve: func(e *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			q := src.(gqlQuarter)
+			return quarterGrowth(q.r.Quarters, q.r.NetProfitNums, q.i, e.zeroBase), nil
+		}},
+	},
+	"Growth": {
+		"pct": {typ: "Float", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			return gqlFloat(src.(growth).Pct), nil
+		}},
+		"change": {typ: "Float", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			return gqlFloat(src.(growth).Abs), nil
+		}},
+		"signFlip": {typ: "Boolean", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) { return src.(growth).Swing, nil }},
+		"text":     {typ: "String", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) { return src.(growth).String(), nil }},
+	},
+	"Company": {
+		"name":     {typ: "String", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) { return src.(gqlCompany).name, nil }},
+		"longName": gqlCompanyField("String", func(r gqlResult) interface{} { return r.r.LongName }),
+		"sector":   gqlCompanyField("String", func(r gqlResult) interface{} { return gqlString(r.r.Sector) }),
+		"latest":   gqlCompanyField("Result", func(r gqlResult) interface{} { return r }),
+		"history": {typ: "[Result]", args: map[string]string{"limit": "Int"}, resolve: func(e *gqlExec, src interface{}, a gqlArgs) (interface{}, error) {
+			rs, err := e.companyResults(src.(gqlCompany).name)
+			if err != nil {
+				return nil, err
+			}
+			if n := a.num("limit"); n > 0 && n < len(rs) {
+				rs = rs[:n]
+			}
+			out := make([]interface{}, len(rs))
+			for i, r := range rs {
+				out[i] = r
+			}
+			return out, nil
+		}},
+	},
+	"Failure": {
+		"company": {typ: "String", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) { return src.(Failure).Company, nil }},
+		"longName": {typ: "String", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+			return gqlString(src.(Failure).LongName), nil
+		}},
+		"error": {typ: "String", resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) { return src.(Failure).Error, nil }},
+	},
+}
+
+// gqlResultField, gqlQuarterField and gqlCompanyField make plain fields from a getter
+func gqlResultField(typ string, get func(CompanyResult) interface{}) gqlField {
+	return gqlField{typ: typ, resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+		return get(src.(gqlResult).r), nil
+	}}
+}
+
+func gqlQuarterField(typ string, get func(gqlQuarter) interface{}) gqlField {
+	return gqlField{typ: typ, resolve: func(_ *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+		return get(src.(gqlQuarter)), nil
+	}}
+}
+
+// gqlCompanyField reads the company's latest result
+func gqlCompanyField(typ string, get func(gqlResult) interface{}) gqlField {
+	return gqlField{typ: typ, resolve: func(e *gqlExec, src interface{}, _ gqlArgs) (interface{}, error) {
+		rs, err := e.companyResults(src.(gqlCompany).name)
+		if err != nil || len(rs) == 0 {
+			return nil, err
+		}
+		return get(rs[0]), nil
+	}}
+}
+
+// gqlFloat is v, or null for NaN
+func gqlFloat(v float64) interface{} {
+	if p := nullableFloat(v); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// gqlString is s, or null when empty
+func gqlString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// companyResults returns a company's result in every run, newest first, also under the
+// names it had before a rename; each company is read from the history once per query
+func (e *gqlExec) companyResults(name string) ([]gqlResult, error) {
+	key := strings.ToUpper(strings.TrimSpace(name))
+	if rs, ok := e.companies[key]; ok {
+		return rs, nil
+	}
+	runs, err := queryHistory(e.db, historyQuery{Company: name, Aliases: e.aliases(name)})
+	if err != nil {
+		return nil, err
+	}
+	var out []gqlResult
+	for _, run := range runs {
+		out = append(out, gqlResult{run.Date, run.Results[0]})
+	}
+	if e.companies == nil {
+		e.companies = map[string][]gqlResult{}
+	}
+	e.companies[key] = out
+	return out, nil
+}
+
+// aliases returns the former names of a company (see historyAliases)
+func (e *gqlExec) aliases(name string) []string {
+	key := strings.ToUpper(strings.TrimSpace(name))
+	if a, ok := e.aliasCache[key]; ok {
+		return a
+	}
+	if e.aliasCache == nil {
+		e.aliasCache = map[string][]string{}
+	}
+	e.aliasCache[key] = historyAliases(e.scrips, name)
+	return e.aliasCache[key]
+}
+
+// setCORS lets pages from origin cors call the API from a browser; nothing when empty
+func setCORS(w http.ResponseWriter, cors string) {
+	if cors != "" {
+		w.Header().Set("Access-Control-Allow-Origin", cors)
+		w.Header().Set("Access-Control-Allow-Headers", "content-type, authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+	}
+}
+
+// graphqlHandler serves GraphQL queries over the history database db: GET with query,
+// operationName and variables parameters, or POST with a JSON body or an
+// application/graphql query. cors, when set, is the origin allowed to call it from a browser.
+func graphqlHandler(db *sql.DB, scrips *scripMaster, watchlist []string, zeroBase, cors string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w, cors)
+		var req struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		switch r.Method {
+		case "OPTIONS":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "GET":
+			q := r.URL.Query()
+			req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+			if v := q.Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					gqlFail(w, fmt.Errorf("variables: %v", err))
+					return
+				}
+			}
+		case "POST":
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				gqlFail(w, err)
+				return
+			}
+			if strings.HasPrefix(r.Header.Get("content-type"), "application/graphql") {
+				req.Query = string(body)
+			} else if err := json.Unmarshal(body, &req); err != nil {
+				gqlFail(w, fmt.Errorf("body: %v", err))
+				return
+			}
+		default:
+			http.Error(w, "use GET or POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if req.Query == "" {
+			gqlFail(w, fmt.Errorf("no query; the schema is at /graphql/schema"))
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(runGraphQL(req.Query, req.OperationName, req.Variables, db, scrips, watchlist, zeroBase))
+	}
+}
+
+// gqlFail answers a request that could not be read
+func gqlFail(w http.ResponseWriter, err error) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": []gqlError{{Message: err.Error()}}})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	doc, err := parseGraphQL(`
+		# a comment
+		query Latest($n: Int = 2, $name: String!) @cached {
+			runs(limit: $n) { ...runFields }
+			c: company(name: $name) { name history(limit: 1) { date } }
+			... on Query @include(if: true) { run { date } }
+		}
+		fragment runFields on Run { date companyCount }
+		{ companies(sector: "IT") { name } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.ops) != 2 {
+		t.Fatalf("%d operations, want 2", len(doc.ops))
+	}
+	op := doc.ops[0]
+	if op.kind != "query" || op.name != "Latest" {
+		t.Errorf("operation %s %q", op.kind, op.name)
+	}
+	if want := []gqlVarDef{{"n", "Int", 2}, {"name", "String!", nil}}; !reflect.DeepEqual(op.vars, want) {
+		t.Errorf("variables %+v, want %+v", op.vars, want)
+	}
+	if len(op.sel) != 3 {
+		t.Fatalf("%d selections, want 3", len(op.sel))
+	}
+	if s := op.sel[0]; s.name != "runs" || s.args["limit"] != gqlVar("n") || s.sel[0].spread != "runFields" {
+		t.Errorf("runs selection %+v", s)
+	}
+	if s := op.sel[1]; s.alias != "c" || s.key() != "c" || s.args["name"] != gqlVar("name") || len(s.sel) != 2 {
+		t.Errorf("company selection %+v", s)
+	}
+	if s := op.sel[2]; !s.inline || s.on != "Query" || s.dirs["include"]["if"] != true {
+		t.Errorf("inline fragment %+v", s)
+	}
+	if f := doc.frags["runFields"]; f.on != "Run" || len(f.sel) != 2 {
+		t.Errorf("fragment %+v", f)
+	}
+	if s := doc.ops[1].sel[0]; doc.ops[1].kind != "query" || s.args["sector"] != "IT" {
+		t.Errorf("anonymous operation %+v", doc.ops[1])
+	}
+
+	values, err := parseGraphQL(`{ f(i: -3, f: 1.5e2, s: "a\"b", b: """ block """, e: ENUM, n: null, l: [1 [2]], o: {k: false}) }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"i": -3, "f": 150.0, "s": `a"b`, "b": "block", "e": "ENUM", "n": nil,
+		"l": []interface{}{1, []interface{}{2}}, "o": map[string]interface{}{"k": false},
+	}
+	if got := values.ops[0].sel[0].args; !reflect.DeepEqual(map[string]interface{}(got), want) {
+		t.Errorf("values %#v, want %#v", got, want)
+	}
+
+	deep := strings.Repeat("{ a ", gqlMaxDepth+1) + strings.Repeat("}", gqlMaxDepth+1)
+	errs := []struct{ src, want string }{
+		{``, "no operation"},
+		{`{ runs { date }`, `expected a name, got end of document`},
+		{`{ runs(limit: ) { date } }`, `unexpected ")"`},
+		{`{ runs(limit 1) { date } }`, `expected ":"`},
+		{`{ "runs" }`, `expected a name`},
+		{`{ run(date: "2024) { date } }`, "unterminated string"},
+		{`{ run(date: """2024) { date } }`, "unterminated block string"},
+		{`{ runs ~ }`, "unexpected character '~'"},
+		{`query Q($d) { run(date: $d) { date } }`, `expected ":"`},
+		{`query Q($d: String = $e) { run(date: $d) { date } }`, "variables are not allowed here"},
+		{`fragment F Run { date }`, `expected "on"`},
+		{`subscribe { runs { date } }`, `unexpected "subscribe"`},
+		{deep, "nested deeper than 10 levels"},
+		{`{ run(date: ` + strings.Repeat("[", gqlMaxDepth+1) + `) { date } }`, "nested deeper than 10 levels"},
+		{`query Q($d: ` + strings.Repeat("[", gqlMaxDepth+1) + `String` + strings.Repeat("]", gqlMaxDepth+1) + `) { runs { date } }`, "nested deeper than 10 levels"},
+	}
+	for _, c := range errs {
+		if _, err := parseGraphQL(c.src); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("parseGraphQL(%.40q) = %v, want %q", c.src, err, c.want)
+		}
+	}
+}
+
+func TestRunGraphQL(t *testing.T) {
+	tempAppDir(t)
+	cache, err := cacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := `{"scrips":[{"code":"500209","id":"INFY","name":"Infosys Ltd","former_ids":["INFOSYSTCH"]}]}`
+	if err := os.WriteFile(filepath.Join(cache, "scripmaster.json"), []byte(master), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scrips := loadScripMaster(nil, ScripMasterConfig{})
+	jun := []Quarter{ParseQuarter("Jun 2024"), ParseQuarter("Mar 2024")}
+	tcs := CompanyResult{Company: "TCS", LongName: "Tata Consultancy Services Ltd", Sector: "IT", Quarters: jun, RevenueNums: []float64{110, 100}, NetProfitNums: []float64{12, 10}}
+	infy := CompanyResult{Company: "INFY", Sector: "IT", Quarters: jun, RevenueNums: []float64{90, 100}, NetProfitNums: []float64{-1, 2}}
+	hdfc := CompanyResult{Company: "HDFCBANK", Sector: "Banks", Quarters: jun, RevenueNums: []float64{50, 40}, NetProfitNums: []float64{5, 4}}
+	if err := SaveHistory("2024-07-12", []CompanyResult{tcs}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveHistory("2024-07-18", []CompanyResult{tcs, infy, hdfc}, []Failure{{Company: "WIPRO", Error: "timeout"}}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := openHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cases := []struct {
+		name, query string
+		vars        map[string]interface{}
+		want        string // the response as JSON
+	}{
+		{"runs", `{ runs { date companyCount failures { company error } } }`, nil,
+			`{"data":{"runs":[{"date":"2024-07-18","companyCount":3,"failures":[{"company":"WIPRO","error":"timeout"}]},{"date":"2024-07-12","companyCount":1,"failures":[]}]}}`},
+		{"runs limit variable", `query($n: Int) { runs(limit: $n) { date } }`, map[string]interface{}{"n": 1.0},
+			`{"data":{"runs":[{"date":"2024-07-18"}]}}`},
+		{"latest run", `{ run { date results(filter: "np_growth > 0", sortBy: "company") { company } } }`, nil,
+			`{"data":{"run":{"date":"2024-07-18","results":[{"company":"HDFCBANK"},{"company":"TCS"}]}}}`},
+		{"unknown run", `{ run(date: "2020-01-01") { date } }`, nil, `{"data":{"run":null}}`},
+		{"run results by former name", `{ run { results(company: "infosystch") { company } } }`, nil,
+			`{"data":{"run":{"results":[{"company":"INFY"}]}}}`},
+		{"company by long name", `{ company(name: "tata consultancy services ltd") { name sector history { date } } }`, nil,
+			`{"data":{"company":{"name":"TCS","sector":"IT","history":[{"date":"2024-07-18"},{"date":"2024-07-12"}]}}}`},
+		{"company by former name", `{ company(name: "INFOSYSTCH") { name latest { netProfitGrowth { pct signFlip } } } }`, nil,
+			`{"data":{"company":{"name":"INFY","latest":{"netProfitGrowth":{"pct":null,"signFlip":true}}}}}`},
+		{"unknown company", `{ company(name: "NOPE") { name } }`, nil, `{"data":{"company":null}}`},
+		{"companies by sector", `{ companies(sector: "it") { name } }`, nil,
+			`{"data":{"companies":[{"name":"INFY"},{"name":"TCS"}]}}`},
+		{"fragments, aliases and directives", `
+			query Q($all: Boolean!) { latest: run { ...r } first: runs(limit: 1) @skip(if: $all) { __typename } }
+			fragment r on Run { date ... on Run { companyCount @include(if: $all) } }`, map[string]interface{}{"all": true},
+			`{"data":{"latest":{"date":"2024-07-18","companyCount":3}}}`},
+		{"quarters", `{ company(name: "TCS") { latest { quarters { label end revenue revenueGrowth { pct } } } } }`, nil,
+			`{"data":{"company":{"latest":{"quarters":[{"label":"Jun 2024","end":"2024-06-30","revenue":110,"revenueGrowth":{"pct":10}},{"label":"Mar 2024","end":"2024-03-31","revenue":100,"revenueGrowth":{"pct":null}}]}}}}`},
+		{"resolver error", `{ run { date results(filter: "np_growth >") { company } } }`, nil, ""},
+		{"unknown field", `{ runs { name } }`, nil, `{"errors":[{"message":"cannot query field \"name\" on type Run"}]}`},
+		{"unknown argument", `{ runs(first: 1) { date } }`, nil, `{"errors":[{"message":"unknown argument \"first\" on field Query.runs"}]}`},
+		{"missing argument", `{ company { name } }`, nil, `{"errors":[{"message":"field Query.company needs argument \"name\""}]}`},
+		{"scalar with selection", `{ runs { date { x } } }`, nil, `{"errors":[{"message":"field Run.date is a String and has no fields"}]}`},
+		{"object without selection", `{ runs }`, nil, `{"errors":[{"message":"field Query.runs of type [Run] needs a selection of its fields"}]}`},
+		{"missing variable", `query($name: String!) { company(name: $name) { name } }`, nil,
+			`{"errors":[{"message":"variable $name of type String! is required"}]}`},
+		{"wrong argument type", `{ runs(limit: "2") { date } }`, nil,
+			`{"data":{"runs":null},"errors":[{"message":"argument \"limit\": want an Int","path":["runs"]}]}`},
+		{"unknown fragment", `{ runs { ...nope } }`, nil, `{"errors":[{"message":"unknown fragment \"nope\""}]}`},
+		{"fragment cycle", `{ runs { ...a } } fragment a on Run { ...b } fragment b on Run { ...a }`, nil,
+			`{"errors":[{"message":"fragment \"a\" spreads itself"}]}`},
+		{"fragment on another type", `{ runs { ...c } } fragment c on Company { name }`, nil,
+			`{"errors":[{"message":"fragment \"c\" on Company cannot be spread within Run"}]}`},
+		{"mutation", `mutation { runs { date } }`, nil, `{"errors":[{"message":"only queries are supported, not mutation"}]}`},
+		{"several operations", `query A { runs { date } } query B { run { date } }`, nil,
+			`{"errors":[{"message":"the document has several operations; set operationName"}]}`},
+		{"introspection", `{ __schema { types { name } } }`, nil,
+			`{"errors":[{"message":"introspection is not supported; the schema is served at /graphql/schema"}]}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := runGraphQL(c.query, "", c.vars, db, scrips, nil, zeroBaseNA)
+			b, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.want == "" {
+				if resp["errors"] == nil {
+					t.Errorf("got %s, want an error", b)
+				}
+				return
+			}
+			if string(b) != c.want {
+				t.Errorf("got  %s\nwant %s", b, c.want)
+			}
+		})
+	}
+
+	t.Run("operation name", func(t *testing.T) {
+		resp := runGraphQL(`query A { runs(limit: 1) { date } } query B { run { companyCount } }`, "B", nil, db, scrips, nil, zeroBaseNA)
+		if b, _ := json.Marshal(resp); string(b) != `{"data":{"run":{"companyCount":3}}}` {
+			t.Errorf("got %s", b)
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		// fragments that each spread the next twice expand to 2^12 fields
+		query := `{ runs { ...f0 } } fragment f0 on Run { ...f1 ...f1 }`
+		for i := 1; i < 12; i++ {
+			query += fmt.Sprintf(" fragment f%d on Run { ...f%d ...f%d }", i, i+1, i+1)
+		}
+		query += " fragment f12 on Run { date }"
+		resp := runGraphQL(query, "", nil, db, scrips, nil, zeroBaseNA)
+		if b, _ := json.Marshal(resp); !strings.Contains(string(b), "more than 500 fields") {
+			t.Errorf("fragment fan-out got %s", b)
+		}
+
+		aliases := "{"
+		for i := 0; i <= gqlMaxFields; i++ {
+			aliases += fmt.Sprintf(" a%d: runs { date }", i)
+		}
+		resp = runGraphQL(aliases+" }", "", nil, db, scrips, nil, zeroBaseNA)
+		if b, _ := json.Marshal(resp); !strings.Contains(string(b), "more than 500 fields") {
+			t.Errorf("aliased fields got %s", b)
+		}
+	})
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// grpcService is the path prefix of the methods of the Results service in
+// quarter_compare.proto
+const grpcService = "/quartercompare.v1.Results/"
+
+// gRPC status codes used here
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcPermissionDenied   = 7
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnauthenticated    = 16
+)
+
+// grpcError is a failed call's status
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+// grpcServer serves the Results service of quarter_compare.proto over HTTP/2, with the
+// messages encoded by hand (see the pb* helpers). Each method reads only the runs it
+// answers with from the history database db. events, when set, feeds StreamRun's follow
+// mode with newly stored runs.
+type grpcServer struct {
+	db        *sql.DB
+	watchlist []string
+	zeroBase  string       // the zero_base policy of every growth
+	scrips    *scripMaster // for the former names of a company, loaded once by serve
+	events    *runEvents
+}
+
+func (s *grpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Method != "POST" || !strings.HasPrefix(r.Header.Get("content-type"), "application/grpc") {
+		http.Error(w, "this port serves gRPC (see quarter_compare.proto)", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("content-type", "application/grpc")
+	err := s.call(w, r, strings.TrimPrefix(r.URL.Path, grpcService))
+	code, msg := grpcOK, ""
+	if err != nil {
+		code, msg = grpcInternal, err.Error()
+		if ge, ok := err.(*grpcError); ok {
+			code = ge.code
+		}
+		log.Printf("grpcServer: %s: %v", r.URL.Path, err)
+	}
+	w.Header().Set(http.TrailerPrefix+"grpc-status", fmt.Sprint(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"grpc-message", grpcPercentEncode(msg))
+	}
+}
+
+// call runs one method: it reads the request message and writes the response messages
+func (s *grpcServer) call(w http.ResponseWriter, r *http.Request, method string) error {
+	if !strings.HasPrefix(r.URL.Path, grpcService) {
+		return &grpcError{grpcUnimplemented, "unknown service " + r.URL.Path}
+	}
+	req, err := grpcReadMessage(r)
+	if err != nil {
+		return err
+	}
+	fields, err := pbDecode(req)
+	if err != nil {
+		return &grpcError{grpcInvalidArgument, err.Error()}
+	}
+	switch method {
+	case "ListRuns":
+		runs, err := queryHistory(s.db, historyQuery{Limit: int(fields.varint(1))})
+		if err != nil {
+			return err
+		}
+		var resp []byte
+		for _, run := range runs {
+			resp = pbMessage(resp, 1, pbRunSummary(summarizeRun(run.Date, run.Results, run.Failures, s.zeroBase)))
+		}
+		return grpcWriteMessage(w, resp)
+	case "GetCompany":
+		name := fields.str(1)
+		if name == "" {
+			return &grpcError{grpcInvalidArgument, "name is required"}
+		}
+		matched, err := queryHistory(s.db, historyQuery{Company: name, Aliases: historyAliases(s.scrips, name), Limit: int(fields.varint(2))})
+		if err != nil {
+			return err
+		}
+		if len(matched) == 0 {
+			return &grpcError{grpcNotFound, "no stored results for " + name}
+		}
+		var resp []byte
+		for _, run := range matched {
+			resp = pbMessage(resp, 1, pbCompanyResult(run.Date, run.Results[0], s.zeroBase))
+		}
+		return grpcWriteMessage(w, resp)
+	case "StreamRun":
+		date, filter, follow := fields.str(1), fields.str(2), fields.varint(3) != 0
+		if _, err := ParseExpr(filter); filter != "" && err != nil {
+			return &grpcError{grpcInvalidArgument, "filter: " + err.Error()}
+		}
+		if follow && s.events == nil {
+			return &grpcError{grpcFailedPrecondition, "follow needs live updates (serve -poll > 0)"}
+		}
+		var updates <-chan string
+		if follow {
+			ch, cancel := s.events.subscribe()
+			defer cancel()
+			updates = ch
+		}
+		run, ok, err := storedRun(s.db, date)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &grpcError{grpcNotFound, "no stored results for " + date}
+		}
+		if err := s.streamRun(w, run, filter); err != nil || !follow {
+			return err
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case date := <-updates:
+				run, ok, err := storedRun(s.db, date)
+				if err != nil {
+					return err
+				}
+				if ok {
+					if err := s.streamRun(w, run, filter); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return &grpcError{grpcUnimplemented, "unknown method " + method}
+}
+
+// streamRun sends the results of run matching filter, one message each
+func (s *grpcServer) streamRun(w http.ResponseWriter, run RunRecord, filter string) error {
+	results, err := FilterResults(filter, s.watchlist, s.zeroBase, run.Results)
+	if err != nil {
+		return &grpcError{grpcInvalidArgument, "filter: " + err.Error()}
+	}
+	for _, r := range results {
+		if err := grpcWriteMessage(w, pbCompanyResult(run.Date, r, s.zeroBase)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grpcReadMessage reads the single request message: a compressed flag, a 4-byte length
+// and the message, gzip-compressed when the flag says so
+func grpcReadMessage(r *http.Request) ([]byte, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(r.Body, head[:]); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "reading the request: " + err.Error()}
+	}
+	n := binary.BigEndian.Uint32(head[1:])
+	if n > 1<<20 {
+		return nil, &grpcError{grpcInvalidArgument, "request too large"}
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r.Body, msg); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "reading the request: " + err.Error()}
+	}
+	if head[0] == 0 {
+		return msg, nil
+	}
+	if r.Header.Get("grpc-encoding") != "gzip" {
+		return nil, &grpcError{grpcUnimplemented, "unsupported grpc-encoding " + r.Header.Get("grpc-encoding")}
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(msg))
+	if err != nil {
+		return nil, &grpcError{grpcInvalidArgument, err.Error()}
+	}
+	return io.ReadAll(io.LimitReader(zr, 1<<20))
+}
+
+// grpcWriteMessage sends one uncompressed response message
+func grpcWriteMessage(w http.ResponseWriter, msg []byte) error {
+	head := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+	if _, err := w.Write(append(head, msg...)); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// grpcPercentEncode escapes a grpc-message as the gRPC spec asks
+func grpcPercentEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7E || c == '%' {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// pbRunSummary encodes a RunSummary message
+func pbRunSummary(sum runSummary) []byte {
+	b := pbString(nil, 1, sum.Date)
+	b = pbVarint(b, 2, uint64(sum.Companies))
+	b = pbVarint(b, 3, uint64(sum.Failures))
+	for _, c := range sum.TopNP {
+		b = pbMessage(b, 4, []byte(c))
+	}
+	for _, c := range sum.BottomNP {
+		b = pbMessage(b, 5, []byte(c))
+	}
+	return b
+}
+
+// pbCompanyResult encodes a CompanyResult message, growth under the zero_base policy
+func pbCompanyResult(date string, r CompanyResult, zeroBase string) []byte {
+	b := pbString(nil, 1, date)
+	b = pbString(b, 2, r.Company)
+	b = pbString(b, 3, r.LongName)
+	b = pbString(b, 4, r.Sector)
+	b = pbString(b, 5, r.ISIN)
+	for i, q := range r.Quarters {
+		if q.String() == "" {
+			continue
+		}
+		qb := pbString(nil, 1, q.String())
+		qb = pbDouble(qb, 2, valueAt(r.RevenueNums, i))
+		qb = pbDouble(qb, 3, valueAt(r.NetProfitNums, i))
+		b = pbMessage(b, 6, qb)
+	}
+	b = pbDouble(b, 7, r.MarketCap)
+	b = pbDouble(b, 8, r.Price)
+	b = pbDouble(b, 9, r.PromoterHolding)
+	b = pbDouble(b, 10, r.Pledged)
+	rev, np := latestGrowth(r, zeroBase)
+	b = pbMessage(b, 11, pbGrowth(rev))
+	b = pbMessage(b, 12, pbGrowth(np))
+	for _, s := range r.Issues {
+		b = pbMessage(b, 13, []byte(s))
+	}
+	return b
+}
+
+// pbGrowth encodes a Growth message
+func pbGrowth(g growth) []byte {
+	b := pbDouble(nil, 1, g.Pct)
+	b = pbDouble(b, 2, g.Abs)
+	if g.Swing {
+		b = pbVarint(b, 3, 1)
+	}
+	return pbString(b, 4, g.String())
+}
+
+// pbVarint appends a varint field, left out when 0 as proto3 does
+func pbVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+// pbString appends a string field, left out when empty
+func pbString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return pbMessage(b, field, []byte(s))
+}
+
+// pbDouble appends an optional double field, left out (unset) for NaN
+func pbDouble(b []byte, field int, v float64) []byte {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|1)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+// pbMessage appends a length-delimited field: an embedded message, bytes or a string
+// that is kept even when empty
+func pbMessage(b []byte, field int, m []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(m)))
+	return append(b, m...)
+}
+
+// pbFields are the decoded fields of a message; the last value of a field wins
+type pbFields map[int]interface{}
+
+func (f pbFields) str(field int) string {
+	b, _ := f[field].([]byte)
+	return string(b)
+}
+
+func (f pbFields) varint(field int) uint64 {
+	v, _ := f[field].(uint64)
+	return v
+}
+
+// pbDecode reads the fields of a message: varints as uint64, length-delimited fields as
+// []byte; fixed-size fields are skipped
+func pbDecode(b []byte) (pbFields, error) {
+	fields := pbFields{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("malformed message")
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, fmt.Errorf("malformed varint in field %d", field)
+			}
+			fields[field] = v
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			b = b[size:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			fields[field] = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", key&7, field)
+		}
+	}
+	return fields, nil
+}
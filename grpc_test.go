@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// protoSchema is quarter_compare.proto read as message -> field name -> field number, so
+// the tests below decode by the names a generated client would use
+func protoSchema(t *testing.T) map[string]map[string]int {
+	t.Helper()
+	b, err := os.ReadFile("quarter_compare.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgRe := regexp.MustCompile(`(?s)message (\w+) \{(.*?)\n\}`)
+	fieldRe := regexp.MustCompile(`(?m)^\s*(?:repeated |optional )?\w+ (\w+) = (\d+);`)
+	schema := map[string]map[string]int{}
+	for _, m := range msgRe.FindAllStringSubmatch(string(b), -1) {
+		fields := map[string]int{}
+		for _, f := range fieldRe.FindAllStringSubmatch(m[2], -1) {
+			n := 0
+			for _, c := range f[2] {
+				n = n*10 + int(c-'0')
+			}
+			fields[f[1]] = n
+		}
+		schema[m[1]] = fields
+	}
+	return schema
+}
+
+// pbValue is one decoded field of a message, as a generated decoder would see it
+type pbValue struct {
+	wire  uint64
+	num   uint64 // varint
+	bits  uint64 // fixed64
+	bytes []byte // length-delimited
+}
+
+// pbWalk decodes every field of a message, repeated ones in order, failing on anything
+// a protobuf decoder would reject
+func pbWalk(t *testing.T, b []byte) map[int][]pbValue {
+	t.Helper()
+	out := map[int][]pbValue{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 || key>>3 == 0 {
+			t.Fatalf("bad key at %x", b)
+		}
+		b = b[n:]
+		v := pbValue{wire: key & 7}
+		switch v.wire {
+		case 0:
+			v.num, n = binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("bad varint in field %d", key>>3)
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				t.Fatalf("short fixed64 in field %d", key>>3)
+			}
+			v.bits, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				t.Fatalf("short field %d", key>>3)
+			}
+			v.bytes, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			t.Fatalf("wire type %d in field %d", v.wire, key>>3)
+		}
+		out[int(key>>3)] = append(out[int(key>>3)], v)
+	}
+	return out
+}
+
+// pbMsg gives access to a decoded message by the field names of the .proto
+type pbMsg struct {
+	t      *testing.T
+	fields map[string]int
+	values map[int][]pbValue
+}
+
+func decodeAs(t *testing.T, schema map[string]map[string]int, message string, b []byte) pbMsg {
+	t.Helper()
+	if schema[message] == nil {
+		t.Fatalf("no message %s in quarter_compare.proto", message)
+	}
+	return pbMsg{t, schema[message], pbWalk(t, b)}
+}
+
+func (m pbMsg) all(name string) []pbValue {
+	m.t.Helper()
+	n, ok := m.fields[name]
+	if !ok {
+		m.t.Fatalf("no field %s in quarter_compare.proto", name)
+	}
+	return m.values[n]
+}
+
+func (m pbMsg) str(name string) string {
+	m.t.Helper()
+	vs := m.all(name)
+	if len(vs) == 0 {
+		return ""
+	}
+	return string(vs[len(vs)-1].bytes)
+}
+
+// double is the optional double field, NaN when unset
+func (m pbMsg) double(name string) float64 {
+	m.t.Helper()
+	vs := m.all(name)
+	if len(vs) == 0 {
+		return math.NaN()
+	}
+	if vs[0].wire != 1 {
+		m.t.Fatalf("%s: wire type %d, want 1 (double)", name, vs[0].wire)
+	}
+	return math.Float64frombits(vs[len(vs)-1].bits)
+}
+
+func (m pbMsg) varint(name string) uint64 {
+	m.t.Helper()
+	vs := m.all(name)
+	if len(vs) == 0 {
+		return 0
+	}
+	return vs[len(vs)-1].num
+}
+
+func TestPbCompanyResult(t *testing.T) {
+	schema := protoSchema(t)
+	r := CompanyResult{
+		Company: "TCS", LongName: "Tata Consultancy Services Ltd", Sector: "IT", ISIN: "INE467B01029",
+		Quarters:      []Quarter{ParseQuarter("Jun 2024"), ParseQuarter("Mar 2024"), {}, {}},
+		RevenueNums:   []float64{62613, 61237, math.NaN(), math.NaN()},
+		NetProfitNums: []float64{12105, -250, math.NaN(), math.NaN()},
+		MarketCap:     1.5e6, Price: math.NaN(), PromoterHolding: 71.77, Pledged: 0,
+		Issues: []string{"standalone figures", ""},
+	}
+	msg := decodeAs(t, schema, "CompanyResult", pbCompanyResult("2024-07-12", r, zeroBaseNA))
+	for name, want := range map[string]string{"date": "2024-07-12", "company": "TCS", "long_name": r.LongName, "sector": "IT", "isin": r.ISIN} {
+		if got := msg.str(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := msg.double("market_cap"); got != 1.5e6 {
+		t.Errorf("market_cap = %v", got)
+	}
+	if got := msg.double("price"); !math.IsNaN(got) {
+		t.Errorf("price = %v, want unset for NaN", got)
+	}
+	if got := msg.double("pledged"); got != 0 {
+		t.Errorf("pledged = %v, want a set 0", got)
+	}
+	if issues := msg.all("issues"); len(issues) != 2 || string(issues[0].bytes) != "standalone figures" || len(issues[1].bytes) != 0 {
+		t.Errorf("issues %v, want both, the empty one kept", issues)
+	}
+
+	quarters := msg.all("quarters")
+	if len(quarters) != 2 {
+		t.Fatalf("%d quarters, want the 2 known ones", len(quarters))
+	}
+	q := decodeAs(t, schema, "Quarter", quarters[1].bytes)
+	if q.str("label") != "Mar 2024" || q.double("revenue") != 61237 || q.double("net_profit") != -250 {
+		t.Errorf("second quarter %s %v %v", q.str("label"), q.double("revenue"), q.double("net_profit"))
+	}
+
+	rev := decodeAs(t, schema, "Growth", msg.all("revenue_growth")[0].bytes)
+	if pct := rev.double("pct"); math.Abs(pct-2.247) > 0.001 || rev.double("change") != 1376 || rev.varint("sign_flip") != 0 {
+		t.Errorf("revenue growth pct %v change %v flip %v", pct, rev.double("change"), rev.varint("sign_flip"))
+	}
+	np := decodeAs(t, schema, "Growth", msg.all("net_profit_growth")[0].bytes)
+	if !math.IsNaN(np.double("pct")) || np.double("change") != 12355 || np.varint("sign_flip") != 1 || np.str("text") == "" {
+		t.Errorf("net profit growth pct %v change %v flip %v text %q", np.double("pct"), np.double("change"), np.varint("sign_flip"), np.str("text"))
+	}
+}
+
+// grpcFrames splits a response body into its length-prefixed messages
+func grpcFrames(t *testing.T, body []byte) [][]byte {
+	t.Helper()
+	var frames [][]byte
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("short frame header %x", body)
+		}
+		if body[0] != 0 {
+			t.Fatalf("compressed flag %d on an uncompressed stream", body[0])
+		}
+		n := binary.BigEndian.Uint32(body[1:5])
+		if uint32(len(body)-5) < n {
+			t.Fatalf("frame of %d bytes, %d left", n, len(body)-5)
+		}
+		frames = append(frames, body[5:5+n])
+		body = body[5+n:]
+	}
+	return frames
+}
+
+func TestGRPCServer(t *testing.T) {
+	tempAppDir(t)
+	schema := protoSchema(t)
+	results := []CompanyResult{
+		{Company: "TCS", Quarters: []Quarter{ParseQuarter("Jun 2024")}, RevenueNums: []float64{100}, NetProfitNums: []float64{10}},
+		{Company: "INFY", Quarters: []Quarter{ParseQuarter("Jun 2024")}, RevenueNums: []float64{90}, NetProfitNums: []float64{9}},
+	}
+	if err := SaveHistory("2024-07-12", results[:1], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveHistory("2024-07-18", results, []Failure{{Company: "WIPRO", Error: "timeout"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// INFY was listed as INFOSYSTCH before a rename; GetCompany finds it under both
+	cache, err := cacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := `{"scrips":[{"code":"500209","id":"INFY","name":"Infosys Ltd","former_ids":["INFOSYSTCH"]}]}`
+	if err := os.WriteFile(filepath.Join(cache, "scripmaster.json"), []byte(master), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := openHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	srv := httptest.NewUnstartedServer(&grpcServer{db: db, scrips: loadScripMaster(nil, ScripMasterConfig{})})
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	client := &http.Client{Transport: &http2.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	call := func(method string, req []byte) (*http.Response, [][]byte) {
+		t.Helper()
+		body := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(req)))
+		hr, _ := http.NewRequest("POST", srv.URL+grpcService+method, bytes.NewReader(append(body, req...)))
+		hr.Header.Set("content-type", "application/grpc")
+		hr.Header.Set("te", "trailers")
+		resp, err := client.Do(hr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body) // the trailers arrive after the body
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ProtoMajor != 2 || resp.Header.Get("content-type") != "application/grpc" {
+			t.Fatalf("%s: %s %q", method, resp.Proto, resp.Header.Get("content-type"))
+		}
+		return resp, grpcFrames(t, b)
+	}
+
+	t.Run("ListRuns", func(t *testing.T) {
+		resp, frames := call("ListRuns", nil)
+		if got := resp.Trailer.Get("grpc-status"); got != "0" || len(frames) != 1 {
+			t.Fatalf("grpc-status %q, %d frames", got, len(frames))
+		}
+		runs := decodeAs(t, schema, "ListRunsResponse", frames[0]).all("runs")
+		if len(runs) != 2 {
+			t.Fatalf("%d runs, want 2", len(runs))
+		}
+		latest := decodeAs(t, schema, "RunSummary", runs[0].bytes)
+		if latest.str("date") != "2024-07-18" || latest.varint("companies") != 2 || latest.varint("failures") != 1 {
+			t.Errorf("latest run %s: %d companies, %d failures", latest.str("date"), latest.varint("companies"), latest.varint("failures"))
+		}
+	})
+
+	t.Run("ListRuns limit", func(t *testing.T) {
+		req := pbVarint(nil, schema["ListRunsRequest"]["limit"], 1)
+		_, frames := call("ListRuns", req)
+		if runs := decodeAs(t, schema, "ListRunsResponse", frames[0]).all("runs"); len(runs) != 1 {
+			t.Errorf("%d runs, want 1", len(runs))
+		}
+	})
+
+	t.Run("GetCompany", func(t *testing.T) {
+		resp, frames := call("GetCompany", pbString(nil, schema["GetCompanyRequest"]["name"], "tcs"))
+		if got := resp.Trailer.Get("grpc-status"); got != "0" {
+			t.Fatalf("grpc-status %q", got)
+		}
+		found := decodeAs(t, schema, "GetCompanyResponse", frames[0]).all("results")
+		if len(found) != 2 {
+			t.Fatalf("%d results, want one per run", len(found))
+		}
+		r := decodeAs(t, schema, "CompanyResult", found[0].bytes)
+		if r.str("company") != "TCS" || r.str("date") != "2024-07-18" {
+			t.Errorf("got %s of %s", r.str("company"), r.str("date"))
+		}
+	})
+
+	t.Run("GetCompany former name", func(t *testing.T) {
+		req := pbVarint(pbString(nil, schema["GetCompanyRequest"]["name"], "infosystch"), schema["GetCompanyRequest"]["limit"], 5)
+		_, frames := call("GetCompany", req)
+		if len(frames) != 1 {
+			t.Fatalf("%d messages, want 1", len(frames))
+		}
+		found := decodeAs(t, schema, "GetCompanyResponse", frames[0]).all("results")
+		if len(found) != 1 || decodeAs(t, schema, "CompanyResult", found[0].bytes).str("company") != "INFY" {
+			t.Errorf("%d results, want INFY of 2024-07-18", len(found))
+		}
+	})
+
+	t.Run("StreamRun", func(t *testing.T) {
+		req := pbString(nil, schema["StreamRunRequest"]["date"], "2024-07-18")
+		resp, frames := call("StreamRun", req)
+		if got := resp.Trailer.Get("grpc-status"); got != "0" || len(frames) != 2 {
+			t.Fatalf("grpc-status %q, %d messages, want 2", got, len(frames))
+		}
+		if c := decodeAs(t, schema, "CompanyResult", frames[1]).str("company"); c != "INFY" {
+			t.Errorf("second message is %s", c)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			method string
+			req    []byte
+			status string
+			msg    string
+		}{
+			{"GetCompany", pbString(nil, 1, "WIPRO 100%"), "5", "no stored results for WIPRO 100%25"},
+			{"GetCompany", nil, "3", "name is required"},
+			{"StreamRun", pbString(nil, 2, "np_growth >"), "3", ""},
+			{"StreamRun", pbVarint(nil, 3, 1), "9", "follow needs live updates (serve -poll > 0)"},
+			{"Delete", nil, "12", "unknown method Delete"},
+		}
+		for _, c := range cases {
+			resp, frames := call(c.method, c.req)
+			if len(frames) != 0 {
+				t.Errorf("%s: %d messages on a failed call", c.method, len(frames))
+			}
+			if got := resp.Trailer.Get("grpc-status"); got != c.status {
+				t.Errorf("%s: grpc-status %q, want %s", c.method, got, c.status)
+			}
+			if got := resp.Trailer.Get("grpc-message"); c.msg != "" && got != c.msg || got == "" {
+				t.Errorf("%s: grpc-message %q, want %q", c.method, got, c.msg)
+			}
+		}
+	})
+
+	t.Run("not grpc", func(t *testing.T) {
+		resp, err := srv.Client().Get(srv.URL + grpcService + "ListRuns")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnsupportedMediaType || strings.HasPrefix(resp.Header.Get("content-type"), "application/grpc") {
+			t.Errorf("plain GET got %d %q", resp.StatusCode, resp.Header.Get("content-type"))
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Every response fetched through NewHTTPClient passes guardTransport before anything
+// parses it: a body over the size cap of its host (max_body_mb, max_body_mb_by_host) is
+// refused as soon as its Content-Length says so, or else once the cap is read past, and a
+// body that sniffs as binary (an image, a PDF, an archive) where text was asked for is
+// refused outright. A 50 MB error page or a CAPTCHA image then fails the fetch with a
+// bodyTooLargeError or contentTypeError instead of reaching the regexes and the JSON
+// decoders.
+
+// sniffLen is how much of a body is looked at to tell text from binary
+const sniffLen = 512
+
+// contentTypeError is returned for a response whose body is binary where text was asked for
+type contentTypeError struct {
+	declared string // Content-Type header, empty when missing
+	sniffed  string // what the body looks like
+}
+
+func (e contentTypeError) Error() string {
+	declared := e.declared
+	if declared == "" {
+		declared = "none"
+	}
+	return fmt.Sprintf("binary response (%s, declared %s) where text was expected", e.sniffed, declared)
+}
+
+// bodyLimits are the response size caps in bytes: byHost by host or parent domain, else def
+type bodyLimits struct {
+	def    int64
+	byHost map[string]int64
+}
+
+// forHost is the cap of host: that of the longest matching entry of byHost, else def
+func (l bodyLimits) forHost(host string) int64 {
+	host = strings.ToLower(host)
+	limit, matched := l.def, ""
+	for h, n := range l.byHost {
+		if (host == h || strings.HasSuffix(host, "."+h)) && len(h) > len(matched) {
+			limit, matched = n, h
+		}
+	}
+	return limit
+}
+
+// bodyLimits are the caps of MaxBodyMB and MaxBodyMBByHost
+func (c Config) bodyLimits() bodyLimits {
+	l := bodyLimits{def: c.maxBody(), byHost: map[string]int64{}}
+	if l.def <= 0 {
+		l.def = defaultMaxBodyMB << 20
+	}
+	for h, mb := range c.MaxBodyMBByHost {
+		l.byHost[strings.ToLower(strings.TrimSpace(h))] = int64(mb) << 20
+	}
+	return l
+}
+
+// transport is the RoundTripper of the clients NewHTTPClient makes for cfg
+func (c Config) transport() http.RoundTripper {
+	return guardTransport{base: decodingTransport{base: http.DefaultTransport}, limits: c.bodyLimits()}
+}
+
+// guardTransport caps and sniffs the (decoded) responses of base
+type guardTransport struct {
+	base   http.RoundTripper
+	limits bodyLimits
+}
+
+func (t guardTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || req.Method == http.MethodHead || resp.Body == http.NoBody {
+		return resp, err
+	}
+	limit := t.limits.forHost(req.URL.Hostname())
+	if limit > 0 && resp.ContentLength > limit {
+		resp.Body.Close()
+		return nil, bodyTooLargeError{limit}
+	}
+	body := resp.Body
+	br := bufio.NewReaderSize(&cappedReader{r: body, limit: limit}, sniffLen)
+	head, _ := br.Peek(sniffLen)
+	if sniffed := http.DetectContentType(head); len(head) > 0 && binaryType(sniffed) && !accepts(req, sniffed) {
+		body.Close()
+		return nil, contentTypeError{declared: resp.Header.Get("Content-Type"), sniffed: sniffed}
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, body}
+	return resp, nil
+}
+
+// binaryType reports whether a sniffed media type is something no parser here reads
+func binaryType(ct string) bool {
+	mt, _, _ := mime.ParseMediaType(ct)
+	return !strings.HasPrefix(mt, "text/") && mt != "application/json" && !strings.HasSuffix(mt, "+xml") && mt != "application/xml"
+}
+
+// accepts reports whether req asked for media type ct by name (or its type/*), not just */*
+func accepts(req *http.Request, ct string) bool {
+	mt, _, _ := mime.ParseMediaType(ct)
+	major, _, _ := strings.Cut(mt, "/")
+	for _, a := range strings.Split(req.Header.Get("Accept"), ",") {
+		a, _, _ = strings.Cut(strings.TrimSpace(a), ";")
+		if strings.EqualFold(a, mt) || strings.EqualFold(a, major+"/*") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// The history is a SQLite database, <app dir>/history.db: a row per stored day in runs and
+// a row per company of that day in results, the CompanyResult kept as JSON next to the
+// columns it is looked up by. Versions before it kept a JSON file per day in history/;
+// those are imported the first time the database is opened.
+
+// historySchema creates the history tables
+const historySchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	date      TEXT PRIMARY KEY,     -- 2006-01-02
+	stored_at INTEGER NOT NULL,     -- unix nanoseconds of the last save
+	failures  TEXT NOT NULL         -- []Failure as JSON
+);
+CREATE TABLE IF NOT EXISTS results (
+	date      TEXT NOT NULL,
+	pos       INTEGER NOT NULL,     -- order within the run
+	company   TEXT NOT NULL,
+	long_name TEXT NOT NULL,
+	result    TEXT NOT NULL,        -- CompanyResult as JSON
+	PRIMARY KEY (date, pos)
+);
+CREATE INDEX IF NOT EXISTS results_company ON results (company COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS results_long_name ON results (long_name COLLATE NOCASE);
+`
+
+// RunRecord is one day's results as stored in the history and the published site's data dir
+type RunRecord struct {
+	Date     string          `json:"date"` // 2006-01-02
+	Results  []CompanyResult `json:"results"`
+	Failures []Failure       `json:"failures,omitempty"`
+}
+
+// historyDir returns <app dir>/history, where versions before the database kept their runs
+func historyDir() (string, error) {
+	appDir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appDir, "history"), nil
+}
+
+// openHistory opens <app dir>/history.db, creating its tables and importing the runs of
+// the old history dir when it is new. Several processes (run, watch, serve) may have it
+// open at once; writers wait for each other.
+func openHistory() (*sql.DB, error) {
+	appDir, err := getAppDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(appDir, "history.db")
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := importHistoryDir(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("import history dir: %v", err)
+	}
+	return db, nil
+}
+
+// importHistoryDir stores the runs of the old history dir in an empty database; the
+// files are left where they are
+func importHistoryDir(db *sql.DB) error {
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM runs").Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	dir, err := historyDir()
+	if err != nil {
+		return err
+	}
+	runs, err := loadRunDir(dir)
+	if err != nil || len(runs) == 0 {
+		return err
+	}
+	for _, run := range runs {
+		if err := saveRun(db, run); err != nil {
+			return fmt.Errorf("%s: %v", run.Date, err)
+		}
+	}
+	log.Printf("importHistoryDir: imported %d runs from %s into the history database", len(runs), dir)
+	return nil
+}
+
+// SaveHistory stores the day's results, replacing an earlier run of the same day
+func SaveHistory(date string, results []CompanyResult, failures []Failure) error {
+	db, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return saveRun(db, RunRecord{Date: date, Results: results, Failures: failures})
+}
+
+// saveRun stores run in one transaction, replacing an earlier run of the same day
+func saveRun(db *sql.DB, run RunRecord) error {
+	failures, err := json.Marshal(run.Failures)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM results WHERE date = ?", run.Date); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO runs (date, stored_at, failures) VALUES (?, ?, ?)",
+		run.Date, time.Now().UnixNano(), string(failures)); err != nil {
+		return err
+	}
+	for i, r := range run.Results {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.Company, err)
+		}
+		if _, err := tx.Exec("INSERT INTO results (date, pos, company, long_name, result) VALUES (?, ?, ?, ?, ?)",
+			run.Date, i, r.Company, r.LongName, string(b)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadHistory returns every stored run, newest first
+func LoadHistory() ([]RunRecord, error) {
+	return QueryHistory("", "")
+}
+
+// QueryHistory returns the stored runs on date (if set) with, within them, the results of
+// company (if set, by short or long name, case-insensitively), also under any of its
+// aliases (e.g. the names it had before a rename); newest first, runs with no matching
+// result left out when company is set
+func QueryHistory(company, date string, aliases ...string) ([]RunRecord, error) {
+	db, err := openHistory()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return queryHistory(db, historyQuery{Company: company, Aliases: aliases, Date: date})
+}
+
+// historyQuery selects stored runs and results; the zero value selects everything
+type historyQuery struct {
+	Company string   // results of this company, by short or long name, case-insensitively
+	Aliases []string // other names of Company, e.g. the ones it had before a rename
+	Date    string   // the run of this day (2006-01-02)
+	From    string   // runs of this day or later
+	Before  string   // runs before this day
+	Limit   int      // the newest Limit runs left after the other filters
+}
+
+// where returns the SQL conditions on results rows for q's company and days, and their
+// arguments
+func (q historyQuery) where() ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if q.Date != "" {
+		where, args = append(where, "date = ?"), append(args, q.Date)
+	}
+	if q.From != "" {
+		where, args = append(where, "date >= ?"), append(args, q.From)
+	}
+	if q.Before != "" {
+		where, args = append(where, "date < ?"), append(args, q.Before)
+	}
+	if q.Company != "" {
+		names := append([]string{q.Company}, q.Aliases...)
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+		where = append(where, "(company COLLATE NOCASE IN ("+marks+") OR long_name COLLATE NOCASE IN ("+marks+"))")
+		for range 2 {
+			for _, n := range names {
+				args = append(args, strings.TrimSpace(n))
+			}
+		}
+	}
+	return where, args
+}
+
+// queryHistory returns the runs q selects, newest first, with the results of q.Company in
+// them; runs with no matching result are left out when q.Company is set
+func queryHistory(db *sql.DB, q historyQuery) ([]RunRecord, error) {
+	where, args := q.where()
+	runQuery := "SELECT date, failures FROM runs"
+	switch {
+	case q.Company != "":
+		// only the runs with a result of the company
+		runQuery += " WHERE date IN (SELECT date FROM results WHERE " + strings.Join(where, " AND ") + ")"
+	case len(where) > 0:
+		runQuery += " WHERE " + strings.Join(where, " AND ")
+	}
+	runQuery += " ORDER BY date DESC"
+	runArgs := args
+	if q.Limit > 0 {
+		runQuery, runArgs = runQuery+" LIMIT ?", append(append([]interface{}{}, args...), q.Limit)
+	}
+	rows, err := db.Query(runQuery, runArgs...)
+	if err != nil {
+		return nil, err
+	}
+	var runs []RunRecord
+	byDate := map[string]int{}
+	for rows.Next() {
+		var run RunRecord
+		var failures string
+		if err := rows.Scan(&run.Date, &failures); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(failures), &run.Failures); err != nil {
+			log.Printf("queryHistory: %s: failures: %v", run.Date, err)
+		}
+		byDate[run.Date] = len(runs)
+		runs = append(runs, run)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	if q.Limit > 0 {
+		// runs come newest first, so the last one bounds the results to read
+		where, args = append(where, "date >= ?"), append(args, runs[len(runs)-1].Date)
+	}
+
+	query := "SELECT date, result FROM results"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err = db.Query(query+" ORDER BY date DESC, pos", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d, result string
+		if err := rows.Scan(&d, &result); err != nil {
+			return nil, err
+		}
+		i, ok := byDate[d]
+		if !ok {
+			continue
+		}
+		var r CompanyResult
+		if err := json.Unmarshal([]byte(result), &r); err != nil {
+			log.Printf("queryHistory: %s: skipping a result: %v", d, err)
+			continue
+		}
+		runs[i].Results = append(runs[i].Results, r)
+	}
+	return runs, rows.Err()
+}
+
+// storedRun returns the run stored for date, or the newest run when date is empty
+func storedRun(db *sql.DB, date string) (RunRecord, bool, error) {
+	runs, err := queryHistory(db, historyQuery{Date: date, Limit: 1})
+	if err != nil || len(runs) == 0 {
+		return RunRecord{}, false, err
+	}
+	return runs[0], true, nil
+}
+
+// historyDay is a stored run's day and how many results it has
+type historyDay struct {
+	Date    string
+	Results int
+}
+
+// historyDays lists the stored days, newest first, without reading their results
+func historyDays(db *sql.DB) ([]historyDay, error) {
+	rows, err := db.Query("SELECT runs.date, count(results.pos) FROM runs LEFT JOIN results ON results.date = runs.date GROUP BY runs.date ORDER BY runs.date DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var days []historyDay
+	for rows.Next() {
+		var d historyDay
+		if err := rows.Scan(&d.Date, &d.Results); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// historySectors returns every company in the history with the sector of its latest
+// result, read without decoding the results
+func historySectors(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT company, coalesce(json_extract(result, '$.sector'), '') FROM results ORDER BY date DESC, pos")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sectors := map[string]string{}
+	for rows.Next() {
+		var company, sector string
+		if err := rows.Scan(&company, &sector); err != nil {
+			return nil, err
+		}
+		if _, ok := sectors[company]; !ok { // newest first, so this is the latest result
+			sectors[company] = sector
+		}
+	}
+	return sectors, rows.Err()
+}
+
+// historyAliases returns the other names of company in the scrip master scrips (e.g. the
+// ones it had before a rename), so lookups find its older results too
+func historyAliases(scrips *scripMaster, company string) []string {
+	if company == "" {
+		return nil
+	}
+	s, ok := scrips.find(company)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, n := range s.names() {
+		if n != "" { // an empty one would match every result without a long name
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// historyStoredAt returns when each stored run was last saved, by date
+func historyStoredAt(db *sql.DB) (map[string]int64, error) {
+	rows, err := db.Query("SELECT date, stored_at FROM runs")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := map[string]int64{}
+	for rows.Next() {
+		var date string
+		var at int64
+		if err := rows.Scan(&date, &at); err != nil {
+			return nil, err
+		}
+		stored[date] = at
+	}
+	return stored, rows.Err()
+}
+
+// writeRunFile writes a RunRecord as indented JSON
+func writeRunFile(path string, rec RunRecord) error {
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// loadRunDir reads every *.json RunRecord in dir, newest first
+func loadRunDir(dir string) ([]RunRecord, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []RunRecord
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var run RunRecord
+		if err := json.Unmarshal(b, &run); err != nil {
+			log.Printf("loadRunDir: skipping %s: %v", f, err)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Date > runs[j].Date })
+	return runs, nil
+}
+
+// runHistory implements `quarter-compare history`: query stored runs by company and/or date
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	company := fs.String("company", "", "show every stored result of this company (short or long name, BSE code; also under the names it had before a rename)")
+	date := fs.String("date", "", "show the results stored for this date (2006-01-02)")
+	format := fs.String("format", "table", "output format: table, csv, json, or parquet and arrow (one row per company and quarter; every run without -company/-date)")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	configPath := fs.String("config", "", "path to config.json, for zero_base and -clickhouse (default: <app dir>/config.json)")
+	toClickHouse := fs.Bool("clickhouse", false, "insert the matched runs (every run without -company/-date) into the configured clickhouse table")
+	fs.Parse(args)
+	cfg := mustReadConfig(*configPath)
+
+	matched, err := QueryHistory(*company, *date, historyAliases(loadScripMaster(nil, cfg.ScripMaster), *company)...)
+	if err != nil {
+		log.Fatalf("load history: %v", err)
+	}
+	if *toClickHouse {
+		if cfg.ClickHouse.URL == "" {
+			log.Fatalf("history: clickhouse.url is not set in the config")
+		}
+		client := NewHTTPClient(cfg)
+		n := 0
+		for _, run := range matched {
+			rows := BuildQuarterRows(run.Date, run.Results)
+			if err := InsertClickHouse(client, cfg.ClickHouse, rows); err != nil {
+				log.Fatalf("history: %s: %v", run.Date, err)
+			}
+			n += len(rows)
+		}
+		fmt.Printf("inserted %d quarter rows into clickhouse\n", n)
+		return
+	}
+	dataset := *format == "parquet" || *format == "arrow"
+	if dataset && *out == "" {
+		log.Fatalf("history: -format %s needs -o file", *format)
+	}
+	if *company == "" && *date == "" && !dataset {
+		if len(matched) == 0 {
+			fmt.Println("history is empty; results are stored after each run")
+			return
+		}
+		for _, run := range matched {
+			fmt.Printf("%s  %d companies\n", run.Date, len(run.Results))
+		}
+		return
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "json":
+		if err := writeHistoryJSON(w, matched); err != nil {
+			log.Fatalf("%v", err)
+		}
+	case "csv":
+		if err := writeHistoryCSV(w, matched, cfg.ZeroBase); err != nil {
+			log.Fatalf("%v", err)
+		}
+	case "parquet", "arrow":
+		var rows [][]interface{}
+		for _, run := range matched {
+			for _, row := range BuildQuarterRows(run.Date, run.Results) {
+				rows = append(rows, row.Values())
+			}
+		}
+		write := writeParquet
+		if *format == "arrow" {
+			write = writeArrow
+		}
+		if err := write(w, quarterColumns, rows); err != nil {
+			log.Fatalf("%v", err)
+		}
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "DATE\tCOMPANY\tQUARTER\tREVENUE\tNET PROFIT\tREV %Δ\tNP %Δ")
+		for _, run := range matched {
+			for _, r := range run.Results {
+				rev, np := latestGrowth(r, cfg.ZeroBase)
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", run.Date, r.Company, firstQuarter(r),
+					fmtNum(rev.Curr), fmtNum(np.Curr), rev.String(), np.String())
+			}
+		}
+		tw.Flush()
+	default:
+		log.Fatalf("unknown -format %q (want table, csv, json, parquet or arrow)", *format)
+	}
+}
+
+// writeHistoryJSON writes runs as indented JSON, NaN as null
+func writeHistoryJSON(w io.Writer, runs []RunRecord) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(runs)
+}
+
+// writeHistoryCSV writes one exportHeader row per company of each run, growth under the
+// zero_base policy
+func writeHistoryCSV(w io.Writer, runs []RunRecord, zeroBase string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(exportHeader)
+	for _, run := range runs {
+		for _, row := range BuildExportRows(run.Date, run.Results, zeroBase) {
+			cw.Write(csvValues(row.Values()))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvValues renders ExportRow values as CSV fields (nil -> empty)
+func csvValues(vals []interface{}) []string {
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		switch vv := v.(type) {
+		case nil:
+			out[i] = ""
+		case float64:
+			out[i] = formatFloat(vv)
+		default:
+			out[i] = fmt.Sprint(vv)
+		}
+	}
+	return out
+}
+
+// fmtNum formats a number for text output, "-" for NaN
+func fmtNum(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return formatFloat(v)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// tempAppDir points the app dir (~/Documents/quarter-compare) at a fresh temp dir
+func tempAppDir(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	dir, err := getAppDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestHistoryStore(t *testing.T) {
+	appDir := tempAppDir(t)
+
+	// a run left by a version without the database is imported on first use
+	legacy := RunRecord{Date: "2024-08-09", Results: []CompanyResult{{Company: "INFY", LongName: "Infosys Ltd", RevenueNums: []float64{1, math.NaN()}}}}
+	if err := os.MkdirAll(filepath.Join(appDir, "history"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeRunFile(filepath.Join(appDir, "history", "2024-08-09.json"), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := []Failure{{Company: "BROKEN", Error: "timeout"}}
+	if err := SaveHistory("2024-08-10", []CompanyResult{{Company: "OLD"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// a second run of the day replaces the first
+	if err := SaveHistory("2024-08-10", []CompanyResult{{Company: "TCS", LongName: "Tata Consultancy Services Ltd"}, {Company: "INFY"}}, failures); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dates []string
+	for _, run := range runs {
+		dates = append(dates, run.Date)
+	}
+	if want := []string{"2024-08-10", "2024-08-09"}; !reflect.DeepEqual(dates, want) {
+		t.Fatalf("runs %v, want %v", dates, want)
+	}
+	if got := companies(runs[0]); !reflect.DeepEqual(got, []string{"TCS", "INFY"}) {
+		t.Errorf("2024-08-10 has %v, want the second run's TCS, INFY in order", got)
+	}
+	if !reflect.DeepEqual(runs[0].Failures, failures) {
+		t.Errorf("failures %+v, want %+v", runs[0].Failures, failures)
+	}
+	if nums := runs[1].Results[0].RevenueNums; len(nums) != 2 || !math.IsNaN(nums[1]) {
+		t.Errorf("imported revenue %v, want [1 NaN]", nums)
+	}
+
+	cases := []struct {
+		name          string
+		company, date string
+		aliases       []string
+		want          map[string][]string // companies by date
+	}{
+		{"date", "", "2024-08-10", nil, map[string][]string{"2024-08-10": {"TCS", "INFY"}}},
+		{"company", "infy", "", nil, map[string][]string{"2024-08-10": {"INFY"}, "2024-08-09": {"INFY"}}},
+		{"long name", "tata consultancy services ltd", "", nil, map[string][]string{"2024-08-10": {"TCS"}}},
+		{"company on a date", "INFY", "2024-08-09", nil, map[string][]string{"2024-08-09": {"INFY"}}},
+		{"alias", "INFOSYS", "", []string{"INFY"}, map[string][]string{"2024-08-10": {"INFY"}, "2024-08-09": {"INFY"}}},
+		{"unknown company", "WIPRO", "", nil, map[string][]string{}},
+		{"unknown date", "", "2020-01-01", nil, map[string][]string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			runs, err := QueryHistory(c.company, c.date, c.aliases...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string][]string{}
+			for _, run := range runs {
+				got[run.Date] = companies(run)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	db, err := openHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	queries := []struct {
+		name string
+		q    historyQuery
+		want []string // dates
+	}{
+		{"latest", historyQuery{Limit: 1}, []string{"2024-08-10"}},
+		{"latest with the company", historyQuery{Company: "INFOSYS LTD", Limit: 1}, []string{"2024-08-09"}},
+		{"before", historyQuery{Before: "2024-08-10"}, []string{"2024-08-09"}},
+		{"from", historyQuery{From: "2024-08-10"}, []string{"2024-08-10"}},
+		{"limit past the end", historyQuery{Company: "INFY", Limit: 5}, []string{"2024-08-10", "2024-08-09"}},
+	}
+	for _, c := range queries {
+		t.Run(c.name, func(t *testing.T) {
+			runs, err := queryHistory(db, c.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, run := range runs {
+				got = append(got, run.Date)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+	if run, ok, err := storedRun(db, ""); err != nil || !ok || !reflect.DeepEqual(companies(run), []string{"TCS", "INFY"}) {
+		t.Errorf("storedRun = %v, %v, %v; want the 2024-08-10 run with TCS, INFY", companies(run), ok, err)
+	}
+
+	days, err := historyDays(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []historyDay{{"2024-08-10", 2}, {"2024-08-09", 1}}; !reflect.DeepEqual(days, want) {
+		t.Errorf("days %v, want %v", days, want)
+	}
+
+	stored, err := historyStoredAt(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 || stored["2024-08-10"] == 0 {
+		t.Errorf("stored at %v, want both days", stored)
+	}
+}
+
+// companies lists the companies of run in order
+func companies(run RunRecord) []string {
+	var out []string
+	for _, r := range run.Results {
+		out = append(out, r.Company)
+	}
+	return out
+}
+
+func TestWithHistory(t *testing.T) {
+	tempAppDir(t)
+	for _, date := range []string{"2022-06-01", "2023-01-10", "2024-07-01", "2024-08-10", "2024-08-11"} {
+		if err := SaveHistory(date, []CompanyResult{{Company: "TCS"}}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := openHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the runs before the day, back as far as the seasons the cohort section shows
+	opts := ReportOptions{}.withHistory(db, "2024-08-10")
+	var got []string
+	for _, run := range opts.History {
+		got = append(got, run.Date)
+	}
+	if want := []string{"2024-07-01", "2023-01-10"}; opts.Date != "2024-08-10" || !reflect.DeepEqual(got, want) {
+		t.Errorf("withHistory: date %q, runs %v; want 2024-08-10, %v", opts.Date, got, want)
+	}
+	if opts := (ReportOptions{}).withHistory(nil, "2024-08-10"); opts.Date != "2024-08-10" || opts.History != nil {
+		t.Errorf("withHistory without a database: %+v", opts)
+	}
+}
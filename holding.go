@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// since carries the promoter holding history over from prev, the metadata it replaces:
+// when the shareholding moved, prev's figures become the previous ones, else prev's
+// previous figures are kept. Pages are refreshed weekly, so a new quarterly
+// shareholding pattern shows up as a change within a week of its filing.
+func (m companyMeta) since(prev companyMeta) companyMeta {
+	m.PrevPromoterHolding, m.PrevPledged = prev.PrevPromoterHolding, prev.PrevPledged
+	moved := func(a, b *float64) bool { return a != nil && b != nil && *a != *b }
+	if moved(m.PromoterHolding, prev.PromoterHolding) || moved(m.Pledged, prev.Pledged) {
+		m.PrevPromoterHolding, m.PrevPledged = prev.PromoterHolding, prev.Pledged
+	}
+	return m
+}
+
+// change is curr minus prev in percentage points, NaN when either is unknown
+func change(curr float64, prev *float64) float64 {
+	if prev == nil {
+		return math.NaN()
+	}
+	return curr - *prev
+}
+
+// pledgeRising reports whether the promoters pledged a larger share than before
+func pledgeRising(r CompanyResult) bool {
+	return r.PledgeChange > 0
+}
+
+// hasHolding reports whether any result has promoter holding or pledge figures
+func hasHolding(results []CompanyResult) bool {
+	for _, r := range results {
+		if !math.IsNaN(r.PromoterHolding) || !math.IsNaN(r.Pledged) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatHolding formats a holding percentage with its change, e.g. "52.3% (−1.2)"
+func formatHolding(v, delta float64) string {
+	if math.IsNaN(v) {
+		return "–"
+	}
+	if math.IsNaN(delta) || delta == 0 {
+		return fmt.Sprintf("%.2f%%", v)
+	}
+	return fmt.Sprintf("%.2f%% (%+.2f)", v, delta)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// RunHooks runs every configured hook once per result with the CompanyResult as JSON on stdin
+// and QC_DATE, QC_COMPANY in the environment. Hook failures are logged, never fatal.
+func RunHooks(hooks []HookConfig, watchlist []string, date string, results []CompanyResult) {
+	for _, h := range hooks {
+		if strings.TrimSpace(h.Command) == "" {
+			continue
+		}
+		timeout := time.Duration(h.TimeoutSec) * time.Second
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		for _, r := range results {
+			if h.WatchlistOnly && !inWatchlist(watchlist, r.Company) {
+				continue
+			}
+			if err := runHook(h.Command, timeout, date, r); err != nil {
+				log.Printf("RunHooks: %q for %s: %v", h.Command, r.Company, err)
+			}
+		}
+	}
+}
+
+// runHook runs one hook command for one result
+func runHook(command string, timeout time.Duration, date string, r CompanyResult) error {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), "QC_DATE="+isoDate(date), "QC_COMPANY="+r.Company)
+	cmd.Stdin = bytes.NewReader(payload)
+	out, err := cmd.CombinedOutput()
+	if s := strings.TrimSpace(string(out)); s != "" {
+		log.Printf("hook %s: %s", r.Company, s)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+// shellCommand runs command through the platform shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runUpcoming implements `quarter-compare upcoming`: list upcoming BSE result meetings
+// (watchlist companies only when a watchlist is configured) and write them as an .ics file.
+func runUpcoming(args []string) {
+	fs := flag.NewFlagSet("upcoming", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	icsPath := fs.String("ics", "", "calendar file to write (default: <app dir>/upcoming.ics)")
+	calendarPath := fs.String("calendar", "", "result-day calendar page to write (default: <app dir>/result-calendar.html)")
+	all := fs.Bool("all", false, "include every company, not just the watchlist")
+	fs.Parse(args)
+	cfg := mustLoadConfig(*configPath)
+
+	if *icsPath == "" || *calendarPath == "" {
+		dir, err := getAppDir()
+		if err != nil {
+			log.Fatalf("cannot determine app dir: %v", err)
+		}
+		if *icsPath == "" {
+			*icsPath = filepath.Join(dir, "upcoming.ics")
+		}
+		if *calendarPath == "" {
+			*calendarPath = filepath.Join(dir, "result-calendar.html")
+		}
+	}
+
+	client := NewHTTPClient(cfg)
+	items, err := FetchBSEMeetings(client, cfg.BSEEndpoints)
+	if err != nil {
+		log.Fatalf("fetch bse list: %v", err)
+	}
+	upcoming := UpcomingMeetings(filterPurpose(items, cfg.Purposes), time.Now(), cfg.Watchlist, *all)
+	if len(upcoming) == 0 {
+		fmt.Println("no upcoming meetings found")
+	}
+	for _, m := range upcoming {
+		fmt.Printf("%s  %-12s %s\n", m.MeetingDate, m.ShortName, m.LongName)
+	}
+	if err := os.WriteFile(*icsPath, []byte(BuildICS(upcoming)), 0644); err != nil {
+		log.Fatalf("write calendar: %v", err)
+	}
+	fmt.Println("calendar saved to", *icsPath)
+
+	// the result-day calendar counts every company, whatever the watchlist: it is about
+	// how heavy each evening is
+	now := time.Now()
+	page := RenderResultCalendar(UpcomingMeetings(filterPurpose(items, cfg.Purposes), now, cfg.Watchlist, true), cfg.Watchlist, now)
+	if err := os.WriteFile(*calendarPath, []byte(page), 0644); err != nil {
+		log.Fatalf("write result calendar: %v", err)
+	}
+	fmt.Println("result-day calendar saved to", *calendarPath)
+}
+
+// UpcomingMeetings returns items meeting on or after from's date, sorted by date.
+// When watchlist is non-empty and all is false only watchlist companies are kept.
+func UpcomingMeetings(items []BSEItem, from time.Time, watchlist []string, all bool) []BSEItem {
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	var out []BSEItem
+	for _, it := range items {
+		t, err := time.ParseInLocation("02 Jan 2006", it.MeetingDate, time.Local)
+		if err != nil || t.Before(day) {
+			continue
+		}
+		if !all && len(watchlist) > 0 && !inWatchlist(watchlist, it.ShortName, it.ScripCode) {
+			continue
+		}
+		out = append(out, it)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		ti, _ := time.Parse("02 Jan 2006", out[i].MeetingDate)
+		tj, _ := time.Parse("02 Jan 2006", out[j].MeetingDate)
+		return ti.Before(tj)
+	})
+	return out
+}
+
+// BuildICS renders meetings as all-day events of an RFC 5545 calendar
+func BuildICS(items []BSEItem) string {
+	var sb strings.Builder
+	line := func(s string) {
+		sb.WriteString(foldICSLine(s))
+		sb.WriteString("\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//quarter-compare//upcoming results//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:Upcoming results")
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, it := range items {
+		t, err := time.Parse("02 Jan 2006", it.MeetingDate)
+		if err != nil {
+			continue
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + icsEscape(it.ScripCode+"-"+t.Format("20060102")) + "@quarter-compare")
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + t.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + t.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + icsEscape(it.ShortName+" results (board meeting)"))
+		line("DESCRIPTION:" + icsEscape(it.LongName+" — BSE "+it.ScripCode))
+		if it.URL != "" {
+			line("URL:" + it.URL)
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return sb.String()
+}
+
+// icsEscape escapes TEXT values per RFC 5545 section 3.3.11
+func icsEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// foldICSLine folds content lines longer than 75 octets, without splitting UTF-8 sequences
+func foldICSLine(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > 75 {
+			// continuation lines start with a space, which counts towards the limit
+			sb.WriteString("\r\n ")
+			n = 1
+		}
+		sb.WriteRune(r)
+		n += size
+	}
+	return sb.String()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// KafkaConfig produces one event per result to a Kafka topic through a Kafka REST Proxy
+// (Confluent REST Proxy v2 API, also served by Redpanda's HTTP proxy for JSON), keyed by
+// company. Avro values are registered with the proxy's schema registry under kafkaAvroSchema.
+type KafkaConfig struct {
+	RestURL  string `json:"rest_url"` // e.g. http://kafka-rest:8082
+	Topic    string `json:"topic"`
+	Format   string `json:"format"` // "json" (default) or "avro"
+	Username string `json:"username"`
+	Password string `json:"password" secret:"true"`
+}
+
+// kafkaAvroSchema is the Avro value schema: the export columns, numbers nullable
+const kafkaAvroSchema = `{"type":"record","name":"QuarterResult","namespace":"quarter_compare","fields":[` +
+	`{"name":"date","type":"string"},{"name":"company","type":"string"},{"name":"long_name","type":"string"},` +
+	`{"name":"sector","type":"string"},{"name":"quarter","type":"string"},` +
+	`{"name":"revenue","type":["null","double"],"default":null},{"name":"net_profit","type":["null","double"],"default":null},` +
+	`{"name":"rev_pct","type":["null","double"],"default":null},{"name":"np_pct","type":["null","double"],"default":null},` +
+	`{"name":"market_cap","type":["null","double"],"default":null}]}`
+
+// kafkaAvroKeySchema is the Avro key schema: the company
+const kafkaAvroKeySchema = `"string"`
+
+// ProduceKafka sends rows as events of cfg.Topic in one request. The value is the export
+// row with the exportHeader field names, in JSON or Avro.
+func ProduceKafka(client *http.Client, cfg KafkaConfig, rows []ExportRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	avro := false
+	switch cfg.Format {
+	case "", "json":
+	case "avro":
+		avro = true
+	default:
+		return fmt.Errorf("kafka: unknown format %q (want json or avro)", cfg.Format)
+	}
+	records := make([]map[string]interface{}, 0, len(rows))
+	for _, r := range rows {
+		value := map[string]interface{}{}
+		for i, v := range r.Values() {
+			if _, num := v.(float64); avro && num {
+				v = map[string]interface{}{"double": v} // Avro JSON encoding of a union branch
+			}
+			value[exportHeader[i]] = v
+		}
+		records = append(records, map[string]interface{}{"key": r.Company, "value": value})
+	}
+	payload := map[string]interface{}{"records": records}
+	contentType := "application/vnd.kafka.json.v2+json"
+	if avro {
+		payload["key_schema"] = kafkaAvroKeySchema
+		payload["value_schema"] = kafkaAvroSchema
+		contentType = "application/vnd.kafka.avro.v2+json"
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("kafka: %v", err)
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(cfg.RestURL, "/")+"/topics/"+url.PathEscape(cfg.Topic), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("kafka: %v", err)
+	}
+	req.Header.Set("content-type", contentType)
+	req.Header.Set("accept", "application/vnd.kafka.v2+json")
+	if cfg.Username != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kafka: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("kafka: status=%d body=%q", resp.StatusCode, b[:min(len(b), 512)])
+	}
+	// the proxy answers 200 even when single records fail; each offset carries its error
+	var res struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	if json.Unmarshal(b, &res) == nil {
+		failed, first := 0, ""
+		for _, o := range res.Offsets {
+			if o.Error != "" {
+				if failed == 0 {
+					first = o.Error
+				}
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("kafka: %d of %d records failed: %s", failed, len(rows), first)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// With a Kite Connect API key and access token in the config, the companies held in (or
+// traded through) a Zerodha account join the watchlist on their own. The import is cached
+// and refreshed every kite.refresh; Kite access tokens expire every morning, so when the
+// API refuses, the last import is used until the token is renewed.
+
+// kiteURL is the Kite Connect API
+const kiteURL = "https://api.kite.trade"
+
+// defaultKiteRefresh is how often the holdings are imported again
+const defaultKiteRefresh = 12 * time.Hour
+
+// kiteInstrument is a stock of the account as the API lists it
+type kiteInstrument struct {
+	TradingSymbol string `json:"tradingsymbol"`
+	Exchange      string `json:"exchange"` // NSE or BSE
+	ISIN          string `json:"isin"`     // holdings only
+}
+
+// FetchKite lists the instruments of cfg.Import: the demat holdings, the day's and
+// overnight positions, or both. Kite Connect has no endpoint for the marketwatch lists of
+// the Kite app, so those cannot be imported.
+func FetchKite(client *http.Client, cfg KiteConfig, maxBody int64) ([]kiteInstrument, error) {
+	get := func(path string, data interface{}) error {
+		req, _ := http.NewRequest("GET", strings.TrimRight(cfg.url(), "/")+path, nil)
+		req.Header.Set("x-kite-version", "3")
+		req.Header.Set("authorization", "token "+cfg.APIKey+":"+cfg.AccessToken)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Status    string          `json:"status"`
+			Message   string          `json:"message"`
+			ErrorType string          `json:"error_type"`
+			Data      json.RawMessage `json:"data"`
+		}
+		if err := json.NewDecoder(&cappedReader{r: resp.Body, limit: maxBody}).Decode(&body); err != nil {
+			return fmt.Errorf("%s: status %d: invalid JSON: %v", path, resp.StatusCode, err)
+		}
+		if resp.StatusCode != http.StatusOK || body.Status != "success" {
+			if body.ErrorType == "TokenException" {
+				return fmt.Errorf("%s: %s (the access token expires daily; log in again and update kite.access_token)", path, body.Message)
+			}
+			return fmt.Errorf("%s: status %d: %s %s", path, resp.StatusCode, body.ErrorType, body.Message)
+		}
+		return json.Unmarshal(body.Data, data)
+	}
+
+	var out []kiteInstrument
+	if cfg.Import != "positions" {
+		var holdings []kiteInstrument
+		if err := get("/portfolio/holdings", &holdings); err != nil {
+			return nil, err
+		}
+		out = append(out, holdings...)
+	}
+	if cfg.Import == "positions" || cfg.Import == "both" {
+		var positions struct {
+			Net []kiteInstrument `json:"net"`
+		}
+		if err := get("/portfolio/positions", &positions); err != nil {
+			return nil, err
+		}
+		for _, p := range positions.Net {
+			// derivatives and other segments have no results of their own
+			if p.Exchange == "NSE" || p.Exchange == "BSE" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+// kiteWatchlistNames turns instruments into watchlist entries: the BSE short name of the
+// company from the scrip master (by ISIN, else by symbol), else the trading symbol
+func kiteWatchlistNames(instruments []kiteInstrument, scrips *scripMaster) []string {
+	var out []string
+	for _, in := range instruments {
+		name := strings.TrimSuffix(strings.TrimSuffix(in.TradingSymbol, "-BE"), "-EQ")
+		if s, ok := scrips.byISIN(in.ISIN); ok && s.ID != "" {
+			name = s.ID
+		} else if s, ok := scrips.find(name); ok && s.ID != "" {
+			name = s.ID
+		}
+		if name != "" && !containsFold(out, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// byISIN returns the scrip with the ISIN
+func (m *scripMaster) byISIN(isin string) (Scrip, bool) {
+	if m == nil || isin == "" {
+		return Scrip{}, false
+	}
+	for _, s := range m.Scrips {
+		if strings.EqualFold(s.ISIN, isin) {
+			return s, true
+		}
+	}
+	return Scrip{}, false
+}
+
+// kiteCache is <cache dir>/kite.json, the last import
+type kiteCache struct {
+	path      string
+	FetchedAt time.Time `json:"fetched_at"`
+	Watchlist []string  `json:"watchlist"`
+}
+
+// save writes the cache
+func (c kiteCache) save() error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, b, 0644)
+}
+
+// loadKiteWatchlist returns the imported watchlist: the cached import, fetched again when
+// client is not nil and it is older than cfg.Refresh. A failed import is logged and the
+// cached one used.
+func loadKiteWatchlist(client *http.Client, cfg KiteConfig, maxBody int64, scrips *scripMaster) []string {
+	dir, err := cacheDir()
+	if err != nil {
+		log.Printf("loadKiteWatchlist: %v", err)
+		return nil
+	}
+	c := kiteCache{path: filepath.Join(dir, "kite.json")}
+	b, err := os.ReadFile(c.path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &c); err != nil {
+			log.Printf("loadKiteWatchlist: ignoring %s: %v", c.path, err)
+			c.FetchedAt, c.Watchlist = time.Time{}, nil
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("loadKiteWatchlist: %v", err)
+	}
+	if client == nil || time.Since(c.FetchedAt) < cfg.refresh() {
+		return c.Watchlist
+	}
+	instruments, err := FetchKite(client, cfg, maxBody)
+	if err != nil {
+		log.Printf("loadKiteWatchlist: kite: %v; using the import of %s", err, c.FetchedAt.Format("2006-01-02 15:04"))
+		return c.Watchlist
+	}
+	c.FetchedAt, c.Watchlist = time.Now(), kiteWatchlistNames(instruments, scrips)
+	if err := c.save(); err != nil {
+		log.Printf("loadKiteWatchlist: %v", err)
+	}
+	return c.Watchlist
+}
+
+// withKiteWatchlist adds the companies imported from Kite to cfg.Watchlist
+func (cfg Config) withKiteWatchlist(client *http.Client) Config {
+	if !cfg.Kite.enabled() {
+		return cfg
+	}
+	watchlist := append([]string(nil), cfg.Watchlist...)
+	for _, name := range loadKiteWatchlist(client, cfg.Kite, cfg.maxBody(), loadScripMaster(nil, cfg.ScripMaster)) {
+		if !inWatchlist(watchlist, name) {
+			watchlist = append(watchlist, name)
+		}
+	}
+	cfg.Watchlist = watchlist
+	return cfg
+}
+
+// runKite implements `quarter-compare kite`: import the watchlist from Kite now, e.g.
+// right after renewing the access token, and print it
+func runKite(args []string) {
+	fs := flag.NewFlagSet("kite", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	fs.Parse(args)
+	cfg := mustReadConfig(*configPath)
+	if !cfg.Kite.enabled() {
+		log.Fatalf("kite: set kite.api_key and kite.access_token in the config")
+	}
+	client := NewHTTPClient(cfg)
+	instruments, err := FetchKite(client, cfg.Kite, cfg.maxBody())
+	if err != nil {
+		log.Fatalf("kite: %v", err)
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		log.Fatalf("kite: %v", err)
+	}
+	c := kiteCache{path: filepath.Join(dir, "kite.json"), FetchedAt: time.Now(), Watchlist: kiteWatchlistNames(instruments, loadScripMaster(client, cfg.ScripMaster))}
+	if err := c.save(); err != nil {
+		log.Fatalf("kite: %v", err)
+	}
+	fmt.Printf("imported %d companies from kite:\n", len(c.Watchlist))
+	for _, n := range c.Watchlist {
+		fmt.Println("  " + n)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// liveKeepAlive is how often an idle event stream gets a comment line, so proxies
+// don't close it
+const liveKeepAlive = 30 * time.Second
+
+// runEvents fans the dates of newly stored runs out to the open report pages, as
+// Server-Sent Events ("event: run", the date as data) on /events
+type runEvents struct {
+	mu   sync.Mutex
+	subs map[chan string]bool
+}
+
+func newRunEvents() *runEvents {
+	return &runEvents{subs: map[chan string]bool{}}
+}
+
+// publish sends date to every subscriber; one that is still busy with an earlier event
+// misses it, which only delays its refresh to the next one
+func (e *runEvents) publish(date string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		select {
+		case ch <- date:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel receiving the published dates until cancel is called
+func (e *runEvents) subscribe() (<-chan string, func()) {
+	ch := make(chan string, 1)
+	e.mu.Lock()
+	e.subs[ch] = true
+	e.mu.Unlock()
+	return ch, func() {
+		e.mu.Lock()
+		delete(e.subs, ch)
+		e.mu.Unlock()
+	}
+}
+
+func (e *runEvents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch, cancel := e.subscribe()
+	defer cancel()
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+	ping := time.NewTicker(liveKeepAlive)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case date := <-ch:
+			fmt.Fprintf(w, "event: run\ndata: %s\n\n", date)
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// watchHistory polls the history every interval and publishes the date of every run
+// stored since the previous poll, by `run` or `watch` in another process or a backfill.
+// It never returns.
+func watchHistory(db *sql.DB, events *runEvents, interval time.Duration) {
+	seen, err := historyStoredAt(db)
+	if err != nil {
+		log.Printf("watchHistory: %v", err)
+	}
+	for range time.Tick(interval) {
+		now, err := historyStoredAt(db)
+		if err != nil {
+			log.Printf("watchHistory: %v", err)
+			continue
+		}
+		for date, at := range now {
+			if at != seen[date] {
+				log.Printf("watchHistory: %s stored, updating open reports", date)
+				events.publish(date)
+			}
+		}
+		seen = now
+	}
+}
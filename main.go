@@ -1,154 +1,306 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 )
 
-// getOutputReportPath returns a dynamic path for report.html based on the user's system.
-// Preferred location: $HOME/Documents/quarter-compare/report.html
-// Fallbacks: executable directory, current working directory.
+// errNoMeetings is returned by collectResults when BSE lists no meetings for the date
+var errNoMeetings = errors.New("no meetings for date")
+
+// getOutputReportPath returns a dynamic path for report.html based on the user's system
+// (see getAppDir for the preferred location and fallbacks).
 func getOutputReportPath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err == nil && home != "" {
-		dir := filepath.Join(home, "Documents", "quarter-compare")
-		if err := os.MkdirAll(dir, 0o755); err != nil {
-			return "", err
-		}
-		return filepath.Join(dir, "report.html"), nil
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "report.html"), nil
+}
+
+// configFilePath returns path, else $QC_CONFIG, else <app dir>/config.json
+func configFilePath(path string) (string, error) {
+	if path == "" {
+		path = os.Getenv("QC_CONFIG")
 	}
-	// fallback: executable directory
-	if exe, err2 := os.Executable(); err2 == nil {
-		dir := filepath.Dir(exe)
-		if err := os.MkdirAll(dir, 0o755); err == nil {
-			return filepath.Join(dir, "report.html"), nil
+	if path == "" {
+		dir, err := getAppDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine app dir: %v", err)
 		}
+		path = filepath.Join(dir, "config.json")
 	}
-	// final fallback: current working directory
-	if wd, err3 := os.Getwd(); err3 == nil {
-		return filepath.Join(wd, "report.html"), nil
+	return path, nil
+}
+
+// mustLoadConfig loads the config at path (else $QC_CONFIG, else the default location), exiting
+// on error, with the companies imported from Kite added to the watchlist
+func mustLoadConfig(path string) Config {
+	cfg := mustReadConfig(path)
+	return cfg.withKiteWatchlist(NewHTTPClient(cfg))
+}
+
+// mustReadConfig is mustLoadConfig without the Kite import
+func mustReadConfig(path string) Config {
+	path, err := configFilePath(path)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		log.Fatalf("load config: %v", err)
 	}
-	return "report.html", nil
+	return cfg
 }
 
 func main() {
 	// enable more verbose logging (timestamp + file:line)
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	// create HTTP client with cookie jar
-	client := NewHTTPClient()
+	dispatch(os.Args[1:])
+}
+
+// collectResults fetches the BSE meeting list, keeps the given date ("02 Jan 2006")
+// and collects financials for each company concurrently. Companies that fail are returned
+// as failures for the report rather than dropped, and every listed company gets a
+// decision (see screenItems), also with errNoMeetings.
+func collectResults(client *http.Client, cfg Config, date string) ([]CompanyResult, []Failure, []Decision, error) {
+	if err := TrendlyneLogin(client, cfg.Trendlyne); err != nil {
+		log.Printf("collectResults: trendlyne login failed, continuing anonymously: %v", err)
+	}
 
 	// 1. fetch BSE list
-	bseURL := "https://api.bseindia.com/BseIndiaAPI/api/Corpforthresults/w"
-	bseItems, err := FetchBSEList(client, bseURL)
+	bseItems, err := FetchBSEMeetings(client, cfg.BSEEndpoints)
 	if err != nil {
-		log.Fatalf("fetch bse list: %v", err)
+		return nil, nil, nil, fmt.Errorf("fetch bse list: %v", err)
 	}
 
-	// 2. filter by today's date
-	today := time.Now().Format("02 Jan 2006")
-	var todaysItems []BSEItem
-	for _, it := range bseItems {
-		if it.MeetingDate == today {
-			todaysItems = append(todaysItems, it)
+	// 2. filter by date, purpose, exclusions and group
+	cfg.Scrips = loadScripMaster(client, cfg.ScripMaster)
+	todaysItems, decisions := screenItems(bseItems, cfg, date)
+	if len(todaysItems) == 0 {
+		return nil, nil, decisions, errNoMeetings
+	}
+	results, failures, fetched := collectItems(client, cfg, date, todaysItems)
+	return results, failures, append(decisions, fetched...), nil
+}
+
+// collectItems collects financials for the companies meeting on date ("02 Jan 2006"),
+// within the run's budget, and attaches the day's filings. The decisions say which
+// companies made it and why the others did not.
+func collectItems(client *http.Client, cfg Config, date string, todaysItems []BSEItem) ([]CompanyResult, []Failure, []Decision) {
+	deadline := runDeadline(cfg, time.Now())
+	plugins, err := DiscoverPlugins(cfg.Plugins)
+	if err != nil {
+		log.Printf("collectResults: plugins: %v", err)
+	}
+
+	caches := loadLookupCaches()
+	todaysItems, overLimit := limitItems(todaysItems, cfg.Limit, cfg.Watchlist, cfg.Landed, caches.meta)
+
+	stopInterrupt := catchInterrupt()
+
+	// 3. collect financials: through the trendlyne pipeline when trendlyne is the first
+	// source of every company, else company by company over the configured sources
+	mainClient := *client
+	mainClient.Timeout = time.Duration(cfg.RequestTimeout) * time.Second
+	var results []CompanyResult
+	var failed, outOfTime []BSEItem
+	if trendlyneFirst(cfg, plugins, todaysItems) {
+		results, failed, outOfTime = runPipeline(&mainClient, cfg, caches, todaysItems, deadline)
+	} else {
+		results, failed, outOfTime = fetchConcurrently(&mainClient, cfg, plugins, caches, todaysItems, deadline)
+	}
+
+	// 4. retry the failures once, serially and with a longer timeout: most are transient
+	// rate-limit blips that a calmer second attempt gets through
+	retried, failures := retryFailed(client, cfg, plugins, caches, failed, deadline)
+	results = append(results, retried...)
+	skipped := skipReason()
+	stopInterrupt()
+	decisions := fetchDecisions(todaysItems, results, failures)
+	decisions = append(decisions, itemDecisions(outOfTime, reasonOutOfTime, skipped.Error())...)
+	decisions = append(decisions, itemDecisions(overLimit, reasonOverLimit, fmt.Sprintf("over the limit of %d companies", cfg.Limit))...)
+	failures = append(failures, skippedFailures(outOfTime, skipped.Error())...)
+	failures = append(failures, skippedFailures(overLimit, fmt.Sprintf("skipped: over the limit of %d companies", cfg.Limit))...)
+	caches.save("collectResults")
+	if cfg.Archive.Enabled {
+		if _, err := pruneArchive(cfg.Archive, cfg.Archive.RetentionDays, time.Now()); err != nil {
+			log.Printf("collectItems: prune archive: %v", err)
 		}
 	}
-	if len(todaysItems) == 0 {
-		fmt.Println("no meetings for today:", today)
+	attachDayFilings(client, cfg, date, todaysItems, results)
+	attachPurposes(results, todaysItems)
+	attachScrips(results, todaysItems, cfg.Scrips)
+	if day, err := time.Parse("02 Jan 2006", date); err == nil {
+		attachShareAdjustments(results, todaysItems, loadShareActions(client), day)
+		attachConsensus(results, todaysItems, loadEstimates(), day, cfg.Estimates.window())
+	}
+	flagLeverage(results, cfg.Leverage)
+	if cfg.Profiles.Enabled {
+		attachProfiles(client, cfg, results)
+	}
+	SortResults(results, "company", cfg.ZeroBase)
+	return results, failures, decisions
+}
+
+// trendlyneFirst reports whether trendlyne is the first source of every item
+func trendlyneFirst(cfg Config, plugins []Plugin, items []BSEItem) bool {
+	for _, itm := range items {
+		if sourceOrder(cfg, plugins, itm)[0] != "trendlyne" {
+			return false
+		}
+	}
+	return true
+}
+
+// researchLookback is how many days before the meeting earnings call announcements are
+// looked for
+const researchLookback = 3
+
+// attachDayFilings goes through the BSE announcements of the meeting day and the day
+// after (results often land after midnight): it links the results to their filings and
+// flags the dividends, bonus issues and splits declared alongside them. Investor
+// presentations and earnings calls are looked up from a few days before, as calls are
+// announced ahead. Best effort: the results are kept as they are when the feed fails.
+func attachDayFilings(client *http.Client, cfg Config, date string, items []BSEItem, results []CompanyResult) {
+	day, err := time.Parse("02 Jan 2006", date)
+	if err != nil || len(results) == 0 {
 		return
 	}
+	anns, err := FetchAnnouncements(client, "Result", day, day.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("attachDayFilings: %v", err)
+	}
+	attachFilings(results, items, anns)
+	if cfg.CrossCheck.Enabled {
+		crossCheck(client, cfg, results, items, anns)
+	}
+	// board-meeting outcomes filed as results usually name the dividend; record dates,
+	// bonus issues and splits come as corporate actions
+	actions, err := FetchAnnouncements(client, "Corp. Action", day, day.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("attachDayFilings: %v", err)
+	}
+	attachCorpActions(results, items, append(anns, actions...))
+	updates, err := FetchAnnouncements(client, "Company Update", day.AddDate(0, 0, -researchLookback), day.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("attachDayFilings: %v", err)
+	}
+	attachResearch(results, items, updates)
+}
 
-	// 3. for each item, collect financials concurrently
-	// concurrency limit (adjust as needed)
-	const maxConcurrent = 20
-	sem := make(chan struct{}, maxConcurrent)
+// fetchConcurrently fetches each item over all sources, cfg.Concurrency at a time.
+// Items not started by the deadline are returned as outOfTime.
+func fetchConcurrently(client *http.Client, cfg Config, plugins []Plugin, caches lookupCaches, items []BSEItem, deadline time.Time) (results []CompanyResult, failed, outOfTime []BSEItem) {
+	sem := make(chan struct{}, max(1, cfg.Concurrency))
 	var wg sync.WaitGroup
 
 	type result struct {
+		itm BSEItem
 		cr  CompanyResult
 		err error
 	}
-	resultsCh := make(chan result, len(todaysItems))
+	resultsCh := make(chan result, len(items))
 
-	for _, itm := range todaysItems {
-		itm := itm // capture
+	for i, itm := range items {
 		sem <- struct{}{}
+		if pastDeadline(deadline) {
+			<-sem
+			outOfTime = items[i:]
+			break
+		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer func() { <-sem }()
-			log.Printf("processing (goroutine): %s %s", itm.ShortName, itm.LongName)
-
-			// call trendlyne search
-			trendItems, err := FetchTrendSearch(client, itm.ShortName)
-			if err != nil {
-				log.Printf("trend search error %s: %v", itm.ShortName, err)
-				resultsCh <- result{err: err}
-				return
-			}
-			if len(trendItems) == 0 {
-				log.Printf("no trendlyne results for %s", itm.ShortName)
-				resultsCh <- result{err: fmt.Errorf("no trendlyne results for %s", itm.ShortName)}
-				return
-			}
-			// pick first matching entry
-			tr := trendItems[0]
-
-			// fetch trendlyne page to extract fundamentals URL
-			pageURL := tr.NextURL
-			if pageURL == "" {
-				pageURL = fmt.Sprintf("https://trendlyne.com/equity/%d/%s/%s/", tr.K, tr.ID, tr.SlugName)
-			}
-			fundURL, err := ExtractFundamentalsURLFromPage(client, pageURL)
-			if err != nil {
-				log.Printf("extract fundamentals url failed for %s: %v", itm.ShortName, err)
-				resultsCh <- result{err: err}
-				return
-			}
-
-			// fetch fundamentals JSON
-			fundJSON, err := FetchFundamentalsJSON(client, fundURL, pageURL)
-			if err != nil {
-				log.Printf("fetch fundamentals failed for %s: %v", itm.ShortName, err)
-				resultsCh <- result{err: err}
-				return
-			}
-
-			// parse and collect last 4 quarters
-			cr := ParseCompanyFundamentals(itm.ShortName, fundJSON)
-			// attach long name
-			cr.LongName = itm.LongName
-			resultsCh <- result{cr: cr, err: nil}
+			cr, err := fetchCompany(client, cfg, plugins, caches, itm)
+			resultsCh <- result{itm: itm, cr: cr, err: err}
 		}()
 	}
+	wg.Wait()
+	close(resultsCh)
 
-	// wait for all workers and then close resultsCh
-	go func() {
-		wg.Wait()
-		close(resultsCh)
-	}()
-
-	// gather results
-	var results []CompanyResult
 	for r := range resultsCh {
 		if r.err != nil {
-			// already logged inside worker; skip failed entry
+			log.Printf("fetchConcurrently: %s failed: %v", r.itm.ShortName, r.err)
+			failed = append(failed, r.itm)
 			continue
 		}
 		results = append(results, r.cr)
 	}
+	return results, failed, outOfTime
+}
+
+// retryDelay spaces out the serial retries
+const retryDelay = 2 * time.Second
+
+// retryFailed fetches each item again, one at a time, with three times the request timeout
+func retryFailed(client *http.Client, cfg Config, plugins []Plugin, caches lookupCaches, items []BSEItem, deadline time.Time) ([]CompanyResult, []Failure) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	log.Printf("retryFailed: retrying %d companies", len(items))
+	retryClient := *client
+	retryClient.Timeout = 3 * time.Duration(cfg.RequestTimeout) * time.Second
+	var results []CompanyResult
+	var failures []Failure
+	for i, itm := range items {
+		if i > 0 {
+			time.Sleep(retryDelay)
+		}
+		if pastDeadline(deadline) {
+			log.Printf("retryFailed: deadline reached, %d companies not retried", len(items)-i)
+			for _, itm := range items[i:] {
+				failures = append(failures, Failure{Company: itm.ShortName, LongName: itm.LongName, Error: "failed, not retried: run deadline reached"})
+			}
+			break
+		}
+		cr, err := fetchCompany(&retryClient, cfg, plugins, caches, itm)
+		if err != nil {
+			log.Printf("retryFailed: %s failed again: %v", itm.ShortName, err)
+			failures = append(failures, Failure{Company: itm.ShortName, LongName: itm.LongName, Error: err.Error()})
+			continue
+		}
+		log.Printf("retryFailed: %s succeeded on retry", itm.ShortName)
+		results = append(results, cr)
+	}
+	return results, failures
+}
 
-	// 4. generate HTML report
-	outPath, err := getOutputReportPath()
+// processCompany runs the pipeline steps for one BSE item, one after the other.
+// A cached mapping that stops working is dropped and the company resolved again.
+// Errors name the step that failed.
+func processCompany(client *http.Client, cfg Config, caches lookupCaches, itm BSEItem) (CompanyResult, error) {
+	j := &pipelineJob{itm: itm, key: symbolKey(itm)}
+	err := runSteps(client, cfg, caches, j)
+	if err != nil && j.cached {
+		log.Printf("processCompany: cached mapping for %s failed (%v), resolving again", itm.ShortName, err)
+		caches.symbols.drop(j.key)
+		j = &pipelineJob{itm: itm, key: j.key}
+		err = runSteps(client, cfg, caches, j)
+	}
 	if err != nil {
-		log.Fatalf("cannot determine output path: %v", err)
+		return CompanyResult{}, err
 	}
-	if err := GenerateHTMLReport(outPath, results); err != nil {
-		log.Fatalf("generate report: %v", err)
+	return j.cr, nil
+}
+
+// hasAnyValue reports whether any revenue or net profit value was parsed
+func hasAnyValue(cr CompanyResult) bool {
+	for _, vals := range [][]float64{cr.RevenueNums, cr.NetProfitNums} {
+		for _, v := range vals {
+			if !math.IsNaN(v) {
+				return true
+			}
+		}
 	}
-	fmt.Println("report saved to", outPath)
+	return false
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// metaRefresh is how long cached company metadata is used before the trendlyne page is
+// scraped again; sector, market cap and ISIN change slowly enough for a weekly refresh
+const metaRefresh = 7 * 24 * time.Hour
+
+// companyMeta is the slow-changing metadata of a company
+type companyMeta struct {
+	LongName  string   `json:"long_name,omitempty"`
+	ISIN      string   `json:"isin,omitempty"`
+	Sector    string   `json:"sector,omitempty"`
+	MarketCap *float64 `json:"market_cap,omitempty"` // ₹ cr
+	// quote as of FetchedAt, for the valuation ratios
+	Price           *float64 `json:"price,omitempty"`
+	BookValue       *float64 `json:"book_value,omitempty"`
+	EnterpriseValue *float64 `json:"enterprise_value,omitempty"`
+	// shareholding (%), and the figures before they last changed (see since)
+	PromoterHolding     *float64  `json:"promoter_holding,omitempty"`
+	Pledged             *float64  `json:"pledged,omitempty"`
+	PrevPromoterHolding *float64  `json:"prev_promoter_holding,omitempty"`
+	PrevPledged         *float64  `json:"prev_pledged,omitempty"`
+	FetchedAt           time.Time `json:"fetched_at"`
+	// Validators of the page the metadata came from, for a conditional refresh
+	Validators httpValidators `json:"validators"`
+}
+
+// metaCache is the company metadata cache in <cache dir>/metadata.json, keyed like the
+// symbol cache. A nil *metaCache disables caching. Safe for concurrent use.
+type metaCache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]companyMeta
+	dirty   bool
+}
+
+// lookupCaches bundles the per-company caches threaded through a fetch
+type lookupCaches struct {
+	symbols *symbolCache
+	meta    *metaCache
+}
+
+// loadLookupCaches loads the symbol and metadata caches
+func loadLookupCaches() lookupCaches {
+	return lookupCaches{symbols: loadSymbolCache(), meta: loadMetaCache()}
+}
+
+// save writes both caches, logging failures under the caller's name
+func (c lookupCaches) save(caller string) {
+	if err := c.symbols.save(); err != nil {
+		log.Printf("%s: save symbol cache: %v", caller, err)
+	}
+	if err := c.meta.save(); err != nil {
+		log.Printf("%s: save metadata cache: %v", caller, err)
+	}
+}
+
+// loadMetaCache reads the cache file; a missing or unreadable file starts an empty cache
+func loadMetaCache() *metaCache {
+	dir, err := cacheDir()
+	if err != nil {
+		log.Printf("loadMetaCache: %v", err)
+		return nil
+	}
+	c := &metaCache{path: filepath.Join(dir, "metadata.json"), entries: map[string]companyMeta{}}
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("loadMetaCache: %v", err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(b, &c.entries); err != nil {
+		log.Printf("loadMetaCache: ignoring %s: %v", c.path, err)
+		c.entries = map[string]companyMeta{}
+	}
+	return c
+}
+
+// get returns the cached metadata and whether it is recent enough to skip a refresh
+func (c *metaCache) get(key string) (m companyMeta, ok, fresh bool) {
+	if c == nil {
+		return companyMeta{}, false, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok = c.entries[key]
+	return m, ok, ok && time.Since(m.FetchedAt) < metaRefresh
+}
+
+func (c *metaCache) put(key string, m companyMeta) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m.FetchedAt = time.Now()
+	c.entries[key] = m
+	c.dirty = true
+}
+
+// save writes the cache if it changed
+func (c *metaCache) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// pageMeta builds the cached metadata from a scraped page; longName is the best name known
+func pageMeta(page TrendPage, longName string) companyMeta {
+	meta := page.Meta
+	if meta.LongName != "" {
+		longName = meta.LongName
+	}
+	return companyMeta{
+		LongName:        longName,
+		ISIN:            meta.ISIN,
+		Sector:          meta.Sector,
+		MarketCap:       nullableFloat(meta.MarketCap),
+		Price:           nullableFloat(meta.Price),
+		BookValue:       nullableFloat(meta.BookValue),
+		EnterpriseValue: nullableFloat(meta.EnterpriseValue),
+		PromoterHolding: nullableFloat(meta.PromoterHolding),
+		Pledged:         nullableFloat(meta.Pledged),
+		Validators:      page.Validators,
+	}
+}
+
+// apply copies the metadata onto a result; the BSE long name wins when present
+func (m companyMeta) apply(cr *CompanyResult) {
+	if cr.LongName == "" {
+		cr.LongName = m.LongName
+	}
+	cr.ISIN = m.ISIN
+	cr.Sector = m.Sector
+	cr.MarketCap = nanFloat(m.MarketCap)
+	cr.Price = nanFloat(m.Price)
+	cr.BookValue = nanFloat(m.BookValue)
+	cr.EnterpriseValue = nanFloat(m.EnterpriseValue)
+	cr.PromoterHolding = nanFloat(m.PromoterHolding)
+	cr.Pledged = nanFloat(m.Pledged)
+	cr.HoldingChange = change(cr.PromoterHolding, m.PrevPromoterHolding)
+	cr.PledgeChange = change(cr.Pledged, m.PrevPledged)
+}
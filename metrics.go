@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// Metric is one registry entry: a value read from the fundamentals dump under the first
+// of Keys present for each quarter
+type Metric struct {
+	Name           string   // identifier used in formulas and filters
+	Label          string   // column header
+	Keys           []string // candidate dump keys, first present wins
+	Format         string   // num, pct or cr
+	HigherIsBetter bool
+}
+
+// MetricRegistry lists the metrics read from the fundamentals dump. "revenue" and
+// "net_profit" are built in (their keys can be overridden); other entries become extra
+// report columns and formula/filter names.
+type MetricRegistry []Metric
+
+// defaultMetrics are the built-in metrics
+var defaultMetrics = MetricRegistry{
+	{Name: "revenue", Label: "Revenue", Keys: []string{"TOTAL_SR_Q", "SR_Q"}, Format: "cr", HigherIsBetter: true},
+	{Name: "net_profit", Label: "Net Profit", Keys: []string{"NP_Q"}, Format: "cr", HigherIsBetter: true},
+}
+
+var metricNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// BuildMetricRegistry merges the configured metrics over the defaults; an entry with a
+// built-in name replaces its keys, any other name adds a metric
+func BuildMetricRegistry(cfgs []MetricConfig) (MetricRegistry, error) {
+	reg := append(MetricRegistry(nil), defaultMetrics...)
+	reserved := rowVars(CompanyResult{}, nil, zeroBaseNA)
+	for _, c := range cfgs {
+		if !metricNameRe.MatchString(c.Name) {
+			return nil, fmt.Errorf("metric name %q must be an identifier like ebitda or other_income", c.Name)
+		}
+		if len(c.Keys) == 0 {
+			return nil, fmt.Errorf("metric %s has no keys", c.Name)
+		}
+		switch c.Format {
+		case "", "num", "pct", "cr":
+		default:
+			return nil, fmt.Errorf("metric %s: unknown format %q", c.Name, c.Format)
+		}
+		m := Metric{Name: c.Name, Label: c.Label, Keys: c.Keys, Format: c.Format, HigherIsBetter: true}
+		if c.HigherIsBetter != nil {
+			m.HigherIsBetter = *c.HigherIsBetter
+		}
+		if m.Label == "" {
+			m.Label = m.Name
+		}
+		if i := reg.index(c.Name); i >= 0 {
+			if i < len(defaultMetrics) {
+				// built-ins keep their label and rendering; only the keys are configurable
+				reg[i].Keys = c.Keys
+				continue
+			}
+			return nil, fmt.Errorf("metric %s defined twice", c.Name)
+		}
+		if _, ok := reserved[c.Name]; ok {
+			return nil, fmt.Errorf("metric name %s is already a built-in filter name", c.Name)
+		}
+		reg = append(reg, m)
+	}
+	return reg, nil
+}
+
+func (reg MetricRegistry) index(name string) int {
+	for i, m := range reg {
+		if m.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Keys returns the dump keys of the named metric (the defaults when reg lacks it)
+func (reg MetricRegistry) Keys(name string) []string {
+	if i := reg.index(name); i >= 0 {
+		return reg[i].Keys
+	}
+	if i := defaultMetrics.index(name); i >= 0 {
+		return defaultMetrics[i].Keys
+	}
+	return nil
+}
+
+// Extra returns the metrics beyond the built-in revenue and net profit
+func (reg MetricRegistry) Extra() []Metric {
+	var out []Metric
+	for _, m := range reg {
+		if defaultMetrics.index(m.Name) < 0 {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// String formats a metric value for a table cell
+func (m Metric) String(v float64) string {
+	return Column{Format: m.Format}.String(v)
+}
+
+// class colors the latest value by its change from the previous quarter, taking
+// HigherIsBetter into account
+func (m Metric) class(curr, prev float64) string {
+	if math.IsNaN(curr) || math.IsNaN(prev) || curr == prev {
+		return "neutral"
+	}
+	if (curr > prev) == m.HigherIsBetter {
+		return "positive"
+	}
+	return "negative"
+}
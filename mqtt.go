@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MQTTConfig publishes every result and a run summary to an MQTT broker (MQTT 3.1.1), for
+// home-automation and dashboard setups such as Node-RED or Home Assistant
+type MQTTConfig struct {
+	Broker       string `json:"broker"` // tcp://host:1883 or tls://host:8883
+	Username     string `json:"username"`
+	Password     string `json:"password" secret:"true"`
+	ClientID     string `json:"client_id"`     // default quarter-compare
+	ResultTopic  string `json:"result_topic"`  // default quarter-compare/results/{company}
+	SummaryTopic string `json:"summary_topic"` // default quarter-compare/summary
+	QoS          int    `json:"qos"`           // 0 or 1
+	Retain       bool   `json:"retain"`        // keep the last message per topic on the broker
+}
+
+// mqttTimeout bounds connecting and every broker answer
+const mqttTimeout = 15 * time.Second
+
+// runSummary is the payload of the summary topic, and a RunSummary of the gRPC API
+type runSummary struct {
+	Date      string   `json:"date"`
+	Companies int      `json:"companies"`
+	Failures  int      `json:"failures"`
+	TopNP     []string `json:"top_np"`    // up to 5 companies with the highest NP growth
+	BottomNP  []string `json:"bottom_np"` // and the lowest
+}
+
+// summarizeRun counts a run and names its biggest movers by NP growth under the zero_base
+// policy
+func summarizeRun(date string, results []CompanyResult, failures []Failure, zeroBase string) runSummary {
+	sum := runSummary{Date: isoDate(date), Companies: len(results), Failures: len(failures), TopNP: []string{}, BottomNP: []string{}}
+	top, bottom := digestMoverLists(results, 5, zeroBase)
+	for _, r := range top {
+		sum.TopNP = append(sum.TopNP, r.Company)
+	}
+	for _, r := range bottom {
+		sum.BottomNP = append(sum.BottomNP, r.Company)
+	}
+	return sum
+}
+
+// PublishMQTT publishes each result as JSON to its result topic and then the run summary
+func PublishMQTT(cfg MQTTConfig, date string, results []CompanyResult, failures []Failure, zeroBase string) error {
+	if cfg.QoS != 0 && cfg.QoS != 1 {
+		return fmt.Errorf("mqtt: qos %d not supported (want 0 or 1)", cfg.QoS)
+	}
+	c, err := dialMQTT(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	resultTopic := cfg.ResultTopic
+	if resultTopic == "" {
+		resultTopic = "quarter-compare/results/{company}"
+	}
+	for _, r := range results {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("mqtt: %s: %v", r.Company, err)
+		}
+		if err := c.publish(strings.ReplaceAll(resultTopic, "{company}", mqttTopicLevel(r.Company)), b, cfg.QoS, cfg.Retain); err != nil {
+			return err
+		}
+	}
+
+	b, _ := json.Marshal(summarizeRun(date, results, failures, zeroBase))
+	summaryTopic := cfg.SummaryTopic
+	if summaryTopic == "" {
+		summaryTopic = "quarter-compare/summary"
+	}
+	return c.publish(summaryTopic, b, cfg.QoS, cfg.Retain)
+}
+
+// mqttTopicLevel makes a company name safe as one topic level: no separators or wildcards
+func mqttTopicLevel(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+// mqttConn is a connected MQTT 3.1.1 client that only publishes
+type mqttConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	nextID uint16
+}
+
+// dialMQTT connects and logs in to the broker
+func dialMQTT(cfg MQTTConfig) (*mqttConn, error) {
+	u, err := url.Parse(cfg.Broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("mqtt: broker %q: want tcp://host:port or tls://host:port", cfg.Broker)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if u.Scheme == "tls" || u.Scheme == "ssl" || u.Scheme == "mqtts" {
+			port = "8883"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", host)
+	case "tls", "ssl", "mqtts":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("mqtt: unknown broker scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: %v", err)
+	}
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "quarter-compare"
+	}
+	flags := byte(0x02) // clean session
+	var payload []byte
+	payload = appendMQTTString(payload, clientID)
+	if cfg.Username != "" {
+		flags |= 0x80
+		payload = appendMQTTString(payload, cfg.Username)
+		if cfg.Password != "" {
+			flags |= 0x40
+			payload = appendMQTTString(payload, cfg.Password)
+		}
+	}
+	vh := appendMQTTString(nil, "MQTT")
+	vh = append(vh, 4, flags, 0, 60) // protocol level 4 (3.1.1), keep-alive 60s
+	if err := c.send(0x10, append(vh, payload...)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	typ, body, err := c.receive()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if typ != 0x20 || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: unexpected answer to connect (packet type %#x)", typ)
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connection refused: %s", mqttConnackReason(body[1]))
+	}
+	return c, nil
+}
+
+// mqttConnackReason describes a CONNACK return code
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client id rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+// publish sends one message; at QoS 1 it waits for the broker's acknowledgement
+func (c *mqttConn) publish(topic string, payload []byte, qos int, retain bool) error {
+	header := byte(0x30) | byte(qos)<<1
+	if retain {
+		header |= 0x01
+	}
+	body := appendMQTTString(nil, topic)
+	var id uint16
+	if qos == 1 {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		id = c.nextID
+		body = append(body, byte(id>>8), byte(id))
+	}
+	if err := c.send(header, append(body, payload...)); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+	typ, ack, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if typ != 0x40 || len(ack) != 2 || uint16(ack[0])<<8|uint16(ack[1]) != id {
+		return fmt.Errorf("mqtt: unexpected answer to publish on %s (packet type %#x)", topic, typ)
+	}
+	return nil
+}
+
+// close disconnects cleanly
+func (c *mqttConn) close() {
+	c.send(0xE0, nil)
+	c.conn.Close()
+}
+
+// send writes one packet: the fixed header byte, the remaining length and body
+func (c *mqttConn) send(header byte, body []byte) error {
+	pkt := appendMQTTLength([]byte{header}, len(body))
+	c.conn.SetWriteDeadline(time.Now().Add(mqttTimeout))
+	if _, err := c.conn.Write(append(pkt, body...)); err != nil {
+		return fmt.Errorf("mqtt: %v", err)
+	}
+	return nil
+}
+
+// receive reads one packet and returns its type (upper header bits) and body
+func (c *mqttConn) receive() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(mqttTimeout))
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("mqtt: %v", err)
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, fmt.Errorf("mqtt: %v", err)
+		}
+		n += int(b&0x7f) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("mqtt: malformed packet length")
+		}
+		mult *= 128
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, fmt.Errorf("mqtt: %v", err)
+	}
+	return header & 0xF0, body, nil
+}
+
+// appendMQTTLength appends the remaining length n: seven bits a byte, least significant
+// first, the top bit set on every byte but the last
+func appendMQTTLength(b []byte, n int) []byte {
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// appendMQTTString appends s as an MQTT UTF-8 string (two-byte length prefix)
+func appendMQTTString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestMQTTRemainingLength(t *testing.T) {
+	cases := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{321, []byte{0xC1, 0x02}},
+		{16383, []byte{0xFF, 0x7F}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xFF, 0xFF, 0x7F}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{268435455, []byte{0xFF, 0xFF, 0xFF, 0x7F}},
+	}
+	for _, c := range cases {
+		if got := appendMQTTLength(nil, c.n); !bytes.Equal(got, c.want) {
+			t.Errorf("appendMQTTLength(%d) = % x, want % x", c.n, got, c.want)
+		}
+	}
+
+	// what send writes, receive reads back
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		client, server := net.Pipe()
+		body := bytes.Repeat([]byte{'x'}, n)
+		go func() {
+			(&mqttConn{conn: client}).send(0x30, body)
+			client.Close()
+		}()
+		typ, got, err := (&mqttConn{conn: server, r: bufio.NewReader(server)}).receive()
+		server.Close()
+		if err != nil || typ != 0x30 || len(got) != n {
+			t.Errorf("length %d: receive = %#x, %d bytes, %v", n, typ, len(got), err)
+		}
+	}
+
+	// a remaining length of more than four bytes is refused
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{0x30, 0xFF, 0xFF, 0xFF, 0xFF, 0x01})
+		client.Close()
+	}()
+	_, _, err := (&mqttConn{conn: server, r: bufio.NewReader(server)}).receive()
+	server.Close()
+	if err == nil || !strings.Contains(err.Error(), "malformed packet length") {
+		t.Errorf("five-byte length: err = %v", err)
+	}
+}
+
+// mqttPacket is a packet the fake broker received, with its full fixed header byte
+type mqttPacket struct {
+	header byte
+	body   []byte
+}
+
+// fakeBroker accepts one connection on a local port and hands it to serve, which reads
+// packets with next and answers with reply. It returns the broker URL.
+func fakeBroker(t *testing.T, serve func(next func() mqttPacket, reply func(...byte))) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+		next := func() mqttPacket {
+			h, err := c.r.Peek(1)
+			if err != nil {
+				return mqttPacket{}
+			}
+			header := h[0]
+			if _, body, err := c.receive(); err == nil {
+				return mqttPacket{header, body}
+			}
+			return mqttPacket{}
+		}
+		reply := func(b ...byte) { conn.Write(b) }
+		serve(next, reply)
+	}()
+	return "tcp://" + l.Addr().String()
+}
+
+// mqttField cuts a two-byte length prefixed field off b
+func mqttField(b []byte) (string, []byte) {
+	if len(b) < 2 {
+		return "", nil
+	}
+	n := int(b[0])<<8 | int(b[1])
+	if len(b) < 2+n {
+		return "", nil
+	}
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func TestMQTTConnect(t *testing.T) {
+	cfg := MQTTConfig{ClientID: "qc-test", Username: "user", Password: "secret"}
+	var connect mqttPacket
+	cfg.Broker = fakeBroker(t, func(next func() mqttPacket, reply func(...byte)) {
+		connect = next()
+		reply(0x20, 0x02, 0x00, 0x05) // CONNACK: not authorized
+	})
+	_, err := dialMQTT(cfg)
+	if err == nil || !strings.Contains(err.Error(), "connection refused: not authorized") {
+		t.Fatalf("err = %v, want the refusal", err)
+	}
+	if connect.header != 0x10 {
+		t.Fatalf("CONNECT header = %#x", connect.header)
+	}
+	proto, rest := mqttField(connect.body)
+	if proto != "MQTT" || len(rest) < 4 || rest[0] != 4 || rest[1] != 0xC2 || rest[2] != 0 || rest[3] != 60 {
+		t.Fatalf("CONNECT variable header = %q % x", proto, rest)
+	}
+	var fields []string
+	for rest = rest[4:]; len(rest) > 0; {
+		var f string
+		f, rest = mqttField(rest)
+		fields = append(fields, f)
+	}
+	if strings.Join(fields, ",") != "qc-test,user,secret" {
+		t.Errorf("CONNECT payload = %q", fields)
+	}
+
+	for _, c := range []struct {
+		name  string
+		reply []byte
+		want  string
+	}{
+		{"unknown code", []byte{0x20, 0x02, 0x00, 0x09}, "connection refused: code 9"},
+		{"not a CONNACK", []byte{0x90, 0x03, 0x00, 0x01, 0x00}, "unexpected answer to connect (packet type 0x90)"},
+		{"short CONNACK", []byte{0x20, 0x01, 0x00}, "unexpected answer to connect"},
+		{"hang up", nil, "mqtt: EOF"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			broker := fakeBroker(t, func(next func() mqttPacket, reply func(...byte)) {
+				next()
+				if c.reply != nil {
+					reply(c.reply...)
+				}
+			})
+			if _, err := dialMQTT(MQTTConfig{Broker: broker}); err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("err = %v, want %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestPublishMQTT(t *testing.T) {
+	results := []CompanyResult{
+		{Company: "TCS", RevenueNums: []float64{100}, NetProfitNums: []float64{10}},
+		{Company: "M&M/FIN+#", RevenueNums: []float64{50}, NetProfitNums: []float64{5}},
+	}
+	type message struct {
+		topic   string
+		payload string
+	}
+	got := make(chan []message, 1)
+	broker := fakeBroker(t, func(next func() mqttPacket, reply func(...byte)) {
+		var msgs []message
+		defer func() { got <- msgs }()
+		if p := next(); p.header != 0x10 {
+			t.Errorf("first packet %#x, want CONNECT", p.header)
+			return
+		}
+		reply(0x20, 0x02, 0x00, 0x00)
+		for {
+			p := next()
+			switch {
+			case p.header == 0xE0:
+				return
+			case p.header != 0x33: // PUBLISH, QoS 1, retained
+				t.Errorf("packet header %#x, want PUBLISH at QoS 1 with retain", p.header)
+				return
+			}
+			topic, rest := mqttField(p.body)
+			if len(rest) < 2 {
+				t.Errorf("PUBLISH on %s without a packet id", topic)
+				return
+			}
+			msgs = append(msgs, message{topic, string(rest[2:])})
+			reply(0x40, 0x02, rest[0], rest[1]) // PUBACK
+		}
+	})
+	if err := PublishMQTT(MQTTConfig{Broker: broker, QoS: 1, Retain: true}, "12 Jul 2024", results, nil, zeroBaseNA); err != nil {
+		t.Fatal(err)
+	}
+	msgs := <-got
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want 3: %v", len(msgs), msgs)
+	}
+	if msgs[0].topic != "quarter-compare/results/TCS" || msgs[1].topic != "quarter-compare/results/M&M_FIN__" {
+		t.Errorf("result topics = %q, %q", msgs[0].topic, msgs[1].topic)
+	}
+	var r CompanyResult
+	if err := json.Unmarshal([]byte(msgs[1].payload), &r); err != nil || r.Company != "M&M/FIN+#" {
+		t.Errorf("result payload = %s (%v)", msgs[1].payload, err)
+	}
+	var sum runSummary
+	if err := json.Unmarshal([]byte(msgs[2].payload), &sum); err != nil || msgs[2].topic != "quarter-compare/summary" || sum.Date != "2024-07-12" || sum.Companies != 2 {
+		t.Errorf("summary on %s = %s (%v)", msgs[2].topic, msgs[2].payload, err)
+	}
+
+	// a PUBACK for another packet fails the publish
+	broker = fakeBroker(t, func(next func() mqttPacket, reply func(...byte)) {
+		next()
+		reply(0x20, 0x02, 0x00, 0x00)
+		next()
+		reply(0x40, 0x02, 0x12, 0x34)
+	})
+	err := PublishMQTT(MQTTConfig{Broker: broker, QoS: 1}, "12 Jul 2024", results, nil, zeroBaseNA)
+	if err == nil || !strings.Contains(err.Error(), "unexpected answer to publish on quarter-compare/results/TCS") {
+		t.Errorf("wrong PUBACK: err = %v", err)
+	}
+
+	if err := PublishMQTT(MQTTConfig{Broker: broker, QoS: 2}, "12 Jul 2024", results, nil, zeroBaseNA); err == nil || !strings.Contains(err.Error(), "qos 2 not supported") {
+		t.Errorf("QoS 2: err = %v", err)
+	}
+}
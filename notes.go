@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Notes are personal free-text notes per company ("exited Q1", "avg price 450"), keyed
+// by upper-cased ticker and shown in the report's Notes column
+type Notes map[string]string
+
+// notesPath is cfg.NotesFile, else <app dir>/notes.csv
+func notesPath(cfg Config) (string, error) {
+	if cfg.NotesFile != "" {
+		return cfg.NotesFile, nil
+	}
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "notes.csv"), nil
+}
+
+// LoadNotes reads a two-column CSV (ticker, note); a "ticker,note" header row and blank
+// tickers are skipped, and a later row for the same ticker replaces an earlier one.
+// A missing file gives no notes; the default file only exists if the user created it.
+func LoadNotes(path string) (Notes, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	notes := Notes{}
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("%s:%d: want ticker,note", path, line)
+		}
+		ticker := strings.ToUpper(strings.TrimSpace(rec[0]))
+		if ticker == "" || (line == 1 && ticker == "TICKER") {
+			continue
+		}
+		notes[ticker] = strings.TrimSpace(strings.Join(rec[1:], ","))
+	}
+	return notes, nil
+}
+
+// For returns the note of a company, empty when there is none
+func (n Notes) For(company string) string {
+	return n[strings.ToUpper(strings.TrimSpace(company))]
+}
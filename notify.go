@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// notifiedState records, per day and company, the numbers last sent in an alert so repeated
+// runs (cron, `watch`) only alert on newly declared or materially changed results
+type notifiedState map[string]map[string]notifiedEntry
+
+type notifiedEntry struct {
+	Quarter   string  `json:"quarter"`
+	Revenue   float64 `json:"revenue"`
+	NetProfit float64 `json:"net_profit"`
+	SentAt    string  `json:"sent_at"`
+}
+
+// notifiedKeepDays bounds how long per-day state is kept
+const notifiedKeepDays = 14
+
+// notifiedPath returns <app dir>/notified.json
+func notifiedPath() (string, error) {
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "notified.json"), nil
+}
+
+// loadNotified reads the state file; a missing file is an empty state
+func loadNotified(path string) (notifiedState, error) {
+	st := notifiedState{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return st, nil
+}
+
+// save writes the state, dropping days older than notifiedKeepDays
+func (st notifiedState) save(path string) error {
+	cutoff := time.Now().AddDate(0, 0, -notifiedKeepDays).Format("2006-01-02")
+	for day := range st {
+		if day < cutoff {
+			delete(st, day)
+		}
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// pendingAlerts returns the results of day that were never notified or whose latest quarter
+// numbers moved by at least changePct percent since the last alert
+func (st notifiedState) pendingAlerts(day string, results []CompanyResult, changePct float64) (fresh, changed []CompanyResult) {
+	sent := st[day]
+	for _, r := range results {
+		prev, ok := sent[r.Company]
+		if !ok {
+			fresh = append(fresh, r)
+			continue
+		}
+		cur := entryFor(r)
+		if cur.Quarter != prev.Quarter || materialChange(cur.Revenue, prev.Revenue, changePct) ||
+			materialChange(cur.NetProfit, prev.NetProfit, changePct) {
+			changed = append(changed, r)
+		}
+	}
+	return fresh, changed
+}
+
+// markSent records the numbers that were just sent for each result
+func (st notifiedState) markSent(day string, results []CompanyResult) {
+	if st[day] == nil {
+		st[day] = map[string]notifiedEntry{}
+	}
+	now := time.Now().Format(time.RFC3339)
+	for _, r := range results {
+		e := entryFor(r)
+		e.SentAt = now
+		st[day][r.Company] = e
+	}
+}
+
+func entryFor(r CompanyResult) notifiedEntry {
+	at := func(vals []float64) float64 {
+		if len(vals) > 0 {
+			return vals[0]
+		}
+		return math.NaN()
+	}
+	return notifiedEntry{Quarter: firstQuarter(r), Revenue: at(r.RevenueNums), NetProfit: at(r.NetProfitNums)}
+}
+
+// sameEntry reports whether two entries hold the same quarter and numbers
+func sameEntry(a, b notifiedEntry) bool {
+	eq := func(x, y float64) bool { return x == y || (math.IsNaN(x) && math.IsNaN(y)) }
+	return a.Quarter == b.Quarter && eq(a.Revenue, b.Revenue) && eq(a.NetProfit, b.NetProfit)
+}
+
+// materialChange reports whether cur differs from prev by at least pct percent;
+// a value appearing or disappearing always counts
+func materialChange(cur, prev, pct float64) bool {
+	if math.IsNaN(cur) || math.IsNaN(prev) {
+		return math.IsNaN(cur) != math.IsNaN(prev)
+	}
+	if prev == 0 {
+		return cur != 0
+	}
+	return math.Abs(cur-prev)/math.Abs(prev)*100 >= pct
+}
+
+// MarshalJSON stores unknown numbers as null (NaN is not valid JSON)
+func (e notifiedEntry) MarshalJSON() ([]byte, error) {
+	type alias notifiedEntry
+	return json.Marshal(struct {
+		alias
+		Revenue   *float64 `json:"revenue"`
+		NetProfit *float64 `json:"net_profit"`
+	}{alias(e), nullableFloat(e.Revenue), nullableFloat(e.NetProfit)})
+}
+
+func (e *notifiedEntry) UnmarshalJSON(b []byte) error {
+	type alias notifiedEntry
+	aux := struct {
+		*alias
+		Revenue   *float64 `json:"revenue"`
+		NetProfit *float64 `json:"net_profit"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	vals := nanFloats([]*float64{aux.Revenue, aux.NetProfit})
+	e.Revenue, e.NetProfit = vals[0], vals[1]
+	return nil
+}
+
+// alertMessage formats the fresh and changed results as one plain-text message, growth
+// under the zero_base policy
+func alertMessage(date string, fresh, changed []CompanyResult, zeroBase string) string {
+	var sb strings.Builder
+	line := func(r CompanyResult) {
+		rev, np := latestGrowth(r, zeroBase)
+		name := r.Company
+		if r.LongName != "" {
+			name += " (" + r.LongName + ")"
+		}
+		fmt.Fprintf(&sb, "• %s %s: revenue %s, net profit %s\n", name, firstQuarter(r), rev, np)
+		if pledgeRising(r) {
+			fmt.Fprintf(&sb, "  ⚠ promoter pledge up %.2f points to %.2f%%\n", r.PledgeChange, r.Pledged)
+		}
+	}
+	byName := func(rs []CompanyResult) {
+		sort.Slice(rs, func(i, j int) bool { return rs[i].Company < rs[j].Company })
+	}
+	if len(fresh) > 0 {
+		byName(fresh)
+		fmt.Fprintf(&sb, "New results (%s):\n", date)
+		for _, r := range fresh {
+			line(r)
+		}
+	}
+	if len(changed) > 0 {
+		byName(changed)
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "Updated numbers (%s):\n", date)
+		for _, r := range changed {
+			line(r)
+		}
+	}
+	return sb.String()
+}
+
+// Notify sends alerts for results of date ("02 Jan 2006") not yet notified, or changed by at
+// least cfg.ChangePct since, and records what was sent. It is a no-op without a channel configured.
+// Every configured channel is tried; the returned error joins the failures of each.
+// The email digest also lists the day's movers and failures, and may attach reportFile.
+// Growth is shown, filtered and sorted under the zero_base policy.
+func Notify(client *http.Client, cfg NotifyConfig, watchlist []string, zeroBase string, date string, results []CompanyResult, failures []Failure, reportFile string) error {
+	if cfg.Telegram.BotToken == "" && !cfg.Desktop.Enabled && !cfg.Email.enabled() && !cfg.SMS.enabled() {
+		return nil
+	}
+	all := results
+	if cfg.WatchlistOnly {
+		var kept []CompanyResult
+		for _, r := range results {
+			if inWatchlist(watchlist, r.Company) {
+				kept = append(kept, r)
+			}
+		}
+		results = kept
+	}
+	path, err := notifiedPath()
+	if err != nil {
+		return err
+	}
+	st, err := loadNotified(path)
+	if err != nil {
+		return err
+	}
+	day := isoDate(date)
+	changePct := cfg.ChangePct
+	if changePct <= 0 {
+		changePct = 1
+	}
+	fresh, changed := st.pendingAlerts(day, results, changePct)
+	if len(fresh)+len(changed) == 0 {
+		return nil
+	}
+	// every channel is tried even when an earlier one fails; the results count as sent once
+	// any channel sent a message about them, so a broken channel can't re-send the rest on
+	// every poll. A channel with nothing crossing its threshold sends nothing and doesn't count.
+	var errs []error
+	delivered := false
+	send := func(sent bool, err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+		delivered = delivered || sent
+	}
+	if cfg.Desktop.Enabled {
+		send(desktopAlert(cfg.Desktop, watchlist, zeroBase, day, append(fresh, changed...)))
+	}
+	if cfg.Telegram.BotToken != "" {
+		err := sendTelegram(client, cfg.Telegram, alertMessage(day, fresh, changed, zeroBase))
+		send(err == nil, err)
+	}
+	if cfg.SMS.enabled() {
+		send(smsAlert(client, cfg.SMS, watchlist, zeroBase, append(fresh, changed...)))
+	}
+	if cfg.Email.enabled() {
+		send(emailDigest(cfg.Email, watchlist, zeroBase, day, fresh, changed, all, failures, reportFile))
+	}
+	if delivered {
+		st.markSent(day, append(fresh, changed...))
+		if err := st.save(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// telegramMaxLen is the Bot API limit on message text
+const telegramMaxLen = 4096
+
+// sendTelegram posts text to the configured chat via the Bot API
+func sendTelegram(client *http.Client, cfg TelegramConfig, text string) error {
+	if r := []rune(text); len(r) > telegramMaxLen {
+		text = string(r[:telegramMaxLen-1]) + "…"
+	}
+	form := url.Values{"chat_id": {cfg.ChatID}, "text": {text}, "disable_web_page_preview": {"true"}}
+	resp, err := client.PostForm("https://api.telegram.org/bot"+cfg.BotToken+"/sendMessage", form)
+	if err != nil {
+		// the request URL embeds the token; don't let it reach the logs
+		return errors.New("telegram: request failed: " + strings.ReplaceAll(err.Error(), cfg.BotToken, "***"))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("telegram: status=%d body=%q", resp.StatusCode, b)
+	}
+	return nil
+}
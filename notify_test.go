@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// telegramStub answers Bot API calls with status and counts them
+type telegramStub struct {
+	status int
+	calls  int
+}
+
+func (s *telegramStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.calls++
+	return &http.Response{StatusCode: s.status, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+// closedPort returns a local port with nothing listening on it
+func closedPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestNotifyFailingChannel(t *testing.T) {
+	tempAppDir(t)
+	stub := &telegramStub{status: http.StatusInternalServerError}
+	client := &http.Client{Transport: stub}
+	cfg := NotifyConfig{
+		Telegram: TelegramConfig{BotToken: "token", ChatID: "1"},
+		Email:    EmailConfig{Host: "127.0.0.1", Port: closedPort(t), To: []string{"me@example.com"}},
+	}
+	today := time.Now().Format("02 Jan 2006")
+	results := []CompanyResult{{Company: "TCS", RevenueNums: []float64{100}, NetProfitNums: []float64{10}}}
+
+	// nothing delivered: both channels report and the alert stays pending
+	err := Notify(client, cfg, nil, zeroBaseNA, today, results, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "telegram") || !strings.Contains(err.Error(), "email") {
+		t.Fatalf("err = %v, want both the telegram and the email failure", err)
+	}
+	if stub.calls != 1 {
+		t.Fatalf("telegram called %d times, want 1", stub.calls)
+	}
+
+	// telegram recovers while email still fails: the alert is sent and recorded
+	stub.status = http.StatusOK
+	if err := Notify(client, cfg, nil, zeroBaseNA, today, results, nil, ""); err == nil || !strings.Contains(err.Error(), "email") {
+		t.Fatalf("err = %v, want the email failure", err)
+	}
+	if stub.calls != 2 {
+		t.Fatalf("telegram called %d times, want 2", stub.calls)
+	}
+
+	// the next poll finds nothing new, so the broken channel doesn't re-send it
+	if err := Notify(client, cfg, nil, zeroBaseNA, today, results, nil, ""); err != nil {
+		t.Fatalf("err = %v, want nil once the alert is recorded", err)
+	}
+	if stub.calls != 2 {
+		t.Errorf("telegram called %d times after the alert was recorded, want 2", stub.calls)
+	}
+}
+
+func TestNotifyNothingSent(t *testing.T) {
+	tempAppDir(t)
+	stub := &telegramStub{status: http.StatusInternalServerError}
+	client := &http.Client{Transport: stub}
+	// SMS only texts about the watchlist, which TCS isn't on
+	cfg := NotifyConfig{
+		Telegram: TelegramConfig{BotToken: "token", ChatID: "1"},
+		SMS:      SMSConfig{Provider: "twilio", AccountSID: "AC1", AuthToken: "secret", From: "+10000000000", To: []string{"+910000000000"}},
+	}
+	today := time.Now().Format("02 Jan 2006")
+	results := []CompanyResult{{Company: "TCS", RevenueNums: []float64{100, 50}, NetProfitNums: []float64{10, 5}}}
+
+	if err := Notify(client, cfg, []string{"INFY"}, zeroBaseNA, today, results, nil, ""); err == nil || !strings.Contains(err.Error(), "telegram") {
+		t.Fatalf("err = %v, want the telegram failure", err)
+	}
+	// SMS had nothing to send, so the alert is still pending for telegram
+	stub.status = http.StatusOK
+	if err := Notify(client, cfg, []string{"INFY"}, zeroBaseNA, today, results, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if stub.calls != 2 {
+		t.Errorf("telegram called %d times, want the retry", stub.calls)
+	}
+}
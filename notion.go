@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+const notionVersion = "2022-06-28"
+
+// PushToNotion creates one page per row in the configured Notion database.
+// The database needs these properties: Name (title), Date (date), Long name, Sector,
+// Quarter (text), Revenue, Net profit, Rev %Δ, NP %Δ (number) and Report (url).
+func PushToNotion(client *http.Client, cfg NotionConfig, rows []ExportRow, reportURL string) error {
+	if cfg.ReportURL != "" {
+		reportURL = cfg.ReportURL
+	}
+	failed := 0
+	for i, r := range rows {
+		if i > 0 {
+			// Notion allows ~3 requests/second per integration
+			time.Sleep(350 * time.Millisecond)
+		}
+		if err := createNotionPage(client, cfg, r, reportURL); err != nil {
+			log.Printf("PushToNotion: %s: %v", r.Company, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notion pages failed", failed, len(rows))
+	}
+	return nil
+}
+
+func createNotionPage(client *http.Client, cfg NotionConfig, r ExportRow, reportURL string) error {
+	text := func(s string) map[string]interface{} {
+		return map[string]interface{}{"rich_text": []interface{}{map[string]interface{}{"text": map[string]string{"content": s}}}}
+	}
+	number := func(v float64) map[string]interface{} {
+		if math.IsNaN(v) {
+			return map[string]interface{}{"number": nil}
+		}
+		return map[string]interface{}{"number": math.Round(v*100) / 100}
+	}
+	props := map[string]interface{}{
+		"Name":       map[string]interface{}{"title": []interface{}{map[string]interface{}{"text": map[string]string{"content": r.Company}}}},
+		"Date":       map[string]interface{}{"date": map[string]string{"start": r.Date}},
+		"Long name":  text(r.LongName),
+		"Sector":     text(r.Sector),
+		"Quarter":    text(r.Quarter),
+		"Revenue":    number(r.Revenue),
+		"Net profit": number(r.NetProfit),
+		"Rev %Δ":     number(r.RevPct),
+		"NP %Δ":      number(r.NPPct),
+	}
+	if reportURL != "" {
+		props["Report"] = map[string]interface{}{"url": reportURL}
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"parent":     map[string]string{"database_id": cfg.DatabaseID},
+		"properties": props,
+	})
+	req, _ := http.NewRequest("POST", "https://api.notion.com/v1/pages", bytes.NewReader(payload))
+	req.Header.Set("authorization", "Bearer "+cfg.Token)
+	req.Header.Set("notion-version", notionVersion)
+	req.Header.Set("content-type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status=%d body=%q", resp.StatusCode, b)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+)
+
+// outlier policies for the summary averages (see OutlierConfig)
+const (
+	outlierTrim      = "trim"
+	outlierWinsorize = "winsorize"
+	outlierNone      = "none"
+
+	defaultOutlierLimitPct = 500
+)
+
+// OutlierConfig sets how extreme %Δ values, typically off a near-zero base, enter the
+// summary averages: Policy "trim" (default) leaves values beyond ±LimitPct out,
+// "winsorize" clamps them to ±LimitPct and "none" averages them as they are
+type OutlierConfig struct {
+	Policy   string  `json:"policy"`
+	LimitPct float64 `json:"limit_pct"`
+}
+
+// orDefaults fills in the default policy and limit, so a zero OutlierConfig trims
+func (c OutlierConfig) orDefaults() OutlierConfig {
+	if c.Policy == "" {
+		c.Policy = outlierTrim
+	}
+	if c.LimitPct <= 0 {
+		c.LimitPct = defaultOutlierLimitPct
+	}
+	return c
+}
+
+// checkOutlierPolicy validates an outlier policy name
+func checkOutlierPolicy(p string) error {
+	switch p {
+	case outlierTrim, outlierWinsorize, outlierNone:
+		return nil
+	}
+	return fmt.Errorf("unknown policy %q (want %s, %s or %s)", p, outlierTrim, outlierWinsorize, outlierNone)
+}
+
+// outlier is a %Δ value the policy trimmed or clamped
+type outlier struct {
+	Company string
+	Metric  string // "Rev" or "NP"
+	Pct     float64
+}
+
+// average returns the mean of the non-NaN pcts under the policy, how many values it
+// is taken over, and the values beyond the limit; pcts is aligned with companies
+func (c OutlierConfig) average(metric string, companies []string, pcts []float64) (avg float64, n int, outliers []outlier) {
+	c = c.orDefaults()
+	sum := 0.0
+	for i, p := range pcts {
+		if math.IsNaN(p) {
+			continue
+		}
+		if c.Policy != outlierNone && math.Abs(p) > c.LimitPct {
+			outliers = append(outliers, outlier{Company: companies[i], Metric: metric, Pct: p})
+			if c.Policy == outlierTrim {
+				continue
+			}
+			p = math.Copysign(c.LimitPct, p)
+		}
+		sum += p
+		n++
+	}
+	if n == 0 {
+		return math.NaN(), 0, outliers
+	}
+	return sum / float64(n), n, outliers
+}
+
+// writeOutliers lists the values the policy trimmed or clamped, largest first
+func (c OutlierConfig) writeOutliers(sb *strings.Builder, outliers []outlier) {
+	if len(outliers) == 0 {
+		return
+	}
+	c = c.orDefaults()
+	sort.SliceStable(outliers, func(i, j int) bool { return math.Abs(outliers[i].Pct) > math.Abs(outliers[j].Pct) })
+	how := "left out of"
+	if c.Policy == outlierWinsorize {
+		how = fmt.Sprintf("clamped to ±%g%% in", c.LimitPct)
+	}
+	parts := make([]string, len(outliers))
+	for i, o := range outliers {
+		parts[i] = html.EscapeString(o.Company) + " " + o.Metric + " " + fmt.Sprintf("%+.2f%%", o.Pct)
+	}
+	sb.WriteString(fmt.Sprintf("<p class='small' id='outliers'><strong>Outliers (|%%Δ| &gt; %g%%, %s the averages above):</strong> ", c.LimitPct, how))
+	sb.WriteString(strings.Join(parts, ", ") + "</p>")
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// the Parquet format constants used here (parquet.thrift)
+const (
+	parquetInt32     = 1
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetConvertedUTF8 = 0
+	parquetConvertedDate = 6
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip     = 2
+	parquetDataPage = 0
+)
+
+// writeParquet writes rows as a Parquet file of one row group, one gzip-compressed PLAIN
+// page per column. Values follow cols: strings for colString, ISO date strings for
+// colDate, float64 for colDouble; nil is null and only allowed in nullable columns.
+func writeParquet(w io.Writer, cols []dataColumn, rows [][]interface{}) error {
+	type chunk struct {
+		offset, size, rawSize int64
+	}
+	var chunks []chunk
+	offset := int64(4)
+	if _, err := io.WriteString(w, "PAR1"); err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		for i, col := range cols {
+			page, err := parquetPage(col, i, rows)
+			if err != nil {
+				return err
+			}
+			var zipped bytes.Buffer
+			zw := gzip.NewWriter(&zipped)
+			zw.Write(page)
+			zw.Close()
+
+			h := newCompactWriter()
+			h.i32(1, parquetDataPage)
+			h.i32(2, int32(len(page)))
+			h.i32(3, int32(zipped.Len()))
+			h.begin(5)
+			h.i32(1, int32(len(rows)))
+			h.i32(2, parquetPlain)
+			h.i32(3, parquetRLE)
+			h.i32(4, parquetRLE)
+			h.end()
+			h.end()
+			if _, err := w.Write(h.b); err != nil {
+				return err
+			}
+			if _, err := w.Write(zipped.Bytes()); err != nil {
+				return err
+			}
+			c := chunk{offset, int64(len(h.b) + zipped.Len()), int64(len(h.b) + len(page))}
+			chunks = append(chunks, c)
+			offset += c.size
+		}
+	}
+
+	m := newCompactWriter()
+	m.i32(1, 1)
+	m.list(2, 12, len(cols)+1)
+	m.elem()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(cols)))
+	m.end()
+	for _, col := range cols {
+		m.elem()
+		m.i32(1, parquetPhysical(col.typ))
+		if col.nullable {
+			m.i32(3, parquetOptional)
+		} else {
+			m.i32(3, parquetRequired)
+		}
+		m.binary(4, col.name)
+		switch col.typ {
+		case colString:
+			m.i32(6, parquetConvertedUTF8)
+			m.begin(10)
+			m.begin(1) // StringType
+			m.end()
+			m.end()
+		case colDate:
+			m.i32(6, parquetConvertedDate)
+			m.begin(10)
+			m.begin(6) // DateType
+			m.end()
+			m.end()
+		}
+		m.end()
+	}
+	m.i64(3, int64(len(rows)))
+	if len(rows) == 0 {
+		m.list(4, 12, 0)
+	} else {
+		m.list(4, 12, 1)
+		m.elem()
+		m.list(1, 12, len(cols))
+		var total int64
+		for i, col := range cols {
+			c := chunks[i]
+			total += c.rawSize
+			m.elem()
+			m.i64(2, c.offset)
+			m.begin(3)
+			m.i32(1, parquetPhysical(col.typ))
+			m.list(2, 5, 2)
+			m.rawI32(parquetPlain)
+			m.rawI32(parquetRLE)
+			m.list(3, 8, 1)
+			m.rawBinary(col.name)
+			m.i32(4, parquetGzip)
+			m.i64(5, int64(len(rows)))
+			m.i64(6, c.rawSize)
+			m.i64(7, c.size)
+			m.i64(9, c.offset)
+			m.end()
+			m.end()
+		}
+		m.i64(2, total)
+		m.i64(3, int64(len(rows)))
+		m.end()
+	}
+	m.binary(6, "quarter-compare")
+	m.end()
+
+	if _, err := w.Write(m.b); err != nil {
+		return err
+	}
+	tail := binary.LittleEndian.AppendUint32(nil, uint32(len(m.b)))
+	_, err := w.Write(append(tail, "PAR1"...))
+	return err
+}
+
+// parquetPhysical is the physical type a column is stored as
+func parquetPhysical(t columnType) int32 {
+	switch t {
+	case colDate:
+		return parquetInt32
+	case colDouble:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// parquetPage encodes column i of rows as an uncompressed data page: the definition
+// levels (nullable columns only) followed by the PLAIN values of the non-null rows
+func parquetPage(col dataColumn, i int, rows [][]interface{}) ([]byte, error) {
+	var vals []byte
+	defined := make([]bool, len(rows))
+	for n, row := range rows {
+		v := row[i]
+		if v == nil {
+			if !col.nullable {
+				return nil, fmt.Errorf("parquet: row %d: %s is empty", n+1, col.name)
+			}
+			continue
+		}
+		defined[n] = true
+		switch col.typ {
+		case colString:
+			s := fmt.Sprint(v)
+			vals = binary.LittleEndian.AppendUint32(vals, uint32(len(s)))
+			vals = append(vals, s...)
+		case colDate:
+			t, err := time.Parse("2006-01-02", fmt.Sprint(v))
+			if err != nil {
+				return nil, fmt.Errorf("parquet: row %d: %s: %v", n+1, col.name, err)
+			}
+			vals = binary.LittleEndian.AppendUint32(vals, uint32(int32(t.Unix()/86400)))
+		case colDouble:
+			f, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("parquet: row %d: %s is not a number", n+1, col.name)
+			}
+			vals = binary.LittleEndian.AppendUint64(vals, math.Float64bits(f))
+		}
+	}
+	if !col.nullable {
+		return vals, nil
+	}
+	// definition levels (bit width 1) as a single bit-packed run of the RLE hybrid encoding
+	groups := (len(rows) + 7) / 8
+	levels := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups)
+	for n, ok := range defined {
+		if ok {
+			packed[n/8] |= 1 << (n % 8)
+		}
+	}
+	levels = append(levels, packed...)
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	return append(append(page, levels...), vals...), nil
+}
+
+// compactWriter encodes Thrift structs in the compact protocol, which Parquet uses for
+// its page headers and footer. Nested structs and list elements are opened with begin or
+// elem and closed with end.
+type compactWriter struct {
+	b    []byte
+	last []int // the last field id of each open struct
+}
+
+func newCompactWriter() *compactWriter {
+	return &compactWriter{last: []int{0}}
+}
+
+// field writes a field header, as a delta from the previous field id where it fits
+func (w *compactWriter) field(id int, typ byte) {
+	top := len(w.last) - 1
+	if d := id - w.last[top]; d > 0 && d <= 15 {
+		w.b = append(w.b, byte(d)<<4|typ)
+	} else {
+		w.b = append(w.b, typ)
+		w.b = binary.AppendVarint(w.b, int64(id))
+	}
+	w.last[top] = id
+}
+
+func (w *compactWriter) i32(id int, v int32) {
+	w.field(id, 5)
+	w.rawI32(v)
+}
+
+func (w *compactWriter) i64(id int, v int64) {
+	w.field(id, 6)
+	w.b = binary.AppendVarint(w.b, v)
+}
+
+func (w *compactWriter) binary(id int, s string) {
+	w.field(id, 8)
+	w.rawBinary(s)
+}
+
+// rawI32 and rawBinary write list elements
+func (w *compactWriter) rawI32(v int32) {
+	w.b = binary.AppendVarint(w.b, int64(v))
+}
+
+func (w *compactWriter) rawBinary(s string) {
+	w.b = binary.AppendUvarint(w.b, uint64(len(s)))
+	w.b = append(w.b, s...)
+}
+
+// list writes the header of a list of n elements of type elem
+func (w *compactWriter) list(id int, elem byte, n int) {
+	w.field(id, 9)
+	if n < 15 {
+		w.b = append(w.b, byte(n)<<4|elem)
+	} else {
+		w.b = append(w.b, 0xF0|elem)
+		w.b = binary.AppendUvarint(w.b, uint64(n))
+	}
+}
+
+// begin opens a struct field, elem a struct list element
+func (w *compactWriter) begin(id int) {
+	w.field(id, 12)
+	w.elem()
+}
+
+func (w *compactWriter) elem() {
+	w.last = append(w.last, 0)
+}
+
+// end closes the innermost struct
+func (w *compactWriter) end() {
+	w.b = append(w.b, 0)
+	w.last = w.last[:len(w.last)-1]
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes the Thrift compact protocol into maps of field id to value: int64
+// for the integer types, []byte for binary, []interface{} for lists and map[int]interface{}
+// for structs. It is the reading half of compactWriter, for checking what it wrote.
+type thriftReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.b) {
+		r.fail("unexpected end")
+		return 0
+	}
+	r.pos++
+	return r.b[r.pos-1]
+}
+
+func (r *thriftReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("offset %d: %s", r.pos, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[min(r.pos, len(r.b)):])
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.varint()
+	case 7:
+		if r.pos+8 > len(r.b) {
+			r.fail("short double")
+			return 0.0
+		}
+		r.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.b[r.pos-8:]))
+	case 8:
+		n := int(r.uvarint())
+		if r.pos+n > len(r.b) {
+			r.fail("short binary")
+			return []byte(nil)
+		}
+		r.pos += n
+		return r.b[r.pos-n : r.pos]
+	case 9, 10:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			list = append(list, r.value(h&0x0F))
+		}
+		return list
+	case 12:
+		s := map[int]interface{}{}
+		last := 0
+		for r.err == nil {
+			h := r.byte()
+			if h == 0 {
+				break
+			}
+			id := last + int(h>>4)
+			if h>>4 == 0 {
+				id = int(r.varint())
+			}
+			last = id
+			s[id] = r.value(h & 0x0F)
+		}
+		return s
+	}
+	r.fail("unsupported type %d", typ)
+	return nil
+}
+
+// readThriftStruct decodes one struct from the start of b, returning it and its length
+func readThriftStruct(b []byte) (map[int]interface{}, int, error) {
+	r := &thriftReader{b: b}
+	s := r.value(12).(map[int]interface{})
+	return s, r.pos, r.err
+}
+
+// parquetFile is a file written by writeParquet, decoded
+type parquetFile struct {
+	schema  []map[int]interface{}
+	numRows int64
+	rows    [][]interface{}
+}
+
+// readParquet checks the framing of a Parquet file and decodes it: the footer, the schema
+// and the column chunks of its row group, back into rows of string, float64 and nil.
+// Dates come back as ISO strings.
+func readParquet(b []byte) (*parquetFile, error) {
+	if len(b) < 12 || string(b[:4]) != "PAR1" || string(b[len(b)-4:]) != "PAR1" {
+		return nil, fmt.Errorf("no PAR1 magic at both ends")
+	}
+	flen := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	start := len(b) - 8 - flen
+	if start < 4 {
+		return nil, fmt.Errorf("footer length %d past the start of the file", flen)
+	}
+	meta, n, err := readThriftStruct(b[start : len(b)-8])
+	if err != nil {
+		return nil, fmt.Errorf("footer: %v", err)
+	}
+	if n != flen {
+		return nil, fmt.Errorf("footer decodes to %d bytes, length says %d", n, flen)
+	}
+	f := &parquetFile{numRows: meta[3].(int64)}
+	for _, e := range meta[2].([]interface{}) {
+		f.schema = append(f.schema, e.(map[int]interface{}))
+	}
+	cols := f.schema[1:]
+	f.rows = make([][]interface{}, f.numRows)
+	for i := range f.rows {
+		f.rows[i] = make([]interface{}, len(cols))
+	}
+	groups := meta[4].([]interface{})
+	if f.numRows == 0 {
+		return f, nil
+	}
+	if len(groups) != 1 {
+		return nil, fmt.Errorf("%d row groups, want 1", len(groups))
+	}
+	chunks := groups[0].(map[int]interface{})[1].([]interface{})
+	if len(chunks) != len(cols) {
+		return nil, fmt.Errorf("%d column chunks for %d columns", len(chunks), len(cols))
+	}
+	for c, chunk := range chunks {
+		md := chunk.(map[int]interface{})[3].(map[int]interface{})
+		off, size := int(md[9].(int64)), int(md[7].(int64))
+		if off < 4 || off+size > start {
+			return nil, fmt.Errorf("column %d: chunk %d+%d outside the data", c, off, size)
+		}
+		header, hlen, err := readThriftStruct(b[off : off+size])
+		if err != nil {
+			return nil, fmt.Errorf("column %d: page header: %v", c, err)
+		}
+		if int(header[3].(int64)) != size-hlen {
+			return nil, fmt.Errorf("column %d: page of %d bytes in a chunk of %d", c, header[3], size-hlen)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(b[off+hlen : off+size]))
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %v", c, err)
+		}
+		page, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %v", c, err)
+		}
+		if len(page) != int(header[2].(int64)) {
+			return nil, fmt.Errorf("column %d: page inflates to %d bytes, header says %d", c, len(page), header[2])
+		}
+		defined := make([]bool, f.numRows)
+		for i := range defined {
+			defined[i] = true
+		}
+		if cols[c][3].(int64) == parquetOptional {
+			// a single bit-packed run of definition levels
+			llen := int(binary.LittleEndian.Uint32(page))
+			levels := page[4 : 4+llen]
+			h, n := binary.Uvarint(levels)
+			if h&1 != 1 || int(h>>1) != (int(f.numRows)+7)/8 {
+				return nil, fmt.Errorf("column %d: run header %d", c, h)
+			}
+			for i := range defined {
+				defined[i] = levels[n+i/8]&(1<<(i%8)) != 0
+			}
+			page = page[4+llen:]
+		}
+		for i := range f.rows {
+			if !defined[i] {
+				continue
+			}
+			switch cols[c][1].(int64) {
+			case parquetByteArray:
+				l := int(binary.LittleEndian.Uint32(page))
+				f.rows[i][c], page = string(page[4:4+l]), page[4+l:]
+			case parquetInt32:
+				days := int32(binary.LittleEndian.Uint32(page))
+				f.rows[i][c], page = time.Unix(int64(days)*86400, 0).UTC().Format("2006-01-02"), page[4:]
+			case parquetDouble:
+				f.rows[i][c], page = math.Float64frombits(binary.LittleEndian.Uint64(page)), page[8:]
+			}
+		}
+		if len(page) != 0 {
+			return nil, fmt.Errorf("column %d: %d bytes left over", c, len(page))
+		}
+	}
+	return f, nil
+}
+
+func TestWriteParquet(t *testing.T) {
+	var rows [][]interface{}
+	for _, run := range loadFixture(t) {
+		for _, row := range BuildQuarterRows(run.Date, run.Results) {
+			rows = append(rows, row.Values())
+		}
+	}
+	// nulls in every nullable column, and text beyond ASCII
+	rows = append(rows, []interface{}{"2024-07-12", "NEWCO", "Nouvelle Société ₹", "", "Jun 2024", nil, nil, -0.5})
+	if len(rows) < 9 {
+		t.Fatalf("fixture has %d quarter rows, want more than a byte of definition levels", len(rows))
+	}
+
+	var buf bytes.Buffer
+	if err := writeParquet(&buf, quarterColumns, rows); err != nil {
+		t.Fatal(err)
+	}
+	f, err := readParquet(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.schema[0][4] == nil || string(f.schema[0][4].([]byte)) != "schema" || f.schema[0][5].(int64) != int64(len(quarterColumns)) {
+		t.Errorf("root schema element = %v", f.schema[0])
+	}
+	for i, col := range quarterColumns {
+		e := f.schema[i+1]
+		wantRep := int64(parquetRequired)
+		if col.nullable {
+			wantRep = parquetOptional
+		}
+		if string(e[4].([]byte)) != col.name || e[1].(int64) != int64(parquetPhysical(col.typ)) || e[3].(int64) != wantRep {
+			t.Errorf("schema element %d = %v, want %s", i+1, e, col.name)
+		}
+		var converted interface{}
+		switch col.typ {
+		case colString:
+			converted = int64(parquetConvertedUTF8)
+		case colDate:
+			converted = int64(parquetConvertedDate)
+		}
+		if e[6] != converted {
+			t.Errorf("%s: converted type %v, want %v", col.name, e[6], converted)
+		}
+	}
+	if f.numRows != int64(len(rows)) {
+		t.Errorf("num_rows = %d, want %d", f.numRows, len(rows))
+	}
+	if !reflect.DeepEqual(f.rows, rows) {
+		for i := range rows {
+			if !reflect.DeepEqual(f.rows[i], rows[i]) {
+				t.Errorf("row %d = %v, want %v", i, f.rows[i], rows[i])
+			}
+		}
+	}
+
+	// no rows: the schema alone, without a row group
+	buf.Reset()
+	if err := writeParquet(&buf, quarterColumns, nil); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := readParquet(buf.Bytes()); err != nil || f.numRows != 0 || len(f.schema) != len(quarterColumns)+1 {
+		t.Errorf("empty file: %v, %+v", err, f)
+	}
+
+	// a null in a required column is refused
+	bad := append([]interface{}{}, rows[0]...)
+	bad[1] = nil
+	if err := writeParquet(io.Discard, quarterColumns, [][]interface{}{bad}); err == nil || !strings.Contains(err.Error(), "company is empty") {
+		t.Errorf("null company: err = %v", err)
+	}
+}
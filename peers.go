@@ -0,0 +1,114 @@
+package main
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+)
+
+// peerRow is one member of a peer group in the peer section: its result of the run, else
+// its latest stored one (Date says from which run); Result is nil when neither exists
+type peerRow struct {
+	Member   string
+	Result   *CompanyResult
+	Date     string // run the result is from, empty for the current run
+	Reported bool   // reported in the current run
+}
+
+// isPeer reports whether r is the configured peer member (a BSE short name, NSE symbol or
+// scrip code)
+func isPeer(member string, r CompanyResult) bool {
+	return inWatchlist([]string{member}, r.Company, r.NSESymbol, r.ScripCode)
+}
+
+// peerRows finds every member of a peer group in results, else in history (newest first)
+func peerRows(members []string, results []CompanyResult, history []RunRecord) []peerRow {
+	rows := make([]peerRow, 0, len(members))
+	for _, m := range members {
+		row := peerRow{Member: m}
+		for i := range results {
+			if isPeer(m, results[i]) {
+				row.Result, row.Reported = &results[i], true
+				break
+			}
+		}
+		for _, run := range history {
+			if row.Result != nil {
+				break
+			}
+			for i := range run.Results {
+				if isPeer(m, run.Results[i]) {
+					row.Result, row.Date = &run.Results[i], run.Date
+					break
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// writePeerSection writes a comparison table for every configured peer group with a
+// member in results: each member's latest quarter, growth, margin and P/E, from the run
+// when it reported in it, else from its latest stored run (history, newest first), with the
+// group median below. Groups are in name order; growth follows the zero_base policy.
+func writePeerSection(sb *strings.Builder, results []CompanyResult, peers map[string][]string, history []RunRecord, zeroBase string) {
+	names := make([]string, 0, len(peers))
+	for name, members := range peers {
+		for _, r := range results {
+			if inWatchlist(members, r.Company, r.NSESymbol, r.ScripCode) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	pct := func(g growth) string {
+		return "<td class='" + g.class() + "' title='" + html.EscapeString(g.title()) + "'>" + html.EscapeString(g.String()) + "</td>"
+	}
+	sb.WriteString("<div id='peers' class='summary'><h3>Peer groups</h3>")
+	for _, name := range names {
+		rows := peerRows(peers[name], results, history)
+		sb.WriteString("<h4>" + html.EscapeString(name) + "</h4>")
+		sb.WriteString("<table class='peer-table' style='width:auto'><thead><tr><th>Company</th><th>Quarter</th><th>As of</th><th>Revenue</th><th>Rev %Δ</th><th>Net profit</th><th>NP %Δ</th><th>NP margin</th><th>P/E</th></tr></thead><tbody>")
+		var revPcts, npPcts, margins []float64
+		for _, row := range rows {
+			if row.Result == nil {
+				sb.WriteString("<tr><td class='left'>" + html.EscapeString(row.Member) + "</td><td colspan='8' class='small'>no stored result</td></tr>")
+				continue
+			}
+			r := *row.Result
+			rev, np := latestGrowth(r, zeroBase)
+			margin := math.NaN()
+			if rev.Curr > 0 && !math.IsNaN(np.Curr) {
+				margin = np.Curr / rev.Curr * 100
+			}
+			revPcts, npPcts, margins = append(revPcts, rev.Pct), append(npPcts, np.Pct), append(margins, margin)
+			company := html.EscapeString(r.Company)
+			asOf := "this run"
+			if row.Reported {
+				company = "<a href='#" + rowAnchor(r.Company) + "'><b>" + company + "</b></a>"
+			} else {
+				asOf = row.Date
+			}
+			sb.WriteString("<tr><td class='left'>" + company + "</td><td>" + html.EscapeString(seasonOf(r)) + "</td><td class='small'>" + html.EscapeString(asOf) + "</td>")
+			sb.WriteString("<td>" + formatCr(rev.Curr) + "</td>" + pct(rev))
+			sb.WriteString("<td>" + formatCr(np.Curr) + "</td>" + pct(np))
+			sb.WriteString("<td>" + formatPct(margin) + "</td>")
+			pe := Valuate(r).PE
+			sb.WriteString("<td>" + formatMultiple(pe) + "</td></tr>")
+		}
+		medRev, medNP, medMargin := quantile(validSorted(revPcts), 0.5), quantile(validSorted(npPcts), 0.5), quantile(validSorted(margins), 0.5)
+		sb.WriteString("<tr><td class='left'><i>Median</i></td><td></td><td></td><td></td>")
+		sb.WriteString("<td class='" + medianClass(medRev) + "'>" + fmtPct(medRev) + "</td><td></td>")
+		sb.WriteString("<td class='" + medianClass(medNP) + "'>" + fmtPct(medNP) + "</td>")
+		sb.WriteString("<td>" + formatPct(medMargin) + "</td><td></td></tr>")
+		sb.WriteString("</tbody></table>")
+	}
+	sb.WriteString("<p class='small'>Members that did not report in this run show their latest stored result; companies in bold reported in it. Groups come from <code>peers</code> in the config.</p></div>")
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The trendlyne source runs as a staged pipeline: resolve → fetch → parse → enrich.
+// Stages are connected by bounded channels, so a slow stage pushes back on the ones
+// before it instead of piling up work, and each stage has its own worker count and
+// counters. A job that fails in one stage is passed through the rest untouched.
+
+// pipelineJob is one company on its way through the pipeline
+type pipelineJob struct {
+	itm    BSEItem
+	key    string // symbol cache key
+	cached bool   // the trendlyne mapping came from the symbol cache
+
+	tr       TrendItem
+	pageURL  string
+	fundURL  string
+	page     *TrendPage // scraped for the fundamentals URL, nil when the mapping was cached
+	fundRoot map[string]interface{}
+	cr       CompanyResult
+
+	err error
+}
+
+// runDate is the day the job's results belong to (2006-01-02): the meeting day, else today
+func (j *pipelineJob) runDate() string {
+	if j.itm.MeetingDate != "" {
+		return isoDate(j.itm.MeetingDate)
+	}
+	return time.Now().Format("2006-01-02")
+}
+
+// resolveStep finds the company page and fundamentals URL, from the symbol cache when possible
+func resolveStep(client *http.Client, cfg Config, caches lookupCaches, j *pipelineJob) error {
+	if e, ok := caches.symbols.get(j.key); ok {
+		j.cached = true
+		j.pageURL, j.fundURL = e.PageURL, e.FundURL
+		j.tr.Match = e.Match
+		return nil
+	}
+	tr, err := ResolveTrendItem(client, j.itm)
+	if err != nil {
+		return fmt.Errorf("trendlyne search: %v", err)
+	}
+	j.tr = tr
+	j.pageURL = tr.NextURL
+	if j.pageURL == "" {
+		j.pageURL = fmt.Sprintf("https://trendlyne.com/equity/%d/%s/%s/", tr.K, tr.ID, tr.SlugName)
+	}
+	raw := rawWriter(cfg, j.runDate(), j.itm.ShortName, "page.html")
+	defer raw.Close()
+	page, err := ScanTrendPage(client, j.pageURL, cfg.maxBody(), raw.writer(), httpValidators{})
+	if err != nil {
+		return fmt.Errorf("trendlyne page: %v", err)
+	}
+	if page.FundURL == "" {
+		return errors.New("trendlyne page: data-tablesurl not found")
+	}
+	j.fundURL, j.page = page.FundURL, &page
+	return nil
+}
+
+// fetchStep downloads the fundamentals JSON
+func fetchStep(client *http.Client, cfg Config, j *pipelineJob) error {
+	raw := rawWriter(cfg, j.runDate(), j.itm.ShortName, "fundamentals.json")
+	defer raw.Close()
+	root, err := FetchFundamentals(client, j.fundURL, j.pageURL, cfg.maxBody(), raw.writer())
+	if err != nil {
+		return fmt.Errorf("fundamentals: %v", err)
+	}
+	j.fundRoot = root
+	return nil
+}
+
+// parseStep extracts the last 4 quarters from the fundamentals JSON
+func parseStep(cfg Config, j *pipelineJob) error {
+	cr := ParseFundamentalsRoot(j.itm.ShortName, j.fundRoot, cfg.metricRegistry(), cfg.AsOf)
+	if !hasAnyValue(cr) {
+		return fmt.Errorf("fundamentals: no usable values: %s", strings.Join(cr.Issues, "; "))
+	}
+	cr.LongName = j.itm.LongName
+	cr.Match = j.tr.Match
+	j.cr = cr
+	j.fundRoot = nil // no longer needed, don't hold it while later stages run
+	return nil
+}
+
+// enrichStep attaches the company metadata, checking the page again when the cached
+// metadata is older than metaRefresh (a conditional request, so an unchanged page is a
+// 304), and records a fresh mapping in the symbol cache. Metadata is best effort and
+// never fails the job.
+func enrichStep(client *http.Client, cfg Config, caches lookupCaches, j *pipelineJob) error {
+	if j.page != nil {
+		longName := j.itm.LongName
+		if longName == "" {
+			longName = j.tr.Label
+		}
+		prev, _, _ := caches.meta.get(j.key)
+		m := pageMeta(*j.page, longName).since(prev)
+		m.apply(&j.cr)
+		caches.meta.put(j.key, m)
+		caches.symbols.put(j.key, symbolEntry{TrendID: j.tr.ID, K: j.tr.K, Slug: j.tr.SlugName, PageURL: j.pageURL, FundURL: j.fundURL, Match: j.tr.Match})
+		return nil
+	}
+	m, ok, fresh := caches.meta.get(j.key)
+	if !fresh {
+		page, err := ScanTrendPage(client, j.pageURL, cfg.maxBody(), nil, m.Validators)
+		switch {
+		case err == nil:
+			m = pageMeta(page, m.LongName).since(m)
+			caches.meta.put(j.key, m)
+		case errors.Is(err, errNotModified) && ok:
+			caches.meta.put(j.key, m) // still current for another metaRefresh
+		case ok:
+			log.Printf("enrichStep: refresh metadata for %s: %v (using cached)", j.itm.ShortName, err)
+		default:
+			log.Printf("enrichStep: metadata for %s: %v", j.itm.ShortName, err)
+		}
+	}
+	m.apply(&j.cr)
+	return nil
+}
+
+// runSteps runs every step for one job in order, stopping at the first error
+func runSteps(client *http.Client, cfg Config, caches lookupCaches, j *pipelineJob) error {
+	steps := []func() error{
+		func() error { return resolveStep(client, cfg, caches, j) },
+		func() error { return fetchStep(client, cfg, j) },
+		func() error { return parseStep(cfg, j) },
+		func() error { return enrichStep(client, cfg, caches, j) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageStats are the counters of one pipeline stage
+type stageStats struct {
+	processed atomic.Int64
+	failed    atomic.Int64
+	busy      atomic.Int64 // ns spent running the step, summed over workers
+	blocked   atomic.Int64 // ns spent waiting for the next stage to accept a job
+	maxQueue  atomic.Int64 // deepest input queue seen
+}
+
+// pipelineStage is one stage: workers running step on every job from the input channel
+type pipelineStage struct {
+	name     string
+	workers  int
+	step     func(*pipelineJob) error
+	deadline time.Time // jobs reaching the stage after it are failed with errOutOfTime
+	stats    stageStats
+}
+
+// run starts the stage's workers; out is closed once in is drained
+func (s *pipelineStage) run(in <-chan *pipelineJob, out chan<- *pipelineJob) {
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range in {
+				if q := int64(len(in)); q > s.stats.maxQueue.Load() {
+					s.stats.maxQueue.Store(q) // racy max, good enough for a diagnostic
+				}
+				if j.err == nil && pastDeadline(s.deadline) {
+					j.err = errOutOfTime
+				}
+				if j.err == nil {
+					start := time.Now()
+					j.err = s.step(j)
+					s.stats.busy.Add(int64(time.Since(start)))
+					s.stats.processed.Add(1)
+					if j.err != nil {
+						s.stats.failed.Add(1)
+					}
+				}
+				start := time.Now()
+				out <- j
+				s.stats.blocked.Add(int64(time.Since(start)))
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+}
+
+// String summarises the stage for the end-of-run log
+func (s *pipelineStage) String() string {
+	return fmt.Sprintf("%s: %d workers, %d done, %d failed, busy %s, blocked %s, max queue %d",
+		s.name, s.workers, s.stats.processed.Load(), s.stats.failed.Load(),
+		time.Duration(s.stats.busy.Load()).Round(time.Millisecond),
+		time.Duration(s.stats.blocked.Load()).Round(time.Millisecond), s.stats.maxQueue.Load())
+}
+
+// runPipeline pushes items through the trendlyne pipeline and returns the results, the
+// items that failed and those the deadline cut off. Source plugins get their turn on the
+// failed ones in the retry pass. A failed job whose mapping came from the symbol cache has
+// the mapping dropped, so the retry pass resolves the company afresh.
+func runPipeline(client *http.Client, cfg Config, caches lookupCaches, items []BSEItem, deadline time.Time) (results []CompanyResult, failed, outOfTime []BSEItem) {
+	pc := cfg.Pipeline
+	workers := func(n, def int) int {
+		if n > 0 {
+			return n
+		}
+		return max(1, def)
+	}
+	buffer := workers(pc.Buffer, cfg.Concurrency)
+	stages := []*pipelineStage{
+		{name: "resolve", workers: workers(pc.ResolveWorkers, cfg.Concurrency),
+			step: func(j *pipelineJob) error { return resolveStep(client, cfg, caches, j) }},
+		{name: "fetch", workers: workers(pc.FetchWorkers, cfg.Concurrency),
+			step: func(j *pipelineJob) error { return fetchStep(client, cfg, j) }},
+		{name: "parse", workers: workers(pc.ParseWorkers, runtime.NumCPU()),
+			step: func(j *pipelineJob) error { return parseStep(cfg, j) }},
+		{name: "enrich", workers: workers(pc.EnrichWorkers, cfg.Concurrency/2),
+			step: func(j *pipelineJob) error { return enrichStep(client, cfg, caches, j) }},
+	}
+
+	start := time.Now()
+	src := make(chan *pipelineJob, buffer)
+	in := src
+	for _, s := range stages {
+		s.deadline = deadline
+		out := make(chan *pipelineJob, buffer)
+		s.run(in, out)
+		in = out
+	}
+	go func() {
+		for _, itm := range items {
+			src <- &pipelineJob{itm: itm, key: symbolKey(itm)}
+		}
+		close(src)
+	}()
+
+	for j := range in {
+		if errors.Is(j.err, errOutOfTime) {
+			outOfTime = append(outOfTime, j.itm)
+			continue
+		}
+		if j.err != nil {
+			log.Printf("runPipeline: %s failed: %v", j.itm.ShortName, j.err)
+			if j.cached {
+				caches.symbols.drop(j.key)
+			}
+			failed = append(failed, j.itm)
+			continue
+		}
+		results = append(results, j.cr)
+	}
+
+	elapsed := time.Since(start)
+	log.Printf("runPipeline: %d companies in %s (%.1f/s), %d failed, %d out of time", len(items),
+		elapsed.Round(time.Millisecond), float64(len(items))/max(elapsed.Seconds(), 0.001), len(failed), len(outOfTime))
+	for _, s := range stages {
+		log.Printf("runPipeline: %s", s)
+	}
+	return results, failed, outOfTime
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Plugins are executables in the plugins dir (default <app dir>/plugins) speaking JSON over
+// stdio: each call starts the executable, writes one pluginRequest to stdin and reads one
+// pluginResponse from stdout. Methods:
+//
+//	describe                       -> {"name": "...", "kind": "source" | "sink"}
+//	fetch  {"company": BSEItem}    -> {"result": CompanyResult}        (sources)
+//	write  {"date", "results"}     -> {}                               (sinks)
+//
+// A non-empty "error" in the response fails the call. Stderr is passed through to the log.
+
+// Plugin is a discovered plugin executable
+type Plugin struct {
+	Name string
+	Kind string // "source" or "sink"
+	Path string
+}
+
+type pluginRequest struct {
+	Method  string          `json:"method"`
+	Date    string          `json:"date,omitempty"` // 2006-01-02
+	Company *BSEItem        `json:"company,omitempty"`
+	Results []CompanyResult `json:"results,omitempty"`
+}
+
+type pluginResponse struct {
+	Name   string         `json:"name,omitempty"`
+	Kind   string         `json:"kind,omitempty"`
+	Result *CompanyResult `json:"result,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+const pluginTimeout = 2 * time.Minute
+
+// pluginDir returns cfg.Dir or <app dir>/plugins
+func pluginDir(cfg PluginsConfig) (string, error) {
+	if cfg.Dir != "" {
+		return cfg.Dir, nil
+	}
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "plugins"), nil
+}
+
+// DiscoverPlugins asks every executable in the plugins dir to describe itself.
+// A missing dir means no plugins; executables that fail to describe are logged and skipped.
+func DiscoverPlugins(cfg PluginsConfig) ([]Plugin, error) {
+	dir, err := pluginDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var plugins []Plugin
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if fi, err := e.Info(); err != nil || fi.Mode()&0o111 == 0 {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		resp, err := callPlugin(path, pluginRequest{Method: "describe"})
+		if err != nil {
+			log.Printf("DiscoverPlugins: %s: %v", path, err)
+			continue
+		}
+		if resp.Kind != "source" && resp.Kind != "sink" {
+			log.Printf("DiscoverPlugins: %s: unknown kind %q", path, resp.Kind)
+			continue
+		}
+		name := resp.Name
+		if name == "" {
+			name = e.Name()
+		}
+		plugins = append(plugins, Plugin{Name: name, Kind: resp.Kind, Path: path})
+	}
+	return plugins, nil
+}
+
+// callPlugin runs one request/response exchange with the plugin at path
+func callPlugin(path string, req pluginRequest) (pluginResponse, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return pluginResponse{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return pluginResponse{}, fmt.Errorf("%s timed out after %s", req.Method, pluginTimeout)
+	}
+	if err != nil {
+		return pluginResponse{}, fmt.Errorf("%s: %v", req.Method, err)
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(bytes.TrimSpace(out), &resp); err != nil {
+		return pluginResponse{}, fmt.Errorf("%s: bad response: %v", req.Method, err)
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("%s: %s", req.Method, resp.Error)
+	}
+	return resp, nil
+}
+
+// pluginsOfKind returns the plugins of kind, in discovery order
+func pluginsOfKind(plugins []Plugin, kind string) []Plugin {
+	var out []Plugin
+	for _, p := range plugins {
+		if p.Kind == kind {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// fetchCompany tries the built-in trendlyne source and then each source plugin, in the
+// order of sourceOrder, returning the first success
+func fetchCompany(client *http.Client, cfg Config, plugins []Plugin, caches lookupCaches, itm BSEItem) (CompanyResult, error) {
+	var errs []string
+	for _, name := range sourceOrder(cfg, plugins, itm) {
+		var cr CompanyResult
+		var err error
+		if name == "trendlyne" {
+			cr, err = processCompany(client, cfg, caches, itm)
+		} else {
+			cr, err = fetchFromPlugin(plugins, name, itm)
+		}
+		if err == nil {
+			cr.Source = name
+			return cr, nil
+		}
+		errs = append(errs, name+": "+err.Error())
+	}
+	return CompanyResult{}, fmt.Errorf("all sources failed for %s: %s", itm.ShortName, strings.Join(errs, "; "))
+}
+
+// sourceOrder is the order sources are tried for itm: cfg.Plugins.NSESources when it is
+// listed on NSE, else cfg.Plugins.Sources, else the built-in source followed by every
+// source plugin
+func sourceOrder(cfg Config, plugins []Plugin, itm BSEItem) []string {
+	if itm.NSESymbol != "" && len(cfg.Plugins.NSESources) > 0 {
+		return cfg.Plugins.NSESources
+	}
+	if len(cfg.Plugins.Sources) > 0 {
+		return cfg.Plugins.Sources
+	}
+	order := []string{"trendlyne"}
+	for _, p := range pluginsOfKind(plugins, "source") {
+		order = append(order, p.Name)
+	}
+	return order
+}
+
+// fetchFromPlugin asks the named source plugin for one company
+func fetchFromPlugin(plugins []Plugin, name string, itm BSEItem) (CompanyResult, error) {
+	for _, p := range pluginsOfKind(plugins, "source") {
+		if p.Name != name {
+			continue
+		}
+		resp, err := callPlugin(p.Path, pluginRequest{Method: "fetch", Company: &itm})
+		if err != nil {
+			return CompanyResult{}, err
+		}
+		if resp.Result == nil {
+			return CompanyResult{}, errors.New("fetch: no result")
+		}
+		return normalizePluginResult(*resp.Result, itm)
+	}
+	return CompanyResult{}, errors.New("no such source plugin")
+}
+
+// pluginQuarters is how many quarters a plugin result is cut or padded to, as many as the
+// built-in source gives
+const pluginQuarters = 4
+
+// normalizePluginResult fills the fields a plugin may leave out: names, and the display
+// strings or numbers when only one of the two is given. Quarters and their values are cut
+// or padded to pluginQuarters; strings and numbers given for a different number of
+// quarters are an error.
+func normalizePluginResult(cr CompanyResult, itm BSEItem) (CompanyResult, error) {
+	if cr.Company == "" {
+		cr.Company = itm.ShortName
+	}
+	if cr.LongName == "" {
+		cr.LongName = itm.LongName
+	}
+	fill := func(strs []QuarterValue, nums []float64) ([]QuarterValue, []float64) {
+		if len(strs) == 0 {
+			for _, n := range nums {
+				if math.IsNaN(n) {
+					strs = append(strs, QuarterValue("not declared"))
+				} else {
+					strs = append(strs, QuarterValue(formatFloat(n)))
+				}
+			}
+		}
+		if len(nums) == 0 {
+			for _, s := range strs {
+				nums = append(nums, quarterValueToFloat64(s))
+			}
+		}
+		return strs, nums
+	}
+	cr.Revenue, cr.RevenueNums = fill(cr.Revenue, cr.RevenueNums)
+	cr.NetProfit, cr.NetProfitNums = fill(cr.NetProfit, cr.NetProfitNums)
+	if len(cr.Revenue) != len(cr.RevenueNums) {
+		return CompanyResult{}, fmt.Errorf("fetch: %d revenue values but %d revenue numbers", len(cr.Revenue), len(cr.RevenueNums))
+	}
+	if len(cr.NetProfit) != len(cr.NetProfitNums) {
+		return CompanyResult{}, fmt.Errorf("fetch: %d net profit values but %d net profit numbers", len(cr.NetProfit), len(cr.NetProfitNums))
+	}
+
+	// cut to the latest quarters, or pad with "not declared" like companyResultFromDoc
+	if len(cr.Quarters) > pluginQuarters {
+		cr.Quarters = cr.Quarters[:pluginQuarters]
+	}
+	for len(cr.Quarters) < pluginQuarters {
+		cr.Quarters = append(cr.Quarters, Quarter{})
+	}
+	values := func(strs []QuarterValue, nums []float64) ([]QuarterValue, []float64) {
+		if len(strs) > pluginQuarters {
+			strs, nums = strs[:pluginQuarters], nums[:pluginQuarters]
+		}
+		for len(strs) < pluginQuarters {
+			strs, nums = append(strs, QuarterValue("not declared")), append(nums, math.NaN())
+		}
+		return strs, nums
+	}
+	cr.Revenue, cr.RevenueNums = values(cr.Revenue, cr.RevenueNums)
+	cr.NetProfit, cr.NetProfitNums = values(cr.NetProfit, cr.NetProfitNums)
+	for k, vals := range cr.Metrics {
+		if len(vals) > pluginQuarters {
+			cr.Metrics[k] = vals[:pluginQuarters]
+		}
+	}
+	return cr, nil
+}
+
+// RunSinkPlugins hands the day's results to every sink plugin (or those named in cfg.Sinks)
+func RunSinkPlugins(cfg PluginsConfig, plugins []Plugin, date string, results []CompanyResult) {
+	for _, p := range pluginsOfKind(plugins, "sink") {
+		if len(cfg.Sinks) > 0 && !inWatchlist(cfg.Sinks, p.Name) {
+			continue
+		}
+		if _, err := callPlugin(p.Path, pluginRequest{Method: "write", Date: isoDate(date), Results: results}); err != nil {
+			log.Printf("sink plugin %s failed: %v", p.Name, err)
+		} else {
+			fmt.Printf("sent %d results to plugin %s\n", len(results), p.Name)
+		}
+	}
+}
+
+// runPlugins implements `quarter-compare plugins`: list discovered plugins
+func runPlugins(args []string) {
+	fs := flag.NewFlagSet("plugins", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	fs.Parse(args)
+	cfg := mustLoadConfig(*configPath)
+	dir, err := pluginDir(cfg.Plugins)
+	if err != nil {
+		log.Fatalf("cannot determine plugins dir: %v", err)
+	}
+	plugins, err := DiscoverPlugins(cfg.Plugins)
+	if err != nil {
+		log.Fatalf("discover plugins: %v", err)
+	}
+	fmt.Println("plugins dir:", dir)
+	if len(plugins) == 0 {
+		fmt.Println("no plugins found")
+		return
+	}
+	for _, p := range plugins {
+		fmt.Printf("  %-6s %-20s %s\n", p.Kind, p.Name, p.Path)
+	}
+}
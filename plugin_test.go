@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// fiveQuarters is a plugin result with a quarter more than the report shows
+func fiveQuarters() CompanyResult {
+	var cr CompanyResult
+	for _, q := range []string{"Jun 2025", "Mar 2025", "Dec 2024", "Sep 2024", "Jun 2024"} {
+		cr.Quarters = append(cr.Quarters, ParseQuarter(q))
+	}
+	cr.RevenueNums = []float64{500, 480, 460, 440, 420}
+	cr.NetProfitNums = []float64{50, 48, math.NaN(), 44, 42}
+	cr.Metrics = map[string][]float64{"EBITDA_Q": {90, 85, 80, 75, 70}}
+	return cr
+}
+
+func TestNormalizePluginResult(t *testing.T) {
+	itm := BSEItem{ScripCode: "500001", ShortName: "PLUGGED", LongName: "Plugged Ltd"}
+	cases := []struct {
+		name    string
+		cr      func() CompanyResult
+		wantErr string
+		rev     []string // wanted Revenue
+	}{
+		{"five quarters", fiveQuarters, "", []string{"500", "480", "460", "440"}},
+		{"two quarters", func() CompanyResult {
+			return CompanyResult{Quarters: []Quarter{ParseQuarter("Jun 2025")}, Revenue: []QuarterValue{"1,200", "1,100"}}
+		}, "", []string{"1,200", "1,100", "not declared", "not declared"}},
+		{"strings and numbers differ", func() CompanyResult {
+			cr := fiveQuarters()
+			cr.Revenue = []QuarterValue{"500", "480"}
+			return cr
+		}, "2 revenue values but 5 revenue numbers", nil},
+		{"net profit differs", func() CompanyResult {
+			cr := fiveQuarters()
+			cr.NetProfit = []QuarterValue{"50", "48", "46", "44", "42", "40"}
+			return cr
+		}, "6 net profit values but 5 net profit numbers", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cr, err := normalizePluginResult(c.cr(), itm)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("got error %v, want %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cr.Company != "PLUGGED" || cr.LongName != "Plugged Ltd" {
+				t.Errorf("names %q, %q not filled in", cr.Company, cr.LongName)
+			}
+			n := len(cr.Quarters)
+			if n != 4 || len(cr.Revenue) != n || len(cr.RevenueNums) != n || len(cr.NetProfit) != n || len(cr.NetProfitNums) != n {
+				t.Fatalf("quarters %d, revenue %d/%d, net profit %d/%d; want 4 of each",
+					n, len(cr.Revenue), len(cr.RevenueNums), len(cr.NetProfit), len(cr.NetProfitNums))
+			}
+			for i, want := range c.rev {
+				if string(cr.Revenue[i]) != want {
+					t.Errorf("revenue[%d] = %q, want %q", i, cr.Revenue[i], want)
+				}
+			}
+			for k, vals := range cr.Metrics {
+				if len(vals) > n {
+					t.Errorf("metric %s has %d values for %d quarters", k, len(vals), n)
+				}
+			}
+			RenderHTMLReport([]CompanyResult{cr}, nil, ReportOptions{})
+		})
+	}
+}
+
+// TestReportUnevenResult renders results no source normalized: more quarters than the
+// header, and fewer numbers than display strings
+func TestReportUnevenResult(t *testing.T) {
+	long := fiveQuarters()
+	long.Company = "LONG"
+	long.Revenue = []QuarterValue{"500", "480", "460", "440", "420"}
+	long.NetProfit = []QuarterValue{"50", "48", "not declared", "44", "42"}
+	short := fiveQuarters()
+	short.Company = "SHORT"
+	short.Revenue = []QuarterValue{"500", "480", "460", "440"}
+	short.RevenueNums = short.RevenueNums[:1]
+	short.NetProfit = []QuarterValue{"50", "48"}
+	short.NetProfitNums = nil
+	page := RenderHTMLReport([]CompanyResult{long, short}, nil, ReportOptions{})
+	if !strings.Contains(page, "LONG") || !strings.Contains(page, "SHORT") {
+		t.Fatal("rows missing from the report")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Position is one holding of the holdings file: shares held and their average cost (₹)
+type Position struct {
+	Ticker   string
+	Quantity float64
+	AvgPrice float64
+}
+
+// Portfolio is the user's holdings keyed by upper-cased ticker (BSE short name, NSE
+// symbol or scrip code), shown in the report's Position and Impact columns and the
+// "My portfolio" section
+type Portfolio map[string]Position
+
+// holdingsPath is cfg.HoldingsFile, else <app dir>/holdings.csv
+func holdingsPath(cfg Config) (string, error) {
+	if cfg.HoldingsFile != "" {
+		return cfg.HoldingsFile, nil
+	}
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "holdings.csv"), nil
+}
+
+// LoadPortfolio reads a CSV of ticker, quantity, avg price; a header row and blank tickers
+// are skipped, and several rows of one ticker (lots bought at different prices) are added
+// up at their average price. A missing file gives no portfolio.
+func LoadPortfolio(path string) (Portfolio, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	p := Portfolio{}
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		ticker := strings.ToUpper(strings.TrimSpace(rec[0]))
+		if ticker == "" || (line == 1 && ticker == "TICKER") {
+			continue
+		}
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("%s:%d: want ticker,quantity,avg_price", path, line)
+		}
+		num := func(s string) (float64, error) {
+			return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+		}
+		qty, err := num(rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: quantity: %v", path, line, err)
+		}
+		avg, err := num(rec[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: avg price: %v", path, line, err)
+		}
+		pos := p[ticker]
+		if total := pos.Quantity + qty; total != 0 {
+			pos.AvgPrice = (pos.Quantity*pos.AvgPrice + qty*avg) / total
+		}
+		pos.Ticker, pos.Quantity = ticker, pos.Quantity+qty
+		p[ticker] = pos
+	}
+	return p, nil
+}
+
+// For returns the position in the company of r
+func (p Portfolio) For(r CompanyResult) (Position, bool) {
+	for _, name := range []string{r.Company, r.NSESymbol, r.ScripCode} {
+		if pos, ok := p[strings.ToUpper(strings.TrimSpace(name))]; ok && name != "" {
+			return pos, true
+		}
+	}
+	return Position{}, false
+}
+
+// hasPositions reports whether the portfolio holds any of results
+func (p Portfolio) hasPositions(results []CompanyResult) bool {
+	for _, r := range results {
+		if _, ok := p.For(r); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// value is the position at r's price (₹), at its cost when the price is unknown
+func (pos Position) value(r CompanyResult) float64 {
+	if r.Price > 0 {
+		return pos.Quantity * r.Price
+	}
+	return pos.Quantity * pos.AvgPrice
+}
+
+// gainPct is the % gain of r's price over the average cost, NaN without either
+func (pos Position) gainPct(r CompanyResult) float64 {
+	return priceMove(pos.AvgPrice, r.Price)
+}
+
+// impliedImpact is what the result would do to the position (₹) if the stock kept its P/E:
+// the latest quarter's change in net profit against the previous quarter, as a share of
+// the trailing twelve months' profit, applied to the position's value. NaN without four
+// consecutive quarters, a loss over them, or an unknown change.
+func (pos Position) impliedImpact(r CompanyResult) float64 {
+	profit := ttm(r.Quarters, r.NetProfitNums)
+	_, np := latestGrowth(r, zeroBaseNA) // Abs doesn't depend on the policy
+	if !(profit > 0) || math.IsNaN(np.Abs) {
+		return math.NaN()
+	}
+	return pos.value(r) * np.Abs / profit
+}
+
+// formatRupees formats an amount in whole rupees with Indian digit grouping, e.g.
+// "₹12,34,567"
+func formatRupees(v float64) string {
+	if math.IsNaN(v) {
+		return "–"
+	}
+	sign := ""
+	if v < 0 {
+		sign, v = "−", -v
+	}
+	s := strconv.FormatFloat(math.Round(v), 'f', 0, 64)
+	if len(s) > 3 {
+		head, tail := s[:len(s)-3], s[len(s)-3:]
+		var groups []string
+		for len(head) > 2 {
+			groups = append([]string{head[len(head)-2:]}, groups...)
+			head = head[:len(head)-2]
+		}
+		s = strings.Join(append([]string{head}, groups...), ",") + "," + tail
+	}
+	return sign + "₹" + s
+}
+
+// positionCells are the Position and Impact cells of r, empty when it is not held
+func (p Portfolio) positionCells(r CompanyResult) string {
+	pos, ok := p.For(r)
+	if !ok {
+		return "<td data-sort=''></td><td data-sort=''></td>"
+	}
+	v, impact := pos.value(r), pos.impliedImpact(r)
+	title := fmt.Sprintf("%s shares at an average %s", formatFloat(pos.Quantity), formatFloat(pos.AvgPrice))
+	if g := pos.gainPct(r); !math.IsNaN(g) {
+		title += fmt.Sprintf(", %+.1f%% at %s", g, formatFloat(r.Price))
+	}
+	class := ""
+	if impact > 0 {
+		class = "positive"
+	} else if impact < 0 {
+		class = "negative"
+	}
+	return "<td data-sort='" + numSortValue(v) + "' title='" + html.EscapeString(title) + "'>" + formatRupees(v) + "</td>" +
+		"<td class='" + class + "' data-sort='" + numSortValue(impact) + "'>" + formatRupees(impact) + "</td>"
+}
+
+// writePortfolioSection summarizes the holdings in results: how many of them reported,
+// how many grew revenue and net profit, and each with its position and implied impact,
+// followed by the holdings that did not report in the run. Growth follows the zero_base
+// policy.
+func writePortfolioSection(sb *strings.Builder, results []CompanyResult, p Portfolio, zeroBase string) {
+	if !p.hasPositions(results) {
+		return
+	}
+	type held struct {
+		r   CompanyResult
+		pos Position
+	}
+	var rows []held
+	seen := map[string]bool{}
+	for _, r := range results {
+		if pos, ok := p.For(r); ok {
+			rows = append(rows, held{r, pos})
+			seen[pos.Ticker] = true
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].pos.value(rows[i].r) > rows[j].pos.value(rows[j].r) })
+
+	revUp, npUp, total, impact, valued := 0, 0, 0.0, 0.0, 0.0
+	for _, h := range rows {
+		rev, np := latestGrowth(h.r, zeroBase)
+		if rev.Abs > 0 {
+			revUp++
+		}
+		if np.Abs > 0 {
+			npUp++
+		}
+		total += h.pos.value(h.r)
+		if x := h.pos.impliedImpact(h.r); !math.IsNaN(x) {
+			impact += x
+			valued += h.pos.value(h.r)
+		}
+	}
+	sb.WriteString("<div id='portfolio' class='summary'><h3>My portfolio</h3>")
+	sb.WriteString(fmt.Sprintf("<p>%d of your %d holdings reported: revenue up at %d, net profit up at %d. They are worth %s", len(rows), len(p), revUp, npUp, formatRupees(total)))
+	if valued > 0 {
+		sb.WriteString(fmt.Sprintf("; the results imply %s (%+.1f%%) at constant P/E", formatRupees(impact), impact/valued*100))
+	}
+	sb.WriteString(".</p>")
+
+	pct := func(g growth) string {
+		return "<td class='" + g.class() + "' title='" + html.EscapeString(g.title()) + "'>" + html.EscapeString(g.String()) + "</td>"
+	}
+	sb.WriteString("<table class='portfolio-table' style='width:auto'><thead><tr><th>Company</th><th>Quarter</th><th>Quantity</th><th>Avg price</th><th>Gain</th><th>Position</th><th>Impact</th><th>Rev %Δ</th><th>NP %Δ</th></tr></thead><tbody>")
+	for _, h := range rows {
+		rev, np := latestGrowth(h.r, zeroBase)
+		sb.WriteString("<tr><td class='left'><a href='#" + rowAnchor(h.r.Company) + "'>" + html.EscapeString(h.r.Company) + "</a></td><td>" + html.EscapeString(firstQuarter(h.r)) + "</td>")
+		sb.WriteString("<td>" + formatFloat(h.pos.Quantity) + "</td><td>" + formatFloat(h.pos.AvgPrice) + "</td><td>" + formatPct(h.pos.gainPct(h.r)) + "</td>")
+		sb.WriteString(p.positionCells(h.r) + pct(rev) + pct(np) + "</tr>")
+	}
+	sb.WriteString("</tbody></table>")
+
+	var rest []string
+	for t := range p {
+		if !seen[t] {
+			rest = append(rest, t)
+		}
+	}
+	if len(rest) > 0 {
+		sort.Strings(rest)
+		sb.WriteString("<p class='small'>Not reported in this run: " + html.EscapeString(strings.Join(rest, ", ")) + "</p>")
+	}
+	sb.WriteString("<p class='small'>Impact is the quarter's change in net profit as a share of the trailing twelve months' profit, applied to the position: what the result is worth if the stock keeps its P/E. Holdings come from <code>holdings_file</code>.</p></div>")
+}
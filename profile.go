@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Half the small caps of a day's list are companies nobody has heard of. With profiles
+// enabled, each company gets the lead paragraph of its Wikipedia article, shown under the
+// name in the company modal. Articles change slowly, so they are cached for months, and a
+// company without one is not searched again for profileMissRefresh.
+
+// defaultProfileURL is the Wikipedia the profiles come from
+const defaultProfileURL = "https://en.wikipedia.org"
+
+const (
+	profileRefresh     = 180 * 24 * time.Hour // a found profile is fetched again after this
+	profileMissRefresh = 30 * 24 * time.Hour  // a company without one is searched again after this
+	profileMaxLen      = 600                  // the blurb is cut at a sentence end before this
+	profileWorkers     = 4
+)
+
+// ProfilesConfig: with Enabled, results get a business description from Wikipedia (URL,
+// default defaultProfileURL, e.g. another language's)
+type ProfilesConfig struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+}
+
+func (c ProfilesConfig) url() string {
+	if c.URL != "" {
+		return strings.TrimRight(c.URL, "/")
+	}
+	return defaultProfileURL
+}
+
+// Profile is a company's business description and the article it comes from
+type Profile struct {
+	Text      string    `json:"text,omitempty"` // empty when no article was found
+	URL       string    `json:"url,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// profileWords are what a company article's description or lead says it is
+var profileWords = regexp.MustCompile(`(?i)\b(company|companies|conglomerate|manufacturer|maker|producer|bank|lender|firm|corporation|enterprise|insurer|provider|developer|operator|retailer|distributor|refiner|brewer|publisher|broadcaster|airline|holding)\b`)
+
+// legalSuffix matches what BSE long names end in but article titles do not
+var legalSuffix = regexp.MustCompile(`(?i)[\s,.]+(ltd|limited|pvt|private|inc|corp|co)\.?$`)
+
+// profileQuery is the search query for a company: its long name without "Ltd" and the like
+func profileQuery(r CompanyResult) string {
+	name := strings.TrimSpace(r.LongName)
+	if name == "" {
+		name = r.Company
+	}
+	for {
+		trimmed := legalSuffix.ReplaceAllString(name, "")
+		if trimmed == name {
+			return name
+		}
+		name = trimmed
+	}
+}
+
+// profileKey is the cache key of a company: its ISIN, else its upper-cased short name
+func profileKey(r CompanyResult) string {
+	if r.ISIN != "" {
+		return r.ISIN
+	}
+	return strings.ToUpper(strings.TrimSpace(r.Company))
+}
+
+// FetchProfile searches Wikipedia for the company named query and returns the lead of the
+// first of the top results that is about a company with the name's first word in its
+// title; a zero Profile when there is none
+func FetchProfile(client *http.Client, base, query string, maxBody int64) (Profile, error) {
+	get := func(u string, v interface{}) error {
+		req, _ := http.NewRequest("GET", u, nil)
+		req.Header.Set("accept", "application/json")
+		// Wikimedia asks API clients to identify themselves
+		req.Header.Set("user-agent", "quarter-compare (https://github.com/pranegit/quaterly-compare)")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if err := json.NewDecoder(&cappedReader{r: resp.Body, limit: maxBody}).Decode(v); err != nil {
+			return fmt.Errorf("invalid JSON: %v", err)
+		}
+		return nil
+	}
+
+	var search struct {
+		Query struct {
+			Search []struct {
+				Title string `json:"title"`
+			} `json:"search"`
+		} `json:"query"`
+	}
+	q := url.Values{"action": {"query"}, "list": {"search"}, "srsearch": {query}, "srlimit": {"3"}, "format": {"json"}}
+	if err := get(base+"/w/api.php?"+q.Encode(), &search); err != nil {
+		return Profile{}, fmt.Errorf("search: %v", err)
+	}
+	first := strings.ToLower(strings.Fields(query + " ")[0])
+	for _, hit := range search.Query.Search {
+		if !strings.Contains(strings.ToLower(hit.Title), first) {
+			continue
+		}
+		var page struct {
+			Type        string `json:"type"`
+			Description string `json:"description"`
+			Extract     string `json:"extract"`
+			ContentURLs struct {
+				Desktop struct {
+					Page string `json:"page"`
+				} `json:"desktop"`
+			} `json:"content_urls"`
+		}
+		title := strings.ReplaceAll(hit.Title, " ", "_")
+		if err := get(base+"/api/rest_v1/page/summary/"+url.PathEscape(title), &page); err != nil {
+			return Profile{}, fmt.Errorf("%s: %v", hit.Title, err)
+		}
+		if page.Type != "standard" || !profileWords.MatchString(page.Description+" "+page.Extract) {
+			continue
+		}
+		return Profile{Text: blurb(page.Extract), URL: page.ContentURLs.Desktop.Page}, nil
+	}
+	return Profile{}, nil
+}
+
+// blurb is the first paragraph of text, cut at the last sentence end before profileMaxLen
+func blurb(text string) string {
+	text, _, _ = strings.Cut(strings.TrimSpace(text), "\n")
+	if len(text) <= profileMaxLen {
+		return text
+	}
+	if i := strings.LastIndex(text[:profileMaxLen], ". "); i > 0 {
+		return text[:i+1]
+	}
+	return strings.TrimSpace(text[:profileMaxLen]) + "…"
+}
+
+// profileCache is <cache dir>/profiles.json, keyed by profileKey
+type profileCache struct {
+	path    string
+	entries map[string]Profile
+}
+
+// loadProfiles reads the profile cache; a missing or unreadable file gives an empty one
+func loadProfiles() *profileCache {
+	dir, err := cacheDir()
+	if err != nil {
+		log.Printf("loadProfiles: %v", err)
+		return nil
+	}
+	c := &profileCache{path: filepath.Join(dir, "profiles.json"), entries: map[string]Profile{}}
+	b, err := os.ReadFile(c.path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &c.entries); err != nil {
+			log.Printf("loadProfiles: ignoring %s: %v", c.path, err)
+			c.entries = map[string]Profile{}
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("loadProfiles: %v", err)
+	}
+	return c
+}
+
+// stale reports whether p should be fetched again
+func (p Profile) stale() bool {
+	if p.Text == "" {
+		return time.Since(p.FetchedAt) >= profileMissRefresh
+	}
+	return time.Since(p.FetchedAt) >= profileRefresh
+}
+
+// save writes the cache
+func (c *profileCache) save() error {
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// attachProfiles sets the profile of every result, from the cache or, when missing or
+// stale there, from Wikipedia, profileWorkers at a time. A failed fetch is logged and the
+// cached profile, if any, kept.
+func attachProfiles(client *http.Client, cfg Config, results []CompanyResult) {
+	c := loadProfiles()
+	if c == nil {
+		return
+	}
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, profileWorkers)
+		dirty bool
+	)
+	for i := range results {
+		r := &results[i]
+		key := profileKey(*r)
+		p, ok := c.entries[key]
+		if ok && !p.stale() {
+			r.Profile, r.ProfileURL = p.Text, p.URL
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			fresh, err := FetchProfile(client, cfg.Profiles.url(), profileQuery(*r), cfg.maxBody())
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("attachProfiles: %s: %v", r.Company, err)
+			} else {
+				fresh.FetchedAt = time.Now()
+				p, dirty = fresh, true
+				c.entries[key] = p
+			}
+			r.Profile, r.ProfileURL = p.Text, p.URL
+		}()
+	}
+	wg.Wait()
+	if dirty {
+		if err := c.save(); err != nil {
+			log.Printf("attachProfiles: %v", err)
+		}
+	}
+}
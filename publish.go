@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runPublish implements `quarter-compare publish`: collect today's results and add them
+// to a small static site (index + dated reports + data files), optionally committing and pushing it.
+func runPublish(args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	dir := fs.String("dir", "", "site directory (default: publish.dir from config, else <app dir>/site)")
+	gitCommit := fs.Bool("git", false, "commit the site changes (dir must be a git work tree)")
+	push := fs.Bool("push", false, "push after committing (implies -git)")
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+	cfg := mustLoadConfig(*configPath)
+
+	pc := cfg.Publish
+	if *dir != "" {
+		pc.Dir = *dir
+	}
+	if pc.Dir == "" {
+		appDir, err := getAppDir()
+		if err != nil {
+			log.Fatalf("cannot determine app dir: %v", err)
+		}
+		pc.Dir = filepath.Join(appDir, "site")
+	}
+	pc.Git = pc.Git || *gitCommit || *push
+	pc.Push = pc.Push || *push
+
+	client := NewHTTPClient(cfg)
+	today := time.Now().Format("02 Jan 2006")
+	results, failures, decisions, err := collectResults(client, cfg, today)
+	if errors.Is(err, errNoMeetings) {
+		SaveDecisions(isoDate(today), "", decisions)
+		fmt.Println("no meetings for today:", today)
+		return
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	db, err := openHistory()
+	if err != nil {
+		log.Printf("open history: %v", err)
+	} else {
+		defer db.Close()
+		if err := saveRun(db, RunRecord{Date: isoDate(today), Results: results, Failures: failures}); err != nil {
+			log.Printf("save history: %v", err)
+		}
+	}
+	SaveDecisions(isoDate(today), "", decisions)
+	if err := PublishSite(pc, mustReportOptions(cfg).withHistory(db, isoDate(today)), isoDate(today), results, failures); err != nil {
+		log.Fatalf("publish site: %v", err)
+	}
+	fmt.Println("site updated in", pc.Dir)
+	if pc.Git {
+		if err := gitPublish(pc, isoDate(today)); err != nil {
+			log.Fatalf("git publish: %v", err)
+		}
+	}
+}
+
+// PublishSite writes reports/<date>.html and data/<date>.json into pc.Dir and rebuilds index.html and feed.xml
+func PublishSite(pc PublishConfig, opts ReportOptions, date string, results []CompanyResult, failures []Failure) error {
+	dir := pc.Dir
+	for _, sub := range []string{"reports", "data"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+	if err := GenerateHTMLReport(filepath.Join(dir, "reports", date+".html"), results, failures, opts); err != nil {
+		return err
+	}
+	if err := writeRunFile(filepath.Join(dir, "data", date+".json"), RunRecord{Date: date, Results: results, Failures: failures}); err != nil {
+		return err
+	}
+	runs, err := loadRunDir(filepath.Join(dir, "data"))
+	if err != nil {
+		return err
+	}
+	if err := writeSiteIndex(dir, runs, opts.ZeroBase); err != nil {
+		return err
+	}
+	return writeSiteFeed(dir, pc, runs, opts.ZeroBase)
+}
+
+// writeSiteIndex lists every published day, newest first, with its top mover under the
+// zero_base policy
+func writeSiteIndex(dir string, runs []RunRecord, zeroBase string) error {
+	var sb strings.Builder
+	sb.WriteString("<!doctype html><html><head><meta charset='utf-8'><title>Quarter Compare — results</title>")
+	sb.WriteString("<link rel='alternate' type='application/rss+xml' title='Quarter Compare results' href='feed.xml'>")
+	sb.WriteString(styleTag("site.css") + "</head><body>")
+	sb.WriteString("<h2>Quarterly results</h2>")
+	if len(runs) == 0 {
+		sb.WriteString("<p>No runs published yet.</p>")
+	} else {
+		sb.WriteString("<table><thead><tr><th>Date</th><th>Companies</th><th>Top NP mover</th><th>Data</th></tr></thead><tbody>")
+		for _, run := range runs {
+			top := "—"
+			best, bestPct := "", math.NaN()
+			for _, r := range run.Results {
+				if p := npPct(r, zeroBase); !math.IsNaN(p) && (math.IsNaN(bestPct) || p > bestPct) {
+					best, bestPct = r.Company, p
+				}
+			}
+			if best != "" {
+				top = html.EscapeString(best) + " (" + fmtPct(bestPct) + ")"
+			}
+			d := html.EscapeString(run.Date)
+			sb.WriteString("<tr><td><a href='reports/" + d + ".html'>" + d + "</a></td>")
+			sb.WriteString(fmt.Sprintf("<td>%d</td>", len(run.Results)))
+			sb.WriteString("<td>" + top + "</td>")
+			sb.WriteString("<td><a href='data/" + d + ".json'>json</a></td></tr>")
+		}
+		sb.WriteString("</tbody></table>")
+	}
+	sb.WriteString("<p class='small'>Generated " + time.Now().Format("2006-01-02 15:04") + " by quarter-compare.</p></body></html>")
+	return os.WriteFile(filepath.Join(dir, "index.html"), []byte(sb.String()), 0644)
+}
+
+// npPct returns the latest NP %Δ of a result (NaN when not a plain % change)
+func npPct(r CompanyResult, zeroBase string) float64 {
+	_, np := latestGrowth(r, zeroBase)
+	return np.Pct
+}
+
+// gitPublish commits the site directory and optionally pushes it
+func gitPublish(pc PublishConfig, date string) error {
+	gitCmd := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"-C", pc.Dir}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return string(out), fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+		return string(out), nil
+	}
+	if _, err := gitCmd("add", "-A"); err != nil {
+		return err
+	}
+	status, err := gitCmd("status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(status) == "" {
+		fmt.Println("site unchanged; nothing to commit")
+	} else if _, err := gitCmd("commit", "-m", "results for "+date); err != nil {
+		return err
+	}
+	if !pc.Push {
+		return nil
+	}
+	pushArgs := []string{"push"}
+	remote := pc.Remote
+	if remote == "" && pc.Branch != "" {
+		// a branch alone goes to the remote the current branch pushes to, else origin
+		remote = "origin"
+		if out, err := gitCmd("rev-parse", "--abbrev-ref", "@{push}"); err == nil {
+			if r, _, ok := strings.Cut(strings.TrimSpace(out), "/"); ok {
+				remote = r
+			}
+		}
+	}
+	if remote != "" {
+		pushArgs = append(pushArgs, remote)
+		if pc.Branch != "" {
+			pushArgs = append(pushArgs, "HEAD:"+pc.Branch)
+		}
+	}
+	if _, err := gitCmd(pushArgs...); err != nil {
+		return err
+	}
+	fmt.Println("site pushed")
+	return nil
+}
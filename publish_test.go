@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitPublishBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "quarter-compare")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "qc@example.com")
+	}
+	tmp := t.TempDir()
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	remote, site := filepath.Join(tmp, "remote.git"), filepath.Join(tmp, "site")
+	git(tmp, "init", "-q", "--bare", remote)
+	git(tmp, "init", "-q", "-b", "main", site)
+	git(site, "remote", "add", "origin", remote)
+	if err := os.WriteFile(filepath.Join(site, "index.html"), []byte("<html></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a branch without a remote goes to origin, not to the current branch's upstream
+	if err := gitPublish(PublishConfig{Dir: site, Git: true, Push: true, Branch: "gh-pages"}, "2024-07-12"); err != nil {
+		t.Fatal(err)
+	}
+	if got := git(remote, "for-each-ref", "--format=%(refname)"); got != "refs/heads/gh-pages" {
+		t.Errorf("remote has %q, want only refs/heads/gh-pages", got)
+	}
+	if got, want := git(remote, "rev-parse", "gh-pages"), git(site, "rev-parse", "HEAD"); got != want {
+		t.Errorf("gh-pages at %s, want the site's HEAD %s", got, want)
+	}
+}
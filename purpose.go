@@ -0,0 +1,53 @@
+package main
+
+import "strings"
+
+// purposeAll in Config.Purposes keeps meetings of every purpose
+const purposeAll = "all"
+
+// isResultsPurpose reports whether a board-meeting purpose is about financial results.
+// An empty purpose counts: the results calendar endpoint lists nothing else.
+func isResultsPurpose(p string) bool {
+	return p == "" || strings.Contains(strings.ToLower(p), "result")
+}
+
+// matchPurpose reports whether a meeting is kept: results meetings always, others when
+// their purpose contains one of extra (case-insensitive) or extra has "all"
+func matchPurpose(p string, extra []string) bool {
+	if isResultsPurpose(p) {
+		return true
+	}
+	lp := strings.ToLower(p)
+	for _, e := range extra {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == purposeAll || (e != "" && strings.Contains(lp, e)) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterPurpose keeps the items whose purpose matches (see matchPurpose)
+func filterPurpose(items []BSEItem, extra []string) []BSEItem {
+	var out []BSEItem
+	for _, it := range items {
+		if matchPurpose(it.Purpose, extra) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// attachPurposes copies the meeting purpose of each result's BSE item onto it, leaving
+// results meetings blank so the report only calls out the others
+func attachPurposes(results []CompanyResult, items []BSEItem) {
+	purposes := make(map[string]string, len(items))
+	for _, it := range items {
+		if !isResultsPurpose(it.Purpose) {
+			purposes[it.ShortName] = it.Purpose
+		}
+	}
+	for i := range results {
+		results[i].Purpose = purposes[results[i].Company]
+	}
+}
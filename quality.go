@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// how pickTrendItem matched a company to its trendlyne search hit
+const (
+	matchCode   = "code"   // same BSE scrip code
+	matchSymbol = "symbol" // same symbol, no code match
+	matchFirst  = "first"  // neither: the first hit, a guess
+)
+
+// minGoodQuality is the data-quality score below which the badge is shown as a warning
+const minGoodQuality = 70
+
+// dataQuality scores how far the numbers of r can be trusted, from 100 down, and gives a
+// reason for every deduction: quarters not declared, problems in the source data, anomalous
+// figures, a source plugin, standalone figures and an uncertain company match
+func dataQuality(r CompanyResult) (int, []string) {
+	score := 100
+	var reasons []string
+	deduct := func(points int, reason string) {
+		score -= points
+		reasons = append(reasons, fmt.Sprintf("−%d %s", points, reason))
+	}
+
+	declared := 0
+	for i := 0; i < 4; i++ {
+		for _, vals := range [][]float64{r.RevenueNums, r.NetProfitNums} {
+			if i < len(vals) && !math.IsNaN(vals[i]) {
+				declared++
+			}
+		}
+	}
+	if missing := 8 - declared; missing > 0 {
+		deduct(5*missing, fmt.Sprintf("%d of 8 quarterly values not declared", missing))
+	}
+	if len(r.Issues) > 0 {
+		deduct(10, fmt.Sprintf("%d source data issue(s)", len(r.Issues)))
+	}
+	if len(r.Anomalies) > 0 {
+		deduct(20, "out of line with its own history, verify against the filing: "+strings.Join(r.Anomalies, "; "))
+	}
+	if r.CrossCheck != "" {
+		deduct(30, "differs from the BSE filing: "+r.CrossCheck)
+	}
+	if r.Source != "" && r.Source != "trendlyne" {
+		deduct(10, "from the "+r.Source+" plugin")
+	}
+	basis := strings.ToLower(r.Basis)
+	switch {
+	case strings.Contains(basis, "consolidated"):
+	case strings.Contains(basis, "standalone"):
+		deduct(10, "standalone figures, no consolidated results")
+	case basis != "":
+		deduct(5, "figures of the "+r.Basis+" dump")
+	}
+	switch r.Match {
+	case matchSymbol:
+		deduct(5, "matched by symbol, not BSE code")
+	case matchFirst:
+		deduct(25, "matched to the first search hit; check it is the right company")
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score, reasons
+}
+
+// qualityBadge renders the data-quality score as a badge, with the reasons as tooltip
+func qualityBadge(r CompanyResult) string {
+	score, reasons := dataQuality(r)
+	class := "badge dq"
+	if score < minGoodQuality {
+		class += " warn"
+	}
+	title := "Data quality " + fmt.Sprint(score) + "/100"
+	if len(reasons) == 0 {
+		title += ": nothing to flag"
+	} else {
+		title += ": " + strings.Join(reasons, "; ")
+	}
+	return fmt.Sprintf("<span class='%s' title='%s'>DQ %d</span>", class, html.EscapeString(title), score)
+}
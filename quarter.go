@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Quarter is a quarter of an Indian fiscal year (April to March): Q1 ends in June and Q4 in
+// March, and FY is the calendar year the fiscal year ends in, so "Jun 2024" is Q1 FY2025.
+// The zero Quarter is unknown (a padded slot); a label that cannot be parsed is kept as is
+// so it still shows, but takes no part in quarter arithmetic.
+type Quarter struct {
+	FY  int
+	Q   int // 1..4
+	raw string
+}
+
+// quarterLayouts are the calendar labels ParseQuarter understands
+var quarterLayouts = []string{"Jan 2006", "Jan '06", "Jan 06", "Jan-2006", "Jan-06", "2006-01-02", "2006-01"}
+
+// fiscal labels such as "Q1 FY25", "Q1FY2025", "FY25 Q1" and "1QFY25"
+var (
+	quarterFYRe = regexp.MustCompile(`^(?:q([1-4])|([1-4])q)[\s\-']*fy[\s\-']*(\d{2}|\d{4})$`)
+	fyQuarterRe = regexp.MustCompile(`^fy[\s\-']*(\d{2}|\d{4})[\s\-']*q([1-4])$`)
+)
+
+// QuarterOf returns the fiscal quarter t falls in
+func QuarterOf(t time.Time) Quarter {
+	q := (int(t.Month())-4+12)%12/3 + 1
+	fy := t.Year()
+	if t.Month() > time.March {
+		fy++
+	}
+	return Quarter{FY: fy, Q: q}
+}
+
+// ParseQuarter reads a quarter label: a quarter-end month ("Jun 2024", "Jun '24",
+// "2024-06-30", ...) or a fiscal label ("Q1 FY25", "FY25 Q1", ...). A label it cannot
+// read gives a Quarter that is not Known and prints as the label.
+func ParseQuarter(label string) Quarter {
+	s := strings.TrimSpace(label)
+	if s == "" {
+		return Quarter{}
+	}
+	for _, layout := range quarterLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			if t.Month()%3 != 0 {
+				break
+			}
+			return QuarterOf(t)
+		}
+	}
+	l := strings.ToLower(s)
+	if m := quarterFYRe.FindStringSubmatch(l); m != nil {
+		n := m[1]
+		if n == "" {
+			n = m[2]
+		}
+		return fiscalQuarter(m[3], n)
+	}
+	if m := fyQuarterRe.FindStringSubmatch(l); m != nil {
+		return fiscalQuarter(m[1], m[2])
+	}
+	return Quarter{raw: s}
+}
+
+func fiscalQuarter(fy, q string) Quarter {
+	y, _ := strconv.Atoi(fy)
+	if y < 100 {
+		y += 2000
+	}
+	n, _ := strconv.Atoi(q)
+	return Quarter{FY: y, Q: n}
+}
+
+// Known reports whether q is a parsed quarter that takes part in arithmetic
+func (q Quarter) Known() bool { return q.FY != 0 }
+
+// End returns the last day of q; the zero time when q is not Known
+func (q Quarter) End() time.Time {
+	if !q.Known() {
+		return time.Time{}
+	}
+	// Q1 ends in June of FY-1, Q4 in March of FY
+	return time.Date(q.FY-1, time.Month(3*q.Q+4), 0, 0, 0, 0, 0, time.UTC)
+}
+
+// Prev returns the quarter before q
+func (q Quarter) Prev() Quarter {
+	if !q.Known() {
+		return Quarter{}
+	}
+	if q.Q == 1 {
+		return Quarter{FY: q.FY - 1, Q: 4}
+	}
+	return Quarter{FY: q.FY, Q: q.Q - 1}
+}
+
+// YearAgo returns the same quarter of the previous fiscal year
+func (q Quarter) YearAgo() Quarter {
+	if !q.Known() {
+		return Quarter{}
+	}
+	return Quarter{FY: q.FY - 1, Q: q.Q}
+}
+
+// String is the label of q ("Jun 2024"), the original label when it could not be parsed
+// and "" for the zero Quarter
+func (q Quarter) String() string {
+	if !q.Known() {
+		return q.raw
+	}
+	return q.End().Format("Jan 2006")
+}
+
+// MarshalJSON writes q as its label, so stored runs keep their format
+func (q Quarter) MarshalJSON() ([]byte, error) { return json.Marshal(q.String()) }
+
+// UnmarshalJSON reads a label written by MarshalJSON or any label ParseQuarter understands
+func (q *Quarter) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*q = ParseQuarter(s)
+	return nil
+}
+
+// parseQuarterEnd returns the last day of the quarter a label such as "Jun 2024" names
+func parseQuarterEnd(label string) (time.Time, bool) {
+	q := ParseQuarter(label)
+	return q.End(), q.Known()
+}
+
+// consecutive reports whether the first n of qs (newest first) are each the quarter before
+// the previous one. Missing and unparsed labels are taken on trust, but a gap between two
+// known quarters (a quarter missing from the source) is not.
+func consecutive(qs []Quarter, n int) bool {
+	for i := 1; i < n && i < len(qs); i++ {
+		if qs[i-1].Known() && qs[i].Known() && qs[i] != qs[i-1].Prev() {
+			return false
+		}
+	}
+	return true
+}
+
+// quarterIndex returns the index of q in qs, -1 when missing or q is the zero Quarter
+func quarterIndex(qs []Quarter, q Quarter) int {
+	if q == (Quarter{}) {
+		return -1
+	}
+	for i, x := range qs {
+		if x == q {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"html"
+	"log"
 	"math"
+	"net/url"
 	"os"
 	"sort"
 	"strings"
+	"time"
 )
 
 // helper: format percent with sign and two decimals, "N/A" if NaN or missing
@@ -63,109 +67,250 @@ func avgFloats(vals []float64) float64 {
 	return sum / float64(count)
 }
 
+// ReportOptions holds the config-driven parts of the report
+type ReportOptions struct {
+	Metrics   []Metric // extra registry metrics, shown after the built-in columns
+	Columns   []Column // computed columns, shown last
+	Watchlist []string
+	SortBy    string // see SortResults
+	Notes     Notes  // personal notes per company; no Notes column when empty
+	// Portfolio is the user's holdings; held companies get Position and Impact columns and
+	// the "My portfolio" section
+	Portfolio Portfolio
+	Outliers  OutlierConfig
+	// ZeroBase is the zero_base policy of every growth cell, sort and summary (see
+	// Config.ZeroBase)
+	ZeroBase string
+	// Date and History (the stored runs before Date) drive the cohort section comparing the
+	// day with earlier result seasons; no section when Date is empty (see withHistory)
+	Date    string
+	History []RunRecord
+
+	// Peers are the configured peer groups; a group gets a section when a member is in the
+	// results, its other members taken from History
+	Peers map[string][]string
+
+	// Live adds the script that updates the table in place from the server's /events
+	// stream (serve only)
+	Live bool
+}
+
+// withHistory returns opts set up for the cohort section of the run of date (2006-01-02),
+// with the runs of db before it that fall in the seasons the section shows. db is nil when
+// the history database couldn't be opened; the section then compares against nothing.
+func (opts ReportOptions) withHistory(db *sql.DB, date string) ReportOptions {
+	opts.Date = date
+	opts.History = nil
+	if db == nil {
+		return opts
+	}
+	from := ""
+	if day, err := time.Parse("2006-01-02", date); err == nil {
+		from = day.AddDate(0, -cohortHistoryMonths, 0).Format("2006-01-02")
+	}
+	runs, err := queryHistory(db, historyQuery{From: from, Before: date})
+	if err != nil {
+		log.Printf("withHistory: %v", err)
+	}
+	opts.History = runs
+	return opts
+}
+
+// reportOptions builds the report options from cfg
+func reportOptions(cfg Config) (ReportOptions, error) {
+	cols, err := ParseColumns(cfg.Columns)
+	if err != nil {
+		return ReportOptions{}, err
+	}
+	if err := checkSortBy(cfg.SortBy); err != nil {
+		return ReportOptions{}, fmt.Errorf("sort_by: %v", err)
+	}
+	path, err := notesPath(cfg)
+	if err != nil {
+		return ReportOptions{}, err
+	}
+	notes, err := LoadNotes(path)
+	if err != nil {
+		return ReportOptions{}, fmt.Errorf("notes: %v", err)
+	}
+	if path, err = holdingsPath(cfg); err != nil {
+		return ReportOptions{}, err
+	}
+	portfolio, err := LoadPortfolio(path)
+	if err != nil {
+		return ReportOptions{}, fmt.Errorf("holdings: %v", err)
+	}
+	return ReportOptions{Metrics: cfg.metricRegistry().Extra(), Columns: cols, Watchlist: cfg.Watchlist, SortBy: cfg.SortBy, Notes: notes, Portfolio: portfolio, Outliers: cfg.Outliers, ZeroBase: cfg.ZeroBase, Peers: cfg.Peers}, nil
+}
+
+// mustReportOptions is reportOptions, exiting on a bad config
+func mustReportOptions(cfg Config) ReportOptions {
+	opts, err := reportOptions(cfg)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	return opts
+}
+
 // GenerateHTMLReport writes a simple HTML comparing companies
-func GenerateHTMLReport(path string, results []CompanyResult) error {
+func GenerateHTMLReport(path string, results []CompanyResult, failures []Failure, opts ReportOptions) error {
+	return os.WriteFile(path, []byte(RenderHTMLReport(results, failures, opts)), 0644)
+}
+
+// RenderHTMLReport builds the report HTML for results; failures and results with data
+// issues are listed in their own section
+func RenderHTMLReport(results []CompanyResult, failures []Failure, opts ReportOptions) string {
+	warnEmptyColumns(opts.Columns, results, opts.Watchlist, opts.ZeroBase)
+	results = append([]CompanyResult(nil), results...)
+	SortResults(results, opts.SortBy, opts.ZeroBase)
+	pinned := pinWatchlist(results, opts.Watchlist)
+
 	// determine quarters header using first non-empty CompanyResult
 	headerQuarters := []string{"Q1", "Q2", "Q3", "Q4"}
 	for _, r := range results {
 		for i, q := range r.Quarters {
-			if q != "" {
-				headerQuarters[i] = q
+			if i == len(headerQuarters) {
+				break
+			}
+			if q.String() != "" {
+				headerQuarters[i] = q.String()
 			}
 		}
 		break
 	}
 
 	var sb strings.Builder
-	sb.WriteString("<!doctype html><html><head><meta charset='utf-8'><title>Quarter Compare</title>")
-	sb.WriteString(`<style>
-body{font-family:Arial,Helvetica,sans-serif}
-table{border-collapse:collapse;width:100%}td,th{border:1px solid #ccc;padding:6px;text-align:right}
-th{background:#f2f2f2;text-align:center;cursor:pointer;user-select:none}
-td.left{text-align:left}
-.positive{background:#d4edda} .negative{background:#f8d7da} .neutral{background:#fffbe6}
-.highlight{box-shadow:inset 0 0 0 3px #ffd54f}
-.summary{margin-top:20px;padding:10px;border:1px solid #ddd;background:#fafafa}
-.small{font-size:0.9em;color:#666}
-tr:hover{background:#f0f8ff}
-.sort-indicator{margin-left:6px;font-size:0.8em;color:#666}
-</style>`)
+	sb.WriteString("<!doctype html><html lang='en'><head><meta charset='utf-8'><title>Quarter Compare</title>")
+	sb.WriteString(styleTag("report.css"))
 
 	// small JS sorter: uses data-sort attribute when present, toggles asc/desc per column
-	sb.WriteString(`<script>
-document.addEventListener("DOMContentLoaded", function(){
-  const table = document.getElementById("reportTable");
-  if(!table) return;
-  const ths = table.querySelectorAll("thead th");
-  ths.forEach(function(th, idx){
-    // do not attach to the first column (company) if you still want sorting; we attach to all
-    th.addEventListener("click", function(){
-      const curDir = th.getAttribute("data-dir") || "desc";
-      const newDir = curDir === "desc" ? "asc" : "desc";
-      // reset indicators
-      ths.forEach(function(x){ x.setAttribute("data-dir",""); const sp=x.querySelector(".sort-indicator"); if(sp) sp.textContent=""; });
-      th.setAttribute("data-dir", newDir);
-      const indicator = th.querySelector(".sort-indicator");
-      if(indicator) indicator.textContent = newDir==="asc"?"▲":"▼";
-      sortTable(table, idx, newDir==="asc");
-    });
-  });
-});
-
-function parseNumericCell(cell){
-  const ds = cell.getAttribute("data-sort");
-  if(ds !== null && ds.length>0){
-    const n = Number(ds);
-    if(!isNaN(n)) return n;
-  }
-  // fallback: try strip % and commas
-  const txt = cell.textContent.replace(/%/g,'').replace(/,/g,'').trim();
-  const n = Number(txt);
-  if(!isNaN(n)) return n;
-  return NaN;
-}
-
-function sortTable(table, colIndex, asc){
-  const tbody = table.tBodies[0];
-  const rows = Array.from(tbody.rows);
-  rows.sort(function(a,b){
-    const aCell = a.cells[colIndex];
-    const bCell = b.cells[colIndex];
-    const aVal = parseNumericCell(aCell);
-    const bVal = parseNumericCell(bCell);
-    const aNan = Number.isNaN(aVal);
-    const bNan = Number.isNaN(bVal);
-    if(aNan && bNan) return 0;
-    if(aNan) return 1; // push NaN to bottom
-    if(bNan) return -1;
-    if(aVal < bVal) return asc ? -1 : 1;
-    if(aVal > bVal) return asc ? 1 : -1;
-    // tie-breaker: company name (first cell)
-    const aName = a.cells[0].textContent.trim().toLowerCase();
-    const bName = b.cells[0].textContent.trim().toLowerCase();
-    return aName < bName ? -1 : (aName > bName ? 1 : 0);
-  });
-  // re-append rows in new order
-  rows.forEach(function(r){ tbody.appendChild(r); });
-}
-</script>`)
+	sb.WriteString(scriptTag("table.js"))
 
 	sb.WriteString("</head><body>")
+	sb.WriteString("<button type='button' class='print-btn' onclick='window.print()' title='landscape, one table header per page'>Print / Save PDF</button>")
 	sb.WriteString("<h2>Quarterly Revenue & Net Profit comparison</h2>")
+	if opts.Live {
+		sb.WriteString("<p id='liveStatus' class='small' role='status'></p>")
+	}
+	writeTopMoversSection(&sb, results, 10, opts.ZeroBase)
+	if opts.Date != "" {
+		writeCohortSection(&sb, opts.Date, results, opts.History, opts.ZeroBase)
+	}
+	writePeerSection(&sb, results, opts.Peers, opts.History, opts.ZeroBase)
+	writePortfolioSection(&sb, results, opts.Portfolio, opts.ZeroBase)
+	if pinned > 0 {
+		sb.WriteString(fmt.Sprintf("<p class='small'><span class='star'>★</span> Watchlist companies (%d) are pinned to the top.</p>", pinned))
+	}
+	sb.WriteString("<div class='table-tools'><label>Filter companies <input type='search' id='rowFilter' placeholder='name or symbol'></label>" +
+		"<details><summary>Columns</summary><div id='columnList'></div></details>" +
+		"<button type='button' id='resetView' title='forget the saved sort, filter and columns'>Reset view</button>" +
+		"<button type='button' id='exportNotes' title='download your notes as JSON'>Export notes</button>" +
+		"<button type='button' id='importNotes' title='merge notes from an exported JSON file'>Import notes</button>" +
+		"<input type='file' id='importNotesFile' accept='application/json,.json' hidden></div>")
 	// build table with id for JS
-	sb.WriteString("<table id='reportTable'><thead><tr><th>Company <span class='sort-indicator'></span></th>")
-	for _, q := range headerQuarters {
-		sb.WriteString("<th colspan='2'>" + html.EscapeString(q) + " <span class='sort-indicator'></span></th>")
+	sb.WriteString("<table id='reportTable'><caption class='sr-only'>Quarterly results by company; use the column header buttons to sort</caption><thead><tr>" + sortableTh("Company", "", ""))
+	listings := hasListings(results)
+	if listings {
+		sb.WriteString(sortableTh("Exchange", "BSE code and NSE symbol (linked to its NSE quote); sorts by the BSE code", ""))
+	}
+	for i, q := range headerQuarters {
+		sb.WriteString(sortableTh(q, "", " colspan='2' data-col='q"+fmt.Sprint(i+1)+"'"))
 	}
 	// Last-2 percent columns (explicit)
-	sb.WriteString("<th>Last-2 %Δ Rev <span class='sort-indicator'></span></th><th>Last-2 %Δ NP <span class='sort-indicator'></span></th>")
+	sb.WriteString(sortableTh("Last-2 %Δ Rev", growthMethodology, "") + sortableTh("Last-2 %Δ NP", growthMethodology, ""))
 	// avg3 change columns
-	sb.WriteString("<th>Δ Avg3 Rev <span class='sort-indicator'></span></th><th>Δ Avg3 NP <span class='sort-indicator'></span></th>")
+	sb.WriteString(sortableTh("Δ Avg3 Rev", growthMethodology, "") + sortableTh("Δ Avg3 NP", growthMethodology, ""))
+	valuation := hasValuation(results)
+	if valuation {
+		sb.WriteString(sortableTh("P/E", "price / TTM EPS (else market cap / TTM net profit); blank when loss-making", ""))
+		sb.WriteString(sortableTh("P/B", "price / book value per share", ""))
+		sb.WriteString(sortableTh("EV/EBITDA", "enterprise value / TTM EBITDA", ""))
+	}
+	returns := hasReturns(results)
+	if returns {
+		sb.WriteString(sortableTh("ROE", "return on equity, latest year of the annual results", ""))
+		sb.WriteString(sortableTh("ROCE", "return on capital employed, latest year of the annual results", ""))
+	}
+	debt := hasDebt(results)
+	if debt {
+		sb.WriteString(sortableTh("D/E", "total debt / equity, latest year of the annual results", ""))
+		sb.WriteString(sortableTh("Int. cover", "EBIT / interest, latest quarter", ""))
+	}
+	holding := hasHolding(results)
+	if holding {
+		sb.WriteString(sortableTh("Promoter", "promoter holding, with the change in points since it last moved", ""))
+		sb.WriteString(sortableTh("Pledged", "share of the promoter holding pledged, with the change in points", ""))
+	}
+	consensus := hasConsensus(results)
+	if consensus {
+		sb.WriteString(sortableTh("Consensus", "how the analysts' consensus moved in the weeks before the result, and the beat or miss against it; sorts by the beat", ""))
+	}
+	positions := opts.Portfolio.hasPositions(results)
+	if positions {
+		sb.WriteString(sortableTh("Position", "your holding at the current price; quantity, average price and gain on hover", ""))
+		sb.WriteString(sortableTh("Impact", "the quarter's change in net profit as a share of TTM profit, applied to your position: the result's worth at constant P/E", ""))
+	}
+	// extra registry metrics and computed columns from config
+	for _, m := range opts.Metrics {
+		sb.WriteString(sortableTh(m.Label, "latest quarter; dump keys "+strings.Join(m.Keys, ", "), ""))
+	}
+	for _, c := range opts.Columns {
+		sb.WriteString(sortableTh(c.Name, c.Expr.String(), ""))
+	}
+	purposes := hasPurposes(results)
+	if purposes {
+		sb.WriteString("<th>Purpose</th>")
+	}
+	declared := hasDeclared(results)
+	if declared {
+		sb.WriteString(sortableTh("Declared", "when the results filing reached BSE (IST): before the open, during market hours or after the close", ""))
+	}
+	filings := hasFilings(results)
+	if filings {
+		sb.WriteString("<th title='BSE filings: results PDF, investor presentation, earnings call, announcements'>Filings</th>")
+	}
+	if len(opts.Notes) > 0 {
+		sb.WriteString("<th>Notes</th>")
+	}
 	sb.WriteString("</tr><tr><th></th>")
+	if listings {
+		sb.WriteString("<th></th>")
+	}
 	for range headerQuarters {
 		sb.WriteString("<th>Revenue</th><th>Net Profit</th>")
 	}
 	sb.WriteString("<th></th><th></th><th></th><th></th>")
+	if valuation {
+		sb.WriteString("<th></th><th></th><th></th>")
+	}
+	if returns {
+		sb.WriteString("<th></th><th></th>")
+	}
+	if debt {
+		sb.WriteString("<th></th><th></th>")
+	}
+	if holding {
+		sb.WriteString("<th></th><th></th>")
+	}
+	if consensus {
+		sb.WriteString("<th></th>")
+	}
+	if positions {
+		sb.WriteString("<th></th><th></th>")
+	}
+	sb.WriteString(strings.Repeat("<th></th>", len(opts.Metrics)+len(opts.Columns)))
+	if purposes {
+		sb.WriteString("<th></th>")
+	}
+	if declared {
+		sb.WriteString("<th></th>")
+	}
+	if filings {
+		sb.WriteString("<th></th>")
+	}
+	if len(opts.Notes) > 0 {
+		sb.WriteString("<th></th>")
+	}
 	sb.WriteString("</tr></thead><tbody>")
 
 	// collect overall stats
@@ -179,7 +324,9 @@ function sortTable(table, colIndex, asc){
 		NetProfitLatest float64
 	}
 	var stats []statRow
+	var chartRows []chartRow
 	notDeclaredCount := 0
+	swingCount := 0
 
 	for _, r := range results {
 		// embed per-row JSON (company, longName, quarters, revenue nums, netprofit nums)
@@ -187,13 +334,49 @@ function sortTable(table, colIndex, asc){
 			"company":   r.Company,
 			"longName":  r.LongName,
 			"quarters":  r.Quarters,
-			"revenue":   r.RevenueNums,
-			"netprofit": r.NetProfitNums,
+			"revenue":   jsonFloats(r.RevenueNums),
+			"netprofit": jsonFloats(r.NetProfitNums),
+		}
+		if len(r.Segments) > 0 {
+			jsObj["segments"] = segmentRows(r)
+		}
+		if r.Profile != "" {
+			jsObj["profile"], jsObj["profileUrl"] = r.Profile, r.ProfileURL
 		}
 		jb, _ := json.Marshal(jsObj)
-		sb.WriteString("<tr data-json='" + html.EscapeString(string(jb)) + "'>")
+		rowClass, star := "", ""
+		if pinned > 0 && inWatchlist(opts.Watchlist, r.Company) {
+			rowClass, star = " class='watch'", "<span class='star' title='watchlist'>★</span> "
+		}
+		sb.WriteString("<tr id='" + rowAnchor(r.Company) + "'" + rowClass + " data-json='" + html.EscapeString(string(jb)) + "'>")
 
-		sb.WriteString("<td class='left'>" + html.EscapeString(r.Company) + "<br/><span class='small'>" + html.EscapeString(r.LongName) + "</span></td>")
+		partial := ""
+		if len(r.Issues) > 0 {
+			partial = " <a href='#issues' class='small' title='" + html.EscapeString(strings.Join(r.Issues, "\n")) + "'>⚠ partial</a>"
+		}
+		badges := " " + qualityBadge(r)
+		for _, a := range r.CorpActions {
+			badges += " <span class='badge' title='announced with the results'>" + html.EscapeString(a) + "</span>"
+		}
+		if pledgeRising(r) {
+			badges += " <span class='badge warn' title='" + html.EscapeString(fmt.Sprintf("promoter pledge up %.2f points to %.2f%%", r.PledgeChange, r.Pledged)) + "'>Pledge ↑</span>"
+		}
+		if r.CrossCheck != "" {
+			badges += " <span class='badge warn' title='" + html.EscapeString("Differs from the BSE results filing: "+r.CrossCheck) + "'>≠ BSE</span>"
+		}
+		if len(r.ShareAdjustments) > 0 {
+			badges += " <span class='badge' title='" + html.EscapeString("EPS of earlier quarters adjusted to today's share count:\n"+strings.Join(r.ShareAdjustments, "\n")) + "'>EPS adj.</span>"
+		}
+		if len(r.Anomalies) > 0 {
+			badges += " <span class='badge warn' title='" + html.EscapeString("out of line with the company's own history:\n"+strings.Join(r.Anomalies, "\n")) + "'>Verify against filing</span>"
+		}
+		if r.Leverage != "" {
+			badges += " <span class='badge warn' title='" + html.EscapeString("profit growth alongside high, rising leverage: "+r.Leverage) + "'>Leveraged</span>"
+		}
+		sb.WriteString("<td class='left'>" + star + html.EscapeString(r.Company) + badges + partial + "<br/><span class='small'>" + html.EscapeString(r.LongName) + "</span></td>")
+		if listings {
+			sb.WriteString(listingCell(r))
+		}
 
 		// revenue & netprofit cells
 		for i := 0; i < 4; i++ {
@@ -203,11 +386,15 @@ function sortTable(table, colIndex, asc){
 			npNum := math.NaN()
 			if i < len(r.Revenue) && string(r.Revenue[i]) != "" {
 				rv = string(r.Revenue[i])
-				rvNum = r.RevenueNums[i]
+				if i < len(r.RevenueNums) {
+					rvNum = r.RevenueNums[i]
+				}
 			}
 			if i < len(r.NetProfit) && string(r.NetProfit[i]) != "" {
 				np = string(r.NetProfit[i])
-				npNum = r.NetProfitNums[i]
+				if i < len(r.NetProfitNums) {
+					npNum = r.NetProfitNums[i]
+				}
 			}
 			if math.IsNaN(rvNum) {
 				notDeclaredCount++
@@ -219,28 +406,17 @@ function sortTable(table, colIndex, asc){
 		}
 
 		// calculate latest vs previous % (Last-2 %Δ)
-		latestRev := math.NaN()
-		prevRev := math.NaN()
-		latestNP := math.NaN()
-		prevNP := math.NaN()
-		if len(r.RevenueNums) > 0 {
-			latestRev = r.RevenueNums[0]
-		}
-		if len(r.RevenueNums) > 1 {
-			prevRev = r.RevenueNums[1]
-		}
-		if len(r.NetProfitNums) > 0 {
-			latestNP = r.NetProfitNums[0]
+		revG, npG := latestGrowth(r, opts.ZeroBase)
+		latestRev := revG.Curr
+		latestNP := npG.Curr
+		revPctNum := revG.Pct
+		npPctNum := npG.Pct
+		if revG.Swing {
+			swingCount++
 		}
-		if len(r.NetProfitNums) > 1 {
-			prevNP = r.NetProfitNums[1]
+		if npG.Swing {
+			swingCount++
 		}
-		revPctNum := pctOrNaN(latestRev, prevRev)
-		npPctNum := pctOrNaN(latestNP, prevNP)
-		revPctStr := fmtPercentChange(latestRev, prevRev)
-		npPctStr := fmtPercentChange(latestNP, prevNP)
-		revClass := pctColorClass(latestRev, prevRev)
-		npClass := pctColorClass(latestNP, prevNP)
 
 		// compute avg last3 and prev3 change when possible (use positions: [0,1,2] and [1,2,3])
 		avg3Rev := math.NaN()
@@ -250,21 +426,23 @@ function sortTable(table, colIndex, asc){
 		if len(r.RevenueNums) >= 3 {
 			avg3Rev = avgFloats(r.RevenueNums[0:min(3, len(r.RevenueNums))])
 		}
-		if len(r.RevenueNums) >= 4 {
+		if len(r.RevenueNums) >= 4 && consecutive(r.Quarters, 4) {
 			avgPrev3Rev = avgFloats(r.RevenueNums[1:4])
 		}
 		if len(r.NetProfitNums) >= 3 {
 			avg3NP = avgFloats(r.NetProfitNums[0:min(3, len(r.NetProfitNums))])
 		}
-		if len(r.NetProfitNums) >= 4 {
+		if len(r.NetProfitNums) >= 4 && consecutive(r.Quarters, 4) {
 			avgPrev3NP = avgFloats(r.NetProfitNums[1:4])
 		}
-		avg3RevPctNum := pctOrNaN(avg3Rev, avgPrev3Rev)
-		avg3NPPctNum := pctOrNaN(avg3NP, avgPrev3NP)
-		avg3RevPctStr := fmtPercentChange(avg3Rev, avgPrev3Rev)
-		avg3NPPctStr := fmtPercentChange(avg3NP, avgPrev3NP)
+		avg3RevG := computeGrowth(avg3Rev, avgPrev3Rev, opts.ZeroBase)
+		avg3NPG := computeGrowth(avg3NP, avgPrev3NP, opts.ZeroBase)
+		avg3RevPctNum := avg3RevG.Pct
+		avg3NPPctNum := avg3NPG.Pct
 		avg3Class := "neutral"
-		if !math.IsNaN(avg3Rev) && !math.IsNaN(avgPrev3Rev) && avgPrev3Rev != 0 {
+		if avg3RevG.Swing {
+			avg3Class = avg3RevG.class() + " highlight"
+		} else if !math.IsNaN(avg3Rev) && !math.IsNaN(avgPrev3Rev) && avgPrev3Rev != 0 {
 			if (avg3Rev-avgPrev3Rev)/math.Abs(avgPrev3Rev) > 0.5 {
 				avg3Class = "positive highlight"
 			} else if (avg3Rev-avgPrev3Rev)/math.Abs(avgPrev3Rev) < -0.5 {
@@ -273,11 +451,72 @@ function sortTable(table, colIndex, asc){
 		}
 
 		// Last-2 %Δ columns with numeric data-sort for sorting
-		sb.WriteString("<td class='" + revClass + "' data-sort='" + numSortValue(revPctNum) + "' style='font-weight:600;text-align:center'>" + html.EscapeString(revPctStr) + "</td>")
-		sb.WriteString("<td class='" + npClass + "' data-sort='" + numSortValue(npPctNum) + "' style='font-weight:600;text-align:center'>" + html.EscapeString(npPctStr) + "</td>")
+		sb.WriteString("<td class='" + revG.class() + "' data-sort='" + numSortValue(revG.sortKey(latestRev)) + "' title='" + html.EscapeString(revG.title()) + "' style='font-weight:600;text-align:center'>" + html.EscapeString(revG.String()) + "</td>")
+		sb.WriteString("<td class='" + npG.class() + "' data-sort='" + numSortValue(npG.sortKey(latestRev)) + "' title='" + html.EscapeString(npG.title()) + "' style='font-weight:600;text-align:center'>" + html.EscapeString(npG.String()) + "</td>")
 		// avg3 columns
-		sb.WriteString("<td class='" + avg3Class + "' data-sort='" + numSortValue(avg3RevPctNum) + "' style='text-align:center'>" + html.EscapeString(avg3RevPctStr) + "</td>")
-		sb.WriteString("<td class='" + avg3Class + "' data-sort='" + numSortValue(avg3NPPctNum) + "' style='text-align:center'>" + html.EscapeString(avg3NPPctStr) + "</td>")
+		sb.WriteString("<td class='" + avg3Class + "' data-sort='" + numSortValue(avg3RevG.sortKey(avg3Rev)) + "' title='" + html.EscapeString(avg3RevG.title()) + "' style='text-align:center'>" + html.EscapeString(avg3RevG.String()) + "</td>")
+		sb.WriteString("<td class='" + avg3Class + "' data-sort='" + numSortValue(avg3NPG.sortKey(avg3Rev)) + "' title='" + html.EscapeString(avg3NPG.title()) + "' style='text-align:center'>" + html.EscapeString(avg3NPG.String()) + "</td>")
+		if valuation {
+			v := Valuate(r)
+			for _, x := range []float64{v.PE, v.PB, v.EVEBITDA} {
+				sb.WriteString("<td data-sort='" + numSortValue(x) + "'>" + formatMultiple(x) + "</td>")
+			}
+		}
+		if returns {
+			for _, x := range []float64{r.ROE, r.ROCE} {
+				sb.WriteString("<td data-sort='" + numSortValue(x) + "' title='" + html.EscapeString(r.AnnualYear) + "'>" + formatPct(x) + "</td>")
+			}
+		}
+		if debt {
+			cov := interestCoverage(r, 0)
+			sb.WriteString("<td data-sort='" + numSortValue(r.DebtToEquity) + "' title='" + html.EscapeString("debt "+Column{Format: "cr"}.String(r.Debt)) + "'>" + formatRatio(r.DebtToEquity) + "</td>")
+			sb.WriteString("<td data-sort='" + numSortValue(cov) + "'>" + formatMultiple(cov) + "</td>")
+		}
+		if holding {
+			pledgeClass := ""
+			if pledgeRising(r) {
+				pledgeClass = "negative flag"
+			}
+			sb.WriteString("<td data-sort='" + numSortValue(r.PromoterHolding) + "'>" + formatHolding(r.PromoterHolding, r.HoldingChange) + "</td>")
+			sb.WriteString("<td class='" + pledgeClass + "' data-sort='" + numSortValue(r.Pledged) + "'>" + formatHolding(r.Pledged, r.PledgeChange) + "</td>")
+		}
+		if consensus {
+			sb.WriteString(consensusCell(r))
+		}
+		if positions {
+			sb.WriteString(opts.Portfolio.positionCells(r))
+		}
+		for _, m := range opts.Metrics {
+			vals := r.Metrics[m.Name]
+			curr, prev := math.NaN(), math.NaN()
+			if len(vals) > 0 {
+				curr = vals[0]
+			}
+			if len(vals) > 1 {
+				prev = vals[1]
+			}
+			sb.WriteString("<td class='" + m.class(curr, prev) + "' data-sort='" + numSortValue(curr) + "' title='previous quarter: " + html.EscapeString(m.String(prev)) + "'>" + html.EscapeString(m.String(curr)) + "</td>")
+		}
+		for _, c := range opts.Columns {
+			v := c.Value(r, opts.Watchlist, opts.ZeroBase)
+			sb.WriteString("<td class='" + c.class(v) + "' data-sort='" + numSortValue(v) + "'>" + html.EscapeString(c.String(v)) + "</td>")
+		}
+		if purposes {
+			purpose := r.Purpose
+			if purpose == "" {
+				purpose = "Financial Results"
+			}
+			sb.WriteString("<td class='left small'>" + html.EscapeString(purpose) + "</td>")
+		}
+		if declared {
+			sb.WriteString(declaredCell(r.DeclaredAt))
+		}
+		if filings {
+			sb.WriteString("<td class='small'>" + filingLinks(r) + "</td>")
+		}
+		if len(opts.Notes) > 0 {
+			sb.WriteString("<td class='left small'>" + html.EscapeString(opts.Notes.For(r.Company)) + "</td>")
+		}
 
 		sb.WriteString("</tr>")
 
@@ -290,24 +529,41 @@ function sortTable(table, colIndex, asc){
 			RevenueLatest:   latestRev,
 			NetProfitLatest: latestNP,
 		})
+		chartRows = append(chartRows, chartRow{
+			Company:   r.Company,
+			LongName:  r.LongName,
+			Sector:    r.Sector,
+			MarketCap: r.MarketCap,
+			Revenue:   latestRev,
+			Rev:       revG,
+			NP:        npG,
+		})
 	}
 	sb.WriteString("</tbody></table>")
+	writeIssuesSection(&sb, results, failures)
 
 	// Modal HTML (hidden by default) and tooltip container
 	sb.WriteString(`<div id="modalOverlay" style="display:none;position:fixed;left:0;top:0;width:100%;height:100%;background:rgba(0,0,0,0.5);z-index:9999;">
-  <div id="modal" style="background:#fff;width:900px;max-width:95%;margin:60px auto;padding:16px;border-radius:6px;position:relative;">
+  <div id="modal" role="dialog" aria-modal="true" aria-labelledby="modalTitle" style="background:#fff;width:900px;max-width:95%;margin:60px auto;padding:16px;border-radius:6px;position:relative;">
     <button id="modalClose" style="position:absolute;right:10px;top:10px;padding:6px 10px;">Close</button>
+    <button id="modalLink" title="copy a link that opens this chart" style="position:absolute;right:80px;top:10px;padding:6px 10px;">Copy link</button>
     <h3 id="modalTitle"></h3>
+    <p id="modalProfile" class="small" style="margin:-6px 0 10px;color:#444;display:none"></p>
     <div style="display:flex;gap:16px;flex-wrap:wrap;">
       <div style="flex:1 1 400px;min-width:260px;">
-        <canvas id="revenueChart" class="chart-canvas" style="width:100%;height:240px;border:1px solid #eee;display:block"></canvas>
+        <canvas id="revenueChart" class="chart-canvas" role="img" aria-label="Revenue by quarter" style="width:100%;height:240px;border:1px solid #eee;display:block"></canvas>
       </div>
       <div style="flex:1 1 400px;min-width:260px;">
-        <canvas id="profitChart" class="chart-canvas" style="width:100%;height:240px;border:1px solid #eee;display:block"></canvas>
+        <canvas id="profitChart" class="chart-canvas" role="img" aria-label="Net profit by quarter" style="width:100%;height:240px;border:1px solid #eee;display:block"></canvas>
       </div>
     </div>
     <div id="chartTooltip" style="position:absolute;pointer-events:none;display:none;background:#fff;padding:6px;border:1px solid #ccc;border-radius:4px;box-shadow:0 2px 6px rgba(0,0,0,0.15);font-size:12px;z-index:10000"></div>
     <div id="modalNote" class="small" style="margin-top:8px;color:#555"></div>
+    <div id="modalSegments" style="margin-top:10px"></div>
+    <div style="margin-top:10px">
+      <label for="annotation"><strong>Your note</strong></label> <span class="small">kept in this browser; export it from above the table</span>
+      <textarea id="annotation" rows="3" style="width:100%;box-sizing:border-box;margin-top:4px"></textarea>
+    </div>
   </div>
 </div>`)
 
@@ -351,242 +607,118 @@ function sortTable(table, colIndex, asc){
 			sort.Slice(avg3Stats, func(i, j int) bool { return avg3Stats[i].Avg3RevChange > avg3Stats[j].Avg3RevChange })
 			sb.WriteString("<p><strong>Highest Avg3 Revenue change:</strong> " + html.EscapeString(avg3Stats[0].Company) + " — " + fmt.Sprintf("%.2f%%", avg3Stats[0].Avg3RevChange) + "</p>")
 		}
-		// some aggregate metrics: average revenue change across companies (ignore NaN)
-		sumRev := 0.0
-		countRev := 0
-		sumNP := 0.0
-		countNP := 0
-		for _, s := range stats {
-			if !math.IsNaN(s.RevPct) {
-				sumRev += s.RevPct
-				countRev++
-			}
-			if !math.IsNaN(s.NPPct) {
-				sumNP += s.NPPct
-				countNP++
-			}
+		// some aggregate metrics: average revenue change across companies (ignore NaN,
+		// outliers per opts.Outliers)
+		names := make([]string, len(stats))
+		revPcts := make([]float64, len(stats))
+		npPcts := make([]float64, len(stats))
+		for i, s := range stats {
+			names[i], revPcts[i], npPcts[i] = s.Company, s.RevPct, s.NPPct
 		}
+		avgRevPct, countRev, revOutliers := opts.Outliers.average("Rev", names, revPcts)
+		avgNPPct, countNP, npOutliers := opts.Outliers.average("NP", names, npPcts)
 		if countRev > 0 {
-			avgRevPct := sumRev / float64(countRev)
 			sb.WriteString("<p><strong>Average latest %Δ Revenue across companies:</strong> " + fmt.Sprintf("%.2f%%", avgRevPct) + "</p>")
 		}
 		if countNP > 0 {
-			avgNPPct := sumNP / float64(countNP)
 			sb.WriteString("<p><strong>Average latest %Δ NetProfit across companies:</strong> " + fmt.Sprintf("%.2f%%", avgNPPct) + "</p>")
 		}
+		opts.Outliers.writeOutliers(&sb, append(revOutliers, npOutliers...))
+		if swingCount > 0 {
+			sb.WriteString("<p class='small' title='" + growthMethodology + "'><strong>Sign changes (loss ↔ profit):</strong> " + fmt.Sprintf("%d", swingCount) + " values shown as absolute ₹ cr swing and excluded from the averages above.</p>")
+		}
+		writeGrowthDistribution(&sb, chartRows)
 	}
 	sb.WriteString("</div>")
 
+	writeSectorSection(&sb, chartRows)
+	writeHeatmapSection(&sb, chartRows)
+	writeScatterSection(&sb, chartRows)
+
 	// Updated JS: responsive canvas, DPR scaling, redraw on hover, tooltip.
-	sb.WriteString(`<script>
-// helper: setup canvas for devicePixelRatio
-function setupCanvasForDPR(canvas){
-  const dpr = window.devicePixelRatio || 1;
-  const styleW = canvas.clientWidth;
-  const styleH = canvas.clientHeight;
-  canvas.width = Math.round(styleW * dpr);
-  canvas.height = Math.round(styleH * dpr);
-  const ctx = canvas.getContext("2d");
-  ctx.setTransform(dpr,0,0,dpr,0,0); // scale coordinates to CSS pixels
-  return ctx;
-}
-
-// drawChart: draws full chart, optionally highlight index
-function drawChart(canvas, labels, values, title, highlightIndex){
-  const ctx = setupCanvasForDPR(canvas);
-  const cw = canvas.clientWidth;
-  const ch = canvas.clientHeight;
-  // clear
-  ctx.clearRect(0,0,cw,ch);
-  // padding
-  const padLeft = 40, padRight = 20, padTop = 30, padBottom = 40;
-  const chartW = cw - padLeft - padRight;
-  const chartH = ch - padTop - padBottom;
-
-  // numeric array and compute min/max ignoring NaN
-  const nums = [];
-  for(let i=0;i<values.length;i++){
-    const v = values[i];
-    const n = (v === null || v === undefined || isNaN(Number(v))) ? NaN : Number(v);
-    nums.push(n);
-  }
-  let min = Infinity, max = -Infinity;
-  for(const v of nums){ if(!isNaN(v)){ min=Math.min(min,v); max=Math.max(max,v); } }
-  if(min===Infinity || max===-Infinity){
-    ctx.fillStyle="#666";
-    ctx.font="14px Arial";
-    ctx.fillText("No numeric data to display", padLeft, padTop + 20);
-    return;
-  }
-  // add small margins
-  if (min === max) { min = min - Math.abs(min)*0.05 - 1; max = max + Math.abs(max)*0.05 + 1; }
-  const range = max - min;
-
-  // axes
-  ctx.strokeStyle = "#ddd";
-  ctx.lineWidth = 1;
-  ctx.beginPath();
-  // y grid lines and labels
-  ctx.fillStyle = "#666";
-  ctx.font = "11px Arial";
-  const gridLines = 4;
-  for(let i=0;i<=gridLines;i++){
-    const y = padTop + (chartH * i / gridLines);
-    ctx.beginPath();
-    ctx.moveTo(padLeft, y);
-    ctx.lineTo(padLeft + chartW, y);
-    ctx.stroke();
-    const val = (max - (range * i / gridLines));
-    ctx.fillText(val.toFixed(2), 4, y+4);
-  }
-  // x-axis labels placeholders
-  const n = nums.length;
-  const stepX = n>1 ? chartW / (n-1) : chartW;
-  // draw line
-  ctx.beginPath();
-  ctx.strokeStyle = "#2c7be5";
-  ctx.lineWidth = 2;
-  let firstDrawn = false;
-  for(let i=0;i<n;i++){
-    const v = nums[i];
-    if(isNaN(v)) continue;
-    const x = padLeft + i * stepX;
-    const y = padTop + chartH - ((v - min) / range) * chartH;
-    if(!firstDrawn){ ctx.moveTo(x,y); firstDrawn = true; } else { ctx.lineTo(x,y); }
-  }
-  ctx.stroke();
-  // draw points and labels
-  for(let i=0;i<n;i++){
-    const v = nums[i];
-    const x = padLeft + i * stepX;
-    const y = isNaN(v) ? padTop + chartH : padTop + chartH - ((v - min) / range) * chartH;
-    // x label
-    const lab = labels[i] || "";
-    ctx.fillStyle = "#333";
-    ctx.font = "11px Arial";
-    ctx.fillText(lab, x - 20, padTop + chartH + 16, 80);
-    if(!isNaN(v)){
-      ctx.beginPath();
-      ctx.fillStyle = (i===highlightIndex) ? "#ff6b6b" : "#2c7be5";
-      ctx.arc(x, y, (i===highlightIndex)?6:4, 0, Math.PI*2);
-      ctx.fill();
-      // small value near point
-      ctx.fillStyle = "#000";
-      ctx.font = "11px Arial";
-      if (i===highlightIndex) {
-        ctx.fillText(v.toString(), x+8, y-8);
-      }
-    } else {
-      // draw hollow marker for missing
-      ctx.beginPath();
-      ctx.strokeStyle = "#bbb";
-      ctx.arc(x, padTop + chartH, 3, 0, Math.PI*2);
-      ctx.stroke();
-    }
-  }
-  // title
-  ctx.fillStyle="#111";
-  ctx.font="bold 13px Arial";
-  ctx.fillText(title, padLeft, 16);
-  // store computed points for hover interactions
-  const pts = [];
-  for(let i=0;i<n;i++){
-    const px = padLeft + i * stepX;
-    const py = isNaN(nums[i]) ? padTop + chartH : padTop + chartH - ((nums[i] - min) / range) * chartH;
-    pts.push({x:px,y:py,val:nums[i],label:labels[i]||""});
-  }
-  canvas._chartPoints = pts;
-}
-
-// utility: get mouse pos in CSS pixels relative to canvas
-function getMousePos(canvas, evt){
-  const rect = canvas.getBoundingClientRect();
-  const x = evt.clientX - rect.left;
-  const y = evt.clientY - rect.top;
-  return {x:x, y:y};
-}
-
-// attach hover handlers to canvas
-function attachHover(canvas, titlePrefix){
-  if(!canvas) return;
-  // remove existing listeners (simple approach)
-  canvas.onmousemove = null;
-  canvas.onmouseleave = null;
-  const tooltip = document.getElementById("chartTooltip");
-  canvas.onmousemove = function(e){
-    const pos = getMousePos(canvas, e);
-    const pts = canvas._chartPoints || [];
-    let nearest = -1;
-    let minDist = 1e9;
-    for(let i=0;i<pts.length;i++){
-      const d = Math.hypot(pos.x - pts[i].x, pos.y - pts[i].y);
-      if(d < minDist){ minDist = d; nearest = i; }
-    }
-    // consider radius threshold (20px)
-    if(minDist <= 20 && nearest >= 0){
-      // redraw with highlight
-      const allLabels = pts.map(p=>p.label);
-      const allVals = pts.map(p=>p.val);
-      drawChart(canvas, allLabels, allVals, titlePrefix, nearest);
-      // show tooltip near cursor
-      const p = pts[nearest];
-      tooltip.style.display = "block";
-      tooltip.style.left = (e.clientX + 12) + "px";
-      tooltip.style.top = (e.clientY + 12) + "px";
-      tooltip.innerHTML = "<strong>"+ (p.label || "") + "</strong><br/>" + (isNaN(p.val) ? "N/A" : p.val);
-    } else {
-      // no highlight
-      const allLabels = pts.map(p=>p.label);
-      const allVals = pts.map(p=>p.val);
-      drawChart(canvas, allLabels, allVals, titlePrefix, -1);
-      tooltip.style.display = "none";
-    }
-  };
-  canvas.onmouseleave = function(){
-    const pts = canvas._chartPoints || [];
-    const allLabels = pts.map(p=>p.label);
-    const allVals = pts.map(p=>p.val);
-    drawChart(canvas, allLabels, allVals, titlePrefix, -1);
-    const tooltip = document.getElementById("chartTooltip");
-    tooltip.style.display = "none";
-  };
-}
-
-// open modal helper existing in code: ensure we call attachHover after initial draw
-document.addEventListener("DOMContentLoaded", function(){
-  const table = document.getElementById("reportTable");
-  if(!table) return;
-  const rows = table.tBodies[0].rows;
-  for(let r of rows){
-    r.style.cursor = "pointer";
-    r.addEventListener("click", function(e){
-      // open modal with row
-      const j = r.getAttribute("data-json");
-      if(!j) return;
-      let obj;
-      try { obj = JSON.parse(j); } catch(err){ console.error("invalid row json", err); return; }
-      const title = obj.company + " — " + (obj.longName || "");
-      document.getElementById("modalTitle").textContent = title;
-      const quarters = obj.quarters || [];
-      const revenue = obj.revenue || [];
-      const profit = obj.netprofit || [];
-      document.getElementById("modalNote").textContent = "Hover over points to see values. Showing up to 4 quarters.";
-      const revCanvas = document.getElementById("revenueChart");
-      const profCanvas = document.getElementById("profitChart");
-      drawChart(revCanvas, quarters, revenue, "Revenue", -1);
-      drawChart(profCanvas, quarters, profit, "Net Profit", -1);
-      attachHover(revCanvas, "Revenue");
-      attachHover(profCanvas, "Net Profit");
-      document.getElementById("modalOverlay").style.display = "block";
-    });
-  }
-  const closeBtn = document.getElementById("modalClose");
-  if(closeBtn) closeBtn.addEventListener("click", function(){ document.getElementById("modalOverlay").style.display = "none"; document.getElementById("chartTooltip").style.display = "none"; });
-});
-</script>`)
-
-	// write file
-	return os.WriteFile(path, []byte(sb.String()), 0644)
+	sb.WriteString(scriptTag("report.js"))
+	if opts.Live {
+		sb.WriteString(scriptTag("live.js"))
+	}
+
+	return sb.String()
+}
+
+// sortableTh renders a column header whose label is a button, so the column can be sorted
+// from the keyboard; the sorter keeps aria-sort up to date. attrs is added to the th as is.
+// The column is known to the saved view by its label unless attrs sets data-col.
+func sortableTh(label, title, attrs string) string {
+	if !strings.Contains(attrs, "data-col=") {
+		attrs += " data-col='" + html.EscapeString(label) + "'"
+	}
+	if title != "" {
+		attrs += " title='" + html.EscapeString(title) + "'"
+	}
+	return "<th scope='col' aria-sort='none'" + attrs + "><button type='button' class='sort'>" + html.EscapeString(label) +
+		"<span class='sort-indicator' aria-hidden='true'></span></button></th>"
+}
+
+// writeIssuesSection lists companies that failed outright and results whose source data
+// had problems, with the diagnostics for each
+func writeIssuesSection(sb *strings.Builder, results []CompanyResult, failures []Failure) {
+	var partial []CompanyResult
+	for _, r := range results {
+		if len(r.Issues) > 0 {
+			partial = append(partial, r)
+		}
+	}
+	if len(failures) == 0 && len(partial) == 0 {
+		return
+	}
+	sb.WriteString("<div id='issues' class='summary'><h3>Failed &amp; partial</h3>")
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].Company < failures[j].Company })
+		sb.WriteString(fmt.Sprintf("<h4>Failed (%d) — not in the table</h4><table><thead><tr><th>Company</th><th>Error</th></tr></thead><tbody>", len(failures)))
+		for _, f := range failures {
+			sb.WriteString("<tr><td class='left'>" + html.EscapeString(f.Company) + "<br/><span class='small'>" + html.EscapeString(f.LongName) + "</span></td>")
+			sb.WriteString("<td class='left'>" + html.EscapeString(f.Error) + "</td></tr>")
+		}
+		sb.WriteString("</tbody></table>")
+	}
+	if len(partial) > 0 {
+		sort.Slice(partial, func(i, j int) bool { return partial[i].Company < partial[j].Company })
+		sb.WriteString(fmt.Sprintf("<h4>Partial data (%d)</h4><table><thead><tr><th>Company</th><th>Issues</th></tr></thead><tbody>", len(partial)))
+		for _, r := range partial {
+			sb.WriteString("<tr><td class='left'><a href='#" + rowAnchor(r.Company) + "'>" + html.EscapeString(r.Company) + "</a></td><td class='left'><ul style='margin:0;padding-left:18px'>")
+			for _, is := range r.Issues {
+				sb.WriteString("<li>" + html.EscapeString(is) + "</li>")
+			}
+			sb.WriteString("</ul></td></tr>")
+		}
+		sb.WriteString("</tbody></table>")
+	}
+	sb.WriteString("</div>")
+}
+
+// quantile returns the q-th quantile (0..1) of sorted values using linear interpolation; NaN if empty
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	if lo == hi {
+		return sorted[lo]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+// validSorted returns the non-NaN values sorted ascending
+func validSorted(vals []float64) []float64 {
+	out := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		if !math.IsNaN(v) {
+			out = append(out, v)
+		}
+	}
+	sort.Float64s(out)
+	return out
 }
 
 // helper: return percent as float64 or NaN
@@ -601,6 +733,133 @@ func pctOrNaN(curr, prev float64) float64 {
 	return (curr - prev) / math.Abs(prev) * 100.0
 }
 
+// latestGrowth returns revenue and NP growth of the latest quarter vs the previous one,
+// under the zero_base policy
+func latestGrowth(r CompanyResult, zeroBase string) (rev, np growth) {
+	return quarterGrowth(r.Quarters, r.RevenueNums, 0, zeroBase), quarterGrowth(r.Quarters, r.NetProfitNums, 0, zeroBase)
+}
+
+// quarterGrowth returns the growth of vals[i] over the quarter before it; the previous
+// figure is unknown when the source skipped a quarter in between
+func quarterGrowth(qs []Quarter, vals []float64, i int, zeroBase string) growth {
+	prev := valueAt(vals, i+1)
+	if !consecutive(qs[min(i, len(qs)):], 2) {
+		prev = math.NaN()
+	}
+	return computeGrowth(valueAt(vals, i), prev, zeroBase)
+}
+
+// rowAnchor returns the element id of a company's row in the main table
+func rowAnchor(company string) string {
+	var b strings.Builder
+	b.WriteString("row-")
+	for _, c := range company {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
+			b.WriteRune(c)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// growthMethodology is shown as a tooltip on the growth column headers
+const growthMethodology = "Percent change vs the previous period, divided by |previous|. " +
+	"When the sign flips (loss to profit or profit to loss) a percentage is misleading, " +
+	"so the absolute change in ₹ cr is shown instead (marked ⇅) and left out of numeric summaries."
+
+// growth is the change between two periods. When the signs of curr and prev differ,
+// Swing is set and Abs (curr-prev, in ₹ cr) replaces the percentage. Growth off a zero
+// prev sets ZeroBase and follows Policy.
+type growth struct {
+	Curr, Prev float64
+	Pct        float64 // NaN when missing, Swing, or prev==0 (unless the policy is "hundred")
+	Abs        float64 // NaN when either side is missing
+	Swing      bool
+	ZeroBase   bool
+	Policy     string // the zero_base policy (Config.ZeroBase) the growth was computed under
+}
+
+// computeGrowth picks percent change or absolute swing depending on the signs of curr and
+// prev; growth off a zero prev follows the zero_base policy ("" is "na")
+func computeGrowth(curr, prev float64, zeroBase string) growth {
+	if zeroBase == "" {
+		zeroBase = zeroBaseNA
+	}
+	g := growth{Curr: curr, Prev: prev, Pct: math.NaN(), Abs: math.NaN(), Policy: zeroBase}
+	if math.IsNaN(curr) || math.IsNaN(prev) {
+		return g
+	}
+	g.Abs = curr - prev
+	if (curr < 0 && prev > 0) || (curr > 0 && prev < 0) {
+		g.Swing = true
+		return g
+	}
+	if prev == 0 {
+		g.ZeroBase = true
+		g.Pct = zeroBasePct(curr, zeroBase)
+		return g
+	}
+	g.Pct = pctOrNaN(curr, prev)
+	return g
+}
+
+// sortKey is the number the growth orders by in the report and SortResults; NaN sorts last.
+// revenue is the quarter's revenue (₹ cr): a swing sorts by its size as a % of it, among
+// the % changes (see swingSortKey).
+func (g growth) sortKey(revenue float64) float64 {
+	if g.Swing {
+		return swingSortKey(g.Abs, revenue)
+	}
+	if g.ZeroBase {
+		return zeroBaseSortKey(g, revenue)
+	}
+	return g.Pct
+}
+
+// swingSortKey is the sort key of an absolute change of abs ₹ cr: abs as a % of revenue, so
+// a ₹5 cr turnaround on ₹100 cr of sales sorts with a +5% change and a ₹0.01 cr one near
+// zero. It is NaN (sorted last) when revenue isn't positive, as for a swing of revenue itself.
+func swingSortKey(abs, revenue float64) float64 {
+	if !(revenue > 0) {
+		return math.NaN()
+	}
+	return abs / revenue * 100
+}
+
+// String renders the growth for a table cell
+func (g growth) String() string {
+	if g.Swing {
+		return fmt.Sprintf("%+.2f cr ⇅", g.Abs)
+	}
+	if g.ZeroBase {
+		return zeroBaseString(g)
+	}
+	return fmtPercentChange(g.Curr, g.Prev)
+}
+
+// class returns the css color class for the growth cell
+func (g growth) class() string {
+	if g.Swing {
+		if g.Abs > 0 {
+			return "positive"
+		}
+		return "negative"
+	}
+	return pctColorClass(g.Curr, g.Prev)
+}
+
+// title explains the value shown, used as the cell tooltip
+func (g growth) title() string {
+	if g.Swing {
+		return fmt.Sprintf("Sign changed (%s → %s): absolute change in ₹ cr shown instead of %%", formatFloat(g.Prev), formatFloat(g.Curr))
+	}
+	if g.ZeroBase {
+		return fmt.Sprintf("Previous period was 0 (now %s); zero_base policy %q", formatFloat(g.Curr), g.Policy)
+	}
+	return ""
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -608,11 +867,136 @@ func min(a, b int) int {
 	return b
 }
 
+// jsonFloat returns nil for NaN so values can be json-marshalled (encoding/json rejects NaN)
+func jsonFloat(v float64) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return v
+}
+
+// jsonFloats maps jsonFloat over a slice
+func jsonFloats(vals []float64) []interface{} {
+	out := make([]interface{}, len(vals))
+	for i, v := range vals {
+		out[i] = jsonFloat(v)
+	}
+	return out
+}
+
 // numSortValue converts a float64 into a string for data-sort attribute
 func numSortValue(v float64) string {
 	if math.IsNaN(v) {
 		return ""
 	}
+	if math.IsInf(v, 1) {
+		// growth off a zero base under the "new" policy; JS parses these
+		return "Infinity"
+	}
+	if math.IsInf(v, -1) {
+		return "-Infinity"
+	}
 	// use sufficient precision
 	return fmt.Sprintf("%.6f", v)
 }
+
+// hasPurposes reports whether any result comes from a meeting not about results
+func hasPurposes(results []CompanyResult) bool {
+	for _, r := range results {
+		if r.Purpose != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasListings reports whether any result has its BSE code or NSE symbol
+func hasListings(results []CompanyResult) bool {
+	for _, r := range results {
+		if r.ScripCode != "" || r.NSESymbol != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// listingCell renders the exchange codes of a result, the NSE symbol linked to its NSE
+// quote page
+func listingCell(r CompanyResult) string {
+	var lines []string
+	if r.ScripCode != "" {
+		lines = append(lines, "BSE "+html.EscapeString(r.ScripCode))
+	}
+	if r.NSESymbol != "" {
+		lines = append(lines, "NSE <a href='https://www.nseindia.com/get-quotes/equity?symbol="+url.QueryEscape(r.NSESymbol)+"'>"+html.EscapeString(r.NSESymbol)+"</a>")
+	} else if r.ScripCode != "" {
+		lines = append(lines, "BSE only")
+	}
+	return "<td class='left small' data-sort='" + html.EscapeString(r.ScripCode) + "'>" + strings.Join(lines, "<br>") + "</td>"
+}
+
+// hasDeclared reports whether any result has its declaration time
+func hasDeclared(results []CompanyResult) bool {
+	for _, r := range results {
+		if !r.DeclaredAt.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// marketSession names the part of the NSE/BSE trading day t (IST) falls in
+func marketSession(t time.Time) string {
+	t = t.In(istZone)
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return "market closed"
+	}
+	switch hm := t.Hour()*60 + t.Minute(); {
+	case hm < 9*60+15:
+		return "before the open"
+	case hm < 15*60+30:
+		return "market hours"
+	default:
+		return "after the close"
+	}
+}
+
+// declaredCell renders the time of day the results were declared and its market
+// session, sorting by the time; blank when unknown
+func declaredCell(t time.Time) string {
+	if t.IsZero() {
+		return "<td data-sort=''></td>"
+	}
+	t = t.In(istZone)
+	return "<td class='small' data-sort='" + fmt.Sprint(t.Unix()) + "' title='" + t.Format("02 Jan 2006 15:04:05") + " IST'>" +
+		t.Format("15:04") + "<br>" + marketSession(t) + "</td>"
+}
+
+// hasFilings reports whether any result links to a BSE filing
+func hasFilings(results []CompanyResult) bool {
+	for _, r := range results {
+		if r.AnnouncementURL != "" || r.PDFURL != "" || r.PresentationURL != "" || r.CallURL != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// filingLinks renders the links of a result to its results PDF, investor presentation,
+// earnings call and BSE announcements
+func filingLinks(r CompanyResult) string {
+	var links []string
+	if r.PDFURL != "" {
+		links = append(links, "<a href='"+html.EscapeString(r.PDFURL)+"' target='_blank' rel='noopener' title='results filing (PDF)'>PDF</a>")
+	}
+	if r.PresentationURL != "" {
+		links = append(links, "<a href='"+html.EscapeString(r.PresentationURL)+"' target='_blank' rel='noopener' title='investor presentation'>Deck</a>")
+	}
+	if r.CallURL != "" {
+		links = append(links, "<a href='"+html.EscapeString(r.CallURL)+"' target='_blank' rel='noopener' title='earnings call announcement'>Call</a>")
+	}
+	if r.AnnouncementURL != "" {
+		links = append(links, "<a href='"+html.EscapeString(r.AnnouncementURL)+"' target='_blank' rel='noopener' title='announcements on bseindia.com'>BSE</a>")
+	}
+	return strings.Join(links, " · ")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// runReprocess implements `quarter-compare reprocess -date D`: parse the archived raw
+// responses of a stored day again with the current parser, update the history and
+// rewrite the report, so parser fixes reach past days without refetching
+func runReprocess(args []string) {
+	fs := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	date := fs.String("date", "", "stored day to reprocess (2006-01-02)")
+	out := fs.String("o", "", "output file (default: config output, else <app dir>/report.html)")
+	openFlag := fs.Bool("open", false, "open the report in the default browser when written")
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+	cfg := mustLoadConfig(*configPath)
+	if *date == "" {
+		log.Fatalf("reprocess: -date is required")
+	}
+
+	db, err := openHistory()
+	if err != nil {
+		log.Fatalf("open history: %v", err)
+	}
+	defer db.Close()
+	run, ok, err := storedRun(db, *date)
+	if err != nil {
+		log.Fatalf("load history: %v", err)
+	}
+	if !ok {
+		log.Fatalf("no stored results for %q; see `quarter-compare history`", *date)
+	}
+	results, failures, n := reprocessRun(cfg, run)
+	if n == 0 {
+		log.Fatalf("reprocess: nothing archived for %s (is archive.enabled set?)", run.Date)
+	}
+	if err := saveRun(db, RunRecord{Date: run.Date, Results: results, Failures: failures}); err != nil {
+		log.Fatalf("save history: %v", err)
+	}
+	fmt.Printf("%s: re-parsed %d companies from the archive (%d results, %d failed)\n", run.Date, n, len(results), len(failures))
+
+	if *out == "" {
+		if *out, err = reportPath(cfg); err != nil {
+			log.Fatalf("cannot determine output path: %v", err)
+		}
+	}
+	if err := GenerateHTMLReport(*out, results, failures, mustReportOptions(cfg).withHistory(db, run.Date)); err != nil {
+		log.Fatalf("generate report: %v", err)
+	}
+	fmt.Printf("report for %s saved to %s\n", run.Date, *out)
+	showReport(*out, *openFlag)
+}
+
+// reprocessRun re-parses the archived fundamentals of every company of run, results and
+// failures alike, and returns the updated day and how many companies were re-parsed.
+// Companies without an archive are kept as stored; a failure that now parses becomes a
+// result. Only the fundamentals are re-read: metadata, filings and badges stay as stored,
+// and the per-share figures are adjusted again with the cached share actions.
+func reprocessRun(cfg Config, run RunRecord) ([]CompanyResult, []Failure, int) {
+	asOf, _ := time.Parse("2006-01-02", run.Date)
+	reg := cfg.metricRegistry()
+	actions := loadShareActions(nil)
+	n := 0
+	var results []CompanyResult
+	for _, r := range run.Results {
+		cr, err := parseArchived(cfg, run.Date, r.Company, reg, asOf)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			log.Printf("reprocess: %s: %v (keeping the stored result)", r.Company, err)
+		default:
+			r = withFundamentals(r, cr)
+			adjustPerShare(&r, actions[r.ScripCode], asOf)
+			n++
+		}
+		results = append(results, r)
+	}
+	var failures []Failure
+	for _, f := range run.Failures {
+		cr, err := parseArchived(cfg, run.Date, f.Company, reg, asOf)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("reprocess: %s: %v", f.Company, err)
+			}
+			failures = append(failures, f)
+			continue
+		}
+		n++
+		if !hasAnyValue(cr) {
+			failures = append(failures, f)
+			continue
+		}
+		cr.LongName = f.LongName
+		results = append(results, cr)
+	}
+	flagLeverage(results, cfg.Leverage)
+	SortResults(results, "company", cfg.ZeroBase)
+	return results, failures, n
+}
+
+// parseArchived parses a company's archived fundamentals response
+func parseArchived(cfg Config, date, company string, reg MetricRegistry, asOf time.Time) (CompanyResult, error) {
+	r, err := openArchived(cfg.Archive, date, company, "fundamentals.json")
+	if err != nil {
+		return CompanyResult{}, err
+	}
+	defer r.Close()
+	root, err := decodeFundamentals(r)
+	if err != nil {
+		return CompanyResult{}, fmt.Errorf("archived fundamentals: %v", err)
+	}
+	return ParseFundamentalsRoot(company, root, reg, asOf), nil
+}
+
+// withFundamentals returns stored with the fields companyResultFromDoc sets replaced by
+// those of parsed
+func withFundamentals(stored, parsed CompanyResult) CompanyResult {
+	stored.Quarters = parsed.Quarters
+	stored.Revenue, stored.NetProfit = parsed.Revenue, parsed.NetProfit
+	stored.RevenueNums, stored.NetProfitNums = parsed.RevenueNums, parsed.NetProfitNums
+	stored.Metrics = parsed.Metrics
+	stored.Segments = parsed.Segments
+	stored.ROE, stored.ROCE, stored.AnnualYear = parsed.ROE, parsed.ROCE, parsed.AnnualYear
+	stored.Debt, stored.DebtToEquity, stored.DebtChange = parsed.Debt, parsed.DebtToEquity, parsed.DebtChange
+	stored.Basis = parsed.Basis
+	stored.Issues = parsed.Issues
+	stored.Anomalies = parsed.Anomalies
+	stored.Leverage = "" // flagged again from the new numbers
+	stored.ShareAdjustments = nil
+	return stored
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// dump keys read from the annual tables of the fundamentals response, first present wins.
+// Ratios are used as published; otherwise they are computed from the statement lines.
+var (
+	roeKeys             = []string{"ROE_A", "ROE", "RETURN_ON_EQUITY_A"}
+	roceKeys            = []string{"ROCE_A", "ROCE", "RETURN_ON_CAPITAL_EMPLOYED_A"}
+	annualNPKeys        = []string{"NP_A", "PAT_A", "NET_PROFIT_A"}
+	ebitKeys            = []string{"EBIT_A", "PBIT_A"}
+	equityKeys          = []string{"TOTAL_EQUITY_A", "NET_WORTH_A", "SHAREHOLDERS_FUNDS_A", "EQUITY_A"}
+	capitalEmployedKeys = []string{"CAPITAL_EMPLOYED_A"}
+	debtKeys            = []string{"TOTAL_DEBT_A", "BORROWINGS_A", "DEBT_A"}
+)
+
+// annualValue is the first of keys in entry as a number, NaN when absent
+func annualValue(entry map[string]interface{}, keys []string) float64 {
+	if entry == nil {
+		return math.NaN()
+	}
+	return quarterValueToFloat64(valueFromMap(entry, keys...))
+}
+
+// averaged is the mean of curr and prev, or curr alone when prev is unknown
+func averaged(curr, prev float64) float64 {
+	if math.IsNaN(prev) {
+		return curr
+	}
+	return (curr + prev) / 2
+}
+
+// annualReturns computes ROE and ROCE (%) for the latest year of doc's annual tables.
+// Computed ratios use the average of opening and closing equity (capital employed)
+// when the previous year is there.
+func annualReturns(doc fundamentalsDoc) (roe, roce float64) {
+	if len(doc.Annual) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	curr := doc.Annual[0]
+	var prev map[string]interface{}
+	if len(doc.Annual) > 1 {
+		prev = doc.Annual[1]
+	}
+	roe = annualValue(curr, roeKeys)
+	if math.IsNaN(roe) {
+		if equity := averaged(annualValue(curr, equityKeys), annualValue(prev, equityKeys)); equity > 0 {
+			roe = annualValue(curr, annualNPKeys) / equity * 100
+		}
+	}
+	roce = annualValue(curr, roceKeys)
+	if math.IsNaN(roce) {
+		capital := func(e map[string]interface{}) float64 {
+			if v := annualValue(e, capitalEmployedKeys); !math.IsNaN(v) {
+				return v
+			}
+			return annualValue(e, equityKeys) + annualValue(e, debtKeys)
+		}
+		if ce := averaged(capital(curr), capital(prev)); ce > 0 {
+			roce = annualValue(curr, ebitKeys) / ce * 100
+		}
+	}
+	return roe, roce
+}
+
+// hasReturns reports whether any result has ROE or ROCE
+func hasReturns(results []CompanyResult) bool {
+	for _, r := range results {
+		if !math.IsNaN(r.ROE) || !math.IsNaN(r.ROCE) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatPct formats a percentage for a table cell
+func formatPct(v float64) string {
+	if math.IsNaN(v) {
+		return "–"
+	}
+	return fmt.Sprintf("%.1f%%", v)
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The scrip master is BSE's list of every listed equity: code, symbol, name, ISIN, group
+// and industry, joined on ISIN with NSE's equity list for the NSE symbol. It is kept in
+// <cache dir>/scripmaster.json, downloaded again once it is older than
+// scrip_master.refresh, and is the reference companies are joined on: it fills in codes,
+// names and ISINs the other sources lack, filters by BSE group, and remembers the symbols
+// and names a company had before a rename.
+
+// scripMasterURL lists the active equity scrips of every group
+const scripMasterURL = "https://api.bseindia.com/BseIndiaAPI/api/ListofScripData/w?Group=&Scripcode=&industry=&segment=Equity&status=Active"
+
+// nseEquitiesURL is NSE's list of the equities listed there (CSV)
+const nseEquitiesURL = "https://nsearchives.nseindia.com/content/equities/EQUITY_L.csv"
+
+// defaultScripMasterRefresh is how often the scrip master is downloaded again
+const defaultScripMasterRefresh = 24 * time.Hour
+
+// Scrip is one company of the scrip master
+type Scrip struct {
+	Code     string `json:"code"`
+	ID       string `json:"id"` // the BSE symbol, usually the NSE one
+	Name     string `json:"name"`
+	ISIN     string `json:"isin,omitempty"`
+	Group    string `json:"group,omitempty"` // A, B, T, X, ...
+	Industry string `json:"industry,omitempty"`
+	Status   string `json:"status,omitempty"`
+	// NSESymbol is the company's NSE symbol; empty when it is not listed on NSE
+	NSESymbol string `json:"nse_symbol,omitempty"`
+	// FormerIDs and FormerNames are what the company was listed as before a rename,
+	// oldest first, as seen across downloads
+	FormerIDs   []string `json:"former_ids,omitempty"`
+	FormerNames []string `json:"former_names,omitempty"`
+}
+
+// names returns every symbol and name the company is or was known by
+func (s Scrip) names() []string {
+	out := append([]string{s.Code, s.ID, s.NSESymbol, s.Name}, s.FormerIDs...)
+	return append(out, s.FormerNames...)
+}
+
+// scripFieldNames lists the field names of the scrip master endpoint
+var scripFieldNames = struct {
+	Code, ID, Name, ISIN, Group, Industry, Status []string
+}{
+	Code:     []string{"SCRIP_CD", "scrip_cd", "Scrip_Code"},
+	ID:       []string{"scrip_id", "SCRIP_ID", "Scrip_Id"},
+	Name:     []string{"Issuer_Name", "Scrip_Name", "SCRIP_NAME", "LONG_NAME"},
+	ISIN:     []string{"ISIN_NUMBER", "ISIN", "isin"},
+	Group:    []string{"GROUP", "Group", "SCRIP_GROUP"},
+	Industry: []string{"INDUSTRY", "Industry", "industry"},
+	Status:   []string{"Status", "STATUS"},
+}
+
+// decodeScrips decodes a scrip master response; rows without a code are skipped
+func decodeScrips(b []byte) ([]Scrip, error) {
+	rows, err := bseRows(b)
+	if err != nil {
+		return nil, err
+	}
+	var out []Scrip
+	for _, m := range rows {
+		s := Scrip{
+			Code:     bseField(m, scripFieldNames.Code),
+			ID:       strings.ToUpper(bseField(m, scripFieldNames.ID)),
+			Name:     bseField(m, scripFieldNames.Name),
+			ISIN:     bseField(m, scripFieldNames.ISIN),
+			Group:    strings.ToUpper(bseField(m, scripFieldNames.Group)),
+			Industry: bseField(m, scripFieldNames.Industry),
+			Status:   bseField(m, scripFieldNames.Status),
+		}
+		if s.Code != "" {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// FetchScripMaster downloads the scrip master from url (default scripMasterURL)
+func FetchScripMaster(client *http.Client, url string) ([]Scrip, error) {
+	if url == "" {
+		url = scripMasterURL
+	}
+	if err := WarmUpBSE(client, false); err != nil {
+		log.Printf("FetchScripMaster: warm-up: %v", err)
+	}
+	b, err := fetchBSEJSON(client, url)
+	if err != nil {
+		return nil, err
+	}
+	scrips, err := decodeScrips(b)
+	if err != nil {
+		return nil, fmt.Errorf("scrip master: %v", err)
+	}
+	if len(scrips) == 0 {
+		return nil, errors.New("scrip master: no scrips listed")
+	}
+	return scrips, nil
+}
+
+// FetchNSESymbols downloads NSE's equity list from url (default nseEquitiesURL) and maps
+// each ISIN to its NSE symbol
+func FetchNSESymbols(client *http.Client, url string) (map[string]string, error) {
+	if url == "" {
+		url = nseEquitiesURL
+	}
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("accept", "text/csv,*/*")
+	req.Header.Set("user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("nse equity list status=%d", resp.StatusCode)
+	}
+	return decodeNSESymbols(resp.Body)
+}
+
+// decodeNSESymbols reads the NSE equity list CSV: the SYMBOL and ISIN NUMBER columns
+// (headers are matched ignoring case and padding)
+func decodeNSESymbols(r io.Reader) (map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("nse equity list: %v", err)
+	}
+	symCol, isinCol := -1, -1
+	for i, h := range header {
+		switch strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))) {
+		case "SYMBOL":
+			symCol = i
+		case "ISIN NUMBER", "ISIN":
+			isinCol = i
+		}
+	}
+	if symCol < 0 || isinCol < 0 {
+		return nil, fmt.Errorf("nse equity list: no SYMBOL and ISIN NUMBER columns in %q", header)
+	}
+	out := map[string]string{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("nse equity list: %v", err)
+		}
+		if symCol >= len(rec) || isinCol >= len(rec) {
+			continue
+		}
+		sym, isin := strings.TrimSpace(rec[symCol]), strings.ToUpper(strings.TrimSpace(rec[isinCol]))
+		if sym != "" && isin != "" {
+			out[isin] = sym
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("nse equity list: no symbols listed")
+	}
+	return out, nil
+}
+
+// scripMaster is the cached scrip master. A nil *scripMaster knows no company.
+type scripMaster struct {
+	path      string
+	FetchedAt time.Time `json:"fetched_at"`
+	Scrips    []Scrip   `json:"scrips"`
+
+	byCode map[string]int // index into Scrips
+	byName map[string]int // upper-cased current and former symbols and names
+}
+
+// loadScripMaster reads the cached scrip master and, when client is not nil and the
+// copy is older than cfg.Refresh, downloads it again. A failed download is logged and the
+// old copy used; nil is returned when there is none.
+func loadScripMaster(client *http.Client, cfg ScripMasterConfig) *scripMaster {
+	dir, err := cacheDir()
+	if err != nil {
+		log.Printf("loadScripMaster: %v", err)
+		return nil
+	}
+	m := &scripMaster{path: filepath.Join(dir, "scripmaster.json")}
+	b, err := os.ReadFile(m.path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, m); err != nil {
+			log.Printf("loadScripMaster: ignoring %s: %v", m.path, err)
+			m.FetchedAt, m.Scrips = time.Time{}, nil
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("loadScripMaster: %v", err)
+	}
+	m.index()
+	if client != nil && time.Since(m.FetchedAt) >= cfg.refresh() {
+		if err := m.refresh(client, cfg); err != nil {
+			log.Printf("loadScripMaster: %v", err)
+		}
+	}
+	if len(m.Scrips) == 0 {
+		return nil
+	}
+	return m
+}
+
+// refresh downloads the scrip master and the NSE symbols, merges them into m (see merge)
+// and saves it. When NSE does not answer, the NSE symbols of the last download are kept.
+func (m *scripMaster) refresh(client *http.Client, cfg ScripMasterConfig) error {
+	fresh, err := FetchScripMaster(client, cfg.URL)
+	if err != nil {
+		return err
+	}
+	nse, err := FetchNSESymbols(client, cfg.NSEURL)
+	if err != nil {
+		log.Printf("loadScripMaster: %v; keeping the NSE symbols of the last download", err)
+	}
+	for i, s := range fresh {
+		if err == nil {
+			fresh[i].NSESymbol = nse[strings.ToUpper(s.ISIN)]
+		} else if old, ok := m.get(s.Code); ok {
+			fresh[i].NSESymbol = old.NSESymbol
+		}
+	}
+	renamed := m.merge(fresh)
+	m.FetchedAt = time.Now()
+	log.Printf("loadScripMaster: %d scrips, %d renamed since the last download", len(fresh), renamed)
+	return m.save()
+}
+
+// merge replaces the scrips with fresh ones, carrying over what each company was called
+// before: a scrip whose symbol or name changed gets the old one in FormerIDs or
+// FormerNames. Scrips missing from fresh (suspended, delisted) are kept, so that old
+// results can still be joined. It returns the number of renamed companies.
+func (m *scripMaster) merge(fresh []Scrip) int {
+	renamed := 0
+	seen := map[string]bool{}
+	for i, s := range fresh {
+		seen[s.Code] = true
+		old, ok := m.get(s.Code)
+		if !ok {
+			continue
+		}
+		s.FormerIDs, s.FormerNames = old.FormerIDs, old.FormerNames
+		if old.ID != "" && !strings.EqualFold(old.ID, s.ID) && !containsFold(s.FormerIDs, old.ID) {
+			s.FormerIDs = append(s.FormerIDs, old.ID)
+		}
+		if old.Name != "" && !strings.EqualFold(old.Name, s.Name) && !containsFold(s.FormerNames, old.Name) {
+			s.FormerNames = append(s.FormerNames, old.Name)
+		}
+		if len(s.FormerIDs) != len(old.FormerIDs) || len(s.FormerNames) != len(old.FormerNames) {
+			renamed++
+		}
+		fresh[i] = s
+	}
+	for _, s := range m.Scrips {
+		if !seen[s.Code] {
+			fresh = append(fresh, s)
+		}
+	}
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].Code < fresh[j].Code })
+	m.Scrips = fresh
+	m.index()
+	return renamed
+}
+
+// containsFold reports whether list holds s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// index rebuilds the lookup maps. A name that two companies share (or shared) points to
+// the one that carries it now.
+func (m *scripMaster) index() {
+	m.byCode = map[string]int{}
+	m.byName = map[string]int{}
+	for i, s := range m.Scrips {
+		m.byCode[s.Code] = i
+		for _, n := range append(append([]string(nil), s.FormerIDs...), s.FormerNames...) {
+			if n != "" {
+				m.byName[strings.ToUpper(n)] = i
+			}
+		}
+	}
+	for i, s := range m.Scrips {
+		for _, n := range []string{s.ID, s.NSESymbol, s.Name} {
+			if n != "" {
+				m.byName[strings.ToUpper(n)] = i
+			}
+		}
+	}
+}
+
+// save writes the scrip master
+func (m *scripMaster) save() error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// get returns the scrip with the BSE code
+func (m *scripMaster) get(code string) (Scrip, bool) {
+	if m == nil {
+		return Scrip{}, false
+	}
+	i, ok := m.byCode[code]
+	if !ok {
+		return Scrip{}, false
+	}
+	return m.Scrips[i], true
+}
+
+// find returns the scrip with the BSE code, or known by the symbol or name (current or
+// former)
+func (m *scripMaster) find(codeOrName string) (Scrip, bool) {
+	if s, ok := m.get(strings.TrimSpace(codeOrName)); ok {
+		return s, true
+	}
+	if m == nil {
+		return Scrip{}, false
+	}
+	i, ok := m.byName[strings.ToUpper(strings.TrimSpace(codeOrName))]
+	if !ok {
+		return Scrip{}, false
+	}
+	return m.Scrips[i], true
+}
+
+// lookup returns the scrip of a BSE item: by its code, else by its short or long name
+func (m *scripMaster) lookup(itm BSEItem) (Scrip, bool) {
+	if itm.ScripCode != "" {
+		return m.get(itm.ScripCode)
+	}
+	if s, ok := m.find(itm.ShortName); ok {
+		return s, true
+	}
+	if itm.LongName != "" {
+		return m.find(itm.LongName)
+	}
+	return Scrip{}, false
+}
+
+// names returns the item's own names plus every name the scrip master knows the company
+// by, for matching the watchlist and exclude lists across renames
+func (m *scripMaster) names(itm BSEItem) []string {
+	out := []string{itm.ShortName, itm.ScripCode, itm.LongName}
+	if s, ok := m.lookup(itm); ok {
+		out = append(out, s.names()...)
+	}
+	return out
+}
+
+// canonical fills in the code, long name and NSE symbol of an item from the scrip master
+func (m *scripMaster) canonical(itm BSEItem) BSEItem {
+	s, ok := m.lookup(itm)
+	if !ok {
+		return itm
+	}
+	if itm.ScripCode == "" {
+		itm.ScripCode = s.Code
+	}
+	if itm.LongName == "" {
+		itm.LongName = s.Name
+	}
+	if itm.NSESymbol == "" {
+		itm.NSESymbol = s.NSESymbol
+	}
+	return itm
+}
+
+// inGroups reports whether the item's BSE group is one of groups (all when empty).
+// Companies the scrip master does not know are kept.
+func (m *scripMaster) inGroups(itm BSEItem, groups []string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	s, ok := m.lookup(itm)
+	return !ok || containsFold(groups, s.Group)
+}
+
+// attachScrips copies the BSE code, NSE symbol and BSE group onto the results, and the
+// ISIN and industry where the trendlyne page did not give them
+func attachScrips(results []CompanyResult, items []BSEItem, m *scripMaster) {
+	byName := make(map[string]BSEItem, len(items))
+	for _, it := range items {
+		byName[it.ShortName] = it
+	}
+	for i := range results {
+		r := &results[i]
+		itm, ok := byName[r.Company]
+		if !ok {
+			itm = BSEItem{ShortName: r.Company, LongName: r.LongName}
+		}
+		itm = m.canonical(itm)
+		r.ScripCode, r.NSESymbol = itm.ScripCode, itm.NSESymbol
+		s, ok := m.lookup(itm)
+		if !ok {
+			continue
+		}
+		r.Group = s.Group
+		if r.ISIN == "" {
+			r.ISIN = s.ISIN
+		}
+		if r.Sector == "" {
+			r.Sector = s.Industry
+		}
+	}
+}
+
+// runScrips implements `quarter-compare scrips`: look companies up in the scrip master
+func runScrips(args []string) {
+	fs := flag.NewFlagSet("scrips", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	refresh := fs.Bool("refresh", false, "download the scrip master now, however recent the cached copy")
+	group := fs.String("group", "", "only scrips of this BSE group (A, B, T, ...)")
+	renamed := fs.Bool("renamed", false, "only scrips that were renamed")
+	bseOnly := fs.Bool("bse-only", false, "only scrips not listed on NSE")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: quarter-compare scrips [-config file] [-refresh] [-group G] [-renamed] [-bse-only] [CODE|SYMBOL|NAME ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cfg := mustLoadConfig(*configPath)
+
+	client := NewHTTPClient(cfg)
+	if *refresh {
+		cfg.ScripMaster.Refresh = "0s"
+	}
+	m := loadScripMaster(client, cfg.ScripMaster)
+	if m == nil {
+		log.Fatalf("scrips: no scrip master; check that BSE answers (quarter-compare doctor)")
+	}
+	fmt.Printf("%d scrips, downloaded %s\n", len(m.Scrips), m.FetchedAt.Format("2006-01-02 15:04"))
+
+	matches := func(s Scrip) bool {
+		if *group != "" && !strings.EqualFold(s.Group, *group) {
+			return false
+		}
+		if *renamed && len(s.FormerIDs)+len(s.FormerNames) == 0 {
+			return false
+		}
+		if *bseOnly && s.NSESymbol != "" {
+			return false
+		}
+		if fs.NArg() == 0 {
+			return *group != "" || *renamed || *bseOnly
+		}
+		hay := strings.ToLower(strings.Join(s.names(), " "))
+		for _, q := range fs.Args() {
+			if strings.Contains(hay, strings.ToLower(q)) {
+				return true
+			}
+		}
+		return false
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CODE\tSYMBOL\tNSE\tNAME\tGROUP\tISIN\tINDUSTRY\tFORMERLY")
+	for _, s := range m.Scrips {
+		if matches(s) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Code, s.ID, s.NSESymbol, s.Name, s.Group, s.ISIN, s.Industry,
+				strings.Join(append(append([]string(nil), s.FormerIDs...), s.FormerNames...), ", "))
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// revisionTolerancePct is the smallest change (%) of a stored quarterly figure that the
+// season view reports as a revision rather than rounding
+const revisionTolerancePct = 0.5
+
+// runSeason implements `quarter-compare season`: write a page comparing a stored day's
+// companies with their numbers in the runs of the days before
+func runSeason(args []string) {
+	fs := flag.NewFlagSet("season", flag.ExitOnError)
+	date := fs.String("date", "", "stored day to look at (2006-01-02, default: latest)")
+	days := fs.Int("days", 7, "how many days back to look for earlier runs")
+	out := fs.String("o", "", "output file (default: <app dir>/season.html)")
+	openFlag := fs.Bool("open", false, "open the page in the default browser when written")
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+
+	runs, err := LoadHistory()
+	if err != nil {
+		log.Fatalf("load history: %v", err)
+	}
+	run, ok := findRun(runs, *date)
+	if !ok {
+		log.Fatalf("no stored results for %q; see `quarter-compare history`", *date)
+	}
+	if *out == "" {
+		dir, err := getAppDir()
+		if err != nil {
+			log.Fatalf("cannot determine app dir: %v", err)
+		}
+		*out = filepath.Join(dir, "season.html")
+	}
+	if err := os.WriteFile(*out, []byte(RenderSeason(run, earlierRuns(runs, run.Date, *days))), 0644); err != nil {
+		log.Fatalf("write season page: %v", err)
+	}
+	fmt.Println("season view saved to", *out)
+	showReport(*out, *openFlag)
+}
+
+// earlierRuns returns the runs (newest first) of the days up to days before date
+func earlierRuns(runs []RunRecord, date string, days int) []RunRecord {
+	cutoff, ok := daysBefore(date, days)
+	if !ok {
+		return nil
+	}
+	var out []RunRecord
+	for _, run := range runs {
+		if run.Date < date && run.Date >= cutoff {
+			out = append(out, run)
+		}
+	}
+	return out
+}
+
+// daysBefore returns the day (2006-01-02) days before date; false when date isn't one
+func daysBefore(date string, days int) (string, bool) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", false
+	}
+	return day.AddDate(0, 0, -days).Format("2006-01-02"), true
+}
+
+// sighting is a company as an earlier run stored it: a result, or a failure
+type sighting struct {
+	Date    string
+	Result  *CompanyResult
+	Failure *Failure
+}
+
+// seasonRow is a company of the day with its earlier sightings (newest first) and what
+// changed since the oldest of them
+type seasonRow struct {
+	Result    CompanyResult
+	Sightings []sighting
+	Changes   []string
+}
+
+// seasonRows matches the companies of run with the earlier runs; companies seen for the
+// first time are left out
+func seasonRows(run RunRecord, earlier []RunRecord) []seasonRow {
+	var rows []seasonRow
+	for _, r := range run.Results {
+		row := seasonRow{Result: r}
+		for _, e := range earlier {
+			for i := range e.Results {
+				if strings.EqualFold(e.Results[i].Company, r.Company) {
+					row.Sightings = append(row.Sightings, sighting{Date: e.Date, Result: &e.Results[i]})
+				}
+			}
+			for i := range e.Failures {
+				if strings.EqualFold(e.Failures[i].Company, r.Company) {
+					row.Sightings = append(row.Sightings, sighting{Date: e.Date, Failure: &e.Failures[i]})
+				}
+			}
+		}
+		if len(row.Sightings) == 0 {
+			continue
+		}
+		first := row.Sightings[len(row.Sightings)-1]
+		if first.Failure != nil {
+			row.Changes = []string{"failed on " + first.Date + " (" + first.Failure.Error + "), fetched since"}
+		} else {
+			row.Changes = quarterChanges(*first.Result, r)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// quarterChanges lists how the quarterly figures of after differ from before, matching
+// quarters by fiscal quarter whatever their label format: figures declared since (late declarations), revised figures and
+// quarters that were not there before
+func quarterChanges(before, after CompanyResult) []string {
+	var out []string
+	for i, q := range after.Quarters {
+		j := quarterIndex(before.Quarters, q)
+		if j < 0 {
+			if q.String() != "" {
+				out = append(out, "new quarter "+q.String())
+			}
+			continue
+		}
+		for _, m := range []struct {
+			name          string
+			before, after []float64
+		}{{"revenue", before.RevenueNums, after.RevenueNums}, {"net profit", before.NetProfitNums, after.NetProfitNums}} {
+			was, now := valueAt(m.before, j), valueAt(m.after, i)
+			switch {
+			case math.IsNaN(now):
+			case math.IsNaN(was):
+				out = append(out, fmt.Sprintf("%s %s declared late: %s", q, m.name, formatFloat(now)))
+			case math.Abs(now-was) > math.Max(math.Abs(was), 0.01)*revisionTolerancePct/100:
+				out = append(out, fmt.Sprintf("%s %s revised %s → %s", q, m.name, formatFloat(was), formatFloat(now)))
+			}
+		}
+	}
+	return out
+}
+
+// valueAt returns vals[i], NaN when out of range
+func valueAt(vals []float64, i int) float64 {
+	if i < 0 || i >= len(vals) {
+		return math.NaN()
+	}
+	return vals[i]
+}
+
+// RenderSeason builds the season view of run against the earlier runs: for every company
+// that was in one of them, the days it was seen, its latest quarter then and now, and the
+// late declarations and revisions since
+func RenderSeason(run RunRecord, earlier []RunRecord) string {
+	rows := seasonRows(run, earlier)
+	var sb strings.Builder
+	sb.WriteString("<!doctype html><html lang='en'><head><meta charset='utf-8'><title>Season view " + html.EscapeString(run.Date) + "</title>")
+	sb.WriteString(styleTag("season.css") + "</head><body>")
+	sb.WriteString("<h2>Season view — " + html.EscapeString(run.Date) + "</h2>")
+	span := "no earlier runs stored"
+	if len(earlier) > 0 {
+		span = "runs of " + earlier[len(earlier)-1].Date + " to " + earlier[0].Date
+	}
+	changed := 0
+	for _, row := range rows {
+		if len(row.Changes) > 0 {
+			changed++
+		}
+	}
+	sb.WriteString(fmt.Sprintf("<p class='small'>%d of %d companies of the day were also in the %s; %d changed since they were first seen. Quarters are matched by label; changes under %.1f%% are ignored.</p>",
+		len(rows), len(run.Results), html.EscapeString(span), changed, revisionTolerancePct))
+	if len(rows) == 0 {
+		sb.WriteString("</body></html>")
+		return sb.String()
+	}
+	sb.WriteString("<table><thead><tr><th>Company</th><th>Seen on</th><th>Latest quarter then</th><th>Latest quarter now</th><th>Changes</th></tr></thead><tbody>")
+	for _, row := range rows {
+		class := ""
+		if len(row.Changes) > 0 {
+			class = " class='changed'"
+		}
+		var dates []string
+		for _, s := range row.Sightings {
+			d := s.Date
+			if s.Failure != nil {
+				d += " (failed)"
+			}
+			dates = append(dates, d)
+		}
+		then := "—"
+		if first := row.Sightings[len(row.Sightings)-1]; first.Result != nil {
+			then = latestQuarterSummary(*first.Result)
+		}
+		sb.WriteString("<tr" + class + "><td>" + html.EscapeString(row.Result.Company) + "<br/><span class='small'>" + html.EscapeString(row.Result.LongName) + "</span></td>")
+		sb.WriteString("<td class='small'>" + html.EscapeString(strings.Join(dates, ", ")) + "</td>")
+		sb.WriteString("<td>" + html.EscapeString(then) + "</td><td>" + html.EscapeString(latestQuarterSummary(row.Result)) + "</td><td>")
+		if len(row.Changes) == 0 {
+			sb.WriteString("<span class='small'>unchanged</span>")
+		} else {
+			sb.WriteString("<ul>")
+			for _, c := range row.Changes {
+				sb.WriteString("<li>" + html.EscapeString(c) + "</li>")
+			}
+			sb.WriteString("</ul>")
+		}
+		sb.WriteString("</td></tr>")
+	}
+	sb.WriteString("</tbody></table></body></html>")
+	return sb.String()
+}
+
+// latestQuarterSummary describes the latest quarter of r as "Jun 2024: rev 120, NP 12"
+func latestQuarterSummary(r CompanyResult) string {
+	return fmt.Sprintf("%s: rev %s, NP %s", firstQuarter(r), fmtNum(valueAt(r.RevenueNums, 0)), fmtNum(valueAt(r.NetProfitNums, 0)))
+}
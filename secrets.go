@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Secret config values may reference an external store instead of holding plaintext:
+//
+//	"keyring:<service>/<account>"  OS keyring (secret-tool on Linux, security on macOS)
+//	"cmd:<shell command>"          stdout of a command, e.g. "cmd:pass show quarter-compare/notion"
+//
+// Only fields tagged `secret:"true"` are resolved.
+
+// resolveSecrets replaces keyring:/cmd: references in secret-tagged string fields of v
+func resolveSecrets(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if fv.Kind() == reflect.Struct {
+			if err := resolveSecrets(fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if fv.Kind() != reflect.String || f.Tag.Get("secret") != "true" {
+			continue
+		}
+		val, err := resolveSecret(fv.String())
+		if err != nil {
+			return fmt.Errorf("secret %s: %v", strings.Split(f.Tag.Get("json"), ",")[0], err)
+		}
+		fv.SetString(val)
+	}
+	return nil
+}
+
+// resolveSecret returns ref unchanged unless it starts with keyring: or cmd:
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "cmd:"):
+		return secretFromCommand(strings.TrimPrefix(ref, "cmd:"))
+	case strings.HasPrefix(ref, "keyring:"):
+		service, account, ok := strings.Cut(strings.TrimPrefix(ref, "keyring:"), "/")
+		if !ok || service == "" || account == "" {
+			return "", errors.New("keyring reference must look like keyring:<service>/<account>")
+		}
+		return secretFromKeyring(service, account)
+	}
+	return ref, nil
+}
+
+// secretFromCommand runs command through the shell and returns its trimmed stdout
+func secretFromCommand(command string) (string, error) {
+	return runSecretCmd(shellCommand(context.Background(), command))
+}
+
+// secretFromKeyring looks the secret up in the OS keyring via the platform CLI
+func secretFromKeyring(service, account string) (string, error) {
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		return runSecretCmd(exec.Command("secret-tool", "lookup", "service", service, "account", account))
+	case "darwin":
+		return runSecretCmd(exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w"))
+	}
+	return "", fmt.Errorf("keyring lookup is not supported on %s; use a cmd: reference instead", runtime.GOOS)
+}
+
+func runSecretCmd(cmd *exec.Cmd) (string, error) {
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v: %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	val := strings.TrimRight(string(out), "\r\n")
+	if val == "" {
+		return "", fmt.Errorf("%s returned an empty secret", cmd.Args[0])
+	}
+	return val, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+)
+
+// A conglomerate's headline revenue and profit hide which business moved. Where the
+// fundamentals payload has a segment table, segmentEntries reads each segment's revenue
+// and result (profit before interest and tax) per quarter for the company modal.
+
+// keys of a segment's figures within a quarter's entry, first present wins
+var (
+	segmentRevenueKeys = []string{"revenue", "segment_revenue", "SEGMENT_REVENUE", "SEG_REV", "sales", "Revenue", "value"}
+	segmentResultKeys  = []string{"result", "segment_result", "SEGMENT_RESULT", "SEG_RES", "pbit", "PBIT", "ebit", "EBIT", "Result"}
+	segmentNameKeys    = []string{"name", "segment", "segment_name", "SEGMENT", "Segment"}
+)
+
+// Segment is a business segment of a company with its revenue and result (₹ cr) aligned
+// with CompanyResult.Quarters; NaN where a quarter lacks the figure
+type Segment struct {
+	Name    string
+	Revenue []float64
+	Result  []float64
+}
+
+type segmentJSON struct {
+	Name    string     `json:"name"`
+	Revenue []*float64 `json:"revenue"`
+	Result  []*float64 `json:"result,omitempty"`
+}
+
+// MarshalJSON writes NaN values as null
+func (s Segment) MarshalJSON() ([]byte, error) {
+	j := segmentJSON{Name: s.Name, Revenue: nullableFloats(s.Revenue)}
+	if hasKnown(s.Result) {
+		j.Result = nullableFloats(s.Result)
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON reads null values back as NaN
+func (s *Segment) UnmarshalJSON(b []byte) error {
+	var j segmentJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	s.Name, s.Revenue, s.Result = j.Name, nanFloats(j.Revenue), nanFloats(j.Result)
+	return nil
+}
+
+// hasKnown reports whether any of vals is a number
+func hasKnown(vals []float64) bool {
+	for _, v := range vals {
+		if !math.IsNaN(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSegmentTotal reports whether a row of a segment table is a total or reconciling line
+// (inter-segment eliminations, unallocable items) rather than a business
+func isSegmentTotal(name string) bool {
+	n := normalizeKey(name)
+	if strings.HasPrefix(n, "total") || strings.HasPrefix(n, "less") {
+		return true
+	}
+	for _, s := range []string{"intersegment", "unallocable", "unallocated", "eliminat", "reconcil"} {
+		if strings.Contains(n, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentEntries reads the segment table of a fundamentals body: the first key naming
+// segments, holding {<quarter>: <segments>} or that per basis ({"consolidated": ...}, the
+// one of basis preferred). A quarter's segments are {<name>: <revenue>},
+// {<name>: {"revenue": ..., "result": ...}} or a list of {"name": ..., "revenue": ...}.
+// Totals are left out, segments are ordered by their latest revenue, and a company with
+// fewer than two segments gets none, its headline being the one segment.
+func segmentEntries(body map[string]interface{}, quarters []string, basis string) []Segment {
+	var table map[string]interface{}
+	keys := make([]string, 0, len(body))
+	for k := range body {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if m, ok := body[k].(map[string]interface{}); ok && strings.Contains(strings.ToLower(k), "segment") {
+			table = m
+			break
+		}
+	}
+	if table == nil || len(quarters) == 0 {
+		return nil
+	}
+	if findQuarterKey(table, quarters[0]) == "" {
+		if m, ok := table[basis].(map[string]interface{}); ok {
+			table = m
+		} else if _, table = chooseBestDump(table, quarters); table == nil {
+			return nil
+		}
+	}
+
+	byName := map[string]*Segment{}
+	var order []string
+	get := func(name string) *Segment {
+		name = strings.TrimSpace(name)
+		if name == "" || isSegmentTotal(name) {
+			return nil
+		}
+		s := byName[normalizeKey(name)]
+		if s == nil {
+			s = &Segment{Name: name, Revenue: nanSlice(len(quarters)), Result: nanSlice(len(quarters))}
+			byName[normalizeKey(name)] = s
+			order = append(order, normalizeKey(name))
+		}
+		return s
+	}
+	set := func(s *Segment, i int, v interface{}) {
+		if s == nil {
+			return
+		}
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			s.Revenue[i] = quarterValueToFloat64(valueFromMap(vv, segmentRevenueKeys...))
+			s.Result[i] = quarterValueToFloat64(valueFromMap(vv, segmentResultKeys...))
+		default:
+			s.Revenue[i] = quarterValueToFloat64(valueFromMap(map[string]interface{}{"v": v}, "v"))
+		}
+	}
+	for i, q := range quarters {
+		k := q
+		if _, ok := table[k]; !ok {
+			k = findQuarterKey(table, q)
+		}
+		switch entry := table[k].(type) {
+		case map[string]interface{}:
+			names := make([]string, 0, len(entry))
+			for name := range entry {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				set(get(name), i, entry[name])
+			}
+		case []interface{}:
+			for _, row := range entry {
+				if m, ok := row.(map[string]interface{}); ok {
+					set(get(string(valueFromMap(m, segmentNameKeys...))), i, m)
+				}
+			}
+		}
+	}
+
+	var out []Segment
+	for _, k := range order {
+		if s := byName[k]; hasKnown(s.Revenue) {
+			out = append(out, *s)
+		}
+	}
+	if len(out) < 2 {
+		return nil
+	}
+	latest := func(s Segment) float64 {
+		for _, v := range s.Revenue {
+			if !math.IsNaN(v) {
+				return v
+			}
+		}
+		return math.NaN()
+	}
+	sort.SliceStable(out, func(i, j int) bool { return latest(out[i]) > latest(out[j]) })
+	return out
+}
+
+func nanSlice(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
+
+// segmentRows is what the company modal shows of r's segments: the latest quarter's
+// revenue and result of each, and the previous quarter's revenue when the two quarters
+// are adjacent
+func segmentRows(r CompanyResult) []map[string]interface{} {
+	var rows []map[string]interface{}
+	qoq := consecutive(r.Quarters, 2)
+	for _, s := range r.Segments {
+		prev := valueAt(s.Revenue, 1)
+		if !qoq {
+			prev = math.NaN()
+		}
+		rows = append(rows, map[string]interface{}{
+			"name":    s.Name,
+			"revenue": jsonFloat(valueAt(s.Revenue, 0)),
+			"prev":    jsonFloat(prev),
+			"result":  jsonFloat(valueAt(s.Result, 0)),
+		})
+	}
+	return rows
+}
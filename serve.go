@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// runServe implements `quarter-compare serve`: an HTTP view of stored history.
+// "/" lists stored days, "/report.html" renders the latest one and
+// "/reports/<date>.html" renders a given day and "/season.html" is the season view of the
+// latest day. Open reports update live: the history
+// is polled and new runs are pushed to them over "/events". "/graphql" answers GraphQL
+// queries over the history (see graphql.go). With -grpc, the Results service of
+// quarter_compare.proto is served on a second address (see grpc.go). Config serve sets
+// who may connect (see auth.go) and HTTPS (see tls.go).
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	addr := fs.String("addr", "127.0.0.1:8080", "listen address")
+	poll := fs.Duration("poll", 5*time.Second, "how often to check for newly stored runs to push to open reports (0: no live updates)")
+	grpcAddr := fs.String("grpc", "", "also serve the gRPC API of quarter_compare.proto on this address (plaintext HTTP/2), e.g. 127.0.0.1:9090")
+	cors := fs.String("cors", "", "let pages from this origin (e.g. http://localhost:5173, or *) call /graphql")
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+	cfg := mustLoadConfig(*configPath)
+	opts := mustReportOptions(cfg)
+	opts.Live = *poll > 0
+
+	// one handle for every request and poll; SQLite lets run and watch write meanwhile
+	db, err := openHistory()
+	if err != nil {
+		log.Fatalf("serve: %v", err)
+	}
+	defer db.Close()
+	// the cached copy, read once: the API looks up a company's former names in it
+	scrips := loadScripMaster(nil, cfg.ScripMaster)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveIndex(db))
+	mux.HandleFunc("/report.html", func(w http.ResponseWriter, r *http.Request) { serveRun(w, db, "", opts) })
+	mux.HandleFunc("/season.html", func(w http.ResponseWriter, r *http.Request) { serveSeason(w, db) })
+	mux.HandleFunc("/reports/", func(w http.ResponseWriter, r *http.Request) {
+		date := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/reports/"), ".html")
+		serveRun(w, db, date, opts)
+	})
+	mux.HandleFunc("/graphql", graphqlHandler(db, scrips, opts.Watchlist, opts.ZeroBase, *cors))
+	mux.HandleFunc("/graphql/schema", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+		w.Write([]byte(gqlSchema))
+	})
+	var events *runEvents
+	if opts.Live {
+		events = newRunEvents()
+		mux.Handle("/events", events)
+		go watchHistory(db, events, *poll)
+	}
+	tlsConfig, challenges, err := cfg.Serve.tlsConfig()
+	if err != nil {
+		log.Fatalf("serve: %v", err)
+	}
+	if challenges != nil && cfg.Serve.HTTPAddr != "-" {
+		httpAddr := cfg.Serve.HTTPAddr
+		if httpAddr == "" {
+			httpAddr = ":80"
+		}
+		go func() {
+			log.Printf("runServe: certificate challenges and https redirects on %s: %v", httpAddr, http.ListenAndServe(httpAddr, challenges))
+		}()
+	}
+	if *grpcAddr != "" {
+		srv := &http.Server{Addr: *grpcAddr, Handler: cfg.Serve.protect(&grpcServer{db: db, watchlist: opts.Watchlist, zeroBase: opts.ZeroBase, scrips: scrips, events: events}, true, ""), TLSConfig: tlsConfig}
+		if tlsConfig != nil {
+			go func() { log.Fatal(srv.ListenAndServeTLS("", "")) }()
+		} else {
+			srv.Protocols = new(http.Protocols)
+			srv.Protocols.SetUnencryptedHTTP2(true)
+			go func() { log.Fatal(srv.ListenAndServe()) }()
+		}
+		fmt.Printf("serving gRPC on %s\n", *grpcAddr)
+	}
+	for _, a := range []string{*addr, *grpcAddr} {
+		if a != "" && !loopbackAddr(a) && !cfg.Serve.secured() {
+			log.Printf("runServe: %s is reachable from other machines and anyone can read it; set serve.username/password or serve.token in the config", a)
+		}
+	}
+	srv := &http.Server{Addr: *addr, Handler: cfg.Serve.protect(mux, false, *cors), TLSConfig: tlsConfig}
+	if tlsConfig != nil {
+		host := *addr
+		if len(cfg.Serve.Autocert) > 0 {
+			host = cfg.Serve.Autocert[0]
+		}
+		fmt.Printf("serving on https://%s/\n", host)
+		log.Fatal(srv.ListenAndServeTLS("", ""))
+	}
+	fmt.Printf("serving on http://%s/\n", *addr)
+	log.Fatal(srv.ListenAndServe())
+}
+
+// serveIndex lists the stored days
+func serveIndex(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		days, err := historyDays(db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("<!doctype html><html><head><meta charset='utf-8'><title>Quarter Compare</title>")
+		sb.WriteString("<style>body{font-family:Arial,Helvetica,sans-serif;max-width:900px;margin:20px auto}</style></head><body>")
+		sb.WriteString("<h2>Quarter Compare</h2>")
+		if len(days) == 0 {
+			sb.WriteString("<p>No stored results yet; run <code>quarter-compare run</code> first.</p>")
+		} else {
+			sb.WriteString("<p><a href='/report.html'>Latest report</a> · <a href='/season.html'>Season view</a></p><ul>")
+			for _, day := range days {
+				d := html.EscapeString(day.Date)
+				sb.WriteString(fmt.Sprintf("<li><a href='/reports/%s.html'>%s</a> — %d companies</li>", d, d, day.Results))
+			}
+			sb.WriteString("</ul>")
+		}
+		sb.WriteString("</body></html>")
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		w.Write([]byte(sb.String()))
+	}
+}
+
+// serveRun renders the stored run for date (latest when empty)
+func serveRun(w http.ResponseWriter, db *sql.DB, date string, opts ReportOptions) {
+	run, ok, err := storedRun(db, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "no stored results for "+date, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Write([]byte(RenderHTMLReport(run.Results, run.Failures, opts.withHistory(db, run.Date))))
+}
+
+// serveSeason renders the season view of the latest stored day against the week before
+func serveSeason(w http.ResponseWriter, db *sql.DB) {
+	run, ok, err := storedRun(db, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "no stored results", http.StatusNotFound)
+		return
+	}
+	from, _ := daysBefore(run.Date, 7)
+	earlier, err := queryHistory(db, historyQuery{From: from, Before: run.Date})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Write([]byte(RenderSeason(run, earlier)))
+}
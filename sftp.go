@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// UploadSFTP copies the given local files into cfg.RemoteDir on the configured host
+func UploadSFTP(cfg SFTPConfig, files ...string) error {
+	auth := []ssh.AuthMethod{}
+	if cfg.KeyFile != "" {
+		pemBytes, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			return fmt.Errorf("parse sftp key_file: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return errors.New("sftp: no password or key_file configured")
+	}
+
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case cfg.InsecureIgnoreHostKey:
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		khFile := cfg.KnownHostsFile
+		if khFile == "" {
+			home, _ := os.UserHomeDir()
+			khFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		cb, err := knownhosts.New(khFile)
+		if err != nil {
+			return fmt.Errorf("sftp: load known_hosts %s: %v", khFile, err)
+		}
+		hostKey = cb
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = 22
+	}
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(port)), &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("sftp: dial %s: %v", cfg.Host, err)
+	}
+	defer conn.Close()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("sftp: start subsystem: %v", err)
+	}
+	defer client.Close()
+
+	remoteDir := cfg.RemoteDir
+	if remoteDir == "" {
+		remoteDir = "."
+	}
+	if err := client.MkdirAll(remoteDir); err != nil {
+		return fmt.Errorf("sftp: mkdir %s: %v", remoteDir, err)
+	}
+	for _, f := range files {
+		if err := uploadOne(client, f, path.Join(remoteDir, filepath.Base(f))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadOne writes to a temp name then renames, so readers never see a half-written report
+func uploadOne(client *sftp.Client, local, remote string) error {
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := remote + ".part"
+	dst, err := client.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("sftp: create %s: %v", tmp, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("sftp: write %s: %v", tmp, err)
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	// PosixRename replaces an existing file; fall back to remove+rename on servers without the extension
+	if err := client.PosixRename(tmp, remote); err != nil {
+		_ = client.Remove(remote)
+		if err := client.Rename(tmp, remote); err != nil {
+			return fmt.Errorf("sftp: rename %s: %v", remote, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+// serviceAccountKey maps the fields we need from a Google service-account JSON key
+type serviceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// AppendToSheet appends rows to the configured Google Sheet via the Sheets API
+func AppendToSheet(client *http.Client, cfg SheetsConfig, rows []ExportRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	keyJSON := []byte(cfg.Credentials)
+	if len(keyJSON) == 0 {
+		if cfg.CredentialsFile == "" {
+			return errors.New("no service-account credentials or credentials_file configured")
+		}
+		b, err := os.ReadFile(cfg.CredentialsFile)
+		if err != nil {
+			return err
+		}
+		keyJSON = b
+	}
+	token, err := googleAccessToken(client, keyJSON, sheetsScope)
+	if err != nil {
+		return err
+	}
+	rng := cfg.Range
+	if rng == "" {
+		rng = "Sheet1!A1"
+	}
+	values := make([][]interface{}, 0, len(rows))
+	for _, r := range rows {
+		values = append(values, r.Values())
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"values": values})
+	endpoint := fmt.Sprintf("https://sheets.googleapis.com/v4/spreadsheets/%s/values/%s:append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS",
+		url.PathEscape(cfg.SpreadsheetID), url.PathEscape(rng))
+	req, _ := http.NewRequest("POST", endpoint, bytes.NewReader(payload))
+	req.Header.Set("authorization", "Bearer "+token)
+	req.Header.Set("content-type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sheets append: status=%d body=%q", resp.StatusCode, b)
+	}
+	return nil
+}
+
+// googleAccessToken exchanges a self-signed service-account JWT for an OAuth access token
+func googleAccessToken(client *http.Client, keyJSON []byte, scope string) (string, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal(keyJSON, &key); err != nil {
+		return "", fmt.Errorf("parse service-account key: %v", err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", errors.New("service-account private_key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("parse service-account private key: %v", err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("service-account private key is not RSA")
+	}
+
+	now := time.Now()
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": scope,
+		"aud":   key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := header + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	assertion := unsigned + "." + enc.EncodeToString(sig)
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, _ := http.NewRequest("POST", key.TokenURI, strings.NewReader(form.Encode()))
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("token response: status=%d: %v", resp.StatusCode, err)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("token exchange failed: status=%d %s %s", resp.StatusCode, tok.Error, tok.Description)
+	}
+	return tok.AccessToken, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// smsMaxMessages bounds the SMS sent per recipient and run; a busy results day should not
+// turn into a flood of texts
+const smsMaxMessages = 10
+
+// SMSConfig texts watchlist companies crossing a threshold through Twilio or MSG91
+type SMSConfig struct {
+	Provider string   `json:"provider"` // "twilio" or "msg91"
+	To       []string `json:"to"`       // phone numbers in international form, e.g. +919876543210
+	When     string   `json:"when"`     // alert expression (see expr.go); default: the desktop threshold
+
+	// twilio
+	AccountSID string `json:"account_sid"`
+	AuthToken  string `json:"auth_token" secret:"true"`
+	From       string `json:"from"` // twilio sender number or messaging service SID (MG…)
+
+	// msg91: a DLT-approved flow template with the variables ##company##, ##quarter##, ##np## and ##rev##
+	AuthKey    string `json:"auth_key" secret:"true"`
+	TemplateID string `json:"template_id"`
+}
+
+func (c SMSConfig) enabled() bool {
+	return c.Provider != "" && len(c.To) > 0
+}
+
+// checkSMS validates the provider settings and the threshold expression
+func checkSMS(c SMSConfig) error {
+	if c.Provider == "" {
+		return nil
+	}
+	switch c.Provider {
+	case "twilio":
+		if c.AccountSID == "" || c.AuthToken == "" || c.From == "" {
+			return fmt.Errorf("twilio needs account_sid, auth_token and from")
+		}
+	case "msg91":
+		if c.AuthKey == "" || c.TemplateID == "" {
+			return fmt.Errorf("msg91 needs auth_key and template_id")
+		}
+	default:
+		return fmt.Errorf("unknown provider %q (want twilio or msg91)", c.Provider)
+	}
+	if c.When != "" {
+		if _, err := ParseExpr(c.When); err != nil {
+			return fmt.Errorf("when: %v", err)
+		}
+	}
+	return nil
+}
+
+// smsText is the text of one company's alert, e.g. "TCS Jun 2024: NP +12.5%, rev +4.1%"
+func smsText(r CompanyResult, zeroBase string) string {
+	rev, np := latestGrowth(r, zeroBase)
+	text := fmt.Sprintf("%s %s: NP %s, rev %s", r.Company, firstQuarter(r), smsGrowth(np), smsGrowth(rev))
+	if pledgeRising(r) {
+		text += fmt.Sprintf("; pledge up to %.1f%%", r.Pledged)
+	}
+	return text
+}
+
+// smsGrowth formats a growth figure with an explicit sign
+func smsGrowth(g growth) string {
+	s := g.String()
+	if g.class() == "positive" && !strings.HasPrefix(s, "+") {
+		s = "+" + s
+	}
+	return s
+}
+
+// smsAlert texts each recipient about the watchlist results among alerted that match the
+// threshold, one SMS per company, and reports whether any text went out
+func smsAlert(client *http.Client, cfg SMSConfig, watchlist []string, zeroBase string, alerted []CompanyResult) (bool, error) {
+	var ours []CompanyResult
+	for _, r := range alerted {
+		if inWatchlist(watchlist, r.Company) {
+			ours = append(ours, r)
+		}
+	}
+	when := cfg.When
+	if when == "" {
+		when = defaultDesktopWhen
+	}
+	movers, err := FilterResults(when, watchlist, zeroBase, ours)
+	if err != nil {
+		return false, fmt.Errorf("sms: %v", err)
+	}
+	if len(movers) > smsMaxMessages {
+		log.Printf("smsAlert: %d alerts, texting the first %d", len(movers), smsMaxMessages)
+		SortResults(movers, "np-growth", zeroBase)
+		movers = movers[:smsMaxMessages]
+	}
+	sent := false
+	var first error
+	for _, r := range movers {
+		for _, to := range cfg.To {
+			var err error
+			if cfg.Provider == "msg91" {
+				err = sendMSG91(client, cfg, to, r, zeroBase)
+			} else {
+				err = sendTwilio(client, cfg, to, smsText(r, zeroBase))
+			}
+			if err != nil {
+				log.Printf("smsAlert: %s to %s: %v", r.Company, to, err)
+				if first == nil {
+					first = err
+				}
+				continue
+			}
+			sent = true
+		}
+	}
+	return sent, first
+}
+
+// sendTwilio sends text to one number through the Twilio Messages API
+func sendTwilio(client *http.Client, cfg SMSConfig, to, text string) error {
+	form := url.Values{"To": {to}, "Body": {text}}
+	if strings.HasPrefix(cfg.From, "MG") {
+		form.Set("MessagingServiceSid", cfg.From)
+	} else {
+		form.Set("From", cfg.From)
+	}
+	req, _ := http.NewRequest("POST", "https://api.twilio.com/2010-04-01/Accounts/"+url.PathEscape(cfg.AccountSID)+"/Messages.json", strings.NewReader(form.Encode()))
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(cfg.AccountSID, cfg.AuthToken)
+	return doSMSRequest(client, "twilio", req)
+}
+
+// sendMSG91 sends one company's alert through an MSG91 flow; Indian DLT rules only allow
+// pre-approved templates, so the figures go in as template variables
+func sendMSG91(client *http.Client, cfg SMSConfig, to string, r CompanyResult, zeroBase string) error {
+	rev, np := latestGrowth(r, zeroBase)
+	body, _ := json.Marshal(map[string]interface{}{
+		"template_id": cfg.TemplateID,
+		"short_url":   "0",
+		"recipients": []map[string]string{{
+			"mobiles": strings.TrimPrefix(to, "+"),
+			"company": r.Company,
+			"quarter": firstQuarter(r),
+			"np":      smsGrowth(np),
+			"rev":     smsGrowth(rev),
+		}},
+	})
+	req, _ := http.NewRequest("POST", "https://control.msg91.com/api/v5/flow/", bytes.NewReader(body))
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("authkey", cfg.AuthKey)
+	return doSMSRequest(client, "msg91", req)
+}
+
+// doSMSRequest sends a provider request and turns a non-2xx answer into an error
+func doSMSRequest(client *http.Client, provider string, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %v", provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: status=%d body=%q", provider, resp.StatusCode, b)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// sortKeys maps each -sort-by value to the number it orders by (descending) under a
+// zero_base policy; "company" orders by name instead
+var sortKeys = map[string]func(r CompanyResult, zeroBase string) float64{
+	"company": nil,
+	"np-growth": func(r CompanyResult, zeroBase string) float64 {
+		rev, np := latestGrowth(r, zeroBase)
+		return np.sortKey(rev.Curr)
+	},
+	"rev-growth": func(r CompanyResult, zeroBase string) float64 {
+		rev, _ := latestGrowth(r, zeroBase)
+		return rev.sortKey(rev.Curr)
+	},
+	"mcap": func(r CompanyResult, zeroBase string) float64 { return r.MarketCap },
+}
+
+// checkSortBy validates a -sort-by value; empty means "company"
+func checkSortBy(by string) error {
+	if _, ok := sortKeys[by]; by != "" && !ok {
+		return fmt.Errorf("unknown sort %q (want company, np-growth, rev-growth or mcap)", by)
+	}
+	return nil
+}
+
+// SortResults orders results in place by company name, or by the sort key descending
+// with missing values last and ties broken by company name, so the row order never
+// depends on which fetch finished first. Growth follows the zero_base policy.
+func SortResults(results []CompanyResult, by, zeroBase string) {
+	key := sortKeys[by]
+	byName := func(a, b CompanyResult) bool {
+		if c := strings.Compare(strings.ToUpper(a.Company), strings.ToUpper(b.Company)); c != 0 {
+			return c < 0
+		}
+		return a.Company < b.Company
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if key != nil {
+			x, y := key(a, zeroBase), key(b, zeroBase)
+			switch {
+			case math.IsNaN(x) && !math.IsNaN(y):
+				return false
+			case !math.IsNaN(x) && math.IsNaN(y):
+				return true
+			case x != y && !math.IsNaN(x):
+				return x > y
+			}
+		}
+		return byName(a, b)
+	})
+}
+
+// pinWatchlist moves the watchlist companies to the top, keeping the order within both
+// groups, and returns how many were pinned. Nothing is pinned when every row is on the
+// watchlist (e.g. it is the filter), as there is nothing to stand out from.
+func pinWatchlist(results []CompanyResult, watchlist []string) int {
+	var pinned, rest []CompanyResult
+	for _, r := range results {
+		if inWatchlist(watchlist, r.Company) {
+			pinned = append(pinned, r)
+		} else {
+			rest = append(rest, r)
+		}
+	}
+	if len(pinned) == 0 || len(rest) == 0 {
+		return 0
+	}
+	copy(results, pinned)
+	copy(results[len(pinned):], rest)
+	return len(pinned)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortResultsSwings(t *testing.T) {
+	qs := []Quarter{{FY: 2025, Q: 1}, {FY: 2024, Q: 4}}
+	result := func(name string, rev, np, prevNP float64) CompanyResult {
+		return CompanyResult{Company: name, Quarters: qs, RevenueNums: []float64{rev, rev}, NetProfitNums: []float64{np, prevNP}}
+	}
+	results := []CompanyResult{
+		result("TINYSWING", 1000, 0.005, -0.005), // +0.01 cr on ₹1000 cr: 0.001%
+		result("GROWER", 100, 60, 10),            // +500%
+		result("TURNAROUND", 100, 20, -30),       // +50 cr on ₹100 cr: 50%
+		result("FLAT", 100, 10, 10),              // 0%
+		result("SLIDE", 100, -40, 20),            // -60 cr on ₹100 cr: -60%
+		result("NOREVENUE", 0, 5, -5),            // a swing without revenue to measure it by
+		result("SHRINKER", 100, 5, 10),           // -50%
+	}
+	SortResults(results, "np-growth", zeroBaseNA)
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Company)
+	}
+	want := []string{"GROWER", "TURNAROUND", "TINYSWING", "FLAT", "SHRINKER", "SLIDE", "NOREVENUE"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Trendlyne company pages run to several MB and the fundamentals JSON carries far more
+// than the quarterly table, so both are processed as they stream in instead of being
+// read whole: pages are matched in a sliding window, the JSON is walked token by token.
+
+// defaultMaxBodyMB caps one response when max_body_mb is not set
+const defaultMaxBodyMB = 32
+
+// bodyTooLargeError is returned once a response goes past the configured cap
+type bodyTooLargeError struct{ limit int64 }
+
+func (e bodyTooLargeError) Error() string {
+	return fmt.Sprintf("response larger than %d MiB (max_body_mb)", e.limit>>20)
+}
+
+// cappedReader counts what is read and fails with bodyTooLargeError past limit bytes
+// (limit <= 0 means no cap)
+type cappedReader struct {
+	r     io.Reader
+	limit int64
+	n     int64 // bytes read so far
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.limit > 0 && int64(len(p)) > c.limit+1-c.n {
+		p = p[:c.limit+1-c.n] // read one byte past the cap to tell "at" from "over"
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.limit > 0 && c.n > c.limit {
+		return n, bodyTooLargeError{c.limit}
+	}
+	return n, err
+}
+
+// pageChunk and pageOverlap size the window scanPage matches in; every pattern is far
+// shorter than the overlap, so a match is never split between two windows
+const (
+	pageChunk   = 64 << 10
+	pageOverlap = 4 << 10
+)
+
+var (
+	// the data-tablesurl attribute, unquoted or quoted
+	reTablesURL       = regexp.MustCompile(`data-tablesurl=(https?://[^\s"'<>]+)`)
+	reTablesURLQuoted = regexp.MustCompile(`data-tablesurl\s*=\s*["'](https?://[^"']+)["']`)
+	// fallback: any URL that contains get-fundamental_results
+	reFundResultsURL = regexp.MustCompile(`https?://[^\s"'<>]*get-fundamental_results[^\s"'<>]*`)
+
+	// e.g. "Market Cap ... ₹ 12,345.67 Cr" with arbitrary markup in between
+	reMarketCap    = regexp.MustCompile(`(?is)market\s*cap(?:italization)?[^0-9]{0,200}?([0-9][0-9,]*(?:\.[0-9]+)?)\s*(?:cr|crore)`)
+	reSectorJSON   = regexp.MustCompile(`"sector(?:_name|Name)?"\s*:\s*"([^"]{2,80})"`)
+	reSectorLink   = regexp.MustCompile(`(?i)href=["'][^"']*/sector/[^"']*["'][^>]*>\s*([^<]{2,80}?)\s*<`)
+	reISIN         = regexp.MustCompile(`\bIN[EF][0-9A-Z]{9}\b`) // indian ISINs: INE/INF + 9 alphanumerics
+	reHeadlineName = regexp.MustCompile(`(?is)<h1[^>]*>\s*(?:<[^>]+>\s*)*([^<]{2,120}?)\s*<`)
+
+	// quote figures for the valuation ratios: price and book value per share from the
+	// embedded JSON, enterprise value in ₹ cr from the text
+	rePrice           = regexp.MustCompile(`(?i)"(?:current_?price|last_?price|ltp|price)"\s*:\s*"?([0-9][0-9,]*(?:\.[0-9]+)?)`)
+	reBookValue       = regexp.MustCompile(`(?i)"(?:book_?value(?:_?per_?share)?|bvps)"\s*:\s*"?(-?[0-9][0-9,]*(?:\.[0-9]+)?)`)
+	reEnterpriseValue = regexp.MustCompile(`(?is)enterprise\s*value[^0-9]{0,200}?([0-9][0-9,]*(?:\.[0-9]+)?)\s*(?:cr|crore)`)
+
+	// shareholding: promoter holding and the share of it pledged, in %
+	rePromoterHolding = regexp.MustCompile(`(?is)promoter\s*holding[^0-9%]{0,200}?([0-9]+(?:\.[0-9]+)?)\s*%`)
+	rePledged         = regexp.MustCompile(`(?is)pledged?\s*(?:shares|percentage|holding)?[^0-9%]{0,200}?([0-9]+(?:\.[0-9]+)?)\s*%`)
+)
+
+// pageScanner collects the fundamentals URL and metadata from successive windows of a
+// page; the first match of each wins, except that better-grade matches (a data-tablesurl
+// attribute over a bare URL, an embedded sector field over a sector link) replace earlier ones
+type pageScanner struct {
+	fundURL       string
+	fundPreferred bool // fundURL came from data-tablesurl
+	meta          PageMeta
+	sectorJSON    bool // meta.Sector came from an embedded JSON field
+}
+
+func newPageScanner() *pageScanner {
+	nan := math.NaN()
+	return &pageScanner{meta: PageMeta{MarketCap: nan, Price: nan, BookValue: nan, EnterpriseValue: nan, PromoterHolding: nan, Pledged: nan}}
+}
+
+// scan matches one window
+func (s *pageScanner) scan(b []byte) {
+	if !s.fundPreferred {
+		if m := reTablesURL.FindSubmatch(b); len(m) >= 2 {
+			s.fundURL, s.fundPreferred = string(m[1]), true
+		} else if m := reTablesURLQuoted.FindSubmatch(b); len(m) >= 2 {
+			s.fundURL, s.fundPreferred = string(m[1]), true
+		} else if s.fundURL == "" {
+			if m := reFundResultsURL.Find(b); m != nil {
+				// trendlyne expects the trailing slash
+				u := string(bytes.TrimSpace(m))
+				if !strings.HasSuffix(u, "/") {
+					u += "/"
+				}
+				s.fundURL = u
+			}
+		}
+	}
+	if math.IsNaN(s.meta.MarketCap) {
+		if m := reMarketCap.FindSubmatch(b); len(m) >= 2 {
+			s.meta.MarketCap = quarterValueToFloat64(QuarterValue(m[1]))
+		}
+	}
+	for _, f := range []struct {
+		v  *float64
+		re *regexp.Regexp
+	}{
+		{&s.meta.Price, rePrice}, {&s.meta.BookValue, reBookValue}, {&s.meta.EnterpriseValue, reEnterpriseValue},
+		{&s.meta.PromoterHolding, rePromoterHolding}, {&s.meta.Pledged, rePledged},
+	} {
+		if math.IsNaN(*f.v) {
+			if m := f.re.FindSubmatch(b); len(m) >= 2 {
+				*f.v = quarterValueToFloat64(QuarterValue(m[1]))
+			}
+		}
+	}
+	if !s.sectorJSON {
+		if m := reSectorJSON.FindSubmatch(b); len(m) >= 2 {
+			s.meta.Sector, s.sectorJSON = unescapeText(m[1]), true
+		} else if s.meta.Sector == "" {
+			if m := reSectorLink.FindSubmatch(b); len(m) >= 2 {
+				s.meta.Sector = unescapeText(m[1])
+			}
+		}
+	}
+	if s.meta.ISIN == "" {
+		if m := reISIN.Find(b); m != nil {
+			s.meta.ISIN = string(m)
+		}
+	}
+	if s.meta.LongName == "" {
+		if m := reHeadlineName.FindSubmatch(b); len(m) >= 2 {
+			s.meta.LongName = unescapeText(m[1])
+		}
+	}
+}
+
+// scanPage runs a pageScanner over r window by window, holding at most
+// pageOverlap+pageChunk bytes of the page at a time
+func scanPage(r io.Reader) (*pageScanner, error) {
+	s := newPageScanner()
+	buf := make([]byte, 0, pageOverlap+pageChunk)
+	for {
+		n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		s.scan(buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+		buf = append(buf[:0], buf[len(buf)-pageOverlap:]...)
+	}
+}
+
+// fundamentalsKeys are the body fields decodeFundamentals keeps
+var fundamentalsKeys = map[string]bool{
+	"quarterlyOrder": true, "quarterlyDataDump": true,
+	"annualOrder": true, "annualDataDump": true,
+}
+
+// decodeFundamentals walks a fundamentals response token by token and keeps only
+// body.quarterlyOrder, body.quarterlyDataDump and their annual counterparts; every other
+// value (ratios, shareholding, ...) is skipped without being held in memory. The result has the shape of the
+// full document, skipped values being nil, so ValidateFundamentals can report on it.
+func decodeFundamentals(r io.Reader) (map[string]interface{}, error) {
+	dec := json.NewDecoder(r)
+	root, err := decodeObject(dec, func(key string) (interface{}, error) {
+		if key != "body" {
+			return nil, skipValue(dec)
+		}
+		return decodeObject(dec, func(key string) (interface{}, error) {
+			if !fundamentalsKeys[key] {
+				return nil, skipValue(dec)
+			}
+			var v interface{}
+			err := dec.Decode(&v)
+			return v, err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	m, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("top-level value is %T, want an object", root)
+	}
+	return m, nil
+}
+
+// decodeObject reads the next value; for an object it calls field for each key, which must
+// consume the key's value. Other values are returned as decoded (arrays as an empty slice).
+func decodeObject(dec *json.Decoder, field func(key string) (interface{}, error)) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+	case json.Delim('['):
+		return []interface{}{}, skipRest(dec, 1)
+	default:
+		return t, nil
+	}
+	obj := map[string]interface{}{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return nil, errors.New("object key is not a string")
+		}
+		if obj[key], err = field(key); err != nil {
+			return nil, err
+		}
+	}
+	_, err = dec.Token() // closing brace
+	return obj, err
+}
+
+// skipValue consumes the next value token by token
+func skipValue(dec *json.Decoder) error {
+	return skipRest(dec, 0)
+}
+
+// skipRest consumes tokens until depth open objects/arrays are closed (for depth 0: one value)
+func skipRest(dec *json.Decoder, depth int) error {
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// symbolEntry is a resolved company → trendlyne mapping, so repeat runs can go straight
+// to the fundamentals JSON without the search and page-scrape requests
+type symbolEntry struct {
+	TrendID string    `json:"trend_id"`
+	K       int       `json:"k"`
+	Slug    string    `json:"slug"`
+	PageURL string    `json:"page_url"`
+	FundURL string    `json:"fund_url"`
+	Match   string    `json:"match,omitempty"` // see pickTrendItem
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// symbolCache is the persistent symbol-resolution cache in <cache dir>/symbols.json.
+// A nil *symbolCache disables caching. Safe for concurrent use.
+type symbolCache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]symbolEntry
+	dirty   bool
+}
+
+// loadSymbolCache reads the cache file; a missing or unreadable file starts an empty cache
+func loadSymbolCache() *symbolCache {
+	dir, err := cacheDir()
+	if err != nil {
+		log.Printf("loadSymbolCache: %v", err)
+		return nil
+	}
+	c := &symbolCache{path: filepath.Join(dir, "symbols.json"), entries: map[string]symbolEntry{}}
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("loadSymbolCache: %v", err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(b, &c.entries); err != nil {
+		log.Printf("loadSymbolCache: ignoring %s: %v", c.path, err)
+		c.entries = map[string]symbolEntry{}
+	}
+	return c
+}
+
+// symbolKey identifies a company in the cache: its BSE code, else its upper-cased short name
+func symbolKey(itm BSEItem) string {
+	if itm.ScripCode != "" {
+		return itm.ScripCode
+	}
+	return strings.ToUpper(strings.TrimSpace(itm.ShortName))
+}
+
+func (c *symbolCache) get(key string) (symbolEntry, bool) {
+	if c == nil {
+		return symbolEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	return e, ok && e.FundURL != ""
+}
+
+func (c *symbolCache) put(key string, e symbolEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.SavedAt = time.Now()
+	c.entries[key] = e
+	c.dirty = true
+}
+
+// drop forgets a mapping that stopped working (e.g. the fundamentals URL changed)
+func (c *symbolCache) drop(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		delete(c.entries, key)
+		c.dirty = true
+	}
+}
+
+// save writes the cache if it changed
+func (c *symbolCache) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsConfig returns the TLS setup of serve, nil for plain HTTP. With autocert it also
+// returns the handler for port 80: Let's Encrypt's HTTP-01 challenges, and a redirect
+// to https for everything else.
+func (c ServeConfig) tlsConfig() (*tls.Config, http.Handler, error) {
+	switch {
+	case len(c.Autocert) > 0:
+		dir := c.AutocertDir
+		if dir == "" {
+			appDir, err := getAppDir()
+			if err != nil {
+				return nil, nil, err
+			}
+			dir = filepath.Join(appDir, "autocert")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.Autocert...),
+			Cache:      autocert.DirCache(dir),
+			Email:      c.AutocertEmail,
+		}
+		return m.TLSConfig(), m.HTTPHandler(nil), nil
+	case c.CertFile != "":
+		r := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+		if _, err := r.getCertificate(nil); err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{GetCertificate: r.getCertificate}, nil, nil
+	}
+	return nil, nil, nil
+}
+
+// certReloader serves a certificate from PEM files and loads them again when the
+// certificate file changes, so a renewal (certbot, say) needs no restart
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fi, err := os.Stat(r.certFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil // keep serving the loaded one while the file is replaced
+		}
+		return nil, fmt.Errorf("cert_file: %v", err)
+	}
+	if r.cert != nil && fi.ModTime().Equal(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			log.Printf("certReloader: %v; keeping the previous certificate", err)
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("cert_file/key_file: %v", err)
+	}
+	r.cert, r.modTime = &cert, fi.ModTime()
+	return r.cert, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const (
+	trendlyneBase          = "https://trendlyne.com/"
+	trendlyneLoginURL      = "https://trendlyne.com/accounts/login/"
+	trendlyneSessionName   = "sessionid"
+	trendlyneSessionMaxAge = 7 * 24 * time.Hour
+)
+
+// trendlyneSession is the login session cookie saved between runs
+type trendlyneSession struct {
+	Value   string    `json:"value"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// trendlyneSessionPath returns <app dir>/trendlyne-session.json
+func trendlyneSessionPath() (string, error) {
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trendlyne-session.json"), nil
+}
+
+// TrendlyneLogin gives client an authenticated trendlyne session so subscriber-only data is
+// returned. A configured session cookie wins; otherwise a saved session younger than a week is
+// reused, else it logs in with email/password and saves the new session. Without credentials it
+// does nothing and requests stay anonymous.
+func TrendlyneLogin(client *http.Client, cfg TrendlyneConfig) error {
+	if cfg.SessionCookie != "" {
+		setTrendlyneSession(client, cfg.SessionCookie)
+		return nil
+	}
+	if cfg.Email == "" || cfg.Password == "" {
+		return nil
+	}
+	path, err := trendlyneSessionPath()
+	if err != nil {
+		return err
+	}
+	if b, err := os.ReadFile(path); err == nil {
+		var s trendlyneSession
+		if json.Unmarshal(b, &s) == nil && s.Value != "" && time.Since(s.SavedAt) < trendlyneSessionMaxAge {
+			setTrendlyneSession(client, s.Value)
+			return nil
+		}
+	}
+
+	value, err := trendlyneFormLogin(client, cfg.Email, cfg.Password)
+	if err != nil {
+		return err
+	}
+	b, _ := json.Marshal(trendlyneSession{Value: value, SavedAt: time.Now()})
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		log.Printf("TrendlyneLogin: could not save session: %v", err)
+	}
+	return nil
+}
+
+// setTrendlyneSession puts the session cookie into client's jar
+func setTrendlyneSession(client *http.Client, value string) {
+	u, _ := url.Parse(trendlyneBase)
+	client.Jar.SetCookies(u, []*http.Cookie{{Name: trendlyneSessionName, Value: value, Path: "/"}})
+}
+
+// trendlyneFormLogin performs the django login form flow (csrf token, then POST) and
+// returns the resulting session cookie value
+func trendlyneFormLogin(client *http.Client, email, password string) (string, error) {
+	req, _ := http.NewRequest("GET", trendlyneLoginURL, nil)
+	req.Header.Set("user-agent", "go-client")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	m := regexp.MustCompile(`name=["']csrfmiddlewaretoken["']\s+value=["']([^"']+)["']`).FindSubmatch(page)
+	if len(m) < 2 {
+		return "", errors.New("trendlyne login: csrf token not found on login page")
+	}
+
+	form := url.Values{
+		"csrfmiddlewaretoken": {string(m[1])},
+		"login":               {email},
+		"password":            {password},
+		"remember":            {"on"},
+	}
+	req, _ = http.NewRequest("POST", trendlyneLoginURL, bytes.NewBufferString(form.Encode()))
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.Header.Set("referer", trendlyneLoginURL)
+	req.Header.Set("user-agent", "go-client")
+	resp, err = client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	u, _ := url.Parse(trendlyneBase)
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == trendlyneSessionName && c.Value != "" {
+			return c.Value, nil
+		}
+	}
+	return "", fmt.Errorf("trendlyne login failed (status=%d); check email/password", resp.StatusCode)
+}
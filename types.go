@@ -1,5 +1,11 @@
 package main
 
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
 // BSEItem maps the fields we need from the BSE API
 type BSEItem struct {
 	ScripCode   string `json:"scrip_Code"`
@@ -7,6 +13,8 @@ type BSEItem struct {
 	LongName    string `json:"Long_Name"`
 	MeetingDate string `json:"meeting_date"`
 	URL         string `json:"URL"`
+	Purpose     string `json:"purpose,omitempty"`    // board-meeting purpose; empty on the results calendar
+	NSESymbol   string `json:"nse_symbol,omitempty"` // from the scrip master; empty when not listed on NSE
 }
 
 // TrendItem maps relevant fields from Trendlyne search response
@@ -20,6 +28,8 @@ type TrendItem struct {
 	DefaultExchange string `json:"defaultExchange"`
 	BSEcode         string `json:"BSEcode"`
 	NextURL         string `json:"nexturl"`
+
+	Match string `json:"-"` // how pickTrendItem chose this hit
 }
 
 // QuarterValue is either a formatted number or "not declared"
@@ -27,13 +37,235 @@ type QuarterValue string
 
 // CompanyResult holds the company and its last 4 quarter metrics
 type CompanyResult struct {
-	Company   string
-	LongName  string
-	Quarters  []string // names of the last 4 quarters (len up to 4)
-	Revenue   []QuarterValue
-	NetProfit []QuarterValue
+	Company   string         `json:"company"`
+	LongName  string         `json:"long_name"`
+	Quarters  []Quarter      `json:"quarters"` // the last 4 quarters, newest first (len up to 4)
+	Revenue   []QuarterValue `json:"revenue"`
+	NetProfit []QuarterValue `json:"net_profit"`
 
 	// Numeric versions for analysis. Use math.NaN() for missing/not-declared.
-	RevenueNums   []float64
-	NetProfitNums []float64
+	RevenueNums   []float64 `json:"revenue_nums"`
+	NetProfitNums []float64 `json:"net_profit_nums"`
+
+	// MarketCap in ₹ cr scraped from the trendlyne page; NaN when unknown.
+	MarketCap float64 `json:"market_cap"`
+	// Price and BookValue (₹ per share) and EnterpriseValue (₹ cr) scraped from the
+	// trendlyne page, for the valuation ratios (see Valuate); NaN when unknown.
+	Price           float64 `json:"price"`
+	BookValue       float64 `json:"book_value"`
+	EnterpriseValue float64 `json:"enterprise_value"`
+	// ROE and ROCE (%) of the latest year in the annual tables of the fundamentals, for
+	// AnnualYear; NaN when unknown.
+	ROE        float64 `json:"roe"`
+	ROCE       float64 `json:"roce"`
+	AnnualYear string  `json:"annual_year,omitempty"`
+	// Debt (₹ cr) for AnnualYear, its ratio to equity and its change (%) from the year
+	// before; NaN when unknown.
+	Debt         float64 `json:"debt"`
+	DebtToEquity float64 `json:"debt_equity"`
+	DebtChange   float64 `json:"debt_change"`
+	// Leverage says why the profit growth looks financed by borrowings (see
+	// flagLeverage); empty when it does not.
+	Leverage string `json:"leverage,omitempty"`
+	// PromoterHolding and Pledged (share of the promoter holding pledged) are % scraped
+	// from the trendlyne page, with their change in percentage points since the
+	// shareholding last moved; NaN when unknown.
+	PromoterHolding float64 `json:"promoter_holding"`
+	Pledged         float64 `json:"pledged"`
+	HoldingChange   float64 `json:"holding_change"`
+	PledgeChange    float64 `json:"pledge_change"`
+	// Sector scraped from the trendlyne page; empty when unknown.
+	Sector string `json:"sector"`
+	// ISIN scraped from the trendlyne page; empty when unknown.
+	ISIN string `json:"isin,omitempty"`
+	// ScripCode is the BSE code and NSESymbol the NSE symbol (from the scrip master);
+	// empty when unknown or not listed there.
+	ScripCode string `json:"scrip_code,omitempty"`
+	NSESymbol string `json:"nse_symbol,omitempty"`
+	// Group is the company's BSE group (A, B, T, ...) from the scrip master; empty when unknown.
+	Group string `json:"group,omitempty"`
+	// AnnouncementURL is the company's BSE announcements page and PDFURL the attachment
+	// of its results filing; empty when not found.
+	AnnouncementURL string `json:"announcement_url,omitempty"`
+	PDFURL          string `json:"pdf_url,omitempty"`
+	// PresentationURL and CallURL link the investor presentation and the earnings call
+	// announcement filed on BSE; empty when not found.
+	PresentationURL string `json:"presentation_url,omitempty"`
+	CallURL         string `json:"call_url,omitempty"`
+	// DeclaredAt is when the results filing reached BSE (IST); zero when not found
+	DeclaredAt time.Time `json:"declared_at,omitzero"`
+	// CorpActions are the corporate actions announced with the results: Dividend, Bonus,
+	// Split (see attachCorpActions)
+	CorpActions []string `json:"corp_actions,omitempty"`
+	// ShareAdjustments describe the splits and bonus issues the per-share Metrics of earlier
+	// quarters were divided for (see adjustPerShare)
+	ShareAdjustments []string `json:"share_adjustments,omitempty"`
+	// Consensus is how the analysts' estimates for the latest quarter moved before the
+	// result, from the snapshots `estimates` recorded (see attachConsensus); nil when none
+	Consensus *Consensus `json:"consensus,omitempty"`
+	// Profile is a one-paragraph business description from the Wikipedia article at
+	// ProfileURL (see attachProfiles); empty when profiles are off or none was found
+	Profile    string `json:"profile,omitempty"`
+	ProfileURL string `json:"profile_url,omitempty"`
+	// Purpose of the board meeting when it is not (only) results; see Config.Purposes
+	Purpose string `json:"purpose,omitempty"`
+
+	// Metrics holds every numeric field of the fundamentals dump (NP_Q, TOTAL_SR_Q, ...),
+	// aligned with Quarters; NaN where a quarter lacks the field. Used by computed columns.
+	Metrics map[string][]float64 `json:"metrics,omitempty"`
+	// Segments are the company's business segments from the fundamentals' segment table,
+	// largest first (see segmentEntries); empty when it has none or a single segment
+	Segments []Segment `json:"segments,omitempty"`
+
+	// Anomalies describe what looks out of line in the latest quarter against the company's
+	// own past quarters (see detectAnomalies): figures to verify against the filing
+	Anomalies []string `json:"anomalies,omitempty"`
+
+	// Issues lists problems found in the source data (see ValidateFundamentals); a result
+	// with issues is reported as partial.
+	Issues []string `json:"issues,omitempty"`
+	// Source is the source that supplied the result ("trendlyne" or a plugin name), Basis
+	// the fundamentals dump the quarters came from (e.g. "consolidated") and Match how the
+	// company was found in the trendlyne search (see matchCode); all feed dataQuality.
+	Source string `json:"source,omitempty"`
+	Basis  string `json:"basis,omitempty"`
+	Match  string `json:"match,omitempty"`
+	// CrossCheck describes how the latest quarter differs from the company's BSE results
+	// filing (see crossCheck); empty when it matches or was not checked
+	CrossCheck string `json:"cross_check,omitempty"`
+}
+
+// Failure is a company that could not be fetched or parsed at all
+type Failure struct {
+	Company  string `json:"company"`
+	LongName string `json:"long_name,omitempty"`
+	Error    string `json:"error"`
+}
+
+// companyResultJSON overrides the float fields of CompanyResult with nullable ones,
+// since encoding/json cannot represent NaN
+type companyResultJSON struct {
+	companyResultAlias
+	RevenueNums   []*float64 `json:"revenue_nums"`
+	NetProfitNums []*float64 `json:"net_profit_nums"`
+	MarketCap     *float64   `json:"market_cap"`
+
+	Price           *float64 `json:"price"`
+	BookValue       *float64 `json:"book_value"`
+	EnterpriseValue *float64 `json:"enterprise_value"`
+	ROE             *float64 `json:"roe"`
+	ROCE            *float64 `json:"roce"`
+	Debt            *float64 `json:"debt"`
+	DebtToEquity    *float64 `json:"debt_equity"`
+	DebtChange      *float64 `json:"debt_change"`
+	PromoterHolding *float64 `json:"promoter_holding"`
+	Pledged         *float64 `json:"pledged"`
+	HoldingChange   *float64 `json:"holding_change"`
+	PledgeChange    *float64 `json:"pledge_change"`
+
+	Metrics map[string][]*float64 `json:"metrics,omitempty"`
+}
+
+type companyResultAlias CompanyResult
+
+// MarshalJSON writes NaN values as null
+func (c CompanyResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(companyResultJSON{
+		companyResultAlias: companyResultAlias(c),
+		RevenueNums:        nullableFloats(c.RevenueNums),
+		NetProfitNums:      nullableFloats(c.NetProfitNums),
+		MarketCap:          nullableFloat(c.MarketCap),
+		Price:              nullableFloat(c.Price),
+		BookValue:          nullableFloat(c.BookValue),
+		EnterpriseValue:    nullableFloat(c.EnterpriseValue),
+		ROE:                nullableFloat(c.ROE),
+		ROCE:               nullableFloat(c.ROCE),
+		Debt:               nullableFloat(c.Debt),
+		DebtToEquity:       nullableFloat(c.DebtToEquity),
+		DebtChange:         nullableFloat(c.DebtChange),
+		PromoterHolding:    nullableFloat(c.PromoterHolding),
+		Pledged:            nullableFloat(c.Pledged),
+		HoldingChange:      nullableFloat(c.HoldingChange),
+		PledgeChange:       nullableFloat(c.PledgeChange),
+		Metrics:            nullableMetrics(c.Metrics),
+	})
+}
+
+// UnmarshalJSON reads null values back as NaN
+func (c *CompanyResult) UnmarshalJSON(b []byte) error {
+	var j companyResultJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*c = CompanyResult(j.companyResultAlias)
+	c.RevenueNums = nanFloats(j.RevenueNums)
+	c.NetProfitNums = nanFloats(j.NetProfitNums)
+	c.MarketCap = nanFloat(j.MarketCap)
+	c.Price = nanFloat(j.Price)
+	c.BookValue = nanFloat(j.BookValue)
+	c.EnterpriseValue = nanFloat(j.EnterpriseValue)
+	c.ROE = nanFloat(j.ROE)
+	c.ROCE = nanFloat(j.ROCE)
+	c.Debt = nanFloat(j.Debt)
+	c.DebtToEquity = nanFloat(j.DebtToEquity)
+	c.DebtChange = nanFloat(j.DebtChange)
+	c.PromoterHolding = nanFloat(j.PromoterHolding)
+	c.Pledged = nanFloat(j.Pledged)
+	c.HoldingChange = nanFloat(j.HoldingChange)
+	c.PledgeChange = nanFloat(j.PledgeChange)
+	c.Metrics = nil
+	if j.Metrics != nil {
+		c.Metrics = make(map[string][]float64, len(j.Metrics))
+		for k, v := range j.Metrics {
+			c.Metrics[k] = nanFloats(v)
+		}
+	}
+	return nil
+}
+
+func nullableMetrics(m map[string][]float64) map[string][]*float64 {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string][]*float64, len(m))
+	for k, v := range m {
+		out[k] = nullableFloats(v)
+	}
+	return out
+}
+
+func nullableFloat(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+func nullableFloats(vals []float64) []*float64 {
+	if vals == nil {
+		return nil
+	}
+	out := make([]*float64, len(vals))
+	for i, v := range vals {
+		out[i] = nullableFloat(v)
+	}
+	return out
+}
+
+func nanFloat(v *float64) float64 {
+	if v == nil {
+		return math.NaN()
+	}
+	return *v
+}
+
+func nanFloats(vals []*float64) []float64 {
+	if vals == nil {
+		return nil
+	}
+	out := make([]float64, len(vals))
+	for i, v := range vals {
+		out[i] = nanFloat(v)
+	}
+	return out
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// version is the release this binary was built from, set with
+// -ldflags "-X main.version=v1.2.3"; "dev" for local builds
+var version = "dev"
+
+// updateRepo is the GitHub repository releases are published to
+const updateRepo = "PraneGIT/quarter-compare"
+
+// binaryName is the executable's name inside release archives
+const binaryName = "quarter-compare"
+
+// maxUpdateSize bounds a downloaded release asset
+const maxUpdateSize = 200 << 20
+
+// ghRelease is the part of the GitHub release API response used here
+type ghRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// buildVersion is version, else the module version recorded by `go install`
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return bi.Main.Version
+	}
+	return version
+}
+
+// runUpdate implements `quarter-compare update`: replace the running binary with the
+// asset of the latest GitHub release for this OS/arch, after checking its SHA-256
+// against the release's checksum file
+func runUpdate(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	repo := fs.String("repo", updateRepo, "GitHub owner/repo to update from")
+	check := fs.Bool("check", false, "only report whether a newer release exists")
+	force := fs.Bool("force", false, "install even when already on the latest release, or on a development build")
+	fs.Parse(args)
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	rel, err := latestRelease(client, *repo)
+	if err != nil {
+		log.Fatalf("update: %v", err)
+	}
+	current := buildVersion()
+	fmt.Printf("current: %s, latest: %s\n", current, rel.TagName)
+	switch {
+	case *check:
+		return
+	case current == rel.TagName && !*force:
+		fmt.Println("already up to date")
+		return
+	case current == "dev" && !*force:
+		fmt.Println("this is a development build; use -force to replace it with the release")
+		return
+	}
+
+	asset, sums, err := pickAssets(rel, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		log.Fatalf("update: %v", err)
+	}
+	want, err := fetchChecksum(client, sums, asset.Name)
+	if err != nil {
+		log.Fatalf("update: checksums: %v", err)
+	}
+	body, err := download(client, asset.URL)
+	if err != nil {
+		log.Fatalf("update: download %s: %v", asset.Name, err)
+	}
+	sum := sha256.Sum256(body)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		log.Fatalf("update: checksum mismatch for %s: got %s, want %s", asset.Name, got, want)
+	}
+	bin, err := extractBinary(asset.Name, body)
+	if err != nil {
+		log.Fatalf("update: %v", err)
+	}
+	exe, err := replaceExecutable(bin)
+	if err != nil {
+		log.Fatalf("update: %v", err)
+	}
+	fmt.Printf("updated %s to %s\n", exe, rel.TagName)
+}
+
+// latestRelease asks the GitHub API for the latest release of repo. $GITHUB_TOKEN, when
+// set, lifts the anonymous rate limit.
+func latestRelease(client *http.Client, repo string) (ghRelease, error) {
+	req, _ := http.NewRequest("GET", "https://api.github.com/repos/"+repo+"/releases/latest", nil)
+	req.Header.Set("accept", "application/vnd.github+json")
+	req.Header.Set("user-agent", binaryName+"/"+buildVersion())
+	if tok := os.Getenv("GITHUB_TOKEN"); tok != "" {
+		req.Header.Set("authorization", "Bearer "+tok)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ghRelease{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return ghRelease{}, fmt.Errorf("github releases: status=%d body=%s", resp.StatusCode, b)
+	}
+	var rel ghRelease
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return ghRelease{}, fmt.Errorf("github releases: %v", err)
+	}
+	if rel.TagName == "" {
+		return ghRelease{}, errors.New("github releases: no tag in latest release")
+	}
+	return rel, nil
+}
+
+// assetRef is a release asset to download
+type assetRef struct{ Name, URL string }
+
+// pickAssets finds the binary (or .tar.gz / .zip holding it) built for goos/goarch, e.g.
+// quarter-compare_linux_amd64.tar.gz, and the checksum file (checksums.txt, SHA256SUMS, ...)
+func pickAssets(rel ghRelease, goos, goarch string) (bin, sums assetRef, err error) {
+	for _, a := range rel.Assets {
+		lower := strings.ToLower(a.Name)
+		switch {
+		case strings.Contains(lower, "checksums") || strings.Contains(lower, "sha256sums"):
+			sums = assetRef{a.Name, a.URL}
+		case strings.HasSuffix(lower, ".sha256") || strings.HasSuffix(lower, ".sig") || strings.HasSuffix(lower, ".pem"):
+		case hasToken(lower, goos) && hasToken(lower, goarch) && bin.Name == "":
+			bin = assetRef{a.Name, a.URL}
+		}
+	}
+	if bin.Name == "" {
+		return bin, sums, fmt.Errorf("release %s has no asset for %s/%s", rel.TagName, goos, goarch)
+	}
+	if sums.Name == "" {
+		return bin, sums, fmt.Errorf("release %s has no checksum file; refusing to install an unverified binary", rel.TagName)
+	}
+	return bin, sums, nil
+}
+
+// hasToken reports whether tok is one of the _ - . separated parts of name, so that
+// "arm" does not match an arm64 asset
+func hasToken(name, tok string) bool {
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if part == tok {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchChecksum returns the hex SHA-256 listed for name in a sha256sum-style file
+func fetchChecksum(client *http.Client, sums assetRef, name string) (string, error) {
+	b, err := download(client, sums.URL)
+	if err != nil {
+		return "", err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) == 2 && strings.TrimPrefix(f[1], "*") == name {
+			return strings.ToLower(f[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s not listed in %s", name, sums.Name)
+}
+
+// download GETs url into memory, up to maxUpdateSize
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status=%d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(&cappedReader{r: resp.Body, limit: maxUpdateSize})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// extractBinary returns the executable from a downloaded asset: the asset itself, or the
+// quarter-compare entry of a .tar.gz / .zip archive
+func extractBinary(name string, body []byte) ([]byte, error) {
+	isBinary := func(entry string) bool {
+		base := strings.TrimSuffix(path.Base(entry), ".exe")
+		return base == binaryName
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if h.Typeflag == tar.TypeReg && isBinary(h.Name) {
+				return io.ReadAll(io.LimitReader(tr, maxUpdateSize))
+			}
+		}
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if !f.FileInfo().IsDir() && isBinary(f.Name) {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(io.LimitReader(rc, maxUpdateSize))
+			}
+		}
+	default:
+		return body, nil
+	}
+	return nil, fmt.Errorf("%s does not contain %s", name, binaryName)
+}
+
+// replaceExecutable swaps the running executable for bin. The new file is written next to
+// it and renamed into place; the old one is moved aside first, which also works on
+// Windows where a running executable can be renamed but not overwritten.
+func replaceExecutable(bin []byte) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, bin, 0755); err != nil {
+		return "", fmt.Errorf("write %s: %v", tmp, err)
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		os.Rename(old, exe) // put the original back
+		return "", err
+	}
+	if runtime.GOOS != "windows" {
+		os.Remove(old)
+	}
+	return exe, nil
+}
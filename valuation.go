@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// candidate Metrics names for the per-quarter EPS (₹) and EBITDA (₹ cr); a configured
+// metric of the same name comes first
+var (
+	epsNames    = []string{"eps", "EPS_Q", "BASIC_EPS_Q", "EPS_BASIC_Q", "DIL_EPS_Q"}
+	ebitdaNames = []string{"ebitda", "EBITDA_Q", "OPBDIT_Q"}
+)
+
+// Valuation holds the valuation ratios of a result; NaN when not computable
+type Valuation struct {
+	PE       float64 // price / TTM EPS, else market cap / TTM net profit
+	PB       float64 // price / book value per share
+	EVEBITDA float64 // enterprise value / TTM EBITDA
+}
+
+// ttm sums the latest four quarters of vals; NaN unless all four are known and follow
+// each other in quarters (a gap would make it more than a year)
+func ttm(quarters []Quarter, vals []float64) float64 {
+	if len(vals) < 4 || !consecutive(quarters, 4) {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, v := range vals[:4] {
+		if math.IsNaN(v) {
+			return math.NaN()
+		}
+		sum += v
+	}
+	return sum
+}
+
+// ttmMetric is the TTM of the first of names with four known quarters in r.Metrics
+func ttmMetric(r CompanyResult, names []string) float64 {
+	for _, n := range names {
+		if v := ttm(r.Quarters, r.Metrics[n]); !math.IsNaN(v) {
+			return v
+		}
+	}
+	return math.NaN()
+}
+
+// ratio is a/b for positive a and b; a loss-making company has no meaningful multiple
+func ratio(a, b float64) float64 {
+	if !(a > 0) || !(b > 0) {
+		return math.NaN()
+	}
+	return a / b
+}
+
+// Valuate computes the valuation ratios of r from the scraped price, book value and
+// enterprise value and the trailing twelve months of its fetched quarters
+func Valuate(r CompanyResult) Valuation {
+	v := Valuation{
+		PE:       ratio(r.Price, ttmMetric(r, epsNames)),
+		PB:       ratio(r.Price, r.BookValue),
+		EVEBITDA: ratio(r.EnterpriseValue, ttmMetric(r, ebitdaNames)),
+	}
+	if math.IsNaN(v.PE) {
+		v.PE = ratio(r.MarketCap, ttm(r.Quarters, r.NetProfitNums))
+	}
+	return v
+}
+
+// hasValuation reports whether any ratio is known for any result
+func hasValuation(results []CompanyResult) bool {
+	for _, r := range results {
+		v := Valuate(r)
+		if !math.IsNaN(v.PE) || !math.IsNaN(v.PB) || !math.IsNaN(v.EVEBITDA) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatMultiple formats a ratio for a table cell, e.g. 23.4x
+func formatMultiple(v float64) string {
+	if math.IsNaN(v) {
+		return "–"
+	}
+	return fmt.Sprintf("%.1fx", v)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+)
+
+// chartRow is the per-company data the report visualizations work from
+type chartRow struct {
+	Company   string
+	LongName  string
+	Sector    string
+	MarketCap float64
+	Revenue   float64 // latest quarter, used for sizing when market cap is unknown
+	Rev       growth  // latest vs previous quarter
+	NP        growth
+}
+
+// writeHeatmapSection renders a treemap of the day's companies: tile area by market cap
+// (falling back to latest revenue when any market cap is missing), color by NP growth.
+func writeHeatmapSection(sb *strings.Builder, tiles []chartRow) {
+	// size every tile on the same basis, otherwise areas are not comparable
+	basis := "market cap"
+	for _, t := range tiles {
+		if math.IsNaN(t.MarketCap) || t.MarketCap <= 0 {
+			basis = "latest revenue"
+			break
+		}
+	}
+	items := []map[string]interface{}{}
+	skipped := 0
+	for _, t := range tiles {
+		size := t.MarketCap
+		if basis != "market cap" {
+			size = t.Revenue
+		}
+		if math.IsNaN(size) || size <= 0 {
+			skipped++
+			continue
+		}
+		// color intensity: percent growth, or the sign of the swing for loss<->profit
+		score := t.NP.Pct
+		if t.NP.Swing {
+			score = math.Copysign(100, t.NP.Abs)
+		}
+		items = append(items, map[string]interface{}{
+			"company":  t.Company,
+			"longName": t.LongName,
+			"size":     size,
+			"score":    jsonFloat(score),
+			"label":    t.NP.String(),
+		})
+	}
+	jb, _ := json.Marshal(items)
+
+	sb.WriteString("<div class='summary'><h3>Result-day heatmap</h3>")
+	if len(items) == 0 {
+		sb.WriteString("<p>No companies with size data to plot.</p></div>")
+		return
+	}
+	sb.WriteString("<div id='heatmap' style='position:relative;width:100%;height:420px;border:1px solid #eee'></div>")
+	note := "Tile area: " + basis + ". Color: latest NP %Δ (green up, red down, grey n/a; capped at ±50%)."
+	if skipped > 0 {
+		note += " Companies without size data are not shown."
+	}
+	sb.WriteString("<p class='small'>" + note + "</p></div>")
+	sb.WriteString("<script>var QC_HEATMAP = " + string(jb) + ";</script>")
+	sb.WriteString(scriptTag("heatmap.js"))
+}
+
+// writeScatterSection renders revenue %Δ (x) against NP %Δ (y), one dot per company.
+// Divergent companies (revenue up, profit down) are drawn in red.
+func writeScatterSection(sb *strings.Builder, rows []chartRow) {
+	points := []map[string]interface{}{}
+	for _, r := range rows {
+		if math.IsNaN(r.Rev.Pct) || math.IsNaN(r.NP.Pct) {
+			continue
+		}
+		points = append(points, map[string]interface{}{
+			"company":  r.Company,
+			"longName": r.LongName,
+			"rev":      r.Rev.Pct,
+			"np":       r.NP.Pct,
+		})
+	}
+	jb, _ := json.Marshal(points)
+
+	sb.WriteString("<div class='summary'><h3>Revenue growth vs profit growth</h3>")
+	if len(points) == 0 {
+		sb.WriteString("<p>No companies with both revenue and NP %Δ to plot.</p></div>")
+		return
+	}
+	sb.WriteString("<canvas id='scatterChart' style='width:100%;height:380px;border:1px solid #eee;display:block'></canvas>")
+	sb.WriteString("<div id='scatterTooltip' style='position:fixed;pointer-events:none;display:none;background:#fff;padding:6px;border:1px solid #ccc;border-radius:4px;box-shadow:0 2px 6px rgba(0,0,0,0.15);font-size:12px;z-index:10000'></div>")
+	sb.WriteString("<p class='small'>One dot per company (latest quarter vs previous). Red: revenue up but net profit down. Axes are capped at ±200%; capped points are drawn hollow. Sign changes and prev=0 cases (unless zero_base is \"hundred\") are not plotted.</p></div>")
+	sb.WriteString("<script>var QC_SCATTER = " + string(jb) + ";</script>")
+	sb.WriteString(scriptTag("scatter.js"))
+}
+
+// histogramEdges are the %Δ bucket boundaries for the growth distribution chart
+var histogramEdges = []float64{-50, -25, -10, 0, 10, 25, 50}
+
+// histogramLabel names bucket i of histogramEdges (len(edges)+1 buckets)
+func histogramLabel(i int) string {
+	switch {
+	case i == 0:
+		return fmt.Sprintf("< %.0f%%", histogramEdges[0])
+	case i == len(histogramEdges):
+		return fmt.Sprintf("≥ %.0f%%", histogramEdges[len(histogramEdges)-1])
+	default:
+		return fmt.Sprintf("%.0f…%.0f%%", histogramEdges[i-1], histogramEdges[i])
+	}
+}
+
+// histogramCounts buckets values by histogramEdges, ignoring NaN
+func histogramCounts(vals []float64) []int {
+	counts := make([]int, len(histogramEdges)+1)
+	for _, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		i := 0
+		for i < len(histogramEdges) && v >= histogramEdges[i] {
+			i++
+		}
+		counts[i]++
+	}
+	return counts
+}
+
+// writeGrowthDistribution adds median/quartiles, positive vs negative counts and a
+// small CSS histogram of latest revenue and NP %Δ to the summary block.
+func writeGrowthDistribution(sb *strings.Builder, rows []chartRow) {
+	var revVals, npVals []float64
+	revUp, revDown, npUp, npDown := 0, 0, 0, 0
+	direction := func(g growth, up, down *int) {
+		d := g.Pct
+		if g.Swing {
+			d = g.Abs
+		}
+		if d > 0 {
+			*up++
+		} else if d < 0 {
+			*down++
+		}
+	}
+	for _, r := range rows {
+		revVals = append(revVals, r.Rev.Pct)
+		npVals = append(npVals, r.NP.Pct)
+		direction(r.Rev, &revUp, &revDown)
+		direction(r.NP, &npUp, &npDown)
+	}
+	revSorted := validSorted(revVals)
+	npSorted := validSorted(npVals)
+	pct := func(sorted []float64, q float64) string {
+		return fmtPct(quantile(sorted, q))
+	}
+
+	sb.WriteString("<h4>Growth distribution (latest %Δ)</h4>")
+	sb.WriteString("<table style='width:auto'><thead><tr><th></th><th>n</th><th>Q1</th><th>Median</th><th>Q3</th><th>Up</th><th>Down</th></tr></thead><tbody>")
+	sb.WriteString(fmt.Sprintf("<tr><td class='left'>Revenue</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td></tr>",
+		len(revSorted), pct(revSorted, 0.25), pct(revSorted, 0.5), pct(revSorted, 0.75), revUp, revDown))
+	sb.WriteString(fmt.Sprintf("<tr><td class='left'>Net Profit</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td></tr>",
+		len(npSorted), pct(npSorted, 0.25), pct(npSorted, 0.5), pct(npSorted, 0.75), npUp, npDown))
+	sb.WriteString("</tbody></table>")
+	sb.WriteString("<p class='small'>Quartiles use %Δ values only; Up/Down also count loss ↔ profit swings by direction.</p>")
+
+	revCounts := histogramCounts(revVals)
+	npCounts := histogramCounts(npVals)
+	maxCount := 1
+	for i := range revCounts {
+		maxCount = max(maxCount, revCounts[i], npCounts[i])
+	}
+	bar := func(n int, color string) string {
+		h := int(math.Round(float64(n) / float64(maxCount) * 80))
+		return fmt.Sprintf("<div title='%d' style='width:12px;height:%dpx;background:%s'></div>", n, h, color)
+	}
+	sb.WriteString("<div style='display:flex;align-items:flex-end;gap:10px;margin-top:8px'>")
+	for i := range revCounts {
+		sb.WriteString("<div style='text-align:center;font-size:11px;color:#555'>")
+		sb.WriteString("<div style='display:flex;align-items:flex-end;gap:2px;height:84px;justify-content:center'>")
+		sb.WriteString(bar(revCounts[i], "#2c7be5") + bar(npCounts[i], "#f0ad4e"))
+		sb.WriteString("</div>" + histogramLabel(i) + "</div>")
+	}
+	sb.WriteString("</div>")
+	sb.WriteString("<p class='small'><span style='color:#2c7be5'>■</span> Revenue <span style='color:#f0ad4e'>■</span> Net Profit (companies per %Δ bucket)</p>")
+}
+
+// writeSectorSection groups the day's companies by sector and shows per-sector
+// median revenue/NP %Δ and the best company by NP %Δ.
+func writeSectorSection(sb *strings.Builder, rows []chartRow) {
+	groups := map[string][]chartRow{}
+	for _, r := range rows {
+		sector := r.Sector
+		if sector == "" {
+			sector = "Unknown"
+		}
+		groups[sector] = append(groups[sector], r)
+	}
+	names := make([]string, 0, len(groups))
+	for k := range groups {
+		names = append(names, k)
+	}
+	// biggest sectors first, then alphabetical
+	sort.Slice(names, func(i, j int) bool {
+		if len(groups[names[i]]) != len(groups[names[j]]) {
+			return len(groups[names[i]]) > len(groups[names[j]])
+		}
+		return names[i] < names[j]
+	})
+
+	sb.WriteString("<div class='summary'><h3>Sector summary</h3>")
+	if len(names) == 0 {
+		sb.WriteString("<p>No companies processed.</p></div>")
+		return
+	}
+	sb.WriteString("<table id='sectorTable'><thead><tr><th>Sector</th><th>Companies</th><th>Median Rev %Δ</th><th>Median NP %Δ</th><th>Best by NP %Δ</th></tr></thead><tbody>")
+	for _, name := range names {
+		var revVals, npVals []float64
+		var best *chartRow
+		for i, r := range groups[name] {
+			revVals = append(revVals, r.Rev.Pct)
+			npVals = append(npVals, r.NP.Pct)
+			if !math.IsNaN(r.NP.Pct) && (best == nil || r.NP.Pct > best.NP.Pct) {
+				best = &groups[name][i]
+			}
+		}
+		medRev := quantile(validSorted(revVals), 0.5)
+		medNP := quantile(validSorted(npVals), 0.5)
+		bestCell := "N/A"
+		if best != nil {
+			bestCell = html.EscapeString(best.Company) + " (" + fmt.Sprintf("%.2f%%", best.NP.Pct) + ")"
+		}
+		sb.WriteString("<tr><td class='left'>" + html.EscapeString(name) + "</td>")
+		sb.WriteString(fmt.Sprintf("<td>%d</td>", len(groups[name])))
+		sb.WriteString("<td class='" + medianClass(medRev) + "'>" + fmtPct(medRev) + "</td>")
+		sb.WriteString("<td class='" + medianClass(medNP) + "'>" + fmtPct(medNP) + "</td>")
+		sb.WriteString("<td class='left'>" + bestCell + "</td></tr>")
+	}
+	sb.WriteString("</tbody></table>")
+	sb.WriteString("<p class='small'>Medians use %Δ values only (sign changes excluded, prev=0 per the zero_base policy). Sector comes from the Trendlyne page; \"Unknown\" when not found.</p></div>")
+}
+
+// fmtPct formats a percentage or "N/A" for NaN
+func fmtPct(v float64) string {
+	if math.IsNaN(v) {
+		return "N/A"
+	}
+	return fmt.Sprintf("%.2f%%", v)
+}
+
+// medianClass colors an aggregate percentage with the same ±0.5% band as pctColorClass
+func medianClass(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "neutral"
+	case v > 0.5:
+		return "positive"
+	case v < -0.5:
+		return "negative"
+	}
+	return "neutral"
+}
+
+// writeTopMoversSection renders compact top-N and bottom-N tables by latest NP %Δ,
+// each company linking to its row in the main table. Growth follows the zero_base policy.
+func writeTopMoversSection(sb *strings.Builder, results []CompanyResult, n int, zeroBase string) {
+	type mover struct {
+		Company string
+		Rev, NP growth
+	}
+	var movers []mover
+	for _, r := range results {
+		rev, np := latestGrowth(r, zeroBase)
+		if math.IsNaN(np.Pct) {
+			continue
+		}
+		movers = append(movers, mover{Company: r.Company, Rev: rev, NP: np})
+	}
+	if len(movers) == 0 {
+		return
+	}
+	sort.SliceStable(movers, func(i, j int) bool { return movers[i].NP.Pct > movers[j].NP.Pct })
+
+	table := func(title string, list []mover) {
+		sb.WriteString("<div style='flex:1 1 320px'><h4>" + title + "</h4><table><thead><tr><th>#</th><th>Company</th><th>NP %Δ</th><th>Rev %Δ</th></tr></thead><tbody>")
+		for i, m := range list {
+			sb.WriteString(fmt.Sprintf("<tr><td>%d</td>", i+1))
+			sb.WriteString("<td class='left'><a href='#" + rowAnchor(m.Company) + "'>" + html.EscapeString(m.Company) + "</a></td>")
+			sb.WriteString("<td class='" + m.NP.class() + "'>" + html.EscapeString(m.NP.String()) + "</td>")
+			sb.WriteString("<td class='" + m.Rev.class() + "' title='" + html.EscapeString(m.Rev.title()) + "'>" + html.EscapeString(m.Rev.String()) + "</td></tr>")
+		}
+		sb.WriteString("</tbody></table></div>")
+	}
+
+	top := movers[:min(n, len(movers))]
+	bottom := make([]mover, 0, n)
+	for i := len(movers) - 1; i >= 0 && len(bottom) < n; i-- {
+		bottom = append(bottom, movers[i])
+	}
+	sb.WriteString("<div id='topMovers' style='display:flex;gap:16px;flex-wrap:wrap;margin-bottom:16px'>")
+	table(fmt.Sprintf("Top %d by NP growth", len(top)), top)
+	table(fmt.Sprintf("Bottom %d by NP growth", len(bottom)), bottom)
+	sb.WriteString("</div>")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// runWatch implements `quarter-compare watch`: re-run today's fetch every interval,
+// refreshing the report and alerting only on new or materially changed results
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to config.json (default: <app dir>/config.json)")
+	interval := fs.Duration("interval", 15*time.Minute, "time between polls")
+	filterFlag := fs.String("filter", "", "only keep rows matching this expression (default: config filter)")
+	dumpRawFlag := fs.String("dump-raw", "", "save raw trendlyne pages and fundamentals JSON per company under this dir")
+	sortFlag := fs.String("sort-by", "", "row order: company, np-growth, rev-growth or mcap (default: config sort_by, else company)")
+	openFlag := fs.Bool("open", false, "open the report in the default browser after the first poll")
+	assetsFlag := fs.String("assets", "", "dir of stylesheets and scripts overriding the built-in ones (see `quarter-compare assets`)")
+	fs.Parse(args)
+	useAssets(*assetsFlag)
+	cfg := mustLoadConfig(*configPath)
+	if *dumpRawFlag != "" {
+		cfg.DumpRaw = *dumpRawFlag
+	}
+	if *sortFlag != "" {
+		cfg.SortBy = *sortFlag
+	}
+	filter := mustFilter(*filterFlag, cfg)
+	opts := mustReportOptions(cfg)
+	if *interval < time.Minute {
+		log.Fatalf("watch: -interval must be at least 1m")
+	}
+	outPath, err := reportPath(cfg)
+	if err != nil {
+		log.Fatalf("cannot determine output path: %v", err)
+	}
+
+	// one handle for every poll, as serve keeps one
+	db, err := openHistory()
+	if err != nil {
+		log.Fatalf("watch: %v", err)
+	}
+	defer db.Close()
+
+	client := NewHTTPClient(cfg)
+	// hooks only run for results that are new or changed since the previous poll
+	hooked := map[string]notifiedEntry{}
+	opened := false
+	var lastPoll time.Time
+	for {
+		now := time.Now()
+		today := now.Format("02 Jan 2006")
+		cfg.Landed = landedResults(client, now, lastPoll)
+		lastPoll = now
+		results, failures, decisions, err := collectResults(client, cfg, today)
+		switch {
+		case errors.Is(err, errNoMeetings):
+			SaveDecisions(isoDate(today), filter, decisions)
+			log.Printf("watch: no meetings for %s", today)
+		case err != nil:
+			log.Printf("watch: %v", err)
+		default:
+			if err := saveRun(db, RunRecord{Date: isoDate(today), Results: results, Failures: failures}); err != nil {
+				log.Printf("save history: %v", err)
+			}
+			results = filterOrAll(filter, cfg, results)
+			markFiltered(decisions, filter, results)
+			SaveDecisions(isoDate(today), filter, decisions)
+			if err := GenerateHTMLReport(outPath, results, failures, opts.withHistory(db, isoDate(today))); err != nil {
+				log.Printf("generate report: %v", err)
+			}
+			var changed []CompanyResult
+			for _, r := range results {
+				key := today + "|" + r.Company
+				if prev, ok := hooked[key]; !ok || !sameEntry(prev, entryFor(r)) {
+					changed = append(changed, r)
+					hooked[key] = entryFor(r)
+				}
+			}
+			RunHooks(cfg.Hooks, cfg.Watchlist, today, changed)
+			if err := Notify(client, cfg.Notify, cfg.Watchlist, cfg.ZeroBase, today, results, failures, outPath); err != nil {
+				log.Printf("notify: %v", err)
+			}
+			fmt.Printf("%s: %d results, report saved to %s\n", time.Now().Format("15:04"), len(results), outPath)
+			if !opened {
+				showReport(outPath, *openFlag)
+				opened = true
+			}
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// landedResults returns when the results filed on BSE today reached it, by scrip code,
+// and prints the companies whose filing landed since the previous poll (since zero: the
+// first poll, which prints nothing). A failing feed leaves the order as it is.
+func landedResults(client *http.Client, now, since time.Time) map[string]time.Time {
+	anns, err := FetchAnnouncements(client, "Result", now, now)
+	if err != nil {
+		log.Printf("watch: announcements: %v", err)
+	}
+	landed := declaredTimes(anns)
+	if since.IsZero() {
+		return landed
+	}
+	var fresh []string
+	seen := map[string]bool{}
+	for _, a := range anns {
+		if t, ok := landed[a.ScripCode]; ok && t.After(since) && !seen[a.ScripCode] {
+			seen[a.ScripCode] = true
+			name := a.Symbol
+			if name == "" {
+				name = a.LongName
+			}
+			fresh = append(fresh, name+" ("+t.Format("15:04")+")")
+		}
+	}
+	if len(fresh) > 0 {
+		fmt.Printf("%s: results landed since the last poll, fetched first: %s\n", now.Format("15:04"), strings.Join(fresh, ", "))
+	}
+	return landed
+}
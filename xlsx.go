@@ -0,0 +1,83 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// the fixed parts of a one-sheet workbook; Excel, LibreOffice and Google Sheets open it
+// without a styles part
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Results" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// writeXLSX writes header and rows as a one-sheet .xlsx workbook. float64 values become
+// numbers, nil an empty cell and anything else text.
+func writeXLSX(w io.Writer, header []string, rows [][]interface{}) error {
+	zw := zip.NewWriter(w)
+	for _, p := range xlsxParts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	writeRow := func(n int, vals []interface{}) {
+		fmt.Fprintf(&sb, `<row r="%d">`, n)
+		for i, v := range vals {
+			ref := xlsxColumn(i) + strconv.Itoa(n)
+			switch vv := v.(type) {
+			case nil:
+			case float64:
+				fmt.Fprintf(&sb, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(vv, 'f', -1, 64))
+			default:
+				fmt.Fprintf(&sb, `<c r="%s" t="inlineStr"><is><t>`, ref)
+				xml.EscapeText(&sb, []byte(fmt.Sprint(vv)))
+				sb.WriteString(`</t></is></c>`)
+			}
+		}
+		sb.WriteString(`</row>`)
+	}
+	head := make([]interface{}, len(header))
+	for i, h := range header {
+		head[i] = h
+	}
+	writeRow(1, head)
+	for i, row := range rows {
+		writeRow(i+2, row)
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	if _, err := io.WriteString(f, sb.String()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// xlsxColumn returns the column letters of the 0-based index i: A, B, …, Z, AA, …
+func xlsxColumn(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// policies for growth off a zero previous value (see Config.ZeroBase)
+const (
+	zeroBaseNA       = "na"       // "N/A (prev=0)", left out of sorting and summaries
+	zeroBaseAbsolute = "absolute" // absolute change in ₹ cr, treated like a sign change
+	zeroBaseNew      = "new"      // a "new" badge, sorted above (or, for a loss, below) every % change
+	zeroBaseHundred  = "hundred"  // ±100%, sorted and averaged like any other % change
+)
+
+// checkZeroBase validates a zero_base policy name
+func checkZeroBase(p string) error {
+	switch p {
+	case zeroBaseNA, zeroBaseAbsolute, zeroBaseNew, zeroBaseHundred:
+		return nil
+	}
+	return fmt.Errorf("unknown policy %q (want %s, %s, %s or %s)", p, zeroBaseNA, zeroBaseAbsolute, zeroBaseNew, zeroBaseHundred)
+}
+
+// zeroBasePct is the % change from a zero previous value under policy; NaN unless it
+// is "hundred"
+func zeroBasePct(curr float64, policy string) float64 {
+	if policy != zeroBaseHundred {
+		return math.NaN()
+	}
+	switch {
+	case curr > 0:
+		return 100
+	case curr < 0:
+		return -100
+	}
+	return 0
+}
+
+// zeroBaseString renders growth off a zero previous value under its policy
+func zeroBaseString(g growth) string {
+	switch g.Policy {
+	case zeroBaseAbsolute:
+		return fmt.Sprintf("%+.2f cr", g.Abs)
+	case zeroBaseNew:
+		if g.Curr == 0 {
+			return "N/A (prev=0)"
+		}
+		return "new"
+	case zeroBaseHundred:
+		return fmt.Sprintf("%.2f%%", g.Pct)
+	}
+	return "N/A (prev=0)"
+}
+
+// zeroBaseSortKey orders growth off a zero previous value: "new" above (a new loss below)
+// every % change, "absolute" like a sign change (by its size as a % of revenue), "hundred"
+// by its ±100%, "na" last
+func zeroBaseSortKey(g growth, revenue float64) float64 {
+	switch {
+	case g.Policy == zeroBaseNew && g.Curr != 0:
+		return math.Inf(int(math.Copysign(1, g.Curr)))
+	case g.Policy == zeroBaseAbsolute && g.Curr != 0:
+		return swingSortKey(g.Abs, revenue)
+	}
+	return g.Pct
+}
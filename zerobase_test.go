@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestZeroBasePolicies(t *testing.T) {
+	cases := []struct {
+		policy string
+		curr   float64
+		str    string
+		pct    float64 // NaN when left out of summaries
+		key    float64 // sortKey on ₹100 cr of revenue
+	}{
+		{"", 5, "N/A (prev=0)", math.NaN(), math.NaN()},
+		{zeroBaseNA, 5, "N/A (prev=0)", math.NaN(), math.NaN()},
+		{zeroBaseAbsolute, 5, "+5.00 cr", math.NaN(), 5},
+		{zeroBaseNew, 5, "new", math.NaN(), math.Inf(1)},
+		{zeroBaseNew, -5, "new", math.NaN(), math.Inf(-1)},
+		{zeroBaseNew, 0, "N/A (prev=0)", math.NaN(), math.NaN()},
+		{zeroBaseHundred, 5, "100.00%", 100, 100},
+		{zeroBaseHundred, -5, "-100.00%", -100, -100},
+	}
+	same := func(a, b float64) bool { return a == b || math.IsNaN(a) && math.IsNaN(b) }
+	// the policies are interleaved: each growth keeps the one it was computed under
+	for _, c := range cases {
+		g := computeGrowth(c.curr, 0, c.policy)
+		if !g.ZeroBase {
+			t.Errorf("%q %v: ZeroBase not set", c.policy, c.curr)
+		}
+		if got := g.String(); got != c.str {
+			t.Errorf("%q %v: String() = %q, want %q", c.policy, c.curr, got, c.str)
+		}
+		if !same(g.Pct, c.pct) {
+			t.Errorf("%q %v: Pct = %v, want %v", c.policy, c.curr, g.Pct, c.pct)
+		}
+		if got := g.sortKey(100); !same(got, c.key) {
+			t.Errorf("%q %v: sortKey(100) = %v, want %v", c.policy, c.curr, got, c.key)
+		}
+		want := c.policy
+		if want == "" {
+			want = zeroBaseNA
+		}
+		if title := g.title(); !strings.Contains(title, `policy "`+want+`"`) {
+			t.Errorf("%q %v: title() = %q, want the policy named", c.policy, c.curr, title)
+		}
+	}
+
+	// filters, sorting and the report read the policy they are given
+	r := CompanyResult{Company: "NEWCO", Quarters: []Quarter{{FY: 2025, Q: 1}, {FY: 2024, Q: 4}}, NetProfitNums: []float64{8, 0}}
+	if _, np := latestGrowth(r, zeroBaseHundred); np.Pct != 100 {
+		t.Errorf("latestGrowth under hundred: Pct = %v, want 100", np.Pct)
+	}
+	for policy, want := range map[string]int{zeroBaseNA: 0, zeroBaseHundred: 1} {
+		kept, err := FilterResults("np_growth > 50", nil, policy, []CompanyResult{r})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kept) != want {
+			t.Errorf("filter under %q kept %d, want %d", policy, len(kept), want)
+		}
+	}
+	html := RenderHTMLReport([]CompanyResult{r}, nil, ReportOptions{ZeroBase: zeroBaseNew})
+	if !strings.Contains(html, `zero_base policy &#34;new&#34;`) {
+		t.Errorf("report doesn't name the policy of its options in the tooltip")
+	}
+}